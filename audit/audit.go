@@ -0,0 +1,143 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/stone1549/auth-service/common"
+	"github.com/stone1549/auth-service/metrics"
+	"time"
+)
+
+// EventType identifies what happened in an audit event.
+type EventType string
+
+const (
+	// LoginSucceeded is recorded when a user authenticates.
+	LoginSucceeded EventType = "login_succeeded"
+	// LoginFailed is recorded when an authentication attempt is rejected, the reason says why.
+	LoginFailed EventType = "login_failed"
+	// Signup is recorded when a user signs up, or fails to.
+	Signup EventType = "signup"
+	// PasswordChanged is recorded when a user's password changes.
+	PasswordChanged EventType = "password_changed"
+	// TokenRevoked is recorded when a token or session is revoked before it expires.
+	TokenRevoked EventType = "token_revoked"
+	// NewDevice is recorded when a user logs in from a device they haven't used before.
+	NewDevice EventType = "new_device"
+	// AdminAction is recorded for every change made through a management endpoint.
+	AdminAction EventType = "admin_action"
+)
+
+// ServiceActor is the actor recorded for actions taken with a service token.
+const ServiceActor = "service"
+
+// Event is a single audited occurrence.
+type Event struct {
+	Id       string    `json:"id"`
+	TenantId string    `json:"tenantId"`
+	Type     EventType `json:"type"`
+	// ActorId is who performed the action, a user id or ServiceActor.
+	ActorId string `json:"actorId,omitempty"`
+	// UserId is the user the event is about, empty when unknown such as a login for an unknown email.
+	UserId     string            `json:"userId,omitempty"`
+	Email      string            `json:"email,omitempty"`
+	Success    bool              `json:"success"`
+	Reason     string            `json:"reason,omitempty"`
+	RemoteAddr string            `json:"remoteAddr,omitempty"`
+	RequestId  string            `json:"requestId,omitempty"`
+	Details    map[string]string `json:"details,omitempty"`
+	CreatedAt  time.Time         `json:"createdAt"`
+}
+
+// Query filters the events retrieved from a Sink, zero valued fields don't filter.
+type Query struct {
+	TenantId string
+	UserId   string
+	Types    []EventType
+	From     time.Time
+	To       time.Time
+	Limit    int
+}
+
+// DefaultLimit is the number of events a query returns when it doesn't set a limit.
+const DefaultLimit = 100
+
+func (q Query) limit() int {
+	if q.Limit <= 0 {
+		return DefaultLimit
+	}
+
+	return q.Limit
+}
+
+func (q Query) matches(event Event) bool {
+	if q.TenantId != "" && event.TenantId != q.TenantId {
+		return false
+	} else if q.UserId != "" && event.UserId != q.UserId && event.ActorId != q.UserId {
+		return false
+	} else if !q.From.IsZero() && event.CreatedAt.Before(q.From) {
+		return false
+	} else if !q.To.IsZero() && !event.CreatedAt.Before(q.To) {
+		return false
+	}
+
+	if len(q.Types) == 0 {
+		return true
+	}
+
+	for _, eventType := range q.Types {
+		if event.Type == eventType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Sink represents a destination audit events are recorded to and queried from.
+type Sink interface {
+	// Record stores an event.
+	Record(ctx context.Context, event Event) error
+	// Query retrieves the events matching the query, newest first. Events about or by Query.UserId match it.
+	Query(ctx context.Context, query Query) ([]Event, error)
+	// Close releases any resources held by the sink.
+	Close() error
+}
+
+// NewSink constructs a Sink from the given configuration.
+func NewSink(config common.Configuration) (Sink, error) {
+	switch config.GetAuditSinkType() {
+	case common.NoAuditSink:
+		return discardSink{}, nil
+	case common.FileAuditSink:
+		return NewFileSink(config.GetAuditFile())
+	case common.PostgreSqlAuditSink:
+		db, err := sql.Open("postgres", config.GetPgUrl())
+
+		if err != nil {
+			return nil, err
+		}
+
+		metrics.RegisterDB("audit", db)
+		return NewPostgresqlSink(db), nil
+	default:
+		return nil, errors.New(fmt.Sprintf("audit sink type %s unimplemented", config.GetAuditSinkType()))
+	}
+}
+
+// discardSink drops every event, used when auditing isn't configured.
+type discardSink struct{}
+
+func (discardSink) Record(ctx context.Context, event Event) error {
+	return nil
+}
+
+func (discardSink) Query(ctx context.Context, query Query) ([]Event, error) {
+	return []Event{}, nil
+}
+
+func (discardSink) Close() error {
+	return nil
+}
@@ -0,0 +1,94 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+type fileSink struct {
+	mutex sync.Mutex
+	path  string
+	file  *os.File
+}
+
+// NewFileSink constructs a Sink appending events to a JSON lines file, one event per line.
+func NewFileSink(path string) (Sink, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileSink{path: path, file: file}, nil
+}
+
+// Record appends an event to the file.
+func (fs *fileSink) Record(ctx context.Context, event Event) error {
+	line, err := json.Marshal(event)
+
+	if err != nil {
+		return err
+	}
+
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	_, err = fs.file.Write(append(line, '\n'))
+
+	return err
+}
+
+// Query scans the file for events matching the query, newest first.
+func (fs *fileSink) Query(ctx context.Context, query Query) ([]Event, error) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	file, err := os.Open(fs.path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	matched := make([]Event, 0)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		var event Event
+		err = json.Unmarshal(scanner.Bytes(), &event)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if query.matches(event) {
+			matched = append(matched, event)
+		}
+	}
+
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// Events are appended in order, so the newest are at the end of the file.
+	events := make([]Event, 0)
+
+	for i := len(matched) - 1; i >= 0 && len(events) < query.limit(); i-- {
+		events = append(events, matched[i])
+	}
+
+	return events, nil
+}
+
+// Close closes the file.
+func (fs *fileSink) Close() error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+
+	return fs.file.Close()
+}
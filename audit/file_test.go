@@ -0,0 +1,101 @@
+package audit_test
+
+import (
+	"context"
+	"github.com/stone1549/auth-service/audit"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func makeFileSink(t *testing.T) (audit.Sink, string) {
+	dir, err := ioutil.TempDir("", "audit")
+	ok(t, err)
+
+	sink, err := audit.NewFileSink(filepath.Join(dir, "audit.jsonl"))
+	ok(t, err)
+
+	return sink, dir
+}
+
+// TestFileSink_Query ensures recorded events are read back newest first and filtered by tenant, user, type and time.
+func TestFileSink_Query(t *testing.T) {
+	sink, dir := makeFileSink(t)
+	defer os.RemoveAll(dir)
+	defer sink.Close()
+
+	ctx := context.Background()
+	start := time.Date(2018, 5, 1, 12, 0, 0, 0, time.UTC)
+	events := []audit.Event{
+		{Id: "1", TenantId: "default", Type: audit.Signup, ActorId: "u1", UserId: "u1", Success: true,
+			CreatedAt: start},
+		{Id: "2", TenantId: "default", Type: audit.LoginFailed, Email: "u1@example.com", Reason: "bad password",
+			CreatedAt: start.Add(time.Minute)},
+		{Id: "3", TenantId: "default", Type: audit.LoginSucceeded, ActorId: "u1", UserId: "u1", Success: true,
+			CreatedAt: start.Add(2 * time.Minute)},
+		{Id: "4", TenantId: "acme", Type: audit.LoginSucceeded, ActorId: "u2", UserId: "u2", Success: true,
+			CreatedAt: start.Add(3 * time.Minute)},
+		{Id: "5", TenantId: "default", Type: audit.AdminAction, ActorId: audit.ServiceActor, UserId: "u1",
+			Success: true, Details: map[string]string{"route": "/group/{groupId}/users/{userId}"},
+			CreatedAt: start.Add(4 * time.Minute)},
+	}
+
+	for _, event := range events {
+		ok(t, sink.Record(ctx, event))
+	}
+
+	ids := func(query audit.Query) []string {
+		found, err := sink.Query(ctx, query)
+		ok(t, err)
+
+		result := make([]string, 0, len(found))
+
+		for _, event := range found {
+			result = append(result, event.Id)
+		}
+
+		return result
+	}
+
+	equals(t, []string{"5", "3", "2", "1"}, ids(audit.Query{TenantId: "default"}))
+	equals(t, []string{"5", "3", "1"}, ids(audit.Query{TenantId: "default", UserId: "u1"}))
+	equals(t, []string{"4", "3", "2"}, ids(audit.Query{Types: []audit.EventType{audit.LoginSucceeded,
+		audit.LoginFailed}}))
+	equals(t, []string{"3", "2"}, ids(audit.Query{TenantId: "default", From: start.Add(time.Minute),
+		To: start.Add(3 * time.Minute)}))
+	equals(t, []string{"5", "4"}, ids(audit.Query{Limit: 2}))
+
+	found, err := sink.Query(ctx, audit.Query{Types: []audit.EventType{audit.AdminAction}})
+	ok(t, err)
+	equals(t, 1, len(found))
+	equals(t, events[4].Details, found[0].Details)
+	equals(t, events[4].CreatedAt.Unix(), found[0].CreatedAt.Unix())
+}
+
+// TestFileSink_Append ensures events recorded before the sink is reopened are kept.
+func TestFileSink_Append(t *testing.T) {
+	sink, dir := makeFileSink(t)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	ok(t, sink.Record(ctx, audit.Event{Id: "1", TenantId: "default", Type: audit.Signup}))
+	ok(t, sink.Close())
+
+	sink, err := audit.NewFileSink(filepath.Join(dir, "audit.jsonl"))
+	ok(t, err)
+	defer sink.Close()
+
+	ok(t, sink.Record(ctx, audit.Event{Id: "2", TenantId: "default", Type: audit.Signup}))
+
+	found, err := sink.Query(ctx, audit.Query{})
+	ok(t, err)
+	equals(t, 2, len(found))
+}
+
+// TestNewFileSink_Fail ensures a sink can't be constructed for a file that can't be written.
+func TestNewFileSink_Fail(t *testing.T) {
+	_, err := audit.NewFileSink(filepath.Join("does", "not", "exist", "audit.jsonl"))
+	notOk(t, err)
+}
@@ -0,0 +1,148 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/lib/pq"
+	"strings"
+)
+
+const (
+	auditColumns = "id, tenant_id, type, actor_id, user_id, email, success, reason, remote_addr, request_id, " +
+		"details, created_at"
+	insertAuditEvent = "INSERT INTO audit_event (" + auditColumns + ") " +
+		"VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)"
+	selectAuditEvents = "SELECT " + auditColumns + " FROM audit_event"
+)
+
+type postgresqlSink struct {
+	db *sql.DB
+}
+
+// NewPostgresqlSink constructs a Sink storing events in the audit_event table.
+func NewPostgresqlSink(db *sql.DB) Sink {
+	return &postgresqlSink{db}
+}
+
+// Ping verifies the database can be reached.
+func (ps *postgresqlSink) Ping(ctx context.Context) error {
+	return ps.db.PingContext(ctx)
+}
+
+// Record inserts an event.
+func (ps *postgresqlSink) Record(ctx context.Context, event Event) error {
+	details, err := json.Marshal(event.Details)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = ps.db.ExecContext(ctx, insertAuditEvent, event.Id, event.TenantId, string(event.Type),
+		nullString(event.ActorId), nullString(event.UserId), nullString(event.Email), event.Success,
+		nullString(event.Reason), nullString(event.RemoteAddr), nullString(event.RequestId), string(details),
+		event.CreatedAt)
+
+	return err
+}
+
+// Query selects the events matching the query, newest first.
+func (ps *postgresqlSink) Query(ctx context.Context, query Query) ([]Event, error) {
+	conditions := make([]string, 0)
+	args := make([]interface{}, 0)
+
+	where := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if query.TenantId != "" {
+		where("tenant_id=$%d", query.TenantId)
+	}
+
+	if query.UserId != "" {
+		args = append(args, query.UserId)
+		conditions = append(conditions, fmt.Sprintf("(user_id=$%d OR actor_id=$%d)", len(args), len(args)))
+	}
+
+	if len(query.Types) > 0 {
+		types := make([]string, 0, len(query.Types))
+
+		for _, eventType := range query.Types {
+			types = append(types, string(eventType))
+		}
+
+		where("type=ANY($%d)", pq.Array(types))
+	}
+
+	if !query.From.IsZero() {
+		where("created_at>=$%d", query.From)
+	}
+
+	if !query.To.IsZero() {
+		where("created_at<$%d", query.To)
+	}
+
+	stmt := selectAuditEvents
+
+	if len(conditions) > 0 {
+		stmt += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	args = append(args, query.limit())
+	stmt += fmt.Sprintf(" ORDER BY created_at DESC LIMIT $%d", len(args))
+
+	rows, err := ps.db.QueryContext(ctx, stmt, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	events := make([]Event, 0)
+
+	for rows.Next() {
+		event := Event{}
+		var eventType string
+		var actorId, userId, email, reason, remoteAddr, requestId sql.NullString
+		var details []byte
+
+		err = rows.Scan(&event.Id, &event.TenantId, &eventType, &actorId, &userId, &email, &event.Success, &reason,
+			&remoteAddr, &requestId, &details, &event.CreatedAt)
+
+		if err != nil {
+			return nil, err
+		}
+
+		event.Type = EventType(eventType)
+		event.ActorId = actorId.String
+		event.UserId = userId.String
+		event.Email = email.String
+		event.Reason = reason.String
+		event.RemoteAddr = remoteAddr.String
+		event.RequestId = requestId.String
+
+		if len(details) > 0 {
+			err = json.Unmarshal(details, &event.Details)
+
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+// Close closes the database connection.
+func (ps *postgresqlSink) Close() error {
+	return ps.db.Close()
+}
+
+func nullString(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
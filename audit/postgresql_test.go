@@ -0,0 +1,64 @@
+package audit_test
+
+import (
+	"context"
+	"github.com/stone1549/auth-service/audit"
+	"gopkg.in/DATA-DOG/go-sqlmock.v2"
+	"testing"
+	"time"
+)
+
+// TestPostgresqlSink_Record ensures events are inserted with their details encoded as JSON.
+func TestPostgresqlSink_Record(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	ok(t, err)
+	defer db.Close()
+
+	createdAt := time.Now().UTC()
+	mock.ExpectExec("INSERT INTO audit_event").
+		WithArgs("1", "default", "admin_action", audit.ServiceActor, nil, nil, true, nil, "127.0.0.1", nil,
+			`{"route":"/group/"}`, createdAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	sink := audit.NewPostgresqlSink(db)
+	err = sink.Record(context.Background(), audit.Event{Id: "1", TenantId: "default", Type: audit.AdminAction,
+		ActorId: audit.ServiceActor, Success: true, RemoteAddr: "127.0.0.1",
+		Details: map[string]string{"route": "/group/"}, CreatedAt: createdAt})
+	ok(t, err)
+	ok(t, mock.ExpectationsWereMet())
+}
+
+// TestPostgresqlSink_Query ensures filters become query conditions and rows are read back into events.
+func TestPostgresqlSink_Query(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	ok(t, err)
+	defer db.Close()
+
+	from := time.Date(2018, 5, 1, 0, 0, 0, 0, time.UTC)
+	columns := []string{"id", "tenant_id", "type", "actor_id", "user_id", "email", "success", "reason",
+		"remote_addr", "request_id", "details", "created_at"}
+	rows := sqlmock.NewRows(columns).
+		AddRow("2", "default", "login_failed", nil, nil, "u1@example.com", false, "bad password", "127.0.0.1",
+			"req-2", []byte("null"), from.Add(time.Hour)).
+		AddRow("1", "default", "signup", "u1", "u1", "u1@example.com", true, nil, "127.0.0.1", "req-1",
+			[]byte(`{"source":"web"}`), from)
+
+	mock.ExpectQuery(`SELECT .* FROM audit_event WHERE tenant_id=\$1 AND \(user_id=\$2 OR actor_id=\$2\) `+
+		`AND created_at>=\$3 ORDER BY created_at DESC LIMIT \$4`).
+		WithArgs("default", "u1", from, 10).
+		WillReturnRows(rows)
+
+	sink := audit.NewPostgresqlSink(db)
+	events, err := sink.Query(context.Background(), audit.Query{TenantId: "default", UserId: "u1", From: from,
+		Limit: 10})
+	ok(t, err)
+	ok(t, mock.ExpectationsWereMet())
+
+	equals(t, 2, len(events))
+	equals(t, audit.LoginFailed, events[0].Type)
+	equals(t, "", events[0].UserId)
+	equals(t, "bad password", events[0].Reason)
+	equals(t, audit.Signup, events[1].Type)
+	equals(t, "u1", events[1].UserId)
+	equals(t, map[string]string{"source": "web"}, events[1].Details)
+}
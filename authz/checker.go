@@ -0,0 +1,378 @@
+package authz
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/stone1549/auth-service/common"
+	"github.com/stone1549/auth-service/repository"
+	"strings"
+)
+
+// maxDepth bounds how many relations a single check or expand may traverse.
+const maxDepth = 32
+
+// ExpandNode is a node of the tree describing every subject of a relation.
+type ExpandNode struct {
+	// Operation is the rewrite that produced this node, leaf nodes have the operation this.
+	Operation string `json:"operation"`
+	// Object and Relation identify the userset this node describes, empty for anonymous operator nodes.
+	Object   string `json:"object,omitempty"`
+	Relation string `json:"relation,omitempty"`
+	// Subjects are the subjects directly related through stored tuples.
+	Subjects []string      `json:"subjects,omitempty"`
+	Children []*ExpandNode `json:"children,omitempty"`
+}
+
+// Checker answers relationship questions by evaluating namespace rewrites over stored tuples.
+type Checker interface {
+	// Check reports whether subject has relation to object within a tenant.
+	Check(ctx context.Context, tenantId, object, relation, subject string) (bool, error)
+	// Expand describes every subject that has relation to object within a tenant.
+	Expand(ctx context.Context, tenantId, object, relation string) (*ExpandNode, error)
+	// Validate ensures a tuple refers to a configured namespace and relation.
+	Validate(tuple common.Tuple) error
+}
+
+type checker struct {
+	namespaces Namespaces
+	repo       repository.TupleRepository
+}
+
+// NewChecker constructs a Checker evaluating the given namespaces over tuples stored in repo.
+func NewChecker(namespaces Namespaces, repo repository.TupleRepository) Checker {
+	return &checker{namespaces, repo}
+}
+
+// SplitObject splits an object of the form namespace:id into its parts.
+func SplitObject(object string) (string, string, error) {
+	parts := strings.SplitN(object, ":", 2)
+
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", errors.New(fmt.Sprintf("invalid object %s, expected namespace:id", object))
+	}
+
+	return parts[0], parts[1], nil
+}
+
+// splitUserset splits a subject of the form namespace:id#relation into its object and relation, ok is false for
+// plain subjects.
+func splitUserset(subject string) (string, string, bool) {
+	index := strings.LastIndex(subject, "#")
+
+	if index < 0 {
+		return subject, "", false
+	}
+
+	return subject[:index], subject[index+1:], true
+}
+
+func (c *checker) rewrite(object, relation string) (*Rewrite, error) {
+	namespaceName, _, err := SplitObject(object)
+
+	if err != nil {
+		return nil, err
+	}
+
+	namespace, ok := c.namespaces[namespaceName]
+
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("unknown namespace %s", namespaceName))
+	}
+
+	rewrite, ok := namespace.Relations[relation]
+
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("unknown relation %s#%s", namespaceName, relation))
+	}
+
+	return rewrite, nil
+}
+
+// Validate ensures a tuple refers to a configured namespace and relation.
+func (c *checker) Validate(tuple common.Tuple) error {
+	_, err := c.rewrite(tuple.Object, tuple.Relation)
+
+	if err != nil {
+		return err
+	}
+
+	if tuple.Subject == "" {
+		return errors.New("subject is required")
+	}
+
+	if object, relation, ok := splitUserset(tuple.Subject); ok {
+		_, err = c.rewrite(object, relation)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if c.isTupleset(tuple.Object, tuple.Relation) {
+		_, _, isUserset := splitUserset(tuple.Subject)
+
+		if _, _, err = SplitObject(tuple.Subject); err != nil || isUserset {
+			return errors.New(fmt.Sprintf("subject of tupleset %s must be an object namespace:id", tuple.Relation))
+		}
+	}
+
+	return nil
+}
+
+// isTupleset reports whether any relation of the object's namespace follows relation as a tupleset.
+func (c *checker) isTupleset(object, relation string) bool {
+	namespaceName, _, err := SplitObject(object)
+
+	if err != nil {
+		return false
+	}
+
+	namespace, ok := c.namespaces[namespaceName]
+
+	if !ok {
+		return false
+	}
+
+	for _, rewrite := range namespace.Relations {
+		if followsTupleset(rewrite, relation) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// followsTupleset reports whether rewrite, or any of its children, is a tuple to userset rewrite over tupleset.
+func followsTupleset(rewrite *Rewrite, tupleset string) bool {
+	if rewrite.Kind == TupleToUsersetRewrite && rewrite.Tupleset == tupleset {
+		return true
+	}
+
+	for _, child := range rewrite.Children {
+		if followsTupleset(child, tupleset) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Check reports whether subject has relation to object within a tenant.
+func (c *checker) Check(ctx context.Context, tenantId, object, relation, subject string) (bool, error) {
+	return c.check(ctx, tenantId, object, relation, subject, make(map[string]bool))
+}
+
+func (c *checker) check(ctx context.Context, tenantId, object, relation, subject string,
+	path map[string]bool) (bool, error) {
+	key := object + "#" + relation
+
+	if key == subject {
+		return true, nil
+	}
+
+	// Revisiting a userset already being evaluated can't contribute anything new.
+	if path[key] {
+		return false, nil
+	}
+
+	if len(path) >= maxDepth {
+		return false, errors.New("maximum check depth exceeded")
+	}
+
+	rewrite, err := c.rewrite(object, relation)
+
+	if err != nil {
+		return false, err
+	}
+
+	path[key] = true
+	defer delete(path, key)
+
+	return c.checkRewrite(ctx, tenantId, object, relation, rewrite, subject, path)
+}
+
+func (c *checker) checkRewrite(ctx context.Context, tenantId, object, relation string, rewrite *Rewrite,
+	subject string, path map[string]bool) (bool, error) {
+	switch rewrite.Kind {
+	case ThisRewrite:
+		tuples, err := c.repo.ReadTuples(ctx, tenantId, object, relation)
+
+		if err != nil {
+			return false, err
+		}
+
+		for _, tuple := range tuples {
+			if tuple.Subject == subject {
+				return true, nil
+			}
+
+			if usersetObject, usersetRelation, ok := splitUserset(tuple.Subject); ok {
+				allowed, err := c.check(ctx, tenantId, usersetObject, usersetRelation, subject, path)
+
+				if err != nil || allowed {
+					return allowed, err
+				}
+			}
+		}
+
+		return false, nil
+	case ComputedRewrite:
+		return c.check(ctx, tenantId, object, rewrite.Relation, subject, path)
+	case TupleToUsersetRewrite:
+		tuples, err := c.repo.ReadTuples(ctx, tenantId, object, rewrite.Tupleset)
+
+		if err != nil {
+			return false, err
+		}
+
+		for _, tuple := range tuples {
+			related, _, _ := splitUserset(tuple.Subject)
+			allowed, err := c.check(ctx, tenantId, related, rewrite.Relation, subject, path)
+
+			if err != nil || allowed {
+				return allowed, err
+			}
+		}
+
+		return false, nil
+	case UnionRewrite:
+		for _, child := range rewrite.Children {
+			allowed, err := c.checkRewrite(ctx, tenantId, object, relation, child, subject, path)
+
+			if err != nil || allowed {
+				return allowed, err
+			}
+		}
+
+		return false, nil
+	case IntersectionRewrite:
+		for _, child := range rewrite.Children {
+			allowed, err := c.checkRewrite(ctx, tenantId, object, relation, child, subject, path)
+
+			if err != nil || !allowed {
+				return false, err
+			}
+		}
+
+		return true, nil
+	case ExclusionRewrite:
+		allowed, err := c.checkRewrite(ctx, tenantId, object, relation, rewrite.Children[0], subject, path)
+
+		if err != nil || !allowed {
+			return false, err
+		}
+
+		excluded, err := c.checkRewrite(ctx, tenantId, object, relation, rewrite.Children[1], subject, path)
+
+		return !excluded, err
+	default:
+		return false, errors.New("unsupported rewrite")
+	}
+}
+
+// Expand describes every subject that has relation to object within a tenant.
+func (c *checker) Expand(ctx context.Context, tenantId, object, relation string) (*ExpandNode, error) {
+	return c.expand(ctx, tenantId, object, relation, make(map[string]bool))
+}
+
+func (c *checker) expand(ctx context.Context, tenantId, object, relation string,
+	path map[string]bool) (*ExpandNode, error) {
+	key := object + "#" + relation
+
+	if path[key] {
+		return &ExpandNode{Operation: ThisRewrite.String(), Object: object, Relation: relation}, nil
+	}
+
+	if len(path) >= maxDepth {
+		return nil, errors.New("maximum expand depth exceeded")
+	}
+
+	rewrite, err := c.rewrite(object, relation)
+
+	if err != nil {
+		return nil, err
+	}
+
+	path[key] = true
+	defer delete(path, key)
+
+	node, err := c.expandRewrite(ctx, tenantId, object, relation, rewrite, path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	node.Object = object
+	node.Relation = relation
+
+	return node, nil
+}
+
+func (c *checker) expandRewrite(ctx context.Context, tenantId, object, relation string, rewrite *Rewrite,
+	path map[string]bool) (*ExpandNode, error) {
+	node := &ExpandNode{Operation: rewrite.Kind.String()}
+
+	switch rewrite.Kind {
+	case ThisRewrite:
+		tuples, err := c.repo.ReadTuples(ctx, tenantId, object, relation)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, tuple := range tuples {
+			usersetObject, usersetRelation, ok := splitUserset(tuple.Subject)
+
+			if !ok {
+				node.Subjects = append(node.Subjects, tuple.Subject)
+				continue
+			}
+
+			child, err := c.expand(ctx, tenantId, usersetObject, usersetRelation, path)
+
+			if err != nil {
+				return nil, err
+			}
+
+			node.Children = append(node.Children, child)
+		}
+	case ComputedRewrite:
+		child, err := c.expand(ctx, tenantId, object, rewrite.Relation, path)
+
+		if err != nil {
+			return nil, err
+		}
+
+		node.Children = append(node.Children, child)
+	case TupleToUsersetRewrite:
+		tuples, err := c.repo.ReadTuples(ctx, tenantId, object, rewrite.Tupleset)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, tuple := range tuples {
+			related, _, _ := splitUserset(tuple.Subject)
+			child, err := c.expand(ctx, tenantId, related, rewrite.Relation, path)
+
+			if err != nil {
+				return nil, err
+			}
+
+			node.Children = append(node.Children, child)
+		}
+	default:
+		for _, childRewrite := range rewrite.Children {
+			child, err := c.expandRewrite(ctx, tenantId, object, relation, childRewrite, path)
+
+			if err != nil {
+				return nil, err
+			}
+
+			node.Children = append(node.Children, child)
+		}
+	}
+
+	return node, nil
+}
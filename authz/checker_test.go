@@ -0,0 +1,129 @@
+package authz_test
+
+import (
+	"context"
+	"github.com/stone1549/auth-service/authz"
+	"github.com/stone1549/auth-service/common"
+	"github.com/stone1549/auth-service/repository"
+	"testing"
+)
+
+// tupleRepository is a minimal in memory TupleRepository ignoring tenants.
+type tupleRepository map[string][]common.Tuple
+
+func (tr tupleRepository) WriteTuples(ctx context.Context, tenantId string, writes []common.Tuple,
+	deletes []common.Tuple) error {
+	for _, tuple := range writes {
+		key := tuple.Object + "#" + tuple.Relation
+		tr[key] = append(tr[key], tuple)
+	}
+	return nil
+}
+
+func (tr tupleRepository) ReadTuples(ctx context.Context, tenantId, object, relation string) ([]common.Tuple, error) {
+	return tr[object+"#"+relation], nil
+}
+
+func tuple(object, relation, subject string) common.Tuple {
+	return common.Tuple{Object: object, Relation: relation, Subject: subject}
+}
+
+func makeChecker(t *testing.T, tuples ...common.Tuple) authz.Checker {
+	namespaces, err := authz.LoadNamespaces("../data/namespaces.authz")
+	ok(t, err)
+
+	var repo repository.TupleRepository = tupleRepository{}
+	ok(t, repo.WriteTuples(context.Background(), common.DefaultTenantId, tuples, nil))
+
+	return authz.NewChecker(namespaces, repo)
+}
+
+func checkEquals(t *testing.T, checker authz.Checker, exp bool, object, relation, subject string) {
+	allowed, err := checker.Check(context.Background(), common.DefaultTenantId, object, relation, subject)
+	ok(t, err)
+	assert(t, allowed == exp, "expected check %s#%s@%s to be %v", object, relation, subject, exp)
+}
+
+// TestChecker_Check ensures direct tuples, computed usersets, tuple to userset rewrites, nested usersets and
+// exclusions are all honoured.
+func TestChecker_Check(t *testing.T) {
+	checker := makeChecker(t,
+		tuple("document:readme", "owner", "alice"),
+		tuple("document:readme", "parent", "folder:docs"),
+		tuple("document:readme", "viewer", "group:eng#member"),
+		tuple("document:readme", "banned", "mallory"),
+		tuple("folder:docs", "viewer", "bob"),
+		tuple("folder:docs", "owner", "mallory"),
+		tuple("group:eng", "member", "carol"),
+	)
+
+	checkEquals(t, checker, true, "document:readme", "owner", "alice")
+	checkEquals(t, checker, true, "document:readme", "editor", "alice")
+	checkEquals(t, checker, true, "document:readme", "viewer", "alice")
+	checkEquals(t, checker, true, "document:readme", "viewer", "bob")
+	checkEquals(t, checker, false, "document:readme", "editor", "bob")
+	checkEquals(t, checker, true, "document:readme", "viewer", "carol")
+	checkEquals(t, checker, true, "document:readme", "viewer", "group:eng#member")
+	checkEquals(t, checker, false, "document:readme", "viewer", "mallory")
+	checkEquals(t, checker, true, "folder:docs", "viewer", "mallory")
+	checkEquals(t, checker, false, "document:readme", "viewer", "dave")
+}
+
+// TestChecker_CheckCycle ensures cyclic usersets terminate.
+func TestChecker_CheckCycle(t *testing.T) {
+	checker := makeChecker(t,
+		tuple("group:a", "member", "group:b#member"),
+		tuple("group:b", "member", "group:a#member"),
+		tuple("group:b", "member", "erin"),
+	)
+
+	checkEquals(t, checker, true, "group:a", "member", "erin")
+	checkEquals(t, checker, false, "group:a", "member", "frank")
+}
+
+// TestChecker_Expand ensures expand describes the subjects reachable through each rewrite.
+func TestChecker_Expand(t *testing.T) {
+	checker := makeChecker(t,
+		tuple("folder:docs", "owner", "alice"),
+		tuple("folder:docs", "viewer", "bob"),
+		tuple("folder:docs", "viewer", "group:eng#member"),
+		tuple("group:eng", "member", "carol"),
+	)
+
+	tree, err := checker.Expand(context.Background(), common.DefaultTenantId, "folder:docs", "viewer")
+	ok(t, err)
+	equals(t, "union", tree.Operation)
+	equals(t, "folder:docs", tree.Object)
+	equals(t, 2, len(tree.Children))
+
+	direct := tree.Children[0]
+	equals(t, []string{"bob"}, direct.Subjects)
+	equals(t, "group:eng", direct.Children[0].Object)
+	equals(t, []string{"carol"}, direct.Children[0].Subjects)
+
+	owners := tree.Children[1].Children[0]
+	equals(t, "owner", owners.Relation)
+	equals(t, []string{"alice"}, owners.Subjects)
+}
+
+// TestChecker_Validate ensures tuples naming unknown namespaces or relations are rejected.
+func TestChecker_Validate(t *testing.T) {
+	checker := makeChecker(t)
+
+	ok(t, checker.Validate(tuple("document:readme", "owner", "alice")))
+	ok(t, checker.Validate(tuple("document:readme", "viewer", "group:eng#member")))
+	notOk(t, checker.Validate(tuple("document", "owner", "alice")))
+	notOk(t, checker.Validate(tuple("spreadsheet:1", "owner", "alice")))
+	notOk(t, checker.Validate(tuple("document:readme", "approver", "alice")))
+	notOk(t, checker.Validate(tuple("document:readme", "viewer", "group:eng#admin")))
+}
+
+// TestChecker_ValidateTupleset ensures tuples of a relation followed as a tupleset must name an object, as
+// anything else could never be followed.
+func TestChecker_ValidateTupleset(t *testing.T) {
+	checker := makeChecker(t)
+
+	ok(t, checker.Validate(tuple("document:readme", "parent", "folder:docs")))
+	notOk(t, checker.Validate(tuple("document:readme", "parent", "alice")))
+	notOk(t, checker.Validate(tuple("document:readme", "parent", "folder:docs#viewer")))
+}
@@ -0,0 +1,385 @@
+package authz
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"strings"
+	"unicode"
+)
+
+// RewriteKind represents a way of computing the subjects of a relation.
+type RewriteKind int
+
+const (
+	// ThisRewrite represents the subjects directly related to an object by stored tuples.
+	ThisRewrite RewriteKind = 0
+	// ComputedRewrite represents the subjects of another relation of the same object.
+	ComputedRewrite RewriteKind = iota
+	// TupleToUsersetRewrite represents the subjects of a relation of the objects related through a tupleset relation.
+	TupleToUsersetRewrite RewriteKind = iota
+	// UnionRewrite represents the subjects of any child rewrite.
+	UnionRewrite RewriteKind = iota
+	// IntersectionRewrite represents the subjects of every child rewrite.
+	IntersectionRewrite RewriteKind = iota
+	// ExclusionRewrite represents the subjects of the first child rewrite that aren't subjects of the second.
+	ExclusionRewrite RewriteKind = iota
+)
+
+func (rk RewriteKind) String() string {
+	switch rk {
+	case ThisRewrite:
+		return "this"
+	case ComputedRewrite:
+		return "computed"
+	case TupleToUsersetRewrite:
+		return "tupleToUserset"
+	case UnionRewrite:
+		return "union"
+	case IntersectionRewrite:
+		return "intersection"
+	case ExclusionRewrite:
+		return "exclusion"
+	default:
+		return ""
+	}
+}
+
+// Rewrite describes how the subjects of a relation are computed.
+type Rewrite struct {
+	Kind RewriteKind
+	// Relation is the computed relation for computed and tuple to userset rewrites.
+	Relation string
+	// Tupleset is the relation followed to find related objects for tuple to userset rewrites.
+	Tupleset string
+	// Children are the operands of union, intersection and exclusion rewrites.
+	Children []*Rewrite
+}
+
+// Namespace holds the relations defined for a type of object.
+type Namespace struct {
+	Name      string
+	Relations map[string]*Rewrite
+}
+
+// Namespaces holds namespace configurations keyed by name.
+type Namespaces map[string]*Namespace
+
+// LoadNamespaces reads and parses a namespace configuration file.
+func LoadNamespaces(path string) (Namespaces, error) {
+	if path == "" {
+		return Namespaces{}, nil
+	}
+
+	src, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseNamespaces(string(src))
+}
+
+// ParseNamespaces parses namespace configuration source of the form:
+//
+//	namespace document {
+//	  relation owner
+//	  relation parent
+//	  relation editor = this | owner
+//	  relation viewer = this | editor | parent->viewer
+//	}
+//
+// A relation without a rewrite is only made of its stored tuples. Rewrites combine this, other relations of the
+// same namespace and tupleset->relation with | (union), & (intersection) and - (exclusion), evaluated left to right
+// unless grouped with parentheses.
+func ParseNamespaces(src string) (Namespaces, error) {
+	tokens, err := tokenize(src)
+
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	namespaces := Namespaces{}
+
+	for !p.done() {
+		namespace, err := p.namespace()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := namespaces[namespace.Name]; ok {
+			return nil, errors.New(fmt.Sprintf("duplicate namespace %s", namespace.Name))
+		}
+
+		namespaces[namespace.Name] = namespace
+	}
+
+	for _, namespace := range namespaces {
+		for name, rewrite := range namespace.Relations {
+			err = namespace.validate(rewrite)
+
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("%s#%s: %s", namespace.Name, name, err.Error()))
+			}
+		}
+	}
+
+	return namespaces, nil
+}
+
+func (ns *Namespace) validate(rewrite *Rewrite) error {
+	switch rewrite.Kind {
+	case ComputedRewrite:
+		if _, ok := ns.Relations[rewrite.Relation]; !ok {
+			return errors.New(fmt.Sprintf("unknown relation %s", rewrite.Relation))
+		}
+	case TupleToUsersetRewrite:
+		if _, ok := ns.Relations[rewrite.Tupleset]; !ok {
+			return errors.New(fmt.Sprintf("unknown tupleset relation %s", rewrite.Tupleset))
+		}
+	}
+
+	for _, child := range rewrite.Children {
+		err := ns.validate(child)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type token struct {
+	text string
+	line int
+}
+
+func tokenize(src string) ([]token, error) {
+	tokens := make([]token, 0)
+	line := 1
+	runes := []rune(src)
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+
+		switch {
+		case r == '\n':
+			line++
+		case unicode.IsSpace(r):
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '/':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+			line++
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '>':
+			tokens = append(tokens, token{"->", line})
+			i++
+		case strings.ContainsRune("{}=|&-()", r):
+			tokens = append(tokens, token{string(r), line})
+		case isIdentRune(r):
+			start := i
+			for i+1 < len(runes) && isIdentRune(runes[i+1]) {
+				i++
+			}
+			tokens = append(tokens, token{string(runes[start : i+1]), line})
+		default:
+			return nil, errors.New(fmt.Sprintf("line %d: unexpected character %q", line, r))
+		}
+	}
+
+	return tokens, nil
+}
+
+func isIdentRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func isIdent(text string) bool {
+	for _, r := range text {
+		if !isIdentRune(r) {
+			return false
+		}
+	}
+
+	return text != ""
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *parser) peek() string {
+	if p.done() {
+		return ""
+	}
+
+	return p.tokens[p.pos].text
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	line := 0
+
+	if !p.done() {
+		line = p.tokens[p.pos].line
+	} else if len(p.tokens) > 0 {
+		line = p.tokens[len(p.tokens)-1].line
+	}
+
+	return errors.New(fmt.Sprintf("line %d: ", line) + fmt.Sprintf(format, args...))
+}
+
+func (p *parser) expect(text string) error {
+	if p.peek() != text {
+		return p.errorf("expected %q, found %q", text, p.peek())
+	}
+
+	p.pos++
+	return nil
+}
+
+func (p *parser) ident() (string, error) {
+	text := p.peek()
+
+	if !isIdent(text) {
+		return "", p.errorf("expected identifier, found %q", text)
+	}
+
+	p.pos++
+	return text, nil
+}
+
+func (p *parser) namespace() (*Namespace, error) {
+	err := p.expect("namespace")
+
+	if err != nil {
+		return nil, err
+	}
+
+	name, err := p.ident()
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.expect("{")
+
+	if err != nil {
+		return nil, err
+	}
+
+	namespace := &Namespace{Name: name, Relations: make(map[string]*Rewrite)}
+
+	for p.peek() != "}" {
+		err = p.expect("relation")
+
+		if err != nil {
+			return nil, err
+		}
+
+		relation, err := p.ident()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := namespace.Relations[relation]; ok {
+			return nil, p.errorf("duplicate relation %s", relation)
+		}
+
+		rewrite := &Rewrite{Kind: ThisRewrite}
+
+		if p.peek() == "=" {
+			p.pos++
+			rewrite, err = p.expression()
+
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		namespace.Relations[relation] = rewrite
+	}
+
+	return namespace, p.expect("}")
+}
+
+func (p *parser) expression() (*Rewrite, error) {
+	left, err := p.term()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		var kind RewriteKind
+
+		switch p.peek() {
+		case "|":
+			kind = UnionRewrite
+		case "&":
+			kind = IntersectionRewrite
+		case "-":
+			kind = ExclusionRewrite
+		default:
+			return left, nil
+		}
+
+		p.pos++
+		right, err := p.term()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if left.Kind == kind && kind != ExclusionRewrite {
+			left.Children = append(left.Children, right)
+		} else {
+			left = &Rewrite{Kind: kind, Children: []*Rewrite{left, right}}
+		}
+	}
+}
+
+func (p *parser) term() (*Rewrite, error) {
+	if p.peek() == "(" {
+		p.pos++
+		rewrite, err := p.expression()
+
+		if err != nil {
+			return nil, err
+		}
+
+		// Wrap grouped expressions so they aren't flattened into the surrounding operator.
+		return &Rewrite{Kind: UnionRewrite, Children: []*Rewrite{rewrite}}, p.expect(")")
+	}
+
+	name, err := p.ident()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if name == "this" {
+		return &Rewrite{Kind: ThisRewrite}, nil
+	}
+
+	if p.peek() == "->" {
+		p.pos++
+		relation, err := p.ident()
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &Rewrite{Kind: TupleToUsersetRewrite, Tupleset: name, Relation: relation}, nil
+	}
+
+	return &Rewrite{Kind: ComputedRewrite, Relation: name}, nil
+}
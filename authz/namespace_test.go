@@ -0,0 +1,54 @@
+package authz_test
+
+import (
+	"github.com/stone1549/auth-service/authz"
+	"testing"
+)
+
+// TestLoadNamespaces ensures the sample namespace configuration parses into the expected rewrites.
+func TestLoadNamespaces(t *testing.T) {
+	namespaces, err := authz.LoadNamespaces("../data/namespaces.authz")
+	ok(t, err)
+	equals(t, 3, len(namespaces))
+
+	viewer := namespaces["document"].Relations["viewer"]
+	equals(t, authz.ExclusionRewrite, viewer.Kind)
+	equals(t, authz.UnionRewrite, viewer.Children[0].Kind)
+
+	union := viewer.Children[0].Children[0]
+	equals(t, 3, len(union.Children))
+	equals(t, authz.ThisRewrite, union.Children[0].Kind)
+	equals(t, authz.ComputedRewrite, union.Children[1].Kind)
+	equals(t, "editor", union.Children[1].Relation)
+	equals(t, authz.TupleToUsersetRewrite, union.Children[2].Kind)
+	equals(t, "parent", union.Children[2].Tupleset)
+	equals(t, "viewer", union.Children[2].Relation)
+
+	equals(t, authz.ThisRewrite, namespaces["document"].Relations["owner"].Kind)
+}
+
+// TestLoadNamespaces_Empty ensures no namespaces are configured when no file is given.
+func TestLoadNamespaces_Empty(t *testing.T) {
+	namespaces, err := authz.LoadNamespaces("")
+	ok(t, err)
+	equals(t, 0, len(namespaces))
+}
+
+// TestParseNamespaces_Fail ensures invalid namespace configurations are rejected.
+func TestParseNamespaces_Fail(t *testing.T) {
+	invalid := []string{
+		"namespace doc { relation viewer = editor }",
+		"namespace doc { relation viewer = parent->viewer }",
+		"namespace doc { relation owner relation owner }",
+		"namespace doc { relation owner } namespace doc { relation owner }",
+		"namespace doc { relation viewer = (this | owner }",
+		"namespace doc { relation viewer = this | }",
+		"namespace doc { relation viewer = this % owner }",
+		"namespace doc { relation owner",
+	}
+
+	for _, src := range invalid {
+		_, err := authz.ParseNamespaces(src)
+		notOk(t, err)
+	}
+}
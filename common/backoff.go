@@ -0,0 +1,26 @@
+package common
+
+import "time"
+
+const (
+	// baseBackoff is the delay before the first retry, doubled for every attempt after.
+	baseBackoff = 30 * time.Second
+	// maxBackoff caps the delay between attempts.
+	maxBackoff = 6 * time.Hour
+)
+
+// Backoff is the delay before the attempt following the given number of failed attempts, shared by the work the
+// service retries in the background such as webhook deliveries and outbox events.
+func Backoff(attempts int) time.Duration {
+	backoff := baseBackoff
+
+	for i := 1; i < attempts && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+
+	if backoff > maxBackoff {
+		return maxBackoff
+	}
+
+	return backoff
+}
@@ -0,0 +1,15 @@
+package common_test
+
+import (
+	"github.com/stone1549/auth-service/common"
+	"testing"
+	"time"
+)
+
+// TestBackoff ensures the delay between attempts doubles up to a cap.
+func TestBackoff(t *testing.T) {
+	equals(t, 30*time.Second, common.Backoff(1))
+	equals(t, time.Minute, common.Backoff(2))
+	equals(t, 4*time.Minute, common.Backoff(4))
+	equals(t, 6*time.Hour, common.Backoff(20))
+}
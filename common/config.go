@@ -2,10 +2,12 @@ package common
 
 import (
 	"crypto/rsa"
+	"crypto/tls"
 	"fmt"
-	"github.com/dgrijalva/jwt-go"
 	"github.com/pkg/errors"
-	"io/ioutil"
+	"log/slog"
+	"net"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
@@ -22,6 +24,59 @@ const (
 	tokenSecretKeyKey string = "AUTH_SERVICE_TOKEN_SECRET"
 	tokenPrivateKey   string = "AUTH_SERVICE_TOKEN_PRIV"
 	tokenPublicKey    string = "AUTH_SERVICE_TOKEN_PUB"
+	tenantsKey        string = "AUTH_SERVICE_TENANTS"
+	tenantSelectorKey string = "AUTH_SERVICE_TENANT_SELECTOR"
+	groupsClaimKey    string = "AUTH_SERVICE_TOKEN_GROUPS_CLAIM"
+	serviceTokensKey  string = "AUTH_SERVICE_SERVICE_TOKENS"
+	authzNamespaceKey string = "AUTH_SERVICE_AUTHZ_NAMESPACES"
+	policyPathKey     string = "AUTH_SERVICE_POLICY_PATH"
+	policyReloadKey   string = "AUTH_SERVICE_POLICY_RELOAD_SECONDS"
+	auditSinkKey      string = "AUTH_SERVICE_AUDIT_SINK"
+	auditFileKey      string = "AUTH_SERVICE_AUDIT_FILE"
+	webhookMaxKey     string = "AUTH_SERVICE_WEBHOOK_MAX_ATTEMPTS"
+	webhookPollKey    string = "AUTH_SERVICE_WEBHOOK_POLL_SECONDS"
+	outboxPubKey      string = "AUTH_SERVICE_OUTBOX_PUBLISHER"
+	outboxTargetKey   string = "AUTH_SERVICE_OUTBOX_TARGET"
+	outboxPollKey     string = "AUTH_SERVICE_OUTBOX_POLL_SECONDS"
+	outboxMaxKey      string = "AUTH_SERVICE_OUTBOX_MAX_ATTEMPTS"
+	ldapUrlKey        string = "AUTH_SERVICE_LDAP_URL"
+	ldapBaseDnKey     string = "AUTH_SERVICE_LDAP_BASE_DN"
+	ldapBindDnKey     string = "AUTH_SERVICE_LDAP_BIND_DN"
+	ldapBindPassKey   string = "AUTH_SERVICE_LDAP_BIND_PASSWORD"
+	ldapFilterKey     string = "AUTH_SERVICE_LDAP_USER_FILTER"
+	ldapIdAttrKey     string = "AUTH_SERVICE_LDAP_ID_ATTRIBUTE"
+	ldapEmailAttrKey  string = "AUTH_SERVICE_LDAP_EMAIL_ATTRIBUTE"
+	ldapSignupKey     string = "AUTH_SERVICE_LDAP_SIGNUP"
+	ldapLocalRepoKey  string = "AUTH_SERVICE_LDAP_LOCAL_REPO_TYPE"
+	ldapTenantKey     string = "AUTH_SERVICE_LDAP_TENANT"
+	repoChainKey      string = "AUTH_SERVICE_REPO_CHAIN"
+	oidcProvidersKey  string = "AUTH_SERVICE_OIDC_PROVIDERS"
+	samlConfigKey     string = "AUTH_SERVICE_SAML_CONFIG"
+	fwdLoginUrlKey    string = "AUTH_SERVICE_FORWARD_AUTH_LOGIN_URL"
+	fwdRedirectKey    string = "AUTH_SERVICE_FORWARD_AUTH_REDIRECT_HOSTS"
+	sessionIdleKey    string = "AUTH_SERVICE_SESSION_IDLE_SECONDS"
+	sessionLifeKey    string = "AUTH_SERVICE_SESSION_LIFETIME_SECONDS"
+	rememberIdleKey   string = "AUTH_SERVICE_REMEMBER_ME_IDLE_SECONDS"
+	rememberLifeKey   string = "AUTH_SERVICE_REMEMBER_ME_LIFETIME_SECONDS"
+	sessionCleanKey   string = "AUTH_SERVICE_SESSION_CLEANUP_SECONDS"
+	geoIpKey          string = "AUTH_SERVICE_GEOIP_DATABASE"
+	smtpUrlKey        string = "AUTH_SERVICE_SMTP_URL"
+	smtpFromKey       string = "AUTH_SERVICE_SMTP_FROM"
+	traceExporterKey  string = "AUTH_SERVICE_TRACE_EXPORTER"
+	traceEndpointKey  string = "AUTH_SERVICE_TRACE_ENDPOINT"
+	logLevelKey       string = "AUTH_SERVICE_LOG_LEVEL"
+	shutdownGraceKey  string = "AUTH_SERVICE_SHUTDOWN_GRACE_SECONDS"
+	shutdownDrainKey  string = "AUTH_SERVICE_SHUTDOWN_DRAIN_SECONDS"
+	tlsCertKey        string = "AUTH_SERVICE_TLS_CERT"
+	tlsKeyKey         string = "AUTH_SERVICE_TLS_KEY"
+	tlsMinVersionKey  string = "AUTH_SERVICE_TLS_MIN_VERSION"
+	tlsCiphersKey     string = "AUTH_SERVICE_TLS_CIPHER_SUITES"
+	tlsClientCaKey    string = "AUTH_SERVICE_TLS_CLIENT_CA"
+	tlsRequireCertKey string = "AUTH_SERVICE_TLS_REQUIRE_CLIENT_CERT"
+	tlsReloadKey      string = "AUTH_SERVICE_TLS_RELOAD_SECONDS"
+	issuerKey         string = "AUTH_SERVICE_ISSUER"
+	trustedProxiesKey string = "AUTH_SERVICE_TRUSTED_PROXIES"
+	dpopWindowKey     string = "AUTH_SERVICE_DPOP_WINDOW_SECONDS"
 )
 
 // LifeCycle represents a particular application life cycle.
@@ -36,6 +91,15 @@ const (
 	ProdLifeCycle LifeCycle = iota
 )
 
+// LogLevel retrieves the level logged at by default in the life cycle, debug during development and info otherwise.
+func (lc LifeCycle) LogLevel() slog.Level {
+	if lc == DevLifeCycle {
+		return slog.LevelDebug
+	}
+
+	return slog.LevelInfo
+}
+
 func (lc LifeCycle) String() string {
 	switch lc {
 	case DevLifeCycle:
@@ -57,6 +121,10 @@ const (
 	InMemoryRepo UserRepositoryType = 0
 	// PostgreSqlRepo represents a UserRepository that utilizes a PostgreSQL database.
 	PostgreSqlRepo UserRepositoryType = iota
+	// LdapRepo represents a UserRepository that authenticates users against an LDAP directory.
+	LdapRepo UserRepositoryType = iota
+	// ChainedRepo represents a UserRepository that tries an ordered list of other repositories.
+	ChainedRepo UserRepositoryType = iota
 )
 
 func (prt UserRepositoryType) String() string {
@@ -65,11 +133,157 @@ func (prt UserRepositoryType) String() string {
 		return "POSTGRESQL"
 	case InMemoryRepo:
 		return "IN_MEMORY"
+	case LdapRepo:
+		return "LDAP"
+	case ChainedRepo:
+		return "CHAINED"
+	default:
+		return ""
+	}
+}
+
+// AuditSinkType represents a type of audit event sink.
+type AuditSinkType int
+
+const (
+	// NoAuditSink represents discarding audit events.
+	NoAuditSink AuditSinkType = 0
+	// FileAuditSink represents appending audit events to a JSON lines file.
+	FileAuditSink AuditSinkType = iota
+	// PostgreSqlAuditSink represents storing audit events in a PostgreSQL database.
+	PostgreSqlAuditSink AuditSinkType = iota
+)
+
+func (ast AuditSinkType) String() string {
+	switch ast {
+	case NoAuditSink:
+		return "NONE"
+	case FileAuditSink:
+		return "FILE"
+	case PostgreSqlAuditSink:
+		return "POSTGRESQL"
 	default:
 		return ""
 	}
 }
 
+// OutboxPublisherType represents a type of publisher outbox events are relayed to.
+type OutboxPublisherType int
+
+const (
+	// LogOutboxPublisher represents writing outbox events to the log.
+	LogOutboxPublisher OutboxPublisherType = 0
+	// FileOutboxPublisher represents appending outbox events to a JSON lines file.
+	FileOutboxPublisher OutboxPublisherType = iota
+	// HttpOutboxPublisher represents POSTing outbox events to a URL.
+	HttpOutboxPublisher OutboxPublisherType = iota
+)
+
+func (opt OutboxPublisherType) String() string {
+	switch opt {
+	case LogOutboxPublisher:
+		return "LOG"
+	case FileOutboxPublisher:
+		return "FILE"
+	case HttpOutboxPublisher:
+		return "HTTP"
+	default:
+		return ""
+	}
+}
+
+// TraceExporterType represents a type of exporter trace spans are sent to.
+type TraceExporterType int
+
+const (
+	// NoTraceExporter represents not tracing requests.
+	NoTraceExporter TraceExporterType = 0
+	// StdoutTraceExporter represents writing spans to standard output, for local use.
+	StdoutTraceExporter TraceExporterType = iota
+	// OtlpTraceExporter represents sending spans to an OpenTelemetry collector over OTLP/HTTP.
+	OtlpTraceExporter TraceExporterType = iota
+)
+
+func (tet TraceExporterType) String() string {
+	switch tet {
+	case NoTraceExporter:
+		return "NONE"
+	case StdoutTraceExporter:
+		return "STDOUT"
+	case OtlpTraceExporter:
+		return "OTLP"
+	default:
+		return ""
+	}
+}
+
+// LdapConfig holds the settings for authenticating users against an LDAP directory.
+type LdapConfig struct {
+	// Url is the ldap:// or ldaps:// url of the directory server.
+	Url string
+	// BaseDn is the entry users are searched for under.
+	BaseDn string
+	// BindDn and BindPassword are the credentials users are searched for with, anonymously when empty.
+	BindDn       string
+	BindPassword string
+	// UserFilter finds a user's entry, the escaped email is substituted for its %s.
+	UserFilter string
+	// IdAttribute holds the user's unique id, the entry's DN is used when it's missing.
+	IdAttribute string
+	// EmailAttribute holds the user's email.
+	EmailAttribute string
+	// AllowSignup delegates new users to the local repository rather than refusing them.
+	AllowSignup bool
+	// LocalRepoType is the repository that holds what the directory doesn't, such as groups and webhooks.
+	LocalRepoType UserRepositoryType
+	// TenantId is the tenant whose users are in the directory, users of other tenants are never looked up in it.
+	TenantId string
+}
+
+// TlsConfig holds the settings for serving TLS, and verifying the certificates of clients authenticating with mutual
+// TLS.
+type TlsConfig struct {
+	// CertFile and KeyFile are the PEM certificate chain and private key served, plain HTTP is served when empty.
+	CertFile string
+	KeyFile  string
+	// MinVersion is the lowest TLS version accepted, such as tls.VersionTLS12.
+	MinVersion uint16
+	// CipherSuites restricts the TLS 1.2 cipher suites accepted, Go's defaults are used when empty. TLS 1.3 suites
+	// aren't configurable.
+	CipherSuites []uint16
+	// ClientCaFile is a PEM bundle of the CAs client certificates are verified against, clients aren't asked for
+	// certificates when empty.
+	ClientCaFile string
+	// RequireClientCert refuses connections without a verified client certificate.
+	RequireClientCert bool
+	// ReloadInterval is how often the certificate and key files are checked for changes, zero disables reloading.
+	ReloadInterval time.Duration
+}
+
+// Enabled is whether TLS is served.
+func (tc TlsConfig) Enabled() bool {
+	return tc.CertFile != ""
+}
+
+// Repository chain operations a backend can serve.
+const (
+	AuthenticateOperation = "authenticate"
+	SignupOperation       = "signup"
+	ProvisionOperation    = "provision"
+)
+
+// RepoBackend describes a repository of a chain and the operations it serves.
+type RepoBackend struct {
+	Type UserRepositoryType
+	// Authenticate is whether users are authenticated against the backend, in chain order until one succeeds.
+	Authenticate bool
+	// Signup is whether new users are added to the backend, the first backend serving signup gets every new user.
+	Signup bool
+	// Provision is whether users authenticated by the backend are provisioned just in time in the chain's first
+	// backend, authenticating them then identifies them by their id there.
+	Provision bool
+}
+
 // Configuration provides methods for retrieving aspects of the applications configuration.
 type Configuration interface {
 	// GetLifeCycle retrieves the configured life cycle.
@@ -87,6 +301,13 @@ type Configuration interface {
 	// GetPgUrl retrieves the configured url string for connecting to PostgreSQL.
 	GetPgUrl() string
 
+	// GetLdapConfig retrieves the configured LDAP directory settings.
+	GetLdapConfig() LdapConfig
+
+	// GetRepoChain retrieves the ordered backends of a chained repository, the first holds everything that isn't
+	// a user's credentials.
+	GetRepoChain() []RepoBackend
+
 	// GetTokenSecretKey a shared secret key for signing tokens
 	GetTokenSecretKey() string
 
@@ -95,6 +316,106 @@ type Configuration interface {
 
 	// GetTokenPublicKey retrieves public key used to validate JWT tokens.
 	GetTokenPublicKey() *rsa.PublicKey
+
+	// GetTenants retrieves the configured tenants keyed by id.
+	GetTenants() map[string]Tenant
+
+	// GetTenantSelector retrieves the strategy used to determine which tenant a request is for.
+	GetTenantSelector() TenantSelector
+
+	// GetAuthzNamespaces retrieves the path to the relationship authorization namespace configuration.
+	GetAuthzNamespaces() string
+
+	// GetPolicyPath retrieves the path to the attribute based authorization policy file or directory.
+	GetPolicyPath() string
+
+	// GetPolicyReloadInterval retrieves how often policy files are checked for changes, zero disables reloading.
+	GetPolicyReloadInterval() time.Duration
+
+	// GetAuditSinkType retrieves the configured audit event sink type.
+	GetAuditSinkType() AuditSinkType
+
+	// GetAuditFile retrieves the path of the JSON lines file audit events are appended to.
+	GetAuditFile() string
+
+	// GetWebhookMaxAttempts retrieves how many times a webhook delivery is attempted before it's dead lettered.
+	GetWebhookMaxAttempts() int
+
+	// GetWebhookPollInterval retrieves how often due webhook deliveries are attempted, zero disables delivery.
+	GetWebhookPollInterval() time.Duration
+
+	// GetOutboxPublisherType retrieves the configured type of publisher outbox events are relayed to.
+	GetOutboxPublisherType() OutboxPublisherType
+
+	// GetOutboxTarget retrieves the file path or URL outbox events are published to.
+	GetOutboxTarget() string
+
+	// GetOutboxPollInterval retrieves how often outbox events are relayed, zero disables the relay.
+	GetOutboxPollInterval() time.Duration
+
+	// GetOutboxMaxAttempts retrieves how many times publishing an outbox event is attempted before it's marked dead.
+	GetOutboxMaxAttempts() int
+
+	// GetOidcProviders retrieves the path to the configuration of upstream OpenID Connect providers users can log
+	// in with.
+	GetOidcProviders() string
+
+	// GetSamlConfig retrieves the path to the SAML service provider configuration, naming the identity providers
+	// users can log in with.
+	GetSamlConfig() string
+
+	// GetForwardAuthLoginUrl retrieves the URL browsers failing forward authentication are redirected to log in at,
+	// empty when they're refused like any other client.
+	GetForwardAuthLoginUrl() string
+
+	// GetForwardAuthRedirectHosts retrieves the hosts browsers sent to log in by forward authentication may be
+	// returned to afterwards.
+	GetForwardAuthRedirectHosts() []string
+
+	// GetSessionCleanupInterval retrieves how often expired sessions are deleted, zero disables cleanup.
+	GetSessionCleanupInterval() time.Duration
+
+	// GetGeoIpDatabase retrieves the path to a GeoIP database placing the networks users log in from, empty when
+	// they're placed by IP address prefix.
+	GetGeoIpDatabase() string
+
+	// GetSmtpUrl retrieves the URL of the SMTP server notifications are emailed through, empty when they're logged.
+	GetSmtpUrl() string
+
+	// GetSmtpFrom retrieves the address notifications are emailed from.
+	GetSmtpFrom() string
+
+	// GetTraceExporterType retrieves the configured type of exporter trace spans are sent to.
+	GetTraceExporterType() TraceExporterType
+
+	// GetTraceEndpoint retrieves the URL of the OTLP/HTTP collector spans are sent to, empty when the standard
+	// OpenTelemetry environment variables decide.
+	GetTraceEndpoint() string
+
+	// GetLogLevel retrieves the minimum level of messages logged.
+	GetLogLevel() slog.Level
+
+	// GetShutdownGracePeriod retrieves how long in flight requests and background work are given to finish when the
+	// service is asked to stop.
+	GetShutdownGracePeriod() time.Duration
+
+	// GetShutdownDrainDelay retrieves how long the service keeps serving after it's asked to stop and reports not
+	// ready, so load balancers stop routing to it before it stops accepting connections.
+	GetShutdownDrainDelay() time.Duration
+
+	// GetTlsConfig retrieves the settings TLS is served with.
+	GetTlsConfig() TlsConfig
+
+	// GetIssuer retrieves the URL clients reach the service at, which it's advertised by in its authorization server
+	// metadata, empty when the metadata isn't published.
+	GetIssuer() string
+
+	// GetTrustedProxies retrieves the networks of the proxies whose X-Forwarded-Proto and X-Forwarded-For
+	// headers are believed.
+	GetTrustedProxies() []*net.IPNet
+
+	// GetDpopWindow retrieves how long before or after it's verified a DPoP proof may have been issued.
+	GetDpopWindow() time.Duration
 }
 
 type configuration struct {
@@ -103,10 +424,42 @@ type configuration struct {
 	timeout     time.Duration
 	port        int
 	pgUrl       string
+	ldap        LdapConfig
+	repoChain   []RepoBackend
 	initDataset string
 	secretKey   string
 	privateKey  *rsa.PrivateKey
 	publicKey   *rsa.PublicKey
+	tenants     map[string]Tenant
+	selector    TenantSelector
+	authzNs     string
+	policyPath  string
+	policyRl    time.Duration
+	auditSink   AuditSinkType
+	auditFile   string
+	hookMax     int
+	hookPoll    time.Duration
+	outboxPub   OutboxPublisherType
+	outboxTgt   string
+	outboxPoll  time.Duration
+	outboxMax   int
+	oidcPath    string
+	samlPath    string
+	fwdLogin    string
+	fwdHosts    []string
+	sessClean   time.Duration
+	geoIpPath   string
+	smtpUrl     string
+	smtpFrom    string
+	traceExp    TraceExporterType
+	traceUrl    string
+	logLevel    slog.Level
+	grace       time.Duration
+	drain       time.Duration
+	tls         TlsConfig
+	issuer      string
+	proxies     []*net.IPNet
+	dpopWindow  time.Duration
 }
 
 func (conf *configuration) GetLifeCycle() LifeCycle {
@@ -129,6 +482,16 @@ func (conf *configuration) GetPgUrl() string {
 	return conf.pgUrl
 }
 
+// GetLdapConfig retrieves the configured LDAP directory settings.
+func (conf *configuration) GetLdapConfig() LdapConfig {
+	return conf.ldap
+}
+
+// GetRepoChain retrieves the ordered backends of a chained repository.
+func (conf *configuration) GetRepoChain() []RepoBackend {
+	return conf.repoChain
+}
+
 func (conf *configuration) GetInitDataSet() string {
 	return conf.initDataset
 }
@@ -148,6 +511,158 @@ func (conf *configuration) GetTokenPublicKey() *rsa.PublicKey {
 	return conf.publicKey
 }
 
+// GetTenants retrieves the configured tenants keyed by id.
+func (conf *configuration) GetTenants() map[string]Tenant {
+	return conf.tenants
+}
+
+// GetTenantSelector retrieves the strategy used to determine which tenant a request is for.
+func (conf *configuration) GetTenantSelector() TenantSelector {
+	return conf.selector
+}
+
+// GetAuthzNamespaces retrieves the path to the relationship authorization namespace configuration.
+func (conf *configuration) GetAuthzNamespaces() string {
+	return conf.authzNs
+}
+
+// GetPolicyPath retrieves the path to the attribute based authorization policy file or directory.
+func (conf *configuration) GetPolicyPath() string {
+	return conf.policyPath
+}
+
+// GetPolicyReloadInterval retrieves how often policy files are checked for changes, zero disables reloading.
+func (conf *configuration) GetPolicyReloadInterval() time.Duration {
+	return conf.policyRl
+}
+
+// GetAuditSinkType retrieves the configured audit event sink type.
+func (conf *configuration) GetAuditSinkType() AuditSinkType {
+	return conf.auditSink
+}
+
+// GetAuditFile retrieves the path of the JSON lines file audit events are appended to.
+func (conf *configuration) GetAuditFile() string {
+	return conf.auditFile
+}
+
+// GetWebhookMaxAttempts retrieves how many times a webhook delivery is attempted before it's dead lettered.
+func (conf *configuration) GetWebhookMaxAttempts() int {
+	return conf.hookMax
+}
+
+// GetWebhookPollInterval retrieves how often due webhook deliveries are attempted, zero disables delivery.
+func (conf *configuration) GetWebhookPollInterval() time.Duration {
+	return conf.hookPoll
+}
+
+// GetOutboxPublisherType retrieves the configured type of publisher outbox events are relayed to.
+func (conf *configuration) GetOutboxPublisherType() OutboxPublisherType {
+	return conf.outboxPub
+}
+
+// GetOutboxTarget retrieves the file path or URL outbox events are published to.
+func (conf *configuration) GetOutboxTarget() string {
+	return conf.outboxTgt
+}
+
+// GetOutboxPollInterval retrieves how often outbox events are relayed, zero disables the relay.
+func (conf *configuration) GetOutboxPollInterval() time.Duration {
+	return conf.outboxPoll
+}
+
+// GetOutboxMaxAttempts retrieves how many times publishing an outbox event is attempted before it's marked dead.
+func (conf *configuration) GetOutboxMaxAttempts() int {
+	return conf.outboxMax
+}
+
+// GetOidcProviders retrieves the path to the configuration of upstream OpenID Connect providers.
+func (conf *configuration) GetOidcProviders() string {
+	return conf.oidcPath
+}
+
+// GetSamlConfig retrieves the path to the SAML service provider configuration.
+func (conf *configuration) GetSamlConfig() string {
+	return conf.samlPath
+}
+
+// GetForwardAuthLoginUrl retrieves the URL browsers failing forward authentication are redirected to log in at.
+func (conf *configuration) GetForwardAuthLoginUrl() string {
+	return conf.fwdLogin
+}
+
+// GetForwardAuthRedirectHosts retrieves the hosts browsers sent to log in by forward authentication may be returned
+// to.
+func (conf *configuration) GetForwardAuthRedirectHosts() []string {
+	return conf.fwdHosts
+}
+
+// GetSessionCleanupInterval retrieves how often expired sessions are deleted, zero disables cleanup.
+func (conf *configuration) GetSessionCleanupInterval() time.Duration {
+	return conf.sessClean
+}
+
+// GetGeoIpDatabase retrieves the path to a GeoIP database placing the networks users log in from.
+func (conf *configuration) GetGeoIpDatabase() string {
+	return conf.geoIpPath
+}
+
+// GetSmtpUrl retrieves the URL of the SMTP server notifications are emailed through.
+func (conf *configuration) GetSmtpUrl() string {
+	return conf.smtpUrl
+}
+
+// GetSmtpFrom retrieves the address notifications are emailed from.
+func (conf *configuration) GetSmtpFrom() string {
+	return conf.smtpFrom
+}
+
+// GetTraceExporterType retrieves the configured type of exporter trace spans are sent to.
+func (conf *configuration) GetTraceExporterType() TraceExporterType {
+	return conf.traceExp
+}
+
+// GetTraceEndpoint retrieves the URL of the OTLP/HTTP collector spans are sent to.
+func (conf *configuration) GetTraceEndpoint() string {
+	return conf.traceUrl
+}
+
+// GetLogLevel retrieves the minimum level of messages logged.
+func (conf *configuration) GetLogLevel() slog.Level {
+	return conf.logLevel
+}
+
+// GetShutdownGracePeriod retrieves how long in flight work is given to finish when the service is asked to stop.
+func (conf *configuration) GetShutdownGracePeriod() time.Duration {
+	return conf.grace
+}
+
+// GetShutdownDrainDelay retrieves how long the service keeps serving after it's asked to stop.
+func (conf *configuration) GetShutdownDrainDelay() time.Duration {
+	return conf.drain
+}
+
+// GetTlsConfig retrieves the settings TLS is served with.
+func (conf *configuration) GetTlsConfig() TlsConfig {
+	return conf.tls
+}
+
+// GetIssuer retrieves the URL clients reach the service at, empty when the metadata isn't published.
+func (conf *configuration) GetIssuer() string {
+	return conf.issuer
+}
+
+// GetTrustedProxies retrieves the networks of the proxies whose X-Forwarded-Proto and X-Forwarded-For headers are
+// believed.
+func (conf *configuration) GetTrustedProxies() []*net.IPNet {
+	return conf.proxies
+}
+
+// GetDpopWindow retrieves how long before or after it's verified a DPoP proof may have been issued.
+func (conf *configuration) GetDpopWindow() time.Duration {
+	return conf.dpopWindow
+}
+
 // GetConfiguration constructs a Configuration based on environment variables.
 func GetConfiguration() (Configuration, error) {
 	var err error
@@ -177,6 +692,10 @@ func GetConfiguration() (Configuration, error) {
 		config.repoType = InMemoryRepo
 	case PostgreSqlRepo.String():
 		config.repoType = PostgreSqlRepo
+	case LdapRepo.String():
+		config.repoType = LdapRepo
+	case ChainedRepo.String():
+		config.repoType = ChainedRepo
 	default:
 		if config.lifeCycle == DevLifeCycle {
 			config.repoType = InMemoryRepo
@@ -217,9 +736,41 @@ func GetConfiguration() (Configuration, error) {
 	}
 
 	config.port = port
+	graceStr := os.Getenv(shutdownGraceKey)
+
+	if graceStr == "" {
+		graceStr = "15"
+	}
+
+	grace, err := strconv.Atoi(graceStr)
+
+	if err != nil || grace < 0 {
+		return nil, errors.New(fmt.Sprintf("Invalid shutdown grace period, set %s environment variable to a number "+
+			"of seconds", shutdownGraceKey))
+	}
+
+	config.grace = time.Duration(grace) * time.Second
+	drainStr := os.Getenv(shutdownDrainKey)
+
+	if drainStr == "" {
+		drainStr = "5"
+	}
+
+	drain, err := strconv.Atoi(drainStr)
+
+	if err != nil || drain < 0 {
+		return nil, errors.New(fmt.Sprintf("Invalid shutdown drain delay, set %s environment variable to a number "+
+			"of seconds", shutdownDrainKey))
+	}
+
+	config.drain = time.Duration(drain) * time.Second
 
 	if config.repoType == PostgreSqlRepo {
 		err = setPostgresqlConfig(&config)
+	} else if config.repoType == LdapRepo {
+		err = setLdapConfig(&config)
+	} else if config.repoType == ChainedRepo {
+		err = setRepoChainConfig(&config)
 	}
 
 	if err != nil {
@@ -246,28 +797,676 @@ func GetConfiguration() (Configuration, error) {
 	} else if secretKey != "" {
 		config.secretKey = secretKey
 	} else {
-		signBytes, err := ioutil.ReadFile(privateKeyPath)
+		config.privateKey, config.publicKey, err = loadRsaKeys(privateKeyPath, publicKeyPath)
+
 		if err != nil {
 			return nil, err
 		}
+	}
+
+	err = setTenantConfig(&config)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, found := config.tenants[config.ldap.TenantId]; config.ldap.Url != "" && !found {
+		return nil, errors.New(fmt.Sprintf("Invalid LDAP tenant %s, set %s environment variable to a configured "+
+			"tenant", config.ldap.TenantId, ldapTenantKey))
+	}
+
+	config.authzNs = os.Getenv(authzNamespaceKey)
+	config.policyPath = os.Getenv(policyPathKey)
+	config.oidcPath = os.Getenv(oidcProvidersKey)
+	config.samlPath = os.Getenv(samlConfigKey)
+	config.fwdLogin = os.Getenv(fwdLoginUrlKey)
+	config.fwdHosts = make([]string, 0)
+
+	for _, host := range strings.Split(os.Getenv(fwdRedirectKey), ",") {
+		if strings.TrimSpace(host) != "" {
+			config.fwdHosts = append(config.fwdHosts, strings.ToLower(strings.TrimSpace(host)))
+		}
+	}
+
+	config.geoIpPath = os.Getenv(geoIpKey)
+	config.smtpUrl = os.Getenv(smtpUrlKey)
+	config.smtpFrom = os.Getenv(smtpFromKey)
+
+	if config.smtpUrl != "" && config.smtpFrom == "" {
+		return nil, errors.New(fmt.Sprintf("Must set %s environment variable along with %s", smtpFromKey,
+			smtpUrlKey))
+	}
+
+	if config.fwdLogin != "" {
+		loginUrl, err := url.Parse(config.fwdLogin)
+
+		if err != nil || (!loginUrl.IsAbs() && !strings.HasPrefix(loginUrl.Path, "/")) {
+			return nil, errors.New(fmt.Sprintf("Invalid forward auth login URL, set %s environment variable to an "+
+				"absolute URL or path", fwdLoginUrlKey))
+		}
+	}
+
+	policyReloadStr := os.Getenv(policyReloadKey)
+
+	if policyReloadStr == "" {
+		policyReloadStr = "5"
+	}
+
+	policyReload, err := strconv.Atoi(policyReloadStr)
+
+	if err != nil || policyReload < 0 {
+		return nil, errors.New(fmt.Sprintf("Invalid policy reload interval, set %s environment variable to a "+
+			"number of seconds", policyReloadKey))
+	}
+
+	config.policyRl = time.Duration(policyReload) * time.Second
+
+	err = setAuditConfig(&config)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = setWebhookConfig(&config)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = setOutboxConfig(&config)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = setSessionConfig(&config)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = setTraceConfig(&config)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = setTlsConfig(&config)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = setProxyConfig(&config)
+
+	if err != nil {
+		return nil, err
+	}
+
+	config.logLevel = config.lifeCycle.LogLevel()
+
+	if logLevelStr := os.Getenv(logLevelKey); logLevelStr != "" {
+		if config.logLevel.UnmarshalText([]byte(logLevelStr)) != nil {
+			return nil, errors.New(fmt.Sprintf("Invalid log level %s, set %s environment variable to one of DEBUG, "+
+				"INFO, WARN or ERROR", logLevelStr, logLevelKey))
+		}
+	}
+
+	return &config, nil
+}
+
+func setTlsConfig(config *configuration) error {
+	config.tls.CertFile = os.Getenv(tlsCertKey)
+	config.tls.KeyFile = os.Getenv(tlsKeyKey)
+	config.tls.ClientCaFile = os.Getenv(tlsClientCaKey)
+
+	if (config.tls.CertFile == "") != (config.tls.KeyFile == "") {
+		return errors.New(fmt.Sprintf("Must set both %s and %s environment variables to serve TLS", tlsCertKey,
+			tlsKeyKey))
+	} else if config.tls.ClientCaFile != "" && config.tls.CertFile == "" {
+		return errors.New(fmt.Sprintf("Must set %s and %s environment variables to verify client certificates",
+			tlsCertKey, tlsKeyKey))
+	}
+
+	switch os.Getenv(tlsMinVersionKey) {
+	case "1.2", "":
+		config.tls.MinVersion = tls.VersionTLS12
+	case "1.3":
+		config.tls.MinVersion = tls.VersionTLS13
+	default:
+		return errors.New(fmt.Sprintf("Invalid minimum TLS version, set %s environment variable to 1.2 or 1.3",
+			tlsMinVersionKey))
+	}
+
+	suites := make(map[string]uint16)
+
+	for _, suite := range tls.CipherSuites() {
+		suites[suite.Name] = suite.ID
+	}
+
+	for _, name := range strings.Split(os.Getenv(tlsCiphersKey), ",") {
+		if strings.TrimSpace(name) == "" {
+			continue
+		}
+
+		id, ok := suites[strings.TrimSpace(name)]
+
+		if !ok {
+			return errors.New(fmt.Sprintf("Invalid cipher suite %s, set %s environment variable to a comma "+
+				"separated list of secure TLS 1.2 cipher suites such as TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256",
+				strings.TrimSpace(name), tlsCiphersKey))
+		}
+
+		config.tls.CipherSuites = append(config.tls.CipherSuites, id)
+	}
+
+	requireStr := os.Getenv(tlsRequireCertKey)
+
+	if requireStr != "" {
+		require, err := strconv.ParseBool(requireStr)
 
-		privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(signBytes)
 		if err != nil {
-			return nil, err
+			return errors.New(fmt.Sprintf("Invalid client certificate setting, set %s environment variable to "+
+				"true or false", tlsRequireCertKey))
+		} else if require && config.tls.ClientCaFile == "" {
+			return errors.New(fmt.Sprintf("Must set %s environment variable to require client certificates",
+				tlsClientCaKey))
 		}
 
-		verifyBytes, err := ioutil.ReadFile(publicKeyPath)
+		config.tls.RequireClientCert = require
+	}
+
+	reloadStr := os.Getenv(tlsReloadKey)
+
+	if reloadStr == "" {
+		reloadStr = "60"
+	}
+
+	reload, err := strconv.Atoi(reloadStr)
+
+	if err != nil || reload < 0 {
+		return errors.New(fmt.Sprintf("Invalid TLS reload interval, set %s environment variable to a number of "+
+			"seconds", tlsReloadKey))
+	}
+
+	config.tls.ReloadInterval = time.Duration(reload) * time.Second
+
+	return nil
+}
+
+// setProxyConfig parses the issuer clients reach the service at, the proxies in front of it, and how fresh DPoP
+// proofs made for its URLs must be.
+func setProxyConfig(config *configuration) error {
+	config.issuer = strings.TrimSuffix(os.Getenv(issuerKey), "/")
+
+	if config.issuer != "" {
+		issuer, err := url.Parse(config.issuer)
+
+		if err != nil || (issuer.Scheme != "https" && issuer.Scheme != "http") || issuer.Host == "" ||
+			issuer.RawQuery != "" || issuer.Fragment != "" {
+			return errors.New(fmt.Sprintf("Invalid issuer, set %s environment variable to an absolute http or https "+
+				"URL without a query or fragment", issuerKey))
+		}
+	}
+
+	config.proxies = make([]*net.IPNet, 0)
+
+	for _, proxy := range strings.Split(os.Getenv(trustedProxiesKey), ",") {
+		proxy = strings.TrimSpace(proxy)
+		cidr := proxy
+
+		if proxy == "" {
+			continue
+		} else if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+			cidr = proxy + "/32"
+		} else if ip != nil {
+			cidr = proxy + "/128"
+		}
+
+		_, network, err := net.ParseCIDR(cidr)
+
 		if err != nil {
-			return nil, err
+			return errors.New(fmt.Sprintf("Invalid trusted proxy %s, set %s environment variable to comma separated "+
+				"IP addresses or CIDR networks", proxy, trustedProxiesKey))
 		}
 
-		publicKey, err := jwt.ParseRSAPublicKeyFromPEM(verifyBytes)
+		config.proxies = append(config.proxies, network)
+	}
+
+	windowStr := os.Getenv(dpopWindowKey)
 
-		config.privateKey = privateKey
-		config.publicKey = publicKey
+	if windowStr == "" {
+		windowStr = "300"
 	}
 
-	return &config, nil
+	window, err := strconv.Atoi(windowStr)
+
+	if err != nil || window <= 0 {
+		return errors.New(fmt.Sprintf("Invalid DPoP window, set %s environment variable to a positive number of "+
+			"seconds", dpopWindowKey))
+	}
+
+	config.dpopWindow = time.Duration(window) * time.Second
+
+	return nil
+}
+
+func setTraceConfig(config *configuration) error {
+	exporterStr := os.Getenv(traceExporterKey)
+	config.traceUrl = os.Getenv(traceEndpointKey)
+
+	switch exporterStr {
+	case NoTraceExporter.String(), "":
+		config.traceExp = NoTraceExporter
+	case StdoutTraceExporter.String():
+		config.traceExp = StdoutTraceExporter
+	case OtlpTraceExporter.String():
+		config.traceExp = OtlpTraceExporter
+	default:
+		return errors.New(fmt.Sprintf("Invalid trace exporter %s, set %s environment variable to one of %s, %s or "+
+			"%s", exporterStr, traceExporterKey, NoTraceExporter, StdoutTraceExporter, OtlpTraceExporter))
+	}
+
+	if config.traceUrl != "" {
+		endpoint, err := url.Parse(config.traceUrl)
+
+		if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+			return errors.New(fmt.Sprintf("Invalid trace endpoint, set %s environment variable to an http or "+
+				"https URL", traceEndpointKey))
+		}
+	}
+
+	return nil
+}
+
+func setOutboxConfig(config *configuration) error {
+	publisherStr := os.Getenv(outboxPubKey)
+	config.outboxTgt = os.Getenv(outboxTargetKey)
+
+	switch publisherStr {
+	case LogOutboxPublisher.String(), "":
+		config.outboxPub = LogOutboxPublisher
+	case FileOutboxPublisher.String():
+		config.outboxPub = FileOutboxPublisher
+	case HttpOutboxPublisher.String():
+		config.outboxPub = HttpOutboxPublisher
+	default:
+		return errors.New(fmt.Sprintf("Invalid outbox publisher %s, set %s environment variable to one of %s, %s "+
+			"or %s", publisherStr, outboxPubKey, LogOutboxPublisher, FileOutboxPublisher, HttpOutboxPublisher))
+	}
+
+	if config.outboxPub != LogOutboxPublisher && strings.TrimSpace(config.outboxTgt) == "" {
+		return errors.New(fmt.Sprintf("No outbox target configured, set %s environment variable", outboxTargetKey))
+	}
+
+	pollStr := os.Getenv(outboxPollKey)
+
+	if pollStr == "" {
+		pollStr = "5"
+	}
+
+	poll, err := strconv.Atoi(pollStr)
+
+	if err != nil || poll < 0 {
+		return errors.New(fmt.Sprintf("Invalid outbox poll interval, set %s environment variable to a number of "+
+			"seconds", outboxPollKey))
+	}
+
+	config.outboxPoll = time.Duration(poll) * time.Second
+
+	maxAttemptsStr := os.Getenv(outboxMaxKey)
+
+	if maxAttemptsStr == "" {
+		maxAttemptsStr = "8"
+	}
+
+	maxAttempts, err := strconv.Atoi(maxAttemptsStr)
+
+	if err != nil || maxAttempts < 1 {
+		return errors.New(fmt.Sprintf("Invalid outbox max attempts, set %s environment variable to a positive "+
+			"number", outboxMaxKey))
+	}
+
+	config.outboxMax = maxAttempts
+
+	return nil
+}
+
+func setWebhookConfig(config *configuration) error {
+	maxAttemptsStr := os.Getenv(webhookMaxKey)
+
+	if maxAttemptsStr == "" {
+		maxAttemptsStr = "8"
+	}
+
+	maxAttempts, err := strconv.Atoi(maxAttemptsStr)
+
+	if err != nil || maxAttempts < 1 {
+		return errors.New(fmt.Sprintf("Invalid webhook max attempts, set %s environment variable to a positive "+
+			"number", webhookMaxKey))
+	}
+
+	config.hookMax = maxAttempts
+
+	pollStr := os.Getenv(webhookPollKey)
+
+	if pollStr == "" {
+		pollStr = "5"
+	}
+
+	poll, err := strconv.Atoi(pollStr)
+
+	if err != nil || poll < 0 {
+		return errors.New(fmt.Sprintf("Invalid webhook poll interval, set %s environment variable to a number of "+
+			"seconds", webhookPollKey))
+	}
+
+	config.hookPoll = time.Duration(poll) * time.Second
+
+	return nil
+}
+
+// setSessionConfig applies the service wide session limits to tenants that don't set their own, and reads how often
+// expired sessions are cleaned up.
+func setSessionConfig(config *configuration) error {
+	limits := make(map[string]time.Duration)
+
+	for _, key := range []string{sessionIdleKey, sessionLifeKey, rememberIdleKey, rememberLifeKey} {
+		limit, err := strconv.Atoi(os.Getenv(key))
+
+		if os.Getenv(key) == "" {
+			limit, err = 0, nil
+		}
+
+		if err != nil || limit < 0 {
+			return errors.New(fmt.Sprintf("Invalid session limit, set %s environment variable to a number of "+
+				"seconds", key))
+		}
+
+		limits[key] = seconds(limit)
+	}
+
+	for id, tenant := range config.tenants {
+		if tenant.Policy.SessionIdleTimeout == 0 {
+			tenant.Policy.SessionIdleTimeout = limits[sessionIdleKey]
+		}
+
+		if tenant.Policy.SessionLifetime == 0 {
+			tenant.Policy.SessionLifetime = limits[sessionLifeKey]
+		}
+
+		if tenant.Policy.RememberMeIdleTimeout == 0 {
+			tenant.Policy.RememberMeIdleTimeout = limits[rememberIdleKey]
+		}
+
+		if tenant.Policy.RememberMeLifetime == 0 {
+			tenant.Policy.RememberMeLifetime = limits[rememberLifeKey]
+		}
+
+		config.tenants[id] = tenant
+	}
+
+	cleanupStr := os.Getenv(sessionCleanKey)
+
+	if cleanupStr == "" {
+		cleanupStr = "60"
+	}
+
+	cleanup, err := strconv.Atoi(cleanupStr)
+
+	if err != nil || cleanup < 0 {
+		return errors.New(fmt.Sprintf("Invalid session cleanup interval, set %s environment variable to a number "+
+			"of seconds", sessionCleanKey))
+	}
+
+	config.sessClean = time.Duration(cleanup) * time.Second
+
+	return nil
+}
+
+func setAuditConfig(config *configuration) error {
+	auditSinkStr := os.Getenv(auditSinkKey)
+
+	switch auditSinkStr {
+	case NoAuditSink.String(), "":
+		config.auditSink = NoAuditSink
+	case FileAuditSink.String():
+		config.auditSink = FileAuditSink
+		config.auditFile = os.Getenv(auditFileKey)
+
+		if strings.TrimSpace(config.auditFile) == "" {
+			return errors.New(fmt.Sprintf("No audit file configured, set %s environment variable", auditFileKey))
+		}
+	case PostgreSqlAuditSink.String():
+		config.auditSink = PostgreSqlAuditSink
+
+		if config.repoType != PostgreSqlRepo {
+			return setPostgresqlConfig(config)
+		}
+	default:
+		return errors.New(fmt.Sprintf("Invalid audit sink %s, set %s environment variable to one of %s, %s or %s",
+			auditSinkStr, auditSinkKey, NoAuditSink, FileAuditSink, PostgreSqlAuditSink))
+	}
+
+	return nil
+}
+
+func setTenantConfig(config *configuration) error {
+	var err error
+
+	config.tenants, err = loadTenants(os.Getenv(tenantsKey))
+
+	if err != nil {
+		return err
+	}
+
+	for _, token := range strings.Split(os.Getenv(serviceTokensKey), ",") {
+		tenant, ok := config.tenants[DefaultTenantId]
+
+		if strings.TrimSpace(token) == "" {
+			continue
+		} else if !ok {
+			return errors.New(fmt.Sprintf("%s only applies to the %s tenant, give other tenants serviceTokens in "+
+				"%s", serviceTokensKey, DefaultTenantId, tenantsKey))
+		}
+
+		tenant.ServiceTokens = append(tenant.ServiceTokens, strings.TrimSpace(token))
+		config.tenants[DefaultTenantId] = tenant
+	}
+
+	if err = checkServiceTokens(config.tenants); err != nil {
+		return err
+	}
+
+	groupsClaimStr := os.Getenv(groupsClaimKey)
+
+	if groupsClaimStr != "" {
+		groupsClaim, err := strconv.ParseBool(groupsClaimStr)
+
+		if err != nil {
+			return errors.New(fmt.Sprintf("Invalid groups claim setting, set %s environment variable to true or "+
+				"false", groupsClaimKey))
+		}
+
+		for id, tenant := range config.tenants {
+			tenant.Policy.GroupsClaim = tenant.Policy.GroupsClaim || groupsClaim
+			config.tenants[id] = tenant
+		}
+	}
+
+	selectorStr := os.Getenv(tenantSelectorKey)
+
+	switch selectorStr {
+	case HeaderTenantSelector.String():
+		config.selector = HeaderTenantSelector
+	case SubdomainTenantSelector.String():
+		config.selector = SubdomainTenantSelector
+	case PathTenantSelector.String():
+		config.selector = PathTenantSelector
+	case "":
+		config.selector = HeaderTenantSelector
+	default:
+		err = errors.New(fmt.Sprintf("Invalid tenant selector %s, set %s environment variable to one of %s, "+
+			"%s or %s", selectorStr, tenantSelectorKey, HeaderTenantSelector, SubdomainTenantSelector,
+			PathTenantSelector))
+	}
+
+	return err
+}
+
+// setRepoChainConfig parses the chain of the form POSTGRESQL:authenticate,signup;LDAP:authenticate,provision, a
+// backend without operations serves authenticate and signup.
+func setRepoChainConfig(config *configuration) error {
+	chainStr := strings.TrimSpace(os.Getenv(repoChainKey))
+
+	if chainStr == "" {
+		return errors.New(fmt.Sprintf("No repo chain configured, set %s environment variable", repoChainKey))
+	}
+
+	config.repoChain = make([]RepoBackend, 0)
+	seen := make(map[UserRepositoryType]bool)
+
+	for _, backendStr := range strings.Split(chainStr, ";") {
+		parts := strings.SplitN(strings.TrimSpace(backendStr), ":", 2)
+		var backend RepoBackend
+
+		switch parts[0] {
+		case InMemoryRepo.String():
+			backend.Type = InMemoryRepo
+		case PostgreSqlRepo.String():
+			backend.Type = PostgreSqlRepo
+		case LdapRepo.String():
+			backend.Type = LdapRepo
+		default:
+			return errors.New(fmt.Sprintf("Invalid repo chain backend %s, set %s environment variable to backends "+
+				"of %s, %s or %s", parts[0], repoChainKey, InMemoryRepo, PostgreSqlRepo, LdapRepo))
+		}
+
+		if seen[backend.Type] {
+			return errors.New(fmt.Sprintf("Invalid repo chain, %s is listed more than once in %s environment "+
+				"variable", backend.Type, repoChainKey))
+		}
+
+		seen[backend.Type] = true
+		operations := []string{AuthenticateOperation, SignupOperation}
+
+		if len(parts) == 2 {
+			operations = strings.Split(parts[1], ",")
+		}
+
+		for _, operation := range operations {
+			switch strings.TrimSpace(operation) {
+			case AuthenticateOperation:
+				backend.Authenticate = true
+			case SignupOperation:
+				backend.Signup = true
+			case ProvisionOperation:
+				backend.Provision = true
+			default:
+				return errors.New(fmt.Sprintf("Invalid repo chain operation %s, set %s environment variable to "+
+					"backends serving %s, %s or %s", operation, repoChainKey, AuthenticateOperation,
+					SignupOperation, ProvisionOperation))
+			}
+		}
+
+		if backend.Provision && !backend.Authenticate {
+			return errors.New(fmt.Sprintf("Invalid repo chain, %s must authenticate users to provision them, set "+
+				"%s environment variable", backend.Type, repoChainKey))
+		}
+
+		config.repoChain = append(config.repoChain, backend)
+	}
+
+	if config.repoChain[0].Type == LdapRepo {
+		return errors.New(fmt.Sprintf("Invalid repo chain, the first backend must be %s or %s, set %s environment "+
+			"variable", InMemoryRepo, PostgreSqlRepo, repoChainKey))
+	} else if config.repoChain[0].Provision {
+		return errors.New(fmt.Sprintf("Invalid repo chain, users can't be provisioned from the first backend, set "+
+			"%s environment variable", repoChainKey))
+	}
+
+	if seen[PostgreSqlRepo] {
+		err := setPostgresqlConfig(config)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if seen[LdapRepo] {
+		return setLdapConfig(config)
+	}
+
+	return nil
+}
+
+func setLdapConfig(config *configuration) error {
+	config.ldap = LdapConfig{
+		Url:            os.Getenv(ldapUrlKey),
+		BaseDn:         os.Getenv(ldapBaseDnKey),
+		BindDn:         os.Getenv(ldapBindDnKey),
+		BindPassword:   os.Getenv(ldapBindPassKey),
+		UserFilter:     os.Getenv(ldapFilterKey),
+		IdAttribute:    os.Getenv(ldapIdAttrKey),
+		EmailAttribute: os.Getenv(ldapEmailAttrKey),
+		TenantId:       os.Getenv(ldapTenantKey),
+	}
+
+	if !strings.HasPrefix(config.ldap.Url, "ldap://") && !strings.HasPrefix(config.ldap.Url, "ldaps://") {
+		return errors.New(fmt.Sprintf("No LDAP url configured, set %s environment variable to an ldap:// or "+
+			"ldaps:// url", ldapUrlKey))
+	}
+
+	if strings.TrimSpace(config.ldap.BaseDn) == "" {
+		return errors.New(fmt.Sprintf("No LDAP base DN configured, set %s environment variable", ldapBaseDnKey))
+	}
+
+	if config.ldap.UserFilter == "" {
+		config.ldap.UserFilter = "(&(objectClass=person)(mail=%s))"
+	} else if strings.Count(config.ldap.UserFilter, "%s") != 1 {
+		return errors.New(fmt.Sprintf("Invalid LDAP user filter, set %s environment variable to a filter with "+
+			"one %%s", ldapFilterKey))
+	}
+
+	if config.ldap.IdAttribute == "" {
+		config.ldap.IdAttribute = "entryUUID"
+	}
+
+	if config.ldap.EmailAttribute == "" {
+		config.ldap.EmailAttribute = "mail"
+	}
+
+	if config.ldap.TenantId == "" {
+		config.ldap.TenantId = DefaultTenantId
+	}
+
+	signupStr := os.Getenv(ldapSignupKey)
+
+	if signupStr != "" {
+		signup, err := strconv.ParseBool(signupStr)
+
+		if err != nil {
+			return errors.New(fmt.Sprintf("Invalid LDAP signup setting, set %s environment variable to true or "+
+				"false", ldapSignupKey))
+		}
+
+		config.ldap.AllowSignup = signup
+	}
+
+	localRepoStr := os.Getenv(ldapLocalRepoKey)
+
+	switch localRepoStr {
+	case InMemoryRepo.String(), "":
+		config.ldap.LocalRepoType = InMemoryRepo
+	case PostgreSqlRepo.String():
+		config.ldap.LocalRepoType = PostgreSqlRepo
+		return setPostgresqlConfig(config)
+	default:
+		return errors.New(fmt.Sprintf("Invalid LDAP local repo type %s, set %s environment variable to one of %s "+
+			"or %s", localRepoStr, ldapLocalRepoKey, InMemoryRepo, PostgreSqlRepo))
+	}
+
+	return nil
 }
 
 func setPostgresqlConfig(config *configuration) error {
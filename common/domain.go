@@ -1,6 +1,158 @@
 package common
 
+import (
+	"encoding/json"
+	"time"
+)
+
 // User holds information on a user.
 type User struct {
 	Email string `json:"email"`
 }
+
+// UserAccount holds the administrable details of a user. Email is the user's login name, and attributes are further
+// details such as the user's region that authorization policies can refer to.
+type UserAccount struct {
+	Id          string            `json:"id"`
+	TenantId    string            `json:"tenantId"`
+	Email       string            `json:"email"`
+	ExternalId  string            `json:"externalId,omitempty"`
+	GivenName   string            `json:"givenName,omitempty"`
+	FamilyName  string            `json:"familyName,omitempty"`
+	DisplayName string            `json:"displayName,omitempty"`
+	Active      bool              `json:"active"`
+	Attributes  map[string]string `json:"attributes,omitempty"`
+	CreatedAt   time.Time         `json:"createdAt"`
+	UpdatedAt   time.Time         `json:"updatedAt"`
+}
+
+// Group holds information on a named collection of users and other groups within a tenant.
+type Group struct {
+	Id          string    `json:"id"`
+	TenantId    string    `json:"tenantId"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// GroupMembers holds the direct members of a group.
+type GroupMembers struct {
+	UserIds  []string `json:"userIds"`
+	GroupIds []string `json:"groupIds"`
+}
+
+// Tuple holds a relationship between an object and a subject, written object#relation@subject. Objects are named
+// namespace:id, subjects are either a user id or a userset written namespace:id#relation.
+type Tuple struct {
+	Object   string `json:"object"`
+	Relation string `json:"relation"`
+	Subject  string `json:"subject"`
+}
+
+func (t Tuple) String() string {
+	return t.Object + "#" + t.Relation + "@" + t.Subject
+}
+
+// Session records a login of a user, so they can see where they're logged in and revoke it. Tokens issued for a
+// session are only accepted while it exists.
+type Session struct {
+	Id          string    `json:"id"`
+	TenantId    string    `json:"tenantId"`
+	UserId      string    `json:"userId"`
+	RemoteAddr  string    `json:"remoteAddr"`
+	UserAgent   string    `json:"userAgent"`
+	DeviceLabel string    `json:"deviceLabel"`
+	RememberMe  bool      `json:"rememberMe"`
+	CreatedAt   time.Time `json:"createdAt"`
+	LastSeenAt  time.Time `json:"lastSeenAt"`
+	// IdleTimeout is how long the session may go unused before it expires, zero for no limit.
+	IdleTimeout time.Duration `json:"-"`
+	// ExpiresAt is when the session expires however often it's used, zero for no limit.
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Expired reports whether the session went unused for longer than its idle timeout or outlived its lifetime.
+func (s Session) Expired(now time.Time) bool {
+	return (s.IdleTimeout > 0 && !now.Before(s.LastSeenAt.Add(s.IdleTimeout))) ||
+		(!s.ExpiresAt.IsZero() && !now.Before(s.ExpiresAt))
+}
+
+// Device is a device a user has logged in from, identified by a fingerprint of its user agent family and network.
+type Device struct {
+	TenantId    string    `json:"tenantId"`
+	UserId      string    `json:"userId"`
+	Fingerprint string    `json:"fingerprint"`
+	Label       string    `json:"label"`
+	Network     string    `json:"network"`
+	FirstSeenAt time.Time `json:"firstSeenAt"`
+	LastSeenAt  time.Time `json:"lastSeenAt"`
+}
+
+// Webhook holds a subscription delivering account lifecycle events of a tenant to a URL. Events lists the event types
+// delivered, * subscribes to every event.
+type Webhook struct {
+	Id        string    `json:"id"`
+	TenantId  string    `json:"tenantId"`
+	Url       string    `json:"url"`
+	Secret    string    `json:"-"`
+	Events    []string  `json:"events"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Subscribes reports whether the webhook delivers events of the given type.
+func (w Webhook) Subscribes(eventType string) bool {
+	for _, event := range w.Events {
+		if event == eventType || event == "*" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// DeliveryStatus represents the state of a webhook delivery.
+type DeliveryStatus string
+
+const (
+	// PendingDelivery represents a delivery waiting for its next attempt.
+	PendingDelivery DeliveryStatus = "pending"
+	// DeliveredDelivery represents a delivery the webhook acknowledged.
+	DeliveredDelivery DeliveryStatus = "delivered"
+	// DeadDelivery represents a delivery that failed every attempt and is only retried when replayed.
+	DeadDelivery DeliveryStatus = "dead"
+)
+
+// WebhookDelivery holds an event queued for delivery to a webhook and the attempts made so far.
+type WebhookDelivery struct {
+	Id            string          `json:"id"`
+	TenantId      string          `json:"tenantId"`
+	WebhookId     string          `json:"webhookId"`
+	EventType     string          `json:"eventType"`
+	Payload       json.RawMessage `json:"payload"`
+	Status        DeliveryStatus  `json:"status"`
+	Attempts      int             `json:"attempts"`
+	LastError     string          `json:"lastError,omitempty"`
+	NextAttemptAt time.Time       `json:"nextAttemptAt"`
+	CreatedAt     time.Time       `json:"createdAt"`
+	UpdatedAt     time.Time       `json:"updatedAt"`
+}
+
+const (
+	// UserCreatedEvent is the type of event recorded when a user signs up or is provisioned.
+	UserCreatedEvent = "user.created"
+	// UserDeletedEvent is the type of event recorded when a user is deleted.
+	UserDeletedEvent = "user.deleted"
+)
+
+// OutboxEvent holds a domain event recorded in the same transaction as the change it describes, waiting to be
+// published. Its id doubles as the idempotency key consumers use to discard redeliveries.
+type OutboxEvent struct {
+	Id          string          `json:"id"`
+	TenantId    string          `json:"tenantId"`
+	AggregateId string          `json:"aggregateId"`
+	Type        string          `json:"type"`
+	Payload     json.RawMessage `json:"payload"`
+	Attempts    int             `json:"attempts"`
+	CreatedAt   time.Time       `json:"createdAt"`
+}
@@ -0,0 +1,260 @@
+package common
+
+import (
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// DefaultTenantId is the id of the tenant used when no tenants are configured.
+const DefaultTenantId = "default"
+
+// TenantSelector represents a strategy for determining which tenant a request is for.
+type TenantSelector int
+
+const (
+	// HeaderTenantSelector selects the tenant from the X-Tenant-ID request header.
+	HeaderTenantSelector TenantSelector = 0
+	// SubdomainTenantSelector selects the tenant by matching the request host against each tenant's domain.
+	SubdomainTenantSelector TenantSelector = iota
+	// PathTenantSelector selects the tenant from a /tenant/{tenantId} path prefix.
+	PathTenantSelector TenantSelector = iota
+)
+
+func (ts TenantSelector) String() string {
+	switch ts {
+	case HeaderTenantSelector:
+		return "HEADER"
+	case SubdomainTenantSelector:
+		return "SUBDOMAIN"
+	case PathTenantSelector:
+		return "PATH"
+	default:
+		return ""
+	}
+}
+
+// TenantPolicy holds the per tenant rules applied to users of a tenant.
+type TenantPolicy struct {
+	// AllowSignup controls whether new users may register themselves.
+	AllowSignup bool `json:"allowSignup"`
+	// MinPasswordLength is the minimum number of characters required for a new password.
+	MinPasswordLength int `json:"minPasswordLength"`
+	// GroupsClaim controls whether issued tokens carry a groups claim listing the user's group names.
+	GroupsClaim bool `json:"groupsClaim"`
+	// NewDeviceAlerts controls whether users are emailed when they log in from a device they haven't used before.
+	NewDeviceAlerts bool `json:"newDeviceAlerts"`
+	// NewDeviceStepUp controls whether logins from a new device must be confirmed with a code emailed to the user.
+	NewDeviceStepUp bool `json:"newDeviceStepUp"`
+	// CookieSessions controls whether new sessions are kept in an HttpOnly cookie instead of returned to the client.
+	CookieSessions bool `json:"cookieSessions"`
+	// TokenLifetime is how long issued tokens remain valid.
+	TokenLifetime time.Duration `json:"-"`
+	// SessionIdleTimeout is how long a session may go unused before it expires, zero for no limit.
+	SessionIdleTimeout time.Duration `json:"-"`
+	// SessionLifetime is how long a session lasts however often it's used, zero for no limit.
+	SessionLifetime time.Duration `json:"-"`
+	// RememberMeIdleTimeout replaces SessionIdleTimeout for sessions the user asked to be remembered.
+	RememberMeIdleTimeout time.Duration `json:"-"`
+	// RememberMeLifetime replaces SessionLifetime for sessions the user asked to be remembered.
+	RememberMeLifetime time.Duration `json:"-"`
+}
+
+// SessionLimits returns the idle timeout and lifetime of a new session, zero for no limit. Sessions the user asked to
+// be remembered have the remember me limits when they're set.
+func (p TenantPolicy) SessionLimits(rememberMe bool) (time.Duration, time.Duration) {
+	idle, lifetime := p.SessionIdleTimeout, p.SessionLifetime
+
+	if rememberMe && p.RememberMeIdleTimeout > 0 {
+		idle = p.RememberMeIdleTimeout
+	}
+
+	if rememberMe && p.RememberMeLifetime > 0 {
+		lifetime = p.RememberMeLifetime
+	}
+
+	return idle, lifetime
+}
+
+// Tenant represents an organization with its own user namespace, signing keys and policy.
+type Tenant struct {
+	Id     string       `json:"id"`
+	Name   string       `json:"name"`
+	Domain string       `json:"domain"`
+	Policy TenantPolicy `json:"policy"`
+
+	// SecretKey is a shared secret for signing this tenant's tokens, overrides the service wide keys.
+	SecretKey string `json:"-"`
+	// PrivateKey is the RSA key for signing this tenant's tokens, overrides the service wide keys.
+	PrivateKey *rsa.PrivateKey `json:"-"`
+	// PublicKey is the RSA key for validating this tenant's tokens, overrides the service wide keys.
+	PublicKey *rsa.PublicKey `json:"-"`
+	// ServiceTokens are the static bearer tokens trusted services and administrators manage this tenant with.
+	ServiceTokens []string `json:"-"`
+}
+
+type tenantFile struct {
+	Id                   string       `json:"id"`
+	Name                 string       `json:"name"`
+	Domain               string       `json:"domain"`
+	TokenSecret          string       `json:"tokenSecret"`
+	TokenPrivateKeyPath  string       `json:"tokenPrivateKeyPath"`
+	TokenPublicKeyPath   string       `json:"tokenPublicKeyPath"`
+	TokenLifetimeSeconds int          `json:"tokenLifetimeSeconds"`
+	SessionIdleSeconds   int          `json:"sessionIdleSeconds"`
+	SessionLifeSeconds   int          `json:"sessionLifetimeSeconds"`
+	RememberIdleSeconds  int          `json:"rememberMeIdleSeconds"`
+	RememberLifeSeconds  int          `json:"rememberMeLifetimeSeconds"`
+	ServiceTokens        []string     `json:"serviceTokens"`
+	Policy               TenantPolicy `json:"policy"`
+}
+
+// NewDefaultTenant constructs the tenant used when no tenants are configured.
+func NewDefaultTenant() Tenant {
+	return Tenant{
+		Id:            DefaultTenantId,
+		Name:          DefaultTenantId,
+		Policy:        defaultTenantPolicy(),
+		ServiceTokens: make([]string, 0),
+	}
+}
+
+func defaultTenantPolicy() TenantPolicy {
+	return TenantPolicy{AllowSignup: true, MinPasswordLength: 1, TokenLifetime: time.Hour}
+}
+
+func loadTenants(path string) (map[string]Tenant, error) {
+	tenants := make(map[string]Tenant)
+
+	if path == "" {
+		tenants[DefaultTenantId] = NewDefaultTenant()
+		return tenants, nil
+	}
+
+	jsonBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]tenantFile, 0)
+	err = json.Unmarshal(jsonBytes, &files)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, tf := range files {
+		if strings.TrimSpace(tf.Id) == "" {
+			return nil, errors.New("tenant id is required")
+		}
+
+		if _, ok := tenants[tf.Id]; ok {
+			return nil, errors.New(fmt.Sprintf("duplicate tenant id %s", tf.Id))
+		}
+
+		tenant := Tenant{
+			Id:            tf.Id,
+			Name:          tf.Name,
+			Domain:        strings.ToLower(tf.Domain),
+			Policy:        tf.Policy,
+			SecretKey:     tf.TokenSecret,
+			ServiceTokens: make([]string, 0),
+		}
+
+		for _, token := range tf.ServiceTokens {
+			if strings.TrimSpace(token) == "" {
+				return nil, errors.New(fmt.Sprintf("tenant %s has an empty service token", tf.Id))
+			}
+
+			tenant.ServiceTokens = append(tenant.ServiceTokens, token)
+		}
+
+		if tf.TokenLifetimeSeconds > 0 {
+			tenant.Policy.TokenLifetime = time.Duration(tf.TokenLifetimeSeconds) * time.Second
+		} else {
+			tenant.Policy.TokenLifetime = time.Hour
+		}
+
+		tenant.Policy.SessionIdleTimeout = seconds(tf.SessionIdleSeconds)
+		tenant.Policy.SessionLifetime = seconds(tf.SessionLifeSeconds)
+		tenant.Policy.RememberMeIdleTimeout = seconds(tf.RememberIdleSeconds)
+		tenant.Policy.RememberMeLifetime = seconds(tf.RememberLifeSeconds)
+
+		if tenant.Policy.MinPasswordLength < 1 {
+			tenant.Policy.MinPasswordLength = 1
+		}
+
+		if (tf.TokenPrivateKeyPath == "") != (tf.TokenPublicKeyPath == "") {
+			return nil, errors.New(fmt.Sprintf("tenant %s must set both tokenPrivateKeyPath and "+
+				"tokenPublicKeyPath", tf.Id))
+		} else if tf.TokenPrivateKeyPath != "" {
+			tenant.PrivateKey, tenant.PublicKey, err = loadRsaKeys(tf.TokenPrivateKeyPath, tf.TokenPublicKeyPath)
+
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		tenants[tenant.Id] = tenant
+	}
+
+	if len(tenants) == 0 {
+		return nil, errors.New("at least one tenant must be configured")
+	}
+
+	return tenants, checkServiceTokens(tenants)
+}
+
+// checkServiceTokens ensures no service token is shared between tenants, as it could manage each of them.
+func checkServiceTokens(tenants map[string]Tenant) error {
+	owners := make(map[string]string)
+
+	for _, tenant := range tenants {
+		for _, token := range tenant.ServiceTokens {
+			if owner, ok := owners[token]; ok && owner != tenant.Id {
+				return errors.New(fmt.Sprintf("tenants %s and %s share a service token", owner, tenant.Id))
+			}
+
+			owners[token] = tenant.Id
+		}
+	}
+
+	return nil
+}
+
+// seconds converts a positive number of seconds to a duration, anything else to zero.
+func seconds(value int) time.Duration {
+	if value <= 0 {
+		return 0
+	}
+
+	return time.Duration(value) * time.Second
+}
+
+func loadRsaKeys(privateKeyPath, publicKeyPath string) (*rsa.PrivateKey, *rsa.PublicKey, error) {
+	signBytes, err := ioutil.ReadFile(privateKeyPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(signBytes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	verifyBytes, err := ioutil.ReadFile(publicKeyPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	publicKey, err := jwt.ParseRSAPublicKeyFromPEM(verifyBytes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return privateKey, publicKey, nil
+}
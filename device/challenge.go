@@ -0,0 +1,133 @@
+package device
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/stone1549/auth-service/common"
+	"math/big"
+	"sync"
+	"time"
+)
+
+const (
+	// ChallengeTimeout is how long a user has to enter the code sent to them.
+	ChallengeTimeout = 10 * time.Minute
+	// MaxChallengeAttempts is how many wrong codes are accepted before a challenge is abandoned.
+	MaxChallengeAttempts = 5
+	// maxPendingChallenges caps the challenges awaiting their code, the oldest are forgotten first.
+	maxPendingChallenges = 10000
+)
+
+// Challenge is a login from a new device that's held until the user enters the code sent to them.
+type Challenge struct {
+	Email      string
+	Device     common.Device
+	RememberMe bool
+}
+
+type pendingChallenge struct {
+	Challenge
+	code     string
+	attempts int
+	expires  time.Time
+}
+
+// Challenges holds the step up challenges awaiting their code.
+type Challenges struct {
+	mutex   sync.Mutex
+	pending map[string]*pendingChallenge
+	order   []string
+}
+
+// NewChallenges constructs an empty set of challenges.
+func NewChallenges() *Challenges {
+	return &Challenges{pending: make(map[string]*pendingChallenge)}
+}
+
+// Begin holds a login until it's completed with the returned code, returning the challenge's id and code.
+func (c *Challenges) Begin(challenge Challenge) (string, string, error) {
+	id := make([]byte, 32)
+
+	if _, err := rand.Read(id); err != nil {
+		return "", "", err
+	}
+
+	number, err := rand.Int(rand.Reader, big.NewInt(1000000))
+
+	if err != nil {
+		return "", "", err
+	}
+
+	challengeId := base64.RawURLEncoding.EncodeToString(id)
+	code := fmt.Sprintf("%06d", number.Int64())
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.forgetExpired(time.Now())
+
+	if len(c.order) >= maxPendingChallenges {
+		c.forget(len(c.order) - maxPendingChallenges + 1)
+	}
+
+	c.pending[challengeId] = &pendingChallenge{Challenge: challenge, code: code,
+		expires: time.Now().Add(ChallengeTimeout)}
+	c.order = append(c.order, challengeId)
+
+	return challengeId, code, nil
+}
+
+// Complete returns the login held by a challenge of the tenant when the code is right. Challenges can only be
+// completed once, and are abandoned after too many wrong codes.
+func (c *Challenges) Complete(tenantId, challengeId, code string) (Challenge, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	pending, ok := c.pending[challengeId]
+
+	if !ok || pending.Device.TenantId != tenantId || !time.Now().Before(pending.expires) {
+		return Challenge{}, errors.New("challenge not found or expired")
+	}
+
+	if subtle.ConstantTimeCompare([]byte(pending.code), []byte(code)) != 1 {
+		pending.attempts++
+
+		if pending.attempts >= MaxChallengeAttempts {
+			delete(c.pending, challengeId)
+		}
+
+		return Challenge{}, errors.New("invalid code")
+	}
+
+	delete(c.pending, challengeId)
+
+	return pending.Challenge, nil
+}
+
+// forgetExpired drops the oldest challenges while they've expired, along with those already completed.
+func (c *Challenges) forgetExpired(now time.Time) {
+	count := 0
+
+	for _, id := range c.order {
+		pending, ok := c.pending[id]
+
+		if ok && now.Before(pending.expires) {
+			break
+		}
+
+		count++
+	}
+
+	c.forget(count)
+}
+
+func (c *Challenges) forget(count int) {
+	for _, id := range c.order[:count] {
+		delete(c.pending, id)
+	}
+
+	c.order = append([]string{}, c.order[count:]...)
+}
@@ -0,0 +1,133 @@
+package device
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/oschwald/maxminddb-golang"
+	"github.com/stone1549/auth-service/common"
+	"net"
+	"strings"
+)
+
+// geoRecord is the part of a GeoIP country, city or ASN database record used to tell networks apart.
+type geoRecord struct {
+	Country struct {
+		IsoCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	AutonomousSystemNumber uint `maxminddb:"autonomous_system_number"`
+}
+
+// Detector fingerprints the devices users log in from, and holds the step up challenges of logins from new ones.
+type Detector struct {
+	geoIp      *maxminddb.Reader
+	Challenges *Challenges
+}
+
+// NewDetector constructs a Detector placing clients by the country and autonomous system found in the GeoIP
+// database at geoIpPath, or by their IP address prefix when the path is empty.
+func NewDetector(geoIpPath string) (*Detector, error) {
+	detector := &Detector{Challenges: NewChallenges()}
+
+	if geoIpPath == "" {
+		return detector, nil
+	}
+
+	reader, err := maxminddb.Open(geoIpPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	detector.geoIp = reader
+	return detector, nil
+}
+
+// Fingerprint identifies the device a user logged in with by the family of its user agent and the network it's on.
+// The fingerprint is left for the caller to compare against the user's known devices.
+func (d *Detector) Fingerprint(tenantId, userId, remoteAddr, userAgent string) common.Device {
+	label := Label(userAgent)
+	network := d.Network(remoteAddr)
+	sum := sha256.Sum256([]byte(label + "\n" + network))
+
+	return common.Device{
+		TenantId:    tenantId,
+		UserId:      userId,
+		Fingerprint: hex.EncodeToString(sum[:16]),
+		Label:       label,
+		Network:     network,
+	}
+}
+
+// Network places an IP address by its country and autonomous system when a GeoIP database is configured and knows
+// it, or else by its /24 IPv4 or /48 IPv6 prefix.
+func (d *Detector) Network(remoteAddr string) string {
+	ip := net.ParseIP(remoteAddr)
+
+	if ip == nil {
+		return "unknown"
+	}
+
+	if d.geoIp != nil {
+		var record geoRecord
+
+		if err := d.geoIp.Lookup(ip, &record); err == nil {
+			var parts []string
+
+			if record.Country.IsoCode != "" {
+				parts = append(parts, record.Country.IsoCode)
+			}
+
+			if record.AutonomousSystemNumber != 0 {
+				parts = append(parts, fmt.Sprintf("AS%d", record.AutonomousSystemNumber))
+			}
+
+			if len(parts) > 0 {
+				return strings.Join(parts, " ")
+			}
+		}
+	}
+
+	if ipv4 := ip.To4(); ipv4 != nil {
+		return (&net.IPNet{IP: ipv4.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}).String()
+	}
+
+	return (&net.IPNet{IP: ip.Mask(net.CIDRMask(48, 128)), Mask: net.CIDRMask(48, 128)}).String()
+}
+
+// Close releases the GeoIP database.
+func (d *Detector) Close() error {
+	if d.geoIp == nil {
+		return nil
+	}
+
+	return d.geoIp.Close()
+}
+
+// Label describes the browser and operating system of a user agent, such as "Firefox on Windows".
+func Label(userAgent string) string {
+	browser := firstMatch(userAgent, [][2]string{{"Edg/", "Edge"}, {"OPR/", "Opera"}, {"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"}, {"Safari/", "Safari"}, {"curl/", "curl"}})
+	os := firstMatch(userAgent, [][2]string{{"Windows", "Windows"}, {"iPhone", "iOS"}, {"iPad", "iPadOS"},
+		{"Android", "Android"}, {"Mac OS X", "macOS"}, {"CrOS", "ChromeOS"}, {"Linux", "Linux"}})
+
+	if browser == "" {
+		browser = "Unknown browser"
+	}
+
+	if os == "" {
+		return browser
+	}
+
+	return browser + " on " + os
+}
+
+func firstMatch(userAgent string, markers [][2]string) string {
+	for _, marker := range markers {
+		if strings.Contains(userAgent, marker[0]) {
+			return marker[1]
+		}
+	}
+
+	return ""
+}
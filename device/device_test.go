@@ -0,0 +1,105 @@
+package device_test
+
+import (
+	"fmt"
+	"github.com/stone1549/auth-service/common"
+	"github.com/stone1549/auth-service/device"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+// ok fails the test if an err is not nil.
+func ok(tb testing.TB, err error) {
+	if err != nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: unexpected error: %s\033[39m\n\n", filepath.Base(file), line, err.Error())
+		tb.FailNow()
+	}
+}
+
+// notOk fails the test if an err is nil.
+func notOk(tb testing.TB, err error) {
+	if err == nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: unexpected lack of error: \033[39m\n\n", filepath.Base(file), line)
+		tb.FailNow()
+	}
+}
+
+// equals fails the test if exp is not equal to act.
+func equals(tb testing.TB, exp, act interface{}) {
+	if !reflect.DeepEqual(exp, act) {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d:\n\n\texp: %#v\n\n\tgot: %#v\033[39m\n\n", filepath.Base(file), line, exp, act)
+		tb.FailNow()
+	}
+}
+
+const firefoxOnWindows = "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:60.0) Gecko/20100101 Firefox/60.0"
+
+// TestLabel ensures user agents are described by their browser and operating system.
+func TestLabel(t *testing.T) {
+	equals(t, "Firefox on Windows", device.Label(firefoxOnWindows))
+	equals(t, "Chrome on Android", device.Label("Mozilla/5.0 (Linux; Android 8.0.0) AppleWebKit/537.36 "+
+		"(KHTML, like Gecko) Chrome/67.0.3396.87 Mobile Safari/537.36"))
+	equals(t, "curl", device.Label("curl/7.58.0"))
+	equals(t, "Unknown browser", device.Label(""))
+}
+
+// TestDetector_Fingerprint ensures devices are told apart by their network prefix without a GeoIP database, and that
+// addresses in the same network share a fingerprint.
+func TestDetector_Fingerprint(t *testing.T) {
+	detector, err := device.NewDetector("")
+	ok(t, err)
+	defer detector.Close()
+
+	equals(t, "203.0.113.0/24", detector.Network("203.0.113.7"))
+	equals(t, "2001:db8:1::/48", detector.Network("2001:db8:1:2::1"))
+	equals(t, "unknown", detector.Network("not an ip"))
+
+	seen := detector.Fingerprint("acme", "1", "203.0.113.7", firefoxOnWindows)
+	equals(t, "Firefox on Windows", seen.Label)
+	equals(t, "acme", seen.TenantId)
+	equals(t, "1", seen.UserId)
+	equals(t, seen.Fingerprint, detector.Fingerprint("acme", "1", "203.0.113.200", firefoxOnWindows).Fingerprint)
+
+	if seen.Fingerprint == detector.Fingerprint("acme", "1", "198.51.100.7", firefoxOnWindows).Fingerprint {
+		t.Fatal("devices on different networks share a fingerprint")
+	}
+}
+
+// TestChallenges ensures a challenge is completed once with its code, only within its tenant, and is abandoned after
+// too many wrong codes.
+func TestChallenges(t *testing.T) {
+	challenges := device.NewChallenges()
+	challenge := device.Challenge{Email: "jane@example.com", RememberMe: true,
+		Device: common.Device{TenantId: "acme", UserId: "1", Fingerprint: "abc"}}
+
+	id, code, err := challenges.Begin(challenge)
+	ok(t, err)
+	equals(t, 6, len(code))
+
+	_, err = challenges.Complete("other", id, code)
+	notOk(t, err)
+
+	completed, err := challenges.Complete("acme", id, code)
+	ok(t, err)
+	equals(t, challenge, completed)
+
+	_, err = challenges.Complete("acme", id, code)
+	notOk(t, err)
+
+	id, code, err = challenges.Begin(challenge)
+	ok(t, err)
+	wrong := "x" + code[1:]
+
+	for i := 0; i < device.MaxChallengeAttempts; i++ {
+		_, err = challenges.Complete("acme", id, wrong)
+		notOk(t, err)
+	}
+
+	_, err = challenges.Complete("acme", id, code)
+	notOk(t, err)
+}
@@ -0,0 +1,308 @@
+package dpop
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+	"github.com/stone1549/auth-service/forwarded"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Header is the request header carrying a DPoP proof.
+const Header = "DPoP"
+
+// proofType is the typ header proofs must have.
+const proofType = "dpop+jwt"
+
+// minRsaBits is the smallest RSA modulus proofs may be signed with.
+const minRsaBits = 2048
+
+// SigningAlgorithms are the JWS algorithms proofs may be signed with.
+var SigningAlgorithms = []string{"ES256", "ES384", "ES512", "PS256", "PS384", "PS512", "RS256", "RS384", "RS512"}
+
+// Proof is a validated DPoP proof (RFC 9449), showing the client making a request holds a private key.
+type Proof struct {
+	// Thumbprint is the JWK SHA-256 thumbprint (RFC 7638) of the public key the proof was signed with, tokens bound
+	// to the key carry it in their cnf claim as jkt.
+	Thumbprint string
+	// Jti uniquely identifies the proof.
+	Jti string
+	// IssuedAt is when the client made the proof.
+	IssuedAt time.Time
+	// AccessTokenHash is the hash of the access token the proof was made to present, see AccessTokenHash, empty for
+	// proofs made to request a token.
+	AccessTokenHash string
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	D   string `json:"d"`
+}
+
+// Verifier validates DPoP proofs, remembering the ids of those it accepted while they're fresh so that none is
+// accepted twice.
+type Verifier struct {
+	window  time.Duration
+	proxies []*net.IPNet
+	mutex   sync.Mutex
+	seen    map[string]time.Time
+	pruned  time.Time
+}
+
+// NewVerifier constructs a Verifier accepting proofs issued no more than window before or after the time they're
+// verified at, for request URLs named as the proxies on trustedProxies forward them.
+func NewVerifier(window time.Duration, trustedProxies []*net.IPNet) *Verifier {
+	return &Verifier{window: window, proxies: trustedProxies, seen: make(map[string]time.Time), pruned: time.Now()}
+}
+
+// Verify validates a proof made for a request with the given method to requestUrl, which must not have a query or
+// fragment, and returns it. Proofs must be signed with the public key in their header, be fresh, and not have been
+// accepted before.
+func (v *Verifier) Verify(proof, method, requestUrl string) (Proof, error) {
+	var key jwk
+	parser := &jwt.Parser{ValidMethods: SigningAlgorithms, SkipClaimsValidation: true}
+
+	parsed, err := parser.Parse(proof, func(token *jwt.Token) (interface{}, error) {
+		if typ, _ := token.Header["typ"].(string); typ != proofType {
+			return nil, errors.New(fmt.Sprintf("typ isn't %s", proofType))
+		}
+
+		encoded, err := json.Marshal(token.Header["jwk"])
+
+		if err == nil {
+			err = json.Unmarshal(encoded, &key)
+		}
+
+		if err != nil || key.Kty == "" {
+			return nil, errors.New("jwk header is missing")
+		} else if key.D != "" {
+			return nil, errors.New("jwk header holds a private key")
+		}
+
+		return key.publicKey()
+	})
+
+	if err != nil {
+		return Proof{}, errors.New(fmt.Sprintf("invalid DPoP proof: %s", err.Error()))
+	}
+
+	claims, ok := parsed.Claims.(jwt.MapClaims)
+
+	if !ok || !parsed.Valid {
+		return Proof{}, errors.New("invalid DPoP proof")
+	}
+
+	if htm, _ := claims["htm"].(string); htm != method {
+		return Proof{}, errors.New("DPoP proof wasn't made for the request method")
+	}
+
+	if htu, _ := claims["htu"].(string); !sameUrl(htu, requestUrl) {
+		return Proof{}, errors.New("DPoP proof wasn't made for the request URL")
+	}
+
+	iat, ok := claims["iat"].(float64)
+
+	if !ok {
+		return Proof{}, errors.New("DPoP proof has no iat")
+	}
+
+	issuedAt := time.Unix(int64(iat), 0)
+
+	if age := time.Since(issuedAt); age > v.window || age < -v.window {
+		return Proof{}, errors.New("DPoP proof isn't fresh")
+	}
+
+	jti, _ := claims["jti"].(string)
+
+	if jti == "" {
+		return Proof{}, errors.New("DPoP proof has no jti")
+	}
+
+	thumbprint, err := key.thumbprint()
+
+	if err != nil {
+		return Proof{}, err
+	}
+
+	if !v.remember(jti, issuedAt) {
+		return Proof{}, errors.New("DPoP proof was already used")
+	}
+
+	accessTokenHash, _ := claims["ath"].(string)
+
+	return Proof{Thumbprint: thumbprint, Jti: jti, IssuedAt: issuedAt, AccessTokenHash: accessTokenHash}, nil
+}
+
+// remember records the id of an accepted proof until it's no longer fresh, returning false when it was already
+// accepted. Ids that are no longer fresh are forgotten at most once per window.
+func (v *Verifier) remember(jti string, issuedAt time.Time) bool {
+	now := time.Now()
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	if now.Sub(v.pruned) > v.window {
+		for seenJti, expiry := range v.seen {
+			if now.After(expiry) {
+				delete(v.seen, seenJti)
+			}
+		}
+
+		v.pruned = now
+	}
+
+	if expiry, ok := v.seen[jti]; ok && !now.After(expiry) {
+		return false
+	}
+
+	v.seen[jti] = issuedAt.Add(v.window)
+
+	return true
+}
+
+// AccessTokenHash is the base64url encoded SHA-256 hash of an access token, which proofs made to present it carry
+// in their ath claim.
+func AccessTokenHash(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+// RequestUrl is the URL of a request as proofs for it name it, without its query. The scheme is https when the
+// request was made over TLS, or a trusted proxy terminating TLS says so in X-Forwarded-Proto.
+func (v *Verifier) RequestUrl(r *http.Request) string {
+	scheme := "http"
+
+	if r.TLS != nil ||
+		(forwarded.Trusted(r, v.proxies) && strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")) {
+		scheme = "https"
+	}
+
+	return fmt.Sprintf("%s://%s%s", scheme, r.Host, r.URL.Path)
+}
+
+// sameUrl reports whether the htu claim of a proof names requestUrl, ignoring its query and fragment and the case of
+// the scheme and host.
+func sameUrl(htu, requestUrl string) bool {
+	parsed, err := url.Parse(htu)
+
+	if err != nil || htu == "" {
+		return false
+	}
+
+	expected, err := url.Parse(requestUrl)
+
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(parsed.Scheme, expected.Scheme) && strings.EqualFold(parsed.Host, expected.Host) &&
+		parsed.EscapedPath() == expected.EscapedPath()
+}
+
+// thumbprint computes the JWK SHA-256 thumbprint of the key from its required members in lexicographic order.
+func (k jwk) thumbprint() (string, error) {
+	var members interface{}
+
+	switch k.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{k.E, k.Kty, k.N}
+	case "EC":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{k.Crv, k.Kty, k.X, k.Y}
+	default:
+		return "", errors.New(fmt.Sprintf("unsupported key type %s", k.Kty))
+	}
+
+	encoded, err := json.Marshal(members)
+
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.Sum256(encoded)
+
+	return base64.RawURLEncoding.EncodeToString(hash[:]), nil
+}
+
+func (k jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+
+		if err != nil {
+			return nil, err
+		}
+
+		key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+
+		if key.N.BitLen() < minRsaBits {
+			return nil, errors.New(fmt.Sprintf("jwk header RSA key is smaller than %d bits", minRsaBits))
+		}
+
+		return key, nil
+	case "EC":
+		var curve elliptic.Curve
+
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, errors.New(fmt.Sprintf("unsupported curve %s", k.Crv))
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !curve.IsOnCurve(new(big.Int).SetBytes(x), new(big.Int).SetBytes(y)) {
+			return nil, errors.New("jwk header point isn't on its curve")
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	default:
+		return nil, errors.New(fmt.Sprintf("unsupported key type %s", k.Kty))
+	}
+}
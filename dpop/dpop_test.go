@@ -0,0 +1,192 @@
+package dpop_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stone1549/auth-service/dpop"
+	"math/big"
+	"net"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+const tokenUrl = "https://auth.example.com/session"
+
+// publicJwk describes an EC public key as a JWK.
+func publicJwk(key *ecdsa.PrivateKey) map[string]interface{} {
+	return map[string]interface{}{
+		"kty": "EC",
+		"crv": "P-256",
+		"x":   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+		"y":   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+	}
+}
+
+// newProof signs a proof with the given claims and key, with the key's public JWK in its header.
+func newProof(t *testing.T, key *ecdsa.PrivateKey, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["typ"] = "dpop+jwt"
+	token.Header["jwk"] = publicJwk(key)
+	signed, err := token.SignedString(key)
+	ok(t, err)
+
+	return signed
+}
+
+func newKey(t *testing.T) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ok(t, err)
+
+	return key
+}
+
+// TestVerifier_Verify ensures valid proofs are accepted once, and that proofs made for another request, stale ones
+// and ones that aren't DPoP proofs are refused.
+func TestVerifier_Verify(t *testing.T) {
+	key := newKey(t)
+	verifier := dpop.NewVerifier(time.Minute, nil)
+	now := time.Now().Unix()
+
+	proof := newProof(t, key, jwt.MapClaims{"htm": "POST", "htu": tokenUrl + "?ignored=1", "iat": now, "jti": "1"})
+	verified, err := verifier.Verify(proof, "POST", tokenUrl)
+	ok(t, err)
+	equals(t, "1", verified.Jti)
+	equals(t, "", verified.AccessTokenHash)
+
+	_, err = verifier.Verify(proof, "POST", tokenUrl)
+	notOk(t, err)
+
+	other := newProof(t, newKey(t), jwt.MapClaims{"htm": "POST", "htu": tokenUrl, "iat": now, "jti": "2",
+		"ath": dpop.AccessTokenHash("token")})
+	otherVerified, err := verifier.Verify(other, "POST", tokenUrl)
+	ok(t, err)
+	equals(t, dpop.AccessTokenHash("token"), otherVerified.AccessTokenHash)
+
+	if otherVerified.Thumbprint == verified.Thumbprint {
+		t.Fatal("expected proofs signed with different keys to have different thumbprints")
+	}
+
+	refused := []jwt.MapClaims{
+		{"htm": "GET", "htu": tokenUrl, "iat": now, "jti": "3"},
+		{"htm": "POST", "htu": "https://auth.example.com/user", "iat": now, "jti": "4"},
+		{"htm": "POST", "htu": tokenUrl, "iat": now - 120, "jti": "5"},
+		{"htm": "POST", "htu": tokenUrl, "iat": now + 120, "jti": "6"},
+		{"htm": "POST", "htu": tokenUrl, "iat": now},
+		{"htm": "POST", "htu": tokenUrl, "jti": "7"},
+	}
+
+	for _, claims := range refused {
+		_, err = verifier.Verify(newProof(t, key, claims), "POST", tokenUrl)
+		notOk(t, err)
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{"htm": "POST", "htu": tokenUrl, "iat": now,
+		"jti": "8"})
+	token.Header["jwk"] = publicJwk(key)
+	untyped, err := token.SignedString(key)
+	ok(t, err)
+	_, err = verifier.Verify(untyped, "POST", tokenUrl)
+	notOk(t, err)
+
+	token.Header["typ"] = "dpop+jwt"
+	token.Header["jwk"] = publicJwk(newKey(t))
+	mismatched, err := token.SignedString(key)
+	ok(t, err)
+	_, err = verifier.Verify(mismatched, "POST", tokenUrl)
+	notOk(t, err)
+}
+
+// TestVerifier_Thumbprint ensures the thumbprint of a proof's key hashes its required members in lexicographic order
+// (RFC 7638).
+func TestVerifier_Thumbprint(t *testing.T) {
+	key := newKey(t)
+	proof := newProof(t, key, jwt.MapClaims{"htm": "GET", "htu": tokenUrl, "iat": time.Now().Unix(), "jti": "1"})
+	verified, err := dpop.NewVerifier(time.Minute, nil).Verify(proof, "GET", tokenUrl)
+	ok(t, err)
+
+	jwk := publicJwk(key)
+	members := fmt.Sprintf(`{"crv":"P-256","kty":"EC","x":"%s","y":"%s"}`, jwk["x"], jwk["y"])
+	equals(t, dpop.AccessTokenHash(members), verified.Thumbprint)
+}
+
+// TestVerifier_RsaKeySize ensures proofs signed with RSA keys smaller than 2048 bits are refused.
+func TestVerifier_RsaKeySize(t *testing.T) {
+	verifier := dpop.NewVerifier(time.Minute, nil)
+
+	for bits, accepted := range map[int]bool{1024: false, 2048: true} {
+		key, err := rsa.GenerateKey(rand.Reader, bits)
+		ok(t, err)
+
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"htm": "GET", "htu": tokenUrl,
+			"iat": time.Now().Unix(), "jti": fmt.Sprint(bits)})
+		token.Header["typ"] = "dpop+jwt"
+		token.Header["jwk"] = map[string]interface{}{
+			"kty": "RSA",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}
+		proof, err := token.SignedString(key)
+		ok(t, err)
+
+		_, err = verifier.Verify(proof, "GET", tokenUrl)
+		equals(t, accepted, err == nil)
+	}
+}
+
+// TestVerifier_RequestUrl ensures request URLs are named without their query, over https when served over TLS or
+// behind a trusted proxy terminating TLS.
+func TestVerifier_RequestUrl(t *testing.T) {
+	_, proxies, err := net.ParseCIDR("10.0.0.0/8")
+	ok(t, err)
+	verifier := dpop.NewVerifier(time.Minute, []*net.IPNet{proxies})
+
+	req := httptest.NewRequest("POST", "http://auth.example.com/session?rememberMe=true", nil)
+	req.RemoteAddr = "10.1.2.3:40000"
+	equals(t, "http://auth.example.com/session", verifier.RequestUrl(req))
+
+	req.Header.Set("X-Forwarded-Proto", "https")
+	equals(t, tokenUrl, verifier.RequestUrl(req))
+
+	req.RemoteAddr = "192.0.2.1:40000"
+	equals(t, "http://auth.example.com/session", verifier.RequestUrl(req))
+
+	req.TLS = &tls.ConnectionState{}
+	equals(t, tokenUrl, verifier.RequestUrl(req))
+}
+
+// ok fails the test if an err is not nil.
+func ok(tb testing.TB, err error) {
+	if err != nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: unexpected error: %s\033[39m\n\n", filepath.Base(file), line, err.Error())
+		tb.FailNow()
+	}
+}
+
+// notOk fails the test if an err is nil.
+func notOk(tb testing.TB, err error) {
+	if err == nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: expected error\033[39m\n\n", filepath.Base(file), line)
+		tb.FailNow()
+	}
+}
+
+// equals fails the test if exp is not equal to act.
+func equals(tb testing.TB, exp, act interface{}) {
+	if !reflect.DeepEqual(exp, act) {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d:\n\n\texp: %#v\n\n\tgot: %#v\033[39m\n\n", filepath.Base(file), line, exp, act)
+		tb.FailNow()
+	}
+}
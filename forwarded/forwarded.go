@@ -0,0 +1,72 @@
+package forwarded
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Trusted reports whether a request was forwarded by one of the proxies, so that the forwarding headers it carries
+// can be believed.
+func Trusted(r *http.Request, proxies []*net.IPNet) bool {
+	return contains(proxies, parseIp(r.RemoteAddr))
+}
+
+// ClientIp retrieves the address of the client that made a request. Requests forwarded by one of the proxies are
+// attributed to the right-most address in X-Forwarded-For that isn't one of the proxies, as addresses to the left of
+// it could have been made up by the client; any other request is attributed to the address it came from.
+func ClientIp(r *http.Request, proxies []*net.IPNet) string {
+	client := parseIp(r.RemoteAddr)
+
+	if client == nil {
+		return r.RemoteAddr
+	}
+
+	if !contains(proxies, client) {
+		return client.String()
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := parseIp(strings.TrimSpace(hops[i]))
+
+		if hop == nil {
+			break
+		}
+
+		client = hop
+
+		if !contains(proxies, hop) {
+			break
+		}
+	}
+
+	return client.String()
+}
+
+// parseIp parses an address with or without a port, returning nil when it isn't an IP address.
+func parseIp(addr string) net.IP {
+	host, _, err := net.SplitHostPort(addr)
+
+	if err != nil {
+		host = strings.Trim(addr, "[]")
+	}
+
+	return net.ParseIP(host)
+}
+
+// contains reports whether ip is in one of the networks.
+func contains(networks []*net.IPNet, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
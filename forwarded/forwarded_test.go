@@ -0,0 +1,90 @@
+package forwarded_test
+
+import (
+	"fmt"
+	"github.com/stone1549/auth-service/forwarded"
+	"net"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+// proxies parses the networks of the trusted proxies.
+func proxies(t *testing.T, cidrs ...string) []*net.IPNet {
+	var networks []*net.IPNet
+
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		ok(t, err)
+		networks = append(networks, network)
+	}
+
+	return networks
+}
+
+// TestClientIp ensures X-Forwarded-For is only believed when a trusted proxy forwarded the request, and then only as
+// far as the right-most address that isn't a trusted proxy.
+func TestClientIp(t *testing.T) {
+	trusted := proxies(t, "10.0.0.0/8")
+
+	for _, test := range []struct {
+		remoteAddr string
+		forwarded  []string
+		expected   string
+	}{
+		{"203.0.113.7:1234", nil, "203.0.113.7"},
+		{"203.0.113.7:1234", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"10.0.0.2:1234", nil, "10.0.0.2"},
+		{"10.0.0.2:1234", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"10.0.0.2:1234", []string{"192.0.2.9, 198.51.100.1, 10.0.0.3"}, "198.51.100.1"},
+		{"10.0.0.2:1234", []string{"192.0.2.9", "198.51.100.1"}, "198.51.100.1"},
+		{"10.0.0.2:1234", []string{"unknown, 10.0.0.3"}, "10.0.0.3"},
+		{"[2001:db8::1]:1234", []string{"198.51.100.1"}, "2001:db8::1"},
+		{"pipe", nil, "pipe"},
+	} {
+		r := httptest.NewRequest("GET", "https://auth.example.com/session", nil)
+		r.RemoteAddr = test.remoteAddr
+
+		for _, value := range test.forwarded {
+			r.Header.Add("X-Forwarded-For", value)
+		}
+
+		equals(t, test.expected, forwarded.ClientIp(r, trusted))
+	}
+}
+
+// TestTrusted ensures only requests from the trusted proxies are trusted.
+func TestTrusted(t *testing.T) {
+	trusted := proxies(t, "10.0.0.0/8", "2001:db8::/32")
+	r := httptest.NewRequest("GET", "https://auth.example.com/session", nil)
+
+	r.RemoteAddr = "10.0.0.2:1234"
+	equals(t, true, forwarded.Trusted(r, trusted))
+	equals(t, false, forwarded.Trusted(r, nil))
+
+	r.RemoteAddr = "[2001:db8::1]:1234"
+	equals(t, true, forwarded.Trusted(r, trusted))
+
+	r.RemoteAddr = "203.0.113.7:1234"
+	equals(t, false, forwarded.Trusted(r, trusted))
+}
+
+// ok fails the test if an err is not nil.
+func ok(tb testing.TB, err error) {
+	if err != nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: unexpected error: %s\033[39m\n\n", filepath.Base(file), line, err.Error())
+		tb.FailNow()
+	}
+}
+
+// equals fails the test if exp is not equal to act.
+func equals(tb testing.TB, exp, act interface{}) {
+	if !reflect.DeepEqual(exp, act) {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d:\n\n\texp: %#v\n\n\tgot: %#v\033[39m\n\n", filepath.Base(file), line, exp, act)
+		tb.FailNow()
+	}
+}
@@ -0,0 +1,143 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/stone1549/auth-service/logging"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Check reports whether a dependency of the service is usable, returning why when it isn't.
+type Check func(ctx context.Context) error
+
+// Pinger is implemented by dependencies, such as repositories and audit sinks, that hold a connection which can
+// fail.
+type Pinger interface {
+	// Ping verifies the connection is usable.
+	Ping(ctx context.Context) error
+}
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+type checkResult struct {
+	Status string `json:"status"`
+}
+
+type readiness struct {
+	Status string                 `json:"status"`
+	Checks map[string]checkResult `json:"checks,omitempty"`
+}
+
+// Checker decides whether the service is ready to serve requests by running its checks, and reports it not ready
+// once it begins shutting down.
+type Checker struct {
+	timeout      time.Duration
+	checks       []namedCheck
+	shuttingDown int32
+}
+
+// NewChecker constructs a Checker failing checks that take longer than timeout.
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout}
+}
+
+// Add registers a check under a name it's reported by. Checks should be added before the checker is served.
+func (c *Checker) Add(name string, check Check) {
+	c.checks = append(c.checks, namedCheck{name, check})
+}
+
+// AddPinger registers a check pinging dependency when it holds a connection, those that don't are always ready.
+func (c *Checker) AddPinger(name string, dependency interface{}) {
+	if pinger, ok := dependency.(Pinger); ok {
+		c.Add(name, pinger.Ping)
+	}
+}
+
+// ShutDown marks the service as shutting down, so it's reported not ready from then on.
+func (c *Checker) ShutDown() {
+	atomic.StoreInt32(&c.shuttingDown, 1)
+}
+
+// Live responds that the process is alive, whatever the state of its dependencies.
+func (c *Checker) Live(w http.ResponseWriter, r *http.Request) {
+	respond(w, http.StatusOK, readiness{Status: "ok"})
+}
+
+// Ready runs every check concurrently, responding with the status of each and a 503 when any failed or the service
+// is shutting down. Why a check failed is logged rather than responded with, as it can describe the service's
+// dependencies to anyone who can reach it.
+func (c *Checker) Ready(w http.ResponseWriter, r *http.Request) {
+	if atomic.LoadInt32(&c.shuttingDown) == 1 {
+		respond(w, http.StatusServiceUnavailable, readiness{Status: "shutting down"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), c.timeout)
+	defer cancel()
+
+	response := readiness{Status: "ready", Checks: make(map[string]checkResult)}
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, named := range c.checks {
+		wg.Add(1)
+
+		go func(named namedCheck) {
+			defer wg.Done()
+			err := run(ctx, named.check)
+			result := checkResult{Status: "up"}
+
+			if err != nil {
+				result = checkResult{Status: "down"}
+				logging.FromContext(r.Context()).Warn("Readiness check failed", "check", named.name,
+					"error", err.Error())
+			}
+
+			mutex.Lock()
+			response.Checks[named.name] = result
+			mutex.Unlock()
+		}(named)
+	}
+
+	wg.Wait()
+	status := http.StatusOK
+
+	for _, result := range response.Checks {
+		if result.Status != "up" {
+			response.Status = "not ready"
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	respond(w, status, response)
+}
+
+// run waits for a check until the context is done, checks that don't honour the context are abandoned.
+func run(ctx context.Context, check Check) error {
+	done := make(chan error, 1)
+
+	go func() {
+		done <- check(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return errors.New("check timed out")
+	}
+}
+
+func respond(w http.ResponseWriter, status int, body readiness) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
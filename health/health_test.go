@@ -0,0 +1,101 @@
+package health_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/stone1549/auth-service/health"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type readiness struct {
+	Status string `json:"status"`
+	Checks map[string]struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+	} `json:"checks"`
+}
+
+type pinger struct {
+	err error
+}
+
+func (p pinger) Ping(ctx context.Context) error {
+	return p.err
+}
+
+// ready requests the readiness of the checker, returning the status code and decoded response.
+func ready(t *testing.T, checker *health.Checker) (int, readiness) {
+	recorder := httptest.NewRecorder()
+	checker.Ready(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	var response readiness
+
+	if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+
+	return recorder.Code, response
+}
+
+// TestChecker_Ready ensures the service is ready when every check passes, dependencies without a connection are
+// skipped, and failed checks are reported without why they failed.
+func TestChecker_Ready(t *testing.T) {
+	checker := health.NewChecker(time.Second)
+	checker.AddPinger("repository", pinger{})
+	checker.AddPinger("memory", struct{}{})
+	checker.Add("signingKeys", func(ctx context.Context) error { return nil })
+
+	status, response := ready(t, checker)
+
+	if status != http.StatusOK || response.Status != "ready" || len(response.Checks) != 2 ||
+		response.Checks["repository"].Status != "up" {
+		t.Fatalf("expected ready, got %d %+v", status, response)
+	}
+
+	checker.AddPinger("audit", pinger{errors.New("connection refused")})
+	status, response = ready(t, checker)
+
+	if status != http.StatusServiceUnavailable || response.Status != "not ready" ||
+		response.Checks["audit"].Status != "down" || response.Checks["audit"].Error != "" ||
+		response.Checks["repository"].Status != "up" {
+		t.Fatalf("expected not ready, got %d %+v", status, response)
+	}
+}
+
+// TestChecker_ReadyTimeout ensures checks that don't finish in time fail.
+func TestChecker_ReadyTimeout(t *testing.T) {
+	checker := health.NewChecker(10 * time.Millisecond)
+	checker.Add("repository", func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+
+	status, response := ready(t, checker)
+
+	if status != http.StatusServiceUnavailable || response.Checks["repository"].Status != "down" {
+		t.Fatalf("expected timeout, got %d %+v", status, response)
+	}
+}
+
+// TestChecker_ShutDown ensures the service is alive but not ready once it begins shutting down.
+func TestChecker_ShutDown(t *testing.T) {
+	checker := health.NewChecker(time.Second)
+	checker.ShutDown()
+
+	status, response := ready(t, checker)
+
+	if status != http.StatusServiceUnavailable || response.Status != "shutting down" {
+		t.Fatalf("expected shutting down, got %d %+v", status, response)
+	}
+
+	recorder := httptest.NewRecorder()
+	checker.Live(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected alive, got %d", recorder.Code)
+	}
+}
@@ -0,0 +1,151 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type closer struct {
+	name  string
+	close func() error
+}
+
+// Manager runs the HTTP server and the background workers of the service, and stops them gracefully: the server
+// keeps serving for the drain delay while load balancers see it's no longer ready, then stops accepting connections
+// and drains those in flight, workers are stopped and waited for, and resources are closed in the reverse order they
+// were registered.
+type Manager struct {
+	// Server is the HTTP server run by the manager, which may be configured further before it's run.
+	Server     *http.Server
+	drain      time.Duration
+	grace      time.Duration
+	stop       chan struct{}
+	workers    sync.WaitGroup
+	onShutdown []func()
+	closers    []closer
+}
+
+// NewManager constructs a Manager serving handler on addr, which keeps serving for the drain delay once asked to
+// stop, then gives in flight requests and workers the grace period to finish.
+func NewManager(addr string, handler http.Handler, drain, grace time.Duration) *Manager {
+	return &Manager{
+		Server: &http.Server{Addr: addr, Handler: handler, ReadHeaderTimeout: 10 * time.Second},
+		drain:  drain,
+		grace:  grace,
+		stop:   make(chan struct{}),
+	}
+}
+
+// Go runs a background worker until the manager stops, when the stop channel it's given is closed.
+func (m *Manager) Go(worker func(stop <-chan struct{})) {
+	m.workers.Add(1)
+
+	go func() {
+		defer m.workers.Done()
+		worker(m.stop)
+	}()
+}
+
+// OnShutdown registers a function called as soon as the manager begins stopping, before the drain delay.
+func (m *Manager) OnShutdown(fn func()) {
+	m.onShutdown = append(m.onShutdown, fn)
+}
+
+// Close registers a resource closed once the server and workers have stopped.
+func (m *Manager) Close(name string, close func() error) {
+	m.closers = append(m.closers, closer{name, close})
+}
+
+// Run listens on the manager's address and serves until ctx is done or the server fails, then stops gracefully.
+func (m *Manager) Run(ctx context.Context) error {
+	listener, err := net.Listen("tcp", m.Server.Addr)
+
+	if err != nil {
+		m.shutdown(0)
+		return err
+	}
+
+	return m.Serve(ctx, listener)
+}
+
+// Serve serves connections accepted by listener until ctx is done or the server fails, then stops gracefully.
+// Connections are served over TLS when the server has a TLS configuration.
+func (m *Manager) Serve(ctx context.Context, listener net.Listener) error {
+	served := make(chan error, 1)
+
+	go func() {
+		if m.Server.TLSConfig != nil {
+			served <- m.Server.ServeTLS(listener, "", "")
+		} else {
+			served <- m.Server.Serve(listener)
+		}
+	}()
+
+	slog.Info("Serving", "address", listener.Addr().String())
+
+	var err error
+	var drain time.Duration
+
+	select {
+	case err = <-served:
+		if errors.Is(err, http.ErrServerClosed) {
+			err = nil
+		}
+	case <-ctx.Done():
+		slog.Info("Shutting down", "drain", m.drain.String(), "grace", m.grace.String())
+		drain = m.drain
+	}
+
+	if shutdownErr := m.shutdown(drain); err == nil {
+		err = shutdownErr
+	}
+
+	return err
+}
+
+// shutdown keeps serving for the drain delay after calling the shutdown hooks, then drains the server, stops the
+// workers and closes resources, giving up on draining and waiting once the grace period has passed.
+func (m *Manager) shutdown(drain time.Duration) error {
+	for _, fn := range m.onShutdown {
+		fn()
+	}
+
+	time.Sleep(drain)
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.grace)
+	defer cancel()
+
+	err := m.Server.Shutdown(ctx)
+
+	if err != nil {
+		slog.Warn("Unable to drain connections within the grace period", "error", err.Error())
+		m.Server.Close()
+	}
+
+	close(m.stop)
+	stopped := make(chan struct{})
+
+	go func() {
+		m.workers.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		slog.Warn("Background workers didn't stop within the grace period")
+	}
+
+	for i := len(m.closers) - 1; i >= 0; i-- {
+		if closeErr := m.closers[i].close(); closeErr != nil {
+			slog.Error("Unable to close resource", "resource", m.closers[i].name, "error", closeErr.Error())
+		}
+	}
+
+	return err
+}
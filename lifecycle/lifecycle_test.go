@@ -0,0 +1,131 @@
+package lifecycle_test
+
+import (
+	"context"
+	"github.com/stone1549/auth-service/lifecycle"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestManager_Serve ensures stopping the manager drains in flight requests, then stops workers and closes resources
+// in the reverse order they were registered.
+func TestManager_Serve(t *testing.T) {
+	started := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("drained"))
+	})
+
+	manager := lifecycle.NewManager("", handler, 0, 5*time.Second)
+	var mutex sync.Mutex
+	var events []string
+	record := func(event string) {
+		mutex.Lock()
+		events = append(events, event)
+		mutex.Unlock()
+	}
+
+	manager.OnShutdown(func() { record("shutting down") })
+	manager.Go(func(stop <-chan struct{}) {
+		<-stop
+		record("worker stopped")
+	})
+	manager.Close("first", func() error { record("first closed"); return nil })
+	manager.Close("second", func() error { record("second closed"); return nil })
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+
+	go func() {
+		served <- manager.Serve(ctx, listener)
+	}()
+
+	body := make(chan string, 1)
+
+	go func() {
+		resp, err := http.Get("http://" + listener.Addr().String())
+
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+
+		defer resp.Body.Close()
+		read, _ := ioutil.ReadAll(resp.Body)
+		body <- string(read)
+	}()
+
+	<-started
+	cancel()
+
+	if err := <-served; err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	if drained := <-body; drained != "drained" {
+		t.Fatalf("expected in flight request to be drained, got %s", drained)
+	}
+
+	expected := []string{"shutting down", "worker stopped", "second closed", "first closed"}
+
+	if !reflect.DeepEqual(expected, events) {
+		t.Fatalf("expected %v, got %v", expected, events)
+	}
+}
+
+// TestManager_DrainDelay ensures the manager keeps serving new requests for the drain delay after the shutdown hooks
+// have been called.
+func TestManager_DrainDelay(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("served"))
+	})
+
+	manager := lifecycle.NewManager("", handler, 500*time.Millisecond, 5*time.Second)
+	shuttingDown := make(chan struct{})
+	manager.OnShutdown(func() { close(shuttingDown) })
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+
+	go func() {
+		served <- manager.Serve(ctx, listener)
+	}()
+
+	cancel()
+	<-shuttingDown
+
+	resp, err := http.Get("http://" + listener.Addr().String())
+
+	if err != nil {
+		t.Fatalf("expected requests to be served during the drain delay, got %s", err.Error())
+	}
+
+	read, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if string(read) != "served" {
+		t.Fatalf("expected served, got %s", read)
+	}
+
+	if err := <-served; err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+}
@@ -0,0 +1,172 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+// redacted replaces the values of sensitive fields.
+const redacted = "[REDACTED]"
+
+// sensitiveKeys are the lower cased fragments of the names of fields, parameters and headers whose values are never
+// logged.
+var sensitiveKeys = []string{"password", "passwd", "secret", "token", "authorization", "cookie", "code",
+	"samlresponse", "assertion", "apikey", "api_key", "credential"}
+
+type contextKey struct{}
+
+// requestFields are details of a request learnt while it's handled, such as the user it was made by.
+type requestFields struct {
+	mutex  sync.Mutex
+	userId string
+}
+
+// Setup makes a JSON logger of messages at or above level, with sensitive fields redacted, the default for both
+// slog and the standard log package.
+func Setup(level slog.Level) {
+	slog.SetDefault(New(os.Stderr, level))
+}
+
+// New constructs a JSON logger writing messages at or above level to w, with sensitive fields redacted.
+func New(w io.Writer, level slog.Level) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level, ReplaceAttr: redactAttr}))
+}
+
+// Fatal logs an error the service can't start or continue with, and exits.
+func Fatal(msg string, err error) {
+	slog.Error(msg, "error", err.Error())
+	os.Exit(1)
+}
+
+// IsSensitive reports whether a field, parameter or header with the given name holds a secret.
+func IsSensitive(key string) bool {
+	lowered := strings.ToLower(key)
+
+	for _, sensitive := range sensitiveKeys {
+		if strings.Contains(lowered, sensitive) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Redact copies request parameters or headers with the values of sensitive ones replaced.
+func Redact(values map[string][]string) map[string][]string {
+	copied := make(map[string][]string, len(values))
+
+	for key, value := range values {
+		if IsSensitive(key) {
+			copied[key] = []string{redacted}
+		} else {
+			copied[key] = value
+		}
+	}
+
+	return copied
+}
+
+func redactAttr(groups []string, attr slog.Attr) slog.Attr {
+	if IsSensitive(attr.Key) && attr.Value.Kind() != slog.KindGroup {
+		return slog.String(attr.Key, redacted)
+	}
+
+	return attr
+}
+
+// SetUser records the user a request was made by, to be logged with it.
+func SetUser(ctx context.Context, userId string) {
+	if fields, ok := ctx.Value(contextKey{}).(*requestFields); ok {
+		fields.mutex.Lock()
+		fields.userId = userId
+		fields.mutex.Unlock()
+	}
+}
+
+// FromContext retrieves a logger carrying the request id, route, user and trace id of the request being handled in
+// ctx, or the default logger outside of a request.
+func FromContext(ctx context.Context) *slog.Logger {
+	logger := slog.Default()
+
+	if requestId := middleware.GetReqID(ctx); requestId != "" {
+		logger = logger.With("requestId", requestId)
+	}
+
+	// chi.RouteContext panics outside of a request, the route context is looked up directly instead.
+	if rctx, ok := ctx.Value(chi.RouteCtxKey).(*chi.Context); ok && rctx.RoutePattern() != "" {
+		logger = logger.With("route", rctx.RoutePattern())
+	}
+
+	if fields, ok := ctx.Value(contextKey{}).(*requestFields); ok {
+		fields.mutex.Lock()
+		userId := fields.userId
+		fields.mutex.Unlock()
+
+		if userId != "" {
+			logger = logger.With("userId", userId)
+		}
+	}
+
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.HasTraceID() {
+		logger = logger.With("traceId", spanContext.TraceID().String())
+	}
+
+	return logger
+}
+
+// Middleware logs each request once it's handled, with its status, duration and the user it was made by, at info
+// level, or error level for server errors. Sensitive query parameters are redacted. Panics are logged with their
+// stack and answered with a 500, except http.ErrAbortHandler which is passed on to abort the response.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ctx := context.WithValue(r.Context(), contextKey{}, &requestFields{})
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		defer func() {
+			if recovered := recover(); recovered == http.ErrAbortHandler {
+				// The handler aborted the response on purpose, the server closes the connection without logging.
+				panic(recovered)
+			} else if recovered != nil {
+				FromContext(ctx).Error("Request panicked", "panic", fmt.Sprint(recovered),
+					"stack", string(debug.Stack()))
+				http.Error(ww, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			}
+
+			status := ww.Status()
+
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			level := slog.LevelInfo
+
+			if status >= http.StatusInternalServerError {
+				level = slog.LevelError
+			}
+
+			attrs := []any{"method", r.Method, "path", r.URL.Path, "status", status, "bytes", ww.BytesWritten(),
+				"duration", time.Since(start).String(), "remoteAddr", r.RemoteAddr, "userAgent", r.UserAgent()}
+
+			if r.URL.RawQuery != "" {
+				attrs = append(attrs, "query", url.Values(Redact(r.URL.Query())).Encode())
+			}
+
+			FromContext(ctx).Log(ctx, level, "Handled request", attrs...)
+		}()
+
+		next.ServeHTTP(ww, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,145 @@
+package logging_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/stone1549/auth-service/logging"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// capture makes the default logger write JSON to the returned buffer for the rest of the test.
+func capture(t *testing.T, level slog.Level) *bytes.Buffer {
+	previous := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	var buffer bytes.Buffer
+	slog.SetDefault(logging.New(&buffer, level))
+
+	return &buffer
+}
+
+// lines decodes each JSON line logged.
+func lines(t *testing.T, buffer *bytes.Buffer) []map[string]interface{} {
+	var decoded []map[string]interface{}
+
+	for _, line := range strings.Split(strings.TrimSpace(buffer.String()), "\n") {
+		var fields map[string]interface{}
+
+		if err := json.Unmarshal([]byte(line), &fields); err != nil {
+			t.Fatalf("expected a JSON line, got %s", line)
+		}
+
+		decoded = append(decoded, fields)
+	}
+
+	return decoded
+}
+
+// TestNew ensures messages below the level are dropped and sensitive fields are redacted.
+func TestNew(t *testing.T) {
+	buffer := capture(t, slog.LevelInfo)
+	slog.Debug("Dropped")
+	slog.Info("Logged in", "email", "jane@example.com", "password", "hunter2", "csrfToken", "abc")
+
+	logged := lines(t, buffer)
+
+	if len(logged) != 1 {
+		t.Fatalf("expected 1 line, got %d", len(logged))
+	}
+
+	if logged[0]["email"] != "jane@example.com" || logged[0]["password"] != "[REDACTED]" ||
+		logged[0]["csrfToken"] != "[REDACTED]" || logged[0]["level"] != "INFO" {
+		t.Fatalf("unexpected fields %v", logged[0])
+	}
+}
+
+// TestFromContext_Background ensures work outside of a request logs with the default logger.
+func TestFromContext_Background(t *testing.T) {
+	buffer := capture(t, slog.LevelInfo)
+	logging.FromContext(context.Background()).Info("Relayed")
+
+	logged := lines(t, buffer)
+
+	if len(logged) != 1 || logged[0]["msg"] != "Relayed" || logged[0]["route"] != nil {
+		t.Fatalf("unexpected lines %v", logged)
+	}
+}
+
+// TestMiddleware ensures requests are logged with their request id, route, status and user, with sensitive query
+// parameters redacted, and that panics are logged and answered with a 500.
+func TestMiddleware(t *testing.T) {
+	buffer := capture(t, slog.LevelInfo)
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(logging.Middleware)
+	r.Get("/login/{provider}/callback", func(w http.ResponseWriter, r *http.Request) {
+		logging.SetUser(r.Context(), "42")
+		w.WriteHeader(http.StatusCreated)
+	})
+	r.Get("/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet,
+		"/login/google/callback?code=secret-code&state=xyz", nil))
+
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/panic", nil))
+
+	if recorder.Code != http.StatusInternalServerError {
+		t.Fatalf("expected a 500 for a panic, got %d", recorder.Code)
+	}
+
+	logged := lines(t, buffer)
+
+	if len(logged) != 3 {
+		t.Fatalf("expected 3 lines, got %d", len(logged))
+	}
+
+	request := logged[0]
+
+	if request["route"] != "/login/{provider}/callback" || request["userId"] != "42" ||
+		request["status"] != float64(http.StatusCreated) || request["requestId"] == nil {
+		t.Fatalf("unexpected fields %v", request)
+	}
+
+	if strings.Contains(request["query"].(string), "secret-code") || !strings.Contains(request["query"].(string),
+		"state=xyz") {
+		t.Fatalf("expected code to be redacted from %s", request["query"])
+	}
+
+	if logged[1]["panic"] != "boom" || logged[2]["level"] != "ERROR" {
+		t.Fatalf("unexpected panic lines %v", logged[1:])
+	}
+}
+
+// TestMiddleware_Abort ensures handlers aborting their response with http.ErrAbortHandler aren't answered with a 500,
+// the panic is passed on for the server to abort the response.
+func TestMiddleware_Abort(t *testing.T) {
+	buffer := capture(t, slog.LevelInfo)
+	handler := logging.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	recorder := httptest.NewRecorder()
+
+	func() {
+		defer func() {
+			if recovered := recover(); recovered != http.ErrAbortHandler {
+				t.Fatalf("expected http.ErrAbortHandler to be passed on, got %v", recovered)
+			}
+		}()
+
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/abort", nil))
+	}()
+
+	if recorder.Code == http.StatusInternalServerError || buffer.Len() != 0 {
+		t.Fatalf("expected no 500 or log line for an aborted response, got %d and %s", recorder.Code, buffer)
+	}
+}
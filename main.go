@@ -2,30 +2,77 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/render"
+	"github.com/stone1549/auth-service/audit"
+	"github.com/stone1549/auth-service/authz"
 	"github.com/stone1549/auth-service/common"
+	"github.com/stone1549/auth-service/device"
+	"github.com/stone1549/auth-service/dpop"
+	"github.com/stone1549/auth-service/health"
+	"github.com/stone1549/auth-service/lifecycle"
+	"github.com/stone1549/auth-service/logging"
+	"github.com/stone1549/auth-service/mail"
+	"github.com/stone1549/auth-service/metrics"
+	"github.com/stone1549/auth-service/oidc"
+	"github.com/stone1549/auth-service/outbox"
+	"github.com/stone1549/auth-service/policy"
 	"github.com/stone1549/auth-service/repository"
+	"github.com/stone1549/auth-service/saml"
 	"github.com/stone1549/auth-service/service"
+	"github.com/stone1549/auth-service/tlsserver"
+	"github.com/stone1549/auth-service/tracing"
+	"github.com/stone1549/auth-service/webhook"
+	"io"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
+var testPolicies = flag.Bool("test-policies", false, "run the tests bundled with the configured policies and exit")
+
 func main() {
 	flag.Parse()
+	logging.Setup(slog.LevelInfo)
 
 	config, err := common.GetConfiguration()
 
 	if err != nil {
-		panic(fmt.Sprintf("Unable to load configuration: %s", err.Error()))
+		logging.Fatal("Unable to load configuration", err)
+	}
+
+	logging.Setup(config.GetLogLevel())
+
+	if *testPolicies {
+		os.Exit(runPolicyTests(config.GetPolicyPath()))
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), config.GetTraceExporterType(),
+		config.GetTraceEndpoint())
+
+	if err != nil {
+		logging.Fatal("Unable to configure tracing", err)
 	}
 
+	manager := lifecycle.NewManager(fmt.Sprintf(":%d", config.GetPort()), nil, config.GetShutdownDrainDelay(),
+		config.GetShutdownGracePeriod())
+	manager.Close("tracing", func() error { return shutdownTracing(context.Background()) })
+
 	repo, err := repository.NewUserRepository(config)
 
 	if err != nil {
-		panic(fmt.Sprintf("Unable to configure repository: %s", err.Error()))
+		logging.Fatal("Unable to configure repository", err)
+	}
+
+	if closer, ok := repo.(io.Closer); ok {
+		manager.Close("repository", closer.Close)
 	}
 
 	repoMiddleWare := func(next http.Handler) http.Handler {
@@ -38,7 +85,7 @@ func main() {
 	tokenFactory, err := service.NewTokenFactory(config)
 
 	if err != nil {
-		panic(fmt.Sprintf("Unable to configure token factory: %s", err.Error()))
+		logging.Fatal("Unable to configure token factory", err)
 	}
 
 	tokenMiddleware := func(next http.Handler) http.Handler {
@@ -47,28 +94,368 @@ func main() {
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
+	namespaces, err := authz.LoadNamespaces(config.GetAuthzNamespaces())
+
+	if err != nil {
+		logging.Fatal("Unable to load authz namespaces", err)
+	}
+
+	tupleRepo, ok := repo.(repository.TupleRepository)
+
+	if !ok {
+		logging.Fatal("Unable to configure authz", errors.New("repository doesn't support relationship tuples"))
+	}
+
+	checker := authz.NewChecker(namespaces, tupleRepo)
+
+	authzMiddleware := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), "authz", checker)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+
+	policyEngine, err := policy.NewEngine(config.GetPolicyPath())
+
+	if err != nil {
+		logging.Fatal("Unable to load policies", err)
+	}
+
+	if config.GetPolicyPath() != "" && config.GetPolicyReloadInterval() > 0 {
+		manager.Go(func(stop <-chan struct{}) {
+			policyEngine.Watch(config.GetPolicyReloadInterval(), stop)
+		})
+	}
+
+	policyMiddleware := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), "policy", policyEngine)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+
+	webhookRepo, ok := repo.(repository.WebhookRepository)
+
+	if !ok {
+		logging.Fatal("Unable to configure webhooks", errors.New("repository doesn't support webhooks"))
+	}
+
+	if config.GetWebhookPollInterval() > 0 {
+		dispatcher := webhook.NewDispatcher(webhookRepo, &http.Client{Timeout: 10 * time.Second},
+			config.GetWebhookMaxAttempts())
+		manager.Go(func(stop <-chan struct{}) {
+			dispatcher.Run(config.GetWebhookPollInterval(), stop)
+		})
+	}
+
+	sessionRepo, ok := repo.(repository.SessionRepository)
+
+	if !ok {
+		logging.Fatal("Unable to configure sessions", errors.New("repository doesn't support sessions"))
+	}
+
+	if config.GetSessionCleanupInterval() > 0 {
+		manager.Go(func(stop <-chan struct{}) {
+			service.CleanupSessions(sessionRepo, config.GetSessionCleanupInterval(), stop)
+		})
+	}
+
+	outboxRepo, ok := repo.(repository.OutboxRepository)
+
+	if !ok {
+		logging.Fatal("Unable to configure outbox", errors.New("repository doesn't support an outbox"))
+	}
+
+	if config.GetOutboxPollInterval() > 0 {
+		publisher, err := outbox.NewEventPublisher(config)
+
+		if err != nil {
+			logging.Fatal("Unable to configure outbox publisher", err)
+		}
+
+		relay := outbox.NewRelay(outboxRepo, publisher, config.GetOutboxMaxAttempts())
+		manager.Go(func(stop <-chan struct{}) {
+			relay.Run(config.GetOutboxPollInterval(), stop)
+		})
+	}
+
+	if _, ok = repo.(repository.UserAdminRepository); !ok {
+		logging.Fatal("Unable to configure SCIM", errors.New("repository doesn't support user administration"))
+	}
+
+	auditSink, err := audit.NewSink(config)
+
+	if err != nil {
+		logging.Fatal("Unable to configure audit sink", err)
+	}
+
+	manager.Close("audit sink", auditSink.Close)
+
+	auditMiddleware := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), "audit", auditSink)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+
+	readiness := health.NewChecker(2 * time.Second)
+	readiness.AddPinger("repository", repo)
+	readiness.AddPinger("audit", auditSink)
+	readiness.Add("signingKeys", service.CheckSigningKeys(tokenFactory, config.GetTenants()))
+	manager.OnShutdown(readiness.ShutDown)
+
+	federation, err := oidc.LoadFederation(config.GetOidcProviders(), &http.Client{Timeout: 10 * time.Second})
+
+	if err != nil {
+		logging.Fatal("Unable to load OIDC providers", err)
+	}
+
+	oidcMiddleware := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), "oidc", federation)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+
+	serviceProvider, err := saml.LoadServiceProvider(config.GetSamlConfig())
+
+	if err != nil {
+		logging.Fatal("Unable to load SAML configuration", err)
+	}
+
+	samlMiddleware := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), "saml", serviceProvider)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+
+	detector, err := device.NewDetector(config.GetGeoIpDatabase())
+
+	if err != nil {
+		logging.Fatal("Unable to load GeoIP database", err)
+	}
+
+	manager.Close("GeoIP database", detector.Close)
+
+	mailer, err := mail.NewMailer(config.GetSmtpUrl(), config.GetSmtpFrom())
+
+	if err != nil {
+		logging.Fatal("Unable to configure mailer", err)
+	}
+
+	deviceMiddleware := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), "devices", detector)
+			ctx = context.WithValue(ctx, "mailer", mailer)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+
+	proxyMiddleware := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), "trustedProxies", config.GetTrustedProxies())
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+
 	r := chi.NewRouter()
 
 	r.Use(middleware.RequestID)
-	r.Use(middleware.Logger)
-	r.Use(middleware.Recoverer)
+	r.Use(tlsserver.ClientCertMiddleware)
+	r.Use(tracing.Middleware)
+	r.Use(logging.Middleware)
+	r.Use(metrics.Middleware)
 	r.Use(middleware.URLFormat)
 	r.Use(render.SetContentType(render.ContentTypeJSON))
 	r.Use(repoMiddleWare)
 	r.Use(tokenMiddleware)
+	r.Use(authzMiddleware)
+	r.Use(policyMiddleware)
+	r.Use(proxyMiddleware)
+	r.Use(auditMiddleware)
+	r.Use(service.DpopMiddleware(dpop.NewVerifier(config.GetDpopWindow(), config.GetTrustedProxies())))
 
 	// Set a timeout value on the request context (ctx), that will signal
 	// through ctx.Done() that the request has timed out and further
 	// processing should be stopped.
 	r.Use(middleware.Timeout(config.GetTimeout()))
 
-	r.Route("/session", func(r chi.Router) {
-		r.With(service.NewSessionMiddleware).Post("/", service.NewSession)
-	})
+	r.Method(http.MethodGet, "/metrics", metrics.Handler())
+	r.Get("/healthz", readiness.Live)
+	r.Get("/readyz", readiness.Ready)
+
+	routes := func(r chi.Router) {
+		r.Use(service.TenantMiddleware(config.GetTenants(), config.GetTenantSelector()))
+
+		if config.GetIssuer() != "" {
+			r.Get(service.MetadataPath, service.ServerMetadata(config.GetIssuer(),
+				config.GetTlsConfig().ClientCaFile != ""))
+		}
+
+		r.Route("/session", func(r chi.Router) {
+			r.Use(deviceMiddleware)
+			r.With(service.NewSessionMiddleware).Post("/", service.NewSession)
+			r.With(service.NewSessionChallengeMiddleware).Post("/challenge", service.NewSession)
+			r.With(service.NewSessionCertificateMiddleware).Post("/certificate", service.NewSession)
+			r.Delete("/", service.Logout)
+			r.With(service.AuthenticatedMiddleware, service.RefreshSessionMiddleware).Post("/refresh",
+				service.NewSession)
+		})
+
+		r.Get("/auth/verify", service.ForwardAuth(config.GetForwardAuthLoginUrl(),
+			config.GetForwardAuthRedirectHosts()))
+
+		r.Route("/login/{provider}", func(r chi.Router) {
+			r.Use(oidcMiddleware, deviceMiddleware)
+			r.Get("/", service.OidcLogin)
+			r.With(service.OidcCallbackMiddleware).Get("/callback", service.NewSession)
+		})
+
+		r.Route("/saml/{idp}", func(r chi.Router) {
+			r.Use(samlMiddleware, deviceMiddleware)
+			r.Get("/metadata", service.SamlMetadata)
+			r.Get("/login", service.SamlLogin)
+			r.With(service.SamlAcsMiddleware).Post("/acs", service.NewSession)
+		})
+
+		r.Route("/user", func(r chi.Router) {
+			r.With(service.NewUserMiddleware).Post("/", service.NewUser)
+			r.With(service.AuthenticatedMiddleware).Get("/me/groups", service.GetMyGroups)
+			r.With(service.AuthenticatedMiddleware).Get("/me/sessions", service.GetMySessions)
+			r.With(service.AuthenticatedMiddleware).Delete("/me/sessions/{sessionId}", service.RevokeMySession)
+		})
+
+		r.Route("/group", func(r chi.Router) {
+			r.Use(service.ServiceTokenMiddleware)
+			r.Use(service.AuditAdminMiddleware)
+			r.Post("/", service.NewGroup)
+			r.Get("/", service.ListGroups)
+
+			r.Route("/{groupId}", func(r chi.Router) {
+				r.Use(service.GroupCtx)
+				r.Get("/", service.GetGroup)
+				r.Put("/", service.UpdateGroup)
+				r.Delete("/", service.DeleteGroup)
+				r.Get("/members", service.GetGroupMembers)
+				r.Put("/users/{userId}", service.AddGroupUser)
+				r.Delete("/users/{userId}", service.RemoveGroupUser)
+				r.Put("/groups/{memberGroupId}", service.AddSubgroup)
+				r.Delete("/groups/{memberGroupId}", service.RemoveSubgroup)
+			})
+		})
+
+		r.Route("/authz", func(r chi.Router) {
+			r.Group(func(r chi.Router) {
+				r.Use(service.ServiceTokenMiddleware)
+				r.Post("/check", service.Check)
+				r.Post("/expand", service.Expand)
+				r.With(service.AuditAdminMiddleware).Post("/write", service.WriteTuples)
+			})
+
+			r.With(service.AuthenticatedMiddleware).Post("/decide", service.Decide)
+		})
+
+		r.Route("/webhook", func(r chi.Router) {
+			r.Use(service.ServiceTokenMiddleware)
+			r.Use(service.AuditAdminMiddleware)
+			r.Post("/", service.NewWebhook)
+			r.Get("/", service.ListWebhooks)
+			r.Get("/deliveries", service.ListDeliveries)
+			r.Post("/deliveries/{deliveryId}/replay", service.ReplayDelivery)
+			r.Delete("/{webhookId}", service.DeleteWebhook)
+		})
+
+		r.Route("/scim/v2", func(r chi.Router) {
+			r.Use(service.ServiceTokenMiddleware)
+			r.Use(service.AuditAdminMiddleware)
+			r.Get("/ServiceProviderConfig", service.ScimServiceProviderConfig)
+			r.Get("/ResourceTypes", service.ScimResourceTypes)
+			r.Get("/ResourceTypes/{resourceTypeId}", service.ScimResourceTypes)
+			r.Get("/Schemas", service.ScimSchemas)
+			r.Get("/Schemas/{schemaId}", service.ScimSchemas)
+			r.Post("/Users", service.ScimCreateUser)
+			r.Get("/Users", service.ScimListUsers)
+			r.Get("/Users/{userId}", service.ScimGetUser)
+			r.Patch("/Users/{userId}", service.ScimPatchUser)
+			r.Delete("/Users/{userId}", service.ScimDeleteUser)
+			r.Post("/Groups", service.ScimCreateGroup)
+			r.Get("/Groups", service.ScimListGroups)
+			r.Get("/Groups/{groupId}", service.ScimGetGroup)
+			r.Patch("/Groups/{groupId}", service.ScimPatchGroup)
+			r.Delete("/Groups/{groupId}", service.ScimDeleteGroup)
+		})
+
+		r.Route("/audit", func(r chi.Router) {
+			r.Use(service.ServiceTokenMiddleware)
+			r.Get("/", service.QueryAudit)
+		})
+	}
+
+	if config.GetTenantSelector() == common.PathTenantSelector {
+		r.Route(fmt.Sprintf("/tenant/{%s}", service.TenantParam), routes)
+	} else {
+		r.Group(routes)
+	}
+
+	manager.Server.Handler = r
+
+	if config.GetTlsConfig().Enabled() {
+		tlsConfig, certificate, err := tlsserver.NewConfig(config.GetTlsConfig())
 
-	r.Route("/user", func(r chi.Router) {
-		r.With(service.NewUserMiddleware).Post("/", service.NewUser)
-	})
+		if err != nil {
+			logging.Fatal("Unable to configure TLS", err)
+		}
+
+		manager.Server.TLSConfig = tlsConfig
+
+		if config.GetTlsConfig().ReloadInterval > 0 {
+			manager.Go(func(stop <-chan struct{}) {
+				certificate.Watch(config.GetTlsConfig().ReloadInterval, stop)
+			})
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	if err = manager.Run(ctx); err != nil {
+		logging.Fatal("Unable to serve", err)
+	}
+}
+
+// runPolicyTests runs the tests bundled with the policies at path, reporting each result, and returns the process
+// exit code.
+func runPolicyTests(path string) int {
+	if path == "" {
+		fmt.Println("No policies configured")
+		return 1
+	}
+
+	set, err := policy.LoadSet(path)
+
+	if err != nil {
+		fmt.Printf("Unable to load policies: %s\n", err.Error())
+		return 1
+	}
+
+	failed := 0
+
+	for _, result := range policy.RunTests(set) {
+		if result.Passed {
+			fmt.Printf("PASS %s\n", result.Name)
+		} else {
+			failed++
+			fmt.Printf("FAIL %s: expected %s, got %s %s\n", result.Name, result.Expected, result.Actual,
+				result.Error)
+		}
+	}
+
+	fmt.Printf("%d passed, %d failed\n", len(set.Tests)-failed, failed)
+
+	if failed > 0 {
+		return 1
+	}
 
-	http.ListenAndServe(":3333", r)
+	return 0
 }
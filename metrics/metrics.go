@@ -0,0 +1,141 @@
+package metrics
+
+import (
+	"database/sql"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxFailureReasons caps the distinct login failure reasons counted, later ones are counted as "other" so that
+// unexpected error messages can't grow the number of series without bound.
+const maxFailureReasons = 50
+
+var (
+	requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_http_requests_total",
+		Help: "HTTP requests handled, by method, route and status.",
+	}, []string{"method", "route", "status"})
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "auth_http_request_duration_seconds",
+		Help:    "Time taken to handle HTTP requests, by method, route and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+	logins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_logins_total",
+		Help: "Login attempts, by result and the reason failed ones were refused.",
+	}, []string{"result", "reason"})
+	signups = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "auth_signups_total",
+		Help: "Users signed up.",
+	})
+	hashDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "auth_password_hash_duration_seconds",
+		Help:    "Time taken by bcrypt to hash or compare passwords, by operation.",
+		Buckets: []float64{.01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"operation"})
+	tokens = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_tokens_issued_total",
+		Help: "Tokens issued, by signing method.",
+	}, []string{"method"})
+
+	reasonsMutex sync.Mutex
+	reasons      = make(map[string]bool)
+
+	dbMutex sync.Mutex
+	dbStats = make(map[string]prometheus.Collector)
+)
+
+func init() {
+	prometheus.MustRegister(requests, requestDuration, logins, signups, hashDuration, tokens)
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// Middleware counts and times requests by the route they matched, so that ids in URLs don't each get their own
+// series. Requests matching no route are counted under "unmatched".
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		route := "unmatched"
+
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+
+		status := ww.Status()
+
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		labels := prometheus.Labels{"method": r.Method, "route": route, "status": strconv.Itoa(status)}
+		requests.With(labels).Inc()
+		requestDuration.With(labels).Observe(time.Since(start).Seconds())
+	})
+}
+
+// LoginSucceeded counts a successful login.
+func LoginSucceeded() {
+	logins.WithLabelValues("success", "").Inc()
+}
+
+// LoginFailed counts a refused login with the reason it was refused.
+func LoginFailed(reason string) {
+	reasonsMutex.Lock()
+
+	if !reasons[reason] {
+		if len(reasons) >= maxFailureReasons {
+			reason = "other"
+		} else {
+			reasons[reason] = true
+		}
+	}
+
+	reasonsMutex.Unlock()
+
+	logins.WithLabelValues("failure", reason).Inc()
+}
+
+// SignedUp counts a user signing up.
+func SignedUp() {
+	signups.Inc()
+}
+
+// ObservePasswordHash records how long bcrypt took to hash ("hash") or compare ("compare") a password since start.
+func ObservePasswordHash(operation string, start time.Time) {
+	hashDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
+
+// TokenIssued counts a token signed with the given JWT signing method, such as "RS512".
+func TokenIssued(method string) {
+	tokens.WithLabelValues(method).Inc()
+}
+
+// RegisterDB exposes the connection pool statistics of a database under the given name, replacing those of any
+// database previously registered with the name.
+func RegisterDB(name string, db *sql.DB) {
+	dbMutex.Lock()
+	defer dbMutex.Unlock()
+
+	if previous, ok := dbStats[name]; ok {
+		prometheus.Unregister(previous)
+	}
+
+	collector := collectors.NewDBStatsCollector(db, name)
+	prometheus.MustRegister(collector)
+	dbStats[name] = collector
+}
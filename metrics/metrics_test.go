@@ -0,0 +1,64 @@
+package metrics_test
+
+import (
+	"github.com/go-chi/chi"
+	"github.com/stone1549/auth-service/metrics"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// scrape renders the metrics as they'd be exposed to Prometheus.
+func scrape(t *testing.T) string {
+	recorder := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body, err := ioutil.ReadAll(recorder.Body)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(body)
+}
+
+// assertContains fails the test if the metrics don't contain the given series.
+func assertContains(t *testing.T, exposed, series string) {
+	if !strings.Contains(exposed, series) {
+		t.Fatalf("expected metrics to contain %s, got:\n%s", series, exposed)
+	}
+}
+
+// TestMiddleware ensures requests are counted by the route they matched rather than their path.
+func TestMiddleware(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(metrics.Middleware)
+	r.Get("/group/{groupId}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	for _, path := range []string{"/group/1", "/group/2", "/nowhere"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	exposed := scrape(t)
+	assertContains(t, exposed, `auth_http_requests_total{method="GET",route="/group/{groupId}",status="404"} 2`)
+	assertContains(t, exposed, `auth_http_requests_total{method="GET",route="unmatched",status="404"} 1`)
+	assertContains(t, exposed, `auth_http_request_duration_seconds_count{method="GET",route="/group/{groupId}"`)
+}
+
+// TestLoginFailed ensures failed logins are counted by reason, and that reasons beyond the cap are counted as other.
+func TestLoginFailed(t *testing.T) {
+	metrics.LoginSucceeded()
+	metrics.LoginFailed("user not found")
+
+	for i := 0; i < 100; i++ {
+		metrics.LoginFailed(strings.Repeat("x", i+1))
+	}
+
+	exposed := scrape(t)
+	assertContains(t, exposed, `auth_logins_total{reason="",result="success"} 1`)
+	assertContains(t, exposed, `auth_logins_total{reason="user not found",result="failure"} 1`)
+	assertContains(t, exposed, `auth_logins_total{reason="other",result="failure"} 51`)
+}
@@ -0,0 +1,171 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// LoginTimeout is how long a user has to complete a login with a provider.
+	LoginTimeout = 10 * time.Minute
+	// maxPendingLogins caps the logins awaiting their callback, the oldest are forgotten first.
+	maxPendingLogins = 10000
+)
+
+type pendingLogin struct {
+	provider string
+	tenantId string
+	nonce    string
+	verifier string
+	expires  time.Time
+}
+
+// Federation holds the upstream providers users can log in with and the logins awaiting their callback.
+type Federation struct {
+	providers map[string]*Provider
+	mutex     sync.Mutex
+	pending   map[string]pendingLogin
+	order     []string
+}
+
+// NewFederation constructs a Federation of the given providers.
+func NewFederation(providers ...*Provider) (*Federation, error) {
+	federation := &Federation{providers: make(map[string]*Provider), pending: make(map[string]pendingLogin)}
+
+	for _, provider := range providers {
+		if _, ok := federation.providers[provider.Name()]; ok {
+			return nil, errors.New(fmt.Sprintf("provider %s is configured more than once", provider.Name()))
+		}
+
+		federation.providers[provider.Name()] = provider
+	}
+
+	return federation, nil
+}
+
+// LoadFederation reads a JSON array of provider configurations, no providers are configured when path is empty.
+func LoadFederation(path string, client *http.Client) (*Federation, error) {
+	if path == "" {
+		return NewFederation()
+	}
+
+	src, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var configs []ProviderConfig
+	err = json.Unmarshal(src, &configs)
+
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("invalid provider configuration: %s", err.Error()))
+	}
+
+	providers := make([]*Provider, 0, len(configs))
+
+	for _, config := range configs {
+		provider, err := NewProvider(config, client)
+
+		if err != nil {
+			return nil, err
+		}
+
+		providers = append(providers, provider)
+	}
+
+	return NewFederation(providers...)
+}
+
+// Begin starts a login with the named provider for a tenant, returning the URL to send the user to and the state
+// identifying the login, which the caller should bind to the user's browser.
+func (f *Federation) Begin(ctx context.Context, providerName, tenantId string) (string, string, error) {
+	provider, ok := f.providers[providerName]
+
+	if !ok {
+		return "", "", errors.New(fmt.Sprintf("unknown provider %s", providerName))
+	}
+
+	state, err := randomString()
+
+	if err != nil {
+		return "", "", err
+	}
+
+	nonce, err := randomString()
+
+	if err != nil {
+		return "", "", err
+	}
+
+	verifier, err := randomString()
+
+	if err != nil {
+		return "", "", err
+	}
+
+	authUrl, err := provider.AuthCodeUrl(ctx, state, nonce, verifier)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if len(f.order) >= maxPendingLogins {
+		f.forget(len(f.order) - maxPendingLogins + 1)
+	}
+
+	f.pending[state] = pendingLogin{provider: providerName, tenantId: tenantId, nonce: nonce, verifier: verifier,
+		expires: time.Now().Add(LoginTimeout)}
+	f.order = append(f.order, state)
+
+	return authUrl, state, nil
+}
+
+// Complete finishes the login identified by state with the code the provider returned, each login can only be
+// completed once and only by the provider and tenant that began it.
+func (f *Federation) Complete(ctx context.Context, providerName, tenantId, state, code string) (Identity, error) {
+	f.mutex.Lock()
+	login, ok := f.pending[state]
+	delete(f.pending, state)
+	f.mutex.Unlock()
+
+	if !ok || time.Now().After(login.expires) {
+		return Identity{}, errors.New("unknown or expired login")
+	} else if login.provider != providerName || login.tenantId != tenantId {
+		return Identity{}, errors.New("login was started elsewhere")
+	} else if code == "" {
+		return Identity{}, errors.New("code is required")
+	}
+
+	return f.providers[providerName].Exchange(ctx, code, login.nonce, login.verifier)
+}
+
+// forget drops the oldest pending logins, along with the order of those already completed.
+func (f *Federation) forget(count int) {
+	for _, state := range f.order[:count] {
+		delete(f.pending, state)
+	}
+
+	f.order = append([]string{}, f.order[count:]...)
+}
+
+func randomString() (string, error) {
+	value := make([]byte, 32)
+
+	if _, err := rand.Read(value); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(value), nil
+}
@@ -0,0 +1,356 @@
+package oidc_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stone1549/auth-service/oidc"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testClientId     = "auth-service"
+	testClientSecret = "client-secret"
+	testRedirectUrl  = "https://auth.example.com/login/mock/callback"
+)
+
+type authorization struct {
+	challenge string
+	nonce     string
+}
+
+// mockProvider is a local OpenID Connect provider issuing ID tokens for jane, claims can be overridden per test.
+type mockProvider struct {
+	server  *httptest.Server
+	key     *rsa.PrivateKey
+	mutex   sync.Mutex
+	codes   map[string]authorization
+	claims  jwt.MapClaims
+	fetches int
+}
+
+func startMockProvider(t *testing.T) *mockProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	ok(t, err)
+
+	mock := &mockProvider{key: key, codes: make(map[string]authorization), claims: jwt.MapClaims{}}
+	mux := http.NewServeMux()
+	mock.server = httptest.NewServer(mux)
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 mock.server.URL,
+			"authorization_endpoint": mock.server.URL + "/authorize",
+			"token_endpoint":         mock.server.URL + "/token",
+			"jwks_uri":               mock.server.URL + "/jwks",
+		})
+	})
+
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		mock.mutex.Lock()
+		mock.fetches++
+		mock.mutex.Unlock()
+
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "key-1",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		clientId, secret, _ := r.BasicAuth()
+		mock.mutex.Lock()
+		auth, found := mock.codes[r.PostFormValue("code")]
+		delete(mock.codes, r.PostFormValue("code"))
+		mock.mutex.Unlock()
+
+		verifier := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+
+		if clientId != testClientId || secret != testClientSecret || !found ||
+			r.PostFormValue("redirect_uri") != testRedirectUrl ||
+			base64.RawURLEncoding.EncodeToString(verifier[:]) != auth.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{"id_token": mock.idToken(auth.nonce)})
+	})
+
+	return mock
+}
+
+// authorize approves the login the user was sent to the provider for, returning the code the provider redirects
+// back with.
+func (mp *mockProvider) authorize(t *testing.T, authUrl string) string {
+	parsed, err := url.Parse(authUrl)
+	ok(t, err)
+	query := parsed.Query()
+	equals(t, mp.server.URL+"/authorize", parsed.Scheme+"://"+parsed.Host+parsed.Path)
+	equals(t, "code", query.Get("response_type"))
+	equals(t, testClientId, query.Get("client_id"))
+	equals(t, testRedirectUrl, query.Get("redirect_uri"))
+	equals(t, "S256", query.Get("code_challenge_method"))
+
+	mp.mutex.Lock()
+	defer mp.mutex.Unlock()
+
+	code := fmt.Sprintf("code-%d", len(mp.codes)+1)
+	mp.codes[code] = authorization{challenge: query.Get("code_challenge"), nonce: query.Get("nonce")}
+	return code
+}
+
+func (mp *mockProvider) idToken(nonce string) string {
+	claims := jwt.MapClaims{
+		"iss":            mp.server.URL,
+		"aud":            testClientId,
+		"sub":            "jane-subject",
+		"email":          "jane@example.com",
+		"email_verified": true,
+		"name":           "Jane Doe",
+		"nonce":          nonce,
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(time.Minute).Unix(),
+	}
+
+	for name, value := range mp.claims {
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "key-1"
+	signed, _ := token.SignedString(mp.key)
+	return signed
+}
+
+func (mp *mockProvider) provider(t *testing.T, name string) *oidc.Provider {
+	provider, err := oidc.NewProvider(oidc.ProviderConfig{
+		Name:         name,
+		Issuer:       mp.server.URL,
+		ClientId:     testClientId,
+		ClientSecret: testClientSecret,
+		RedirectUrl:  testRedirectUrl,
+	}, mp.server.Client())
+	ok(t, err)
+	return provider
+}
+
+// TestFederation_Login ensures a login begun with a provider completes with the identity of its ID token, and only
+// once.
+func TestFederation_Login(t *testing.T) {
+	mock := startMockProvider(t)
+	defer mock.server.Close()
+	federation, err := oidc.NewFederation(mock.provider(t, "mock"))
+	ok(t, err)
+	ctx := context.Background()
+
+	authUrl, state, err := federation.Begin(ctx, "mock", "default")
+	ok(t, err)
+	code := mock.authorize(t, authUrl)
+
+	identity, err := federation.Complete(ctx, "mock", "default", state, code)
+	ok(t, err)
+	equals(t, oidc.Identity{Provider: "mock", Subject: "jane-subject", Email: "jane@example.com",
+		EmailVerified: true, Name: "Jane Doe"}, identity)
+
+	_, err = federation.Complete(ctx, "mock", "default", state, code)
+	notOk(t, err)
+
+	_, _, err = federation.Begin(ctx, "unknown", "default")
+	notOk(t, err)
+}
+
+// TestFederation_CompleteElsewhere ensures logins can only be completed by the provider and tenant that began them.
+func TestFederation_CompleteElsewhere(t *testing.T) {
+	mock := startMockProvider(t)
+	defer mock.server.Close()
+	federation, err := oidc.NewFederation(mock.provider(t, "mock"), mock.provider(t, "other"))
+	ok(t, err)
+	ctx := context.Background()
+
+	authUrl, state, err := federation.Begin(ctx, "mock", "default")
+	ok(t, err)
+	code := mock.authorize(t, authUrl)
+
+	_, err = federation.Complete(ctx, "mock", "other-tenant", state, code)
+	notOk(t, err)
+
+	authUrl, state, err = federation.Begin(ctx, "mock", "default")
+	ok(t, err)
+	code = mock.authorize(t, authUrl)
+
+	_, err = federation.Complete(ctx, "other", "default", state, code)
+	notOk(t, err)
+
+	_, err = federation.Complete(ctx, "mock", "default", "unknown-state", code)
+	notOk(t, err)
+}
+
+// TestProvider_Exchange ensures codes are only redeemed with the verifier of the challenge they were issued for.
+func TestProvider_Exchange(t *testing.T) {
+	mock := startMockProvider(t)
+	defer mock.server.Close()
+	provider := mock.provider(t, "mock")
+	ctx := context.Background()
+
+	authUrl, err := provider.AuthCodeUrl(ctx, "state", "nonce", "verifier")
+	ok(t, err)
+	code := mock.authorize(t, authUrl)
+
+	_, err = provider.Exchange(ctx, code, "nonce", "other-verifier")
+	notOk(t, err)
+
+	authUrl, err = provider.AuthCodeUrl(ctx, "state", "nonce", "verifier")
+	ok(t, err)
+	code = mock.authorize(t, authUrl)
+
+	identity, err := provider.Exchange(ctx, code, "nonce", "verifier")
+	ok(t, err)
+	equals(t, "jane-subject", identity.Subject)
+}
+
+// TestProvider_Verify ensures ID tokens are refused unless they're signed by the provider, issued by it for this
+// client, unexpired and carry the login's nonce.
+func TestProvider_Verify(t *testing.T) {
+	mock := startMockProvider(t)
+	defer mock.server.Close()
+	provider := mock.provider(t, "mock")
+	ctx := context.Background()
+
+	identity, err := provider.Verify(ctx, mock.idToken("nonce"), "nonce")
+	ok(t, err)
+	equals(t, "jane@example.com", identity.Email)
+
+	_, err = provider.Verify(ctx, mock.idToken("nonce"), "other-nonce")
+	notOk(t, err)
+
+	for _, claims := range []jwt.MapClaims{
+		{"iss": "https://evil.example.com"},
+		{"aud": "other-client"},
+		{"aud": []string{testClientId, "other-client"}},
+		{"exp": time.Now().Add(-time.Minute).Unix()},
+		{"exp": nil},
+		{"sub": nil},
+	} {
+		mock.claims = claims
+		_, err = provider.Verify(ctx, mock.idToken("nonce"), "nonce")
+		notOk(t, err)
+	}
+
+	mock.claims = jwt.MapClaims{"aud": []string{testClientId, "other-client"}, "azp": testClientId,
+		"email_verified": "false"}
+	identity, err = provider.Verify(ctx, mock.idToken("nonce"), "nonce")
+	ok(t, err)
+	equals(t, false, identity.EmailVerified)
+
+	hmac := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"iss": mock.server.URL, "aud": testClientId,
+		"sub": "jane-subject", "nonce": "nonce", "exp": time.Now().Add(time.Minute).Unix()})
+	hmac.Header["kid"] = "key-1"
+	signed, err := hmac.SignedString([]byte("secret"))
+	ok(t, err)
+	_, err = provider.Verify(ctx, signed, "nonce")
+	notOk(t, err)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ok(t, err)
+	unknown := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{"iss": mock.server.URL, "aud": testClientId,
+		"sub": "jane-subject", "nonce": "nonce", "exp": time.Now().Add(time.Minute).Unix()})
+	unknown.Header["kid"] = "key-2"
+	signed, err = unknown.SignedString(ecKey)
+	ok(t, err)
+	_, err = provider.Verify(ctx, signed, "nonce")
+	notOk(t, err)
+	equals(t, 1, mock.fetches)
+}
+
+// TestLoadFederation ensures providers are loaded from a JSON file and refused when incomplete or duplicated.
+func TestLoadFederation(t *testing.T) {
+	_, err := oidc.LoadFederation("", http.DefaultClient)
+	ok(t, err)
+
+	dir, err := ioutil.TempDir("", "oidc")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "providers.json")
+
+	provider := `{"name": "google", "issuer": "https://accounts.google.com", "clientId": "id", ` +
+		`"redirectUrl": "https://auth.example.com/login/google/callback"}`
+
+	ok(t, ioutil.WriteFile(path, []byte("["+provider+"]"), 0600))
+	federation, err := oidc.LoadFederation(path, http.DefaultClient)
+	ok(t, err)
+	assert(t, federation != nil, "expected a federation")
+
+	ok(t, ioutil.WriteFile(path, []byte("["+provider+","+provider+"]"), 0600))
+	_, err = oidc.LoadFederation(path, http.DefaultClient)
+	notOk(t, err)
+
+	ok(t, ioutil.WriteFile(path, []byte(`[{"name": "google", "issuer": "https://accounts.google.com"}]`), 0600))
+	_, err = oidc.LoadFederation(path, http.DefaultClient)
+	notOk(t, err)
+
+	ok(t, ioutil.WriteFile(path, []byte(`{`), 0600))
+	_, err = oidc.LoadFederation(path, http.DefaultClient)
+	notOk(t, err)
+}
+
+// assert fails the test if the condition is false.
+func assert(tb testing.TB, condition bool, msg string, v ...interface{}) {
+	if !condition {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: "+msg+"\033[39m\n\n", append([]interface{}{filepath.Base(file), line}, v...)...)
+		tb.FailNow()
+	}
+}
+
+// ok fails the test if an err is not nil.
+func ok(tb testing.TB, err error) {
+	if err != nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: unexpected error: %s\033[39m\n\n", filepath.Base(file), line, err.Error())
+		tb.FailNow()
+	}
+}
+
+// notOk fails the test if an err is nil.
+func notOk(tb testing.TB, err error) {
+	if err == nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: expected error\033[39m\n\n", filepath.Base(file), line)
+		tb.FailNow()
+	}
+}
+
+// equals fails the test if exp is not equal to act.
+func equals(tb testing.TB, exp, act interface{}) {
+	if !reflect.DeepEqual(exp, act) {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d:\n\n\texp: %#v\n\n\tgot: %#v\033[39m\n\n", filepath.Base(file), line, exp, act)
+		tb.FailNow()
+	}
+}
@@ -0,0 +1,434 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// keyRefreshInterval limits how often a provider's keys are fetched for tokens signed with an unknown key.
+const keyRefreshInterval = time.Minute
+
+// DefaultScopes are requested from providers that don't configure their own.
+var DefaultScopes = []string{"openid", "email", "profile"}
+
+// ProviderConfig is the configuration of an upstream OpenID Connect provider.
+type ProviderConfig struct {
+	// Name identifies the provider in login URLs, such as google in /login/google.
+	Name string `json:"name"`
+	// Issuer is the provider's issuer identifier, its metadata is discovered under it.
+	Issuer       string `json:"issuer"`
+	ClientId     string `json:"clientId"`
+	ClientSecret string `json:"clientSecret"`
+	// RedirectUrl is the absolute URL of the provider's callback, it must be registered with the provider.
+	RedirectUrl string   `json:"redirectUrl"`
+	Scopes      []string `json:"scopes"`
+}
+
+// Identity is the verified identity of a user asserted by a provider's ID token.
+type Identity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksUri               string `json:"jwks_uri"`
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// Provider is an upstream OpenID Connect provider, its metadata and signing keys are fetched when first needed and
+// its keys are fetched again when a token is signed with a key it doesn't know.
+type Provider struct {
+	config ProviderConfig
+	client *http.Client
+	mutex  sync.Mutex
+	meta   *metadata
+	keys   map[string]interface{}
+	// fetched is when the keys were last fetched.
+	fetched time.Time
+}
+
+// NewProvider constructs a Provider making its requests with client.
+func NewProvider(config ProviderConfig, client *http.Client) (*Provider, error) {
+	if config.Name == "" {
+		return nil, errors.New("provider name is required")
+	} else if config.Issuer == "" || config.ClientId == "" || config.RedirectUrl == "" {
+		return nil, errors.New(fmt.Sprintf("provider %s requires an issuer, client id and redirect url",
+			config.Name))
+	}
+
+	if len(config.Scopes) == 0 {
+		config.Scopes = DefaultScopes
+	}
+
+	return &Provider{config: config, client: client}, nil
+}
+
+// Name identifies the provider.
+func (p *Provider) Name() string {
+	return p.config.Name
+}
+
+// AuthCodeUrl is the URL users are sent to to log in, the code challenge of the verifier binds the code issued to
+// the login.
+func (p *Provider) AuthCodeUrl(ctx context.Context, state, nonce, verifier string) (string, error) {
+	meta, err := p.metadata(ctx)
+
+	if err != nil {
+		return "", err
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.config.ClientId},
+		"redirect_uri":          {p.config.RedirectUrl},
+		"scope":                 {strings.Join(p.config.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+
+	return meta.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange redeems an authorization code at the provider's token endpoint and verifies the ID token it returns.
+func (p *Provider) Exchange(ctx context.Context, code, nonce, verifier string) (Identity, error) {
+	meta, err := p.metadata(ctx)
+
+	if err != nil {
+		return Identity{}, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectUrl},
+		"client_id":     {p.config.ClientId},
+		"code_verifier": {verifier},
+	}
+
+	req, err := http.NewRequest(http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+
+	if err != nil {
+		return Identity{}, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	if p.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientId), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	var tokens struct {
+		IdToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+
+	status, err := p.getJson(req.WithContext(ctx), &tokens)
+
+	if err != nil {
+		return Identity{}, err
+	} else if status != http.StatusOK {
+		return Identity{}, errors.New(fmt.Sprintf("provider %s refused the code: %s %s", p.config.Name,
+			tokens.Error, tokens.ErrorDescription))
+	} else if tokens.IdToken == "" {
+		return Identity{}, errors.New(fmt.Sprintf("provider %s didn't return an id token", p.config.Name))
+	}
+
+	return p.Verify(ctx, tokens.IdToken, nonce)
+}
+
+// Verify validates an ID token's signature against the provider's keys and its issuer, audience, expiry and
+// nonce, then returns the identity it asserts.
+func (p *Provider) Verify(ctx context.Context, idToken, nonce string) (Identity, error) {
+	meta, err := p.metadata(ctx)
+
+	if err != nil {
+		return Identity{}, err
+	}
+
+	parsed, err := jwt.Parse(idToken, func(token *jwt.Token) (interface{}, error) {
+		switch token.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA, *jwt.SigningMethodRSAPSS:
+		default:
+			return nil, errors.New(fmt.Sprintf("unexpected id token signing method %s", token.Method.Alg()))
+		}
+
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, kid)
+	})
+
+	if err != nil {
+		return Identity{}, errors.New(fmt.Sprintf("invalid id token: %s", err.Error()))
+	}
+
+	claims, ok := parsed.Claims.(jwt.MapClaims)
+
+	if !ok || !parsed.Valid {
+		return Identity{}, errors.New("invalid id token")
+	}
+
+	if iss, _ := claims["iss"].(string); iss != meta.Issuer {
+		return Identity{}, errors.New("id token wasn't issued by the provider")
+	}
+
+	audiences := audience(claims["aud"])
+
+	if !contains(audiences, p.config.ClientId) {
+		return Identity{}, errors.New("id token wasn't issued for this client")
+	} else if azp, _ := claims["azp"].(string); len(audiences) > 1 && azp != p.config.ClientId {
+		return Identity{}, errors.New("id token wasn't issued for this client")
+	}
+
+	if _, ok := claims["exp"]; !ok {
+		return Identity{}, errors.New("id token doesn't expire")
+	}
+
+	if claimNonce, _ := claims["nonce"].(string); claimNonce == "" || claimNonce != nonce {
+		return Identity{}, errors.New("id token nonce doesn't match the login")
+	}
+
+	identity := Identity{Provider: p.config.Name}
+	identity.Subject, _ = claims["sub"].(string)
+	identity.Email, _ = claims["email"].(string)
+	identity.Name, _ = claims["name"].(string)
+
+	// Some providers send email_verified as a string.
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		identity.EmailVerified = verified
+	case string:
+		identity.EmailVerified = verified == "true"
+	}
+
+	if identity.Subject == "" {
+		return Identity{}, errors.New("id token has no subject")
+	}
+
+	return identity, nil
+}
+
+func (p *Provider) metadata(ctx context.Context) (*metadata, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.meta != nil {
+		return p.meta, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet,
+		strings.TrimSuffix(p.config.Issuer, "/")+"/.well-known/openid-configuration", nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var meta metadata
+	status, err := p.getJson(req.WithContext(ctx), &meta)
+
+	if err != nil {
+		return nil, err
+	} else if status != http.StatusOK {
+		return nil, errors.New(fmt.Sprintf("unable to discover provider %s, status %d", p.config.Name, status))
+	}
+
+	if meta.Issuer != p.config.Issuer {
+		return nil, errors.New(fmt.Sprintf("provider %s reports issuer %s", p.config.Name, meta.Issuer))
+	} else if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JwksUri == "" {
+		return nil, errors.New(fmt.Sprintf("provider %s metadata is incomplete", p.config.Name))
+	}
+
+	p.meta = &meta
+	return p.meta, nil
+}
+
+// key finds the signing key with the given id, fetching the provider's keys when it isn't known yet.
+func (p *Provider) key(ctx context.Context, kid string) (interface{}, error) {
+	p.mutex.Lock()
+	key, ok := p.keys[kid]
+	fresh := time.Since(p.fetched) < keyRefreshInterval
+	p.mutex.Unlock()
+
+	if ok {
+		return key, nil
+	} else if fresh {
+		return nil, errors.New(fmt.Sprintf("provider %s has no signing key %s", p.config.Name, kid))
+	}
+
+	req, err := http.NewRequest(http.MethodGet, p.meta.JwksUri, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+
+	status, err := p.getJson(req.WithContext(ctx), &set)
+
+	if err != nil {
+		return nil, err
+	} else if status != http.StatusOK {
+		return nil, errors.New(fmt.Sprintf("unable to fetch provider %s keys, status %d", p.config.Name, status))
+	}
+
+	keys := make(map[string]interface{})
+
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		if parsed, err := k.publicKey(); err == nil {
+			keys[k.Kid] = parsed
+		}
+	}
+
+	p.mutex.Lock()
+	p.keys = keys
+	p.fetched = time.Now()
+	p.mutex.Unlock()
+
+	key, ok = keys[kid]
+
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("provider %s has no signing key %s", p.config.Name, kid))
+	}
+
+	return key, nil
+}
+
+func (p *Provider) getJson(req *http.Request, v interface{}) (int, error) {
+	resp, err := p.client.Do(req)
+
+	if err != nil {
+		return 0, errors.New(fmt.Sprintf("unable to reach provider %s: %s", p.config.Name, err.Error()))
+	}
+
+	defer resp.Body.Close()
+
+	err = json.NewDecoder(resp.Body).Decode(v)
+
+	if err != nil && resp.StatusCode == http.StatusOK {
+		return 0, errors.New(fmt.Sprintf("invalid response from provider %s: %s", p.config.Name, err.Error()))
+	}
+
+	return resp.StatusCode, nil
+}
+
+func (k jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, errors.New(fmt.Sprintf("unsupported curve %s", k.Crv))
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	default:
+		return nil, errors.New(fmt.Sprintf("unsupported key type %s", k.Kty))
+	}
+}
+
+func audience(aud interface{}) []string {
+	switch aud := aud.(type) {
+	case string:
+		return []string{aud}
+	case []interface{}:
+		audiences := make([]string, 0, len(aud))
+
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				audiences = append(audiences, s)
+			}
+		}
+
+		return audiences
+	default:
+		return nil
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,132 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/stone1549/auth-service/common"
+	"github.com/stone1549/auth-service/logging"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// IdempotencyKeyHeader carries an event's id on HTTP publishes, it's the same every time the event is published.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// EventPublisher represents a destination outbox events are published to. Events are published at least once, so
+// consumers should discard events whose id they've already seen.
+type EventPublisher interface {
+	// Publish delivers an event, returning an error if it may not have been delivered.
+	Publish(ctx context.Context, event common.OutboxEvent) error
+}
+
+// NewEventPublisher constructs an EventPublisher from the given configuration.
+func NewEventPublisher(config common.Configuration) (EventPublisher, error) {
+	switch config.GetOutboxPublisherType() {
+	case common.LogOutboxPublisher:
+		return NewLogPublisher(), nil
+	case common.FileOutboxPublisher:
+		return NewFilePublisher(config.GetOutboxTarget())
+	case common.HttpOutboxPublisher:
+		return NewHttpPublisher(config.GetOutboxTarget(), http.DefaultClient), nil
+	default:
+		return nil, errors.New(fmt.Sprintf("outbox publisher type %s unimplemented",
+			config.GetOutboxPublisherType()))
+	}
+}
+
+type logPublisher struct{}
+
+// Publish writes the event to the standard logger.
+func (logPublisher) Publish(ctx context.Context, event common.OutboxEvent) error {
+	logging.FromContext(ctx).Info("Published outbox event", "type", event.Type, "id", event.Id,
+		"aggregateId", event.AggregateId, "payload", string(event.Payload))
+	return nil
+}
+
+// NewLogPublisher constructs an EventPublisher writing events to the standard logger.
+func NewLogPublisher() EventPublisher {
+	return logPublisher{}
+}
+
+type filePublisher struct {
+	mutex sync.Mutex
+	file  *os.File
+}
+
+// NewFilePublisher constructs an EventPublisher appending events as JSON lines to the file at path.
+func NewFilePublisher(path string) (EventPublisher, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &filePublisher{file: file}, nil
+}
+
+// Publish appends the event to the file.
+func (fp *filePublisher) Publish(ctx context.Context, event common.OutboxEvent) error {
+	line, err := json.Marshal(event)
+
+	if err != nil {
+		return err
+	}
+
+	fp.mutex.Lock()
+	defer fp.mutex.Unlock()
+
+	_, err = fp.file.Write(append(line, '\n'))
+
+	return err
+}
+
+type httpPublisher struct {
+	url    string
+	client *http.Client
+}
+
+// NewHttpPublisher constructs an EventPublisher POSTing each event as JSON to url with the event id as its
+// Idempotency-Key header.
+func NewHttpPublisher(url string, client *http.Client) EventPublisher {
+	return &httpPublisher{url, client}
+}
+
+// Publish POSTs the event, any response other than a 2xx is a failure.
+func (hp *httpPublisher) Publish(ctx context.Context, event common.OutboxEvent) error {
+	body, err := json.Marshal(event)
+
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, hp.url, bytes.NewReader(body))
+
+	if err != nil {
+		return err
+	}
+
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(IdempotencyKeyHeader, event.Id)
+
+	resp, err := hp.client.Do(req)
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.New(fmt.Sprintf("publisher responded with %d", resp.StatusCode))
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package outbox_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"github.com/stone1549/auth-service/common"
+	"github.com/stone1549/auth-service/outbox"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var sampleEvent = common.OutboxEvent{
+	Id:          "event-1",
+	TenantId:    "default",
+	AggregateId: "user-1",
+	Type:        common.UserCreatedEvent,
+	Payload:     json.RawMessage(`{"userId":"user-1"}`),
+}
+
+// TestHttpPublisher ensures events are POSTed with their id as the idempotency key and non 2xx responses fail.
+func TestHttpPublisher(t *testing.T) {
+	status := http.StatusAccepted
+	keys := make([]string, 0)
+	var received common.OutboxEvent
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get(outbox.IdempotencyKeyHeader))
+		json.NewDecoder(r.Body).Decode(&received)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	publisher := outbox.NewHttpPublisher(server.URL, server.Client())
+	ok(t, publisher.Publish(context.Background(), sampleEvent))
+	equals(t, sampleEvent.Type, received.Type)
+	equals(t, string(sampleEvent.Payload), string(received.Payload))
+
+	status = http.StatusBadGateway
+	notOk(t, publisher.Publish(context.Background(), sampleEvent))
+	equals(t, []string{"event-1", "event-1"}, keys)
+}
+
+// TestFilePublisher ensures events are appended to the file as JSON lines.
+func TestFilePublisher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outbox")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "events.jsonl")
+	publisher, err := outbox.NewFilePublisher(path)
+	ok(t, err)
+
+	ok(t, publisher.Publish(context.Background(), sampleEvent))
+	ok(t, publisher.Publish(context.Background(), sampleEvent))
+
+	file, err := os.Open(path)
+	ok(t, err)
+	defer file.Close()
+
+	lines := 0
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		var event common.OutboxEvent
+		ok(t, json.Unmarshal(scanner.Bytes(), &event))
+		equals(t, sampleEvent.Id, event.Id)
+		lines++
+	}
+
+	equals(t, 2, lines)
+}
@@ -0,0 +1,110 @@
+package outbox
+
+import (
+	"context"
+	"github.com/stone1549/auth-service/common"
+	"github.com/stone1549/auth-service/logging"
+	"github.com/stone1549/auth-service/repository"
+	"time"
+)
+
+const (
+	// batchSize is the most events claimed at once.
+	batchSize = 20
+	// publishTimeout bounds each attempt to publish an event.
+	publishTimeout = 10 * time.Second
+	// claimLease is how long claimed events are hidden from other relays. It outlasts publishing a whole batch, so
+	// no event is claimed by another relay while this one may still publish it.
+	claimLease = batchSize*publishTimeout + time.Minute
+)
+
+// Relay publishes events recorded in a repository's outbox.
+type Relay interface {
+	// RelayPending publishes every event that's due, returning how many were published.
+	RelayPending(ctx context.Context) (int, error)
+	// Run relays pending events every interval until stop is closed.
+	Run(interval time.Duration, stop <-chan struct{})
+}
+
+type relay struct {
+	repo        repository.OutboxRepository
+	publisher   EventPublisher
+	maxAttempts int
+}
+
+// NewRelay constructs a Relay publishing events from repo's outbox with publisher, marking events dead after
+// maxAttempts failed attempts.
+func NewRelay(repo repository.OutboxRepository, publisher EventPublisher, maxAttempts int) Relay {
+	return &relay{repo, publisher, maxAttempts}
+}
+
+// RelayPending publishes every event that's due. An event is only marked published after the publisher accepts it,
+// so a crash in between publishes it again. Failed events are retried with exponential backoff until they've been
+// attempted the maximum number of times, then marked dead.
+func (r *relay) RelayPending(ctx context.Context) (int, error) {
+	published := 0
+
+	for {
+		events, err := r.repo.ClaimOutbox(ctx, time.Now().UTC(), claimLease, batchSize)
+
+		if err != nil {
+			return published, err
+		}
+
+		for _, event := range events {
+			err = r.publish(ctx, event)
+
+			if err != nil {
+				attempts := event.Attempts + 1
+				dead := attempts >= r.maxAttempts
+
+				if dead {
+					logging.FromContext(ctx).Error("Giving up on publishing outbox event", "eventId", event.Id,
+						"type", event.Type, "attempts", attempts, "error", err.Error())
+				}
+
+				err = r.repo.MarkPublishFailed(ctx, event.Id, err.Error(),
+					time.Now().UTC().Add(common.Backoff(attempts)), dead)
+			} else {
+				published++
+				err = r.repo.MarkPublished(ctx, event.Id)
+			}
+
+			if err != nil {
+				return published, err
+			}
+		}
+
+		if len(events) < batchSize {
+			return published, nil
+		}
+	}
+}
+
+// publish publishes an event within publishTimeout, so that a batch is published within its claim's lease.
+func (r *relay) publish(ctx context.Context, event common.OutboxEvent) error {
+	ctx, cancel := context.WithTimeout(ctx, publishTimeout)
+	defer cancel()
+
+	return r.publisher.Publish(ctx, event)
+}
+
+// Run relays pending events every interval until stop is closed.
+func (r *relay) Run(interval time.Duration, stop <-chan struct{}) {
+	ctx := context.Background()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			_, err := r.RelayPending(ctx)
+
+			if err != nil {
+				logging.FromContext(ctx).Error("Unable to relay outbox events", "error", err.Error())
+			}
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package outbox_test
+
+import (
+	"context"
+	"errors"
+	"github.com/stone1549/auth-service/common"
+	"github.com/stone1549/auth-service/outbox"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// outboxRepository is a minimal OutboxRepository holding events in a slice.
+type outboxRepository struct {
+	events    []common.OutboxEvent
+	published map[string]bool
+	failed    map[string]string
+	dead      map[string]bool
+	lease     time.Duration
+}
+
+func (or *outboxRepository) ClaimOutbox(ctx context.Context, now time.Time, lease time.Duration,
+	limit int) ([]common.OutboxEvent, error) {
+	or.lease = lease
+	claimed := make([]common.OutboxEvent, 0)
+
+	for _, event := range or.events {
+		if _, ok := or.failed[event.Id]; !ok && !or.published[event.Id] {
+			claimed = append(claimed, event)
+		}
+	}
+
+	return claimed, nil
+}
+
+func (or *outboxRepository) MarkPublished(ctx context.Context, eventId string) error {
+	or.published[eventId] = true
+	return nil
+}
+
+func (or *outboxRepository) MarkPublishFailed(ctx context.Context, eventId, lastError string, nextAttemptAt time.Time,
+	dead bool) error {
+	or.failed[eventId] = lastError
+	or.dead[eventId] = dead
+	return nil
+}
+
+// publisherFunc adapts a function to an EventPublisher.
+type publisherFunc func(ctx context.Context, event common.OutboxEvent) error
+
+func (pf publisherFunc) Publish(ctx context.Context, event common.OutboxEvent) error {
+	return pf(ctx, event)
+}
+
+// TestRelay_RelayPending ensures published events are marked published, failed ones are left for a retry, and those
+// failing their last attempt are marked dead.
+func TestRelay_RelayPending(t *testing.T) {
+	repo := &outboxRepository{
+		events:    []common.OutboxEvent{{Id: "1"}, {Id: "2"}, {Id: "3"}, {Id: "4", Attempts: 2}},
+		published: make(map[string]bool),
+		failed:    make(map[string]string),
+		dead:      make(map[string]bool),
+	}
+
+	publisher := publisherFunc(func(ctx context.Context, event common.OutboxEvent) error {
+		if event.Id == "2" || event.Id == "4" {
+			return errors.New("unavailable")
+		}
+
+		return nil
+	})
+
+	published, err := outbox.NewRelay(repo, publisher, 3).RelayPending(context.Background())
+	ok(t, err)
+	equals(t, 2, published)
+	equals(t, map[string]bool{"1": true, "3": true}, repo.published)
+	equals(t, map[string]string{"2": "unavailable", "4": "unavailable"}, repo.failed)
+	equals(t, map[string]bool{"2": false, "4": true}, repo.dead)
+}
+
+// TestRelay_Lease ensures every publish is bounded, so that a whole batch is published within the lease of its claim
+// and no event is claimed by another relay while it may still be published.
+func TestRelay_Lease(t *testing.T) {
+	events := make([]common.OutboxEvent, 0)
+
+	for i := 0; i < 20; i++ {
+		events = append(events, common.OutboxEvent{Id: strconv.Itoa(i)})
+	}
+
+	repo := &outboxRepository{
+		events:    events,
+		published: make(map[string]bool),
+		failed:    make(map[string]string),
+		dead:      make(map[string]bool),
+	}
+	var longest time.Duration
+
+	publisher := publisherFunc(func(ctx context.Context, event common.OutboxEvent) error {
+		deadline, ok := ctx.Deadline()
+		equals(t, true, ok)
+
+		if remaining := time.Until(deadline); remaining > longest {
+			longest = remaining
+		}
+
+		return nil
+	})
+
+	published, err := outbox.NewRelay(repo, publisher, 3).RelayPending(context.Background())
+	ok(t, err)
+	equals(t, 20, published)
+	equals(t, true, longest > 0 && time.Duration(len(events))*longest < repo.lease)
+}
@@ -0,0 +1,266 @@
+package policy
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// TestResult is the outcome of running a single policy test.
+type TestResult struct {
+	Name     string `json:"name"`
+	Expected Effect `json:"expected"`
+	Actual   Effect `json:"actual"`
+	Passed   bool   `json:"passed"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Engine evaluates decisions against the policies loaded from a file or directory, reloading them when they change.
+type Engine interface {
+	// Decide evaluates the document against the currently loaded policies.
+	Decide(doc Document) (Decision, error)
+	// RunTests runs the tests bundled with the currently loaded policies.
+	RunTests() []TestResult
+	// Reload loads the policies again if any policy file changed, keeping the current policies if the new ones are
+	// invalid or fail their tests. Returns whether new policies were loaded.
+	Reload() (bool, error)
+	// Watch reloads policies every interval until stop is closed.
+	Watch(interval time.Duration, stop <-chan struct{})
+}
+
+type engine struct {
+	path     string
+	mutex    sync.RWMutex
+	set      Set
+	modTimes map[string]time.Time
+}
+
+// NewEngine constructs an Engine from the policy files at path, which may be a single JSON file or a directory of
+// them. Fails if the policies are invalid or their tests don't pass. With no path every action is denied.
+func NewEngine(path string) (Engine, error) {
+	e := &engine{path: path}
+
+	if path == "" {
+		return e, nil
+	}
+
+	set, modTimes, err := e.load()
+
+	if err != nil {
+		return nil, err
+	}
+
+	e.set = set
+	e.modTimes = modTimes
+
+	return e, nil
+}
+
+// RunTests evaluates each test of a policy set against its policies.
+func RunTests(set Set) []TestResult {
+	results := make([]TestResult, 0, len(set.Tests))
+
+	for _, test := range set.Tests {
+		result := TestResult{Name: test.Name, Expected: test.Expect}
+		decision, err := set.Evaluate(test.Input)
+
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Actual = decision.Effect
+			result.Passed = decision.Effect == test.Expect
+		}
+
+		results = append(results, result)
+	}
+
+	return results
+}
+
+func (e *engine) files() ([]string, error) {
+	info, err := os.Stat(e.path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return []string{e.path}, nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(e.path, "*.json"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(files)
+
+	return files, nil
+}
+
+func (e *engine) load() (Set, map[string]time.Time, error) {
+	files, err := e.files()
+
+	if err != nil {
+		return Set{}, nil, err
+	}
+
+	modTimes := make(map[string]time.Time)
+
+	for _, file := range files {
+		info, err := os.Stat(file)
+
+		if err != nil {
+			return Set{}, nil, err
+		}
+
+		modTimes[file] = info.ModTime()
+	}
+
+	set, err := loadFiles(files)
+
+	if err != nil {
+		return Set{}, modTimes, err
+	}
+
+	for _, result := range RunTests(set) {
+		if !result.Passed {
+			return Set{}, modTimes, errors.New(fmt.Sprintf("policy test %s failed: expected %s, got %s %s",
+				result.Name, result.Expected, result.Actual, result.Error))
+		}
+	}
+
+	return set, modTimes, nil
+}
+
+// LoadSet reads and validates the policies at path, which may be a single JSON file or a directory of them, without
+// running their tests.
+func LoadSet(path string) (Set, error) {
+	files, err := (&engine{path: path}).files()
+
+	if err != nil {
+		return Set{}, err
+	}
+
+	return loadFiles(files)
+}
+
+func loadFiles(files []string) (Set, error) {
+	merged := Set{Policies: make([]Policy, 0), Tests: make([]Test, 0)}
+
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+
+		if err != nil {
+			return Set{}, err
+		}
+
+		set, err := ParseSet(data)
+
+		if err != nil {
+			return Set{}, errors.New(fmt.Sprintf("%s: %s", file, err.Error()))
+		}
+
+		merged.Policies = append(merged.Policies, set.Policies...)
+		merged.Tests = append(merged.Tests, set.Tests...)
+	}
+
+	return merged, merged.Validate()
+}
+
+func (e *engine) changed() bool {
+	files, err := e.files()
+
+	if err != nil || len(files) != len(e.modTimes) {
+		return true
+	}
+
+	for _, file := range files {
+		info, err := os.Stat(file)
+
+		if err != nil || !info.ModTime().Equal(e.modTimes[file]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Decide evaluates the document against the currently loaded policies.
+func (e *engine) Decide(doc Document) (Decision, error) {
+	e.mutex.RLock()
+	set := e.set
+	e.mutex.RUnlock()
+
+	return set.Evaluate(doc)
+}
+
+// RunTests runs the tests bundled with the currently loaded policies.
+func (e *engine) RunTests() []TestResult {
+	e.mutex.RLock()
+	set := e.set
+	e.mutex.RUnlock()
+
+	return RunTests(set)
+}
+
+// Reload loads the policies again if any policy file changed.
+func (e *engine) Reload() (bool, error) {
+	if e.path == "" {
+		return false, nil
+	}
+
+	e.mutex.RLock()
+	changed := e.changed()
+	e.mutex.RUnlock()
+
+	if !changed {
+		return false, nil
+	}
+
+	set, modTimes, err := e.load()
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if modTimes != nil {
+		// Remember failed attempts too so a broken file is only reported once per change.
+		e.modTimes = modTimes
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	e.set = set
+
+	return true, nil
+}
+
+// Watch reloads policies every interval until stop is closed.
+func (e *engine) Watch(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			reloaded, err := e.Reload()
+
+			if err != nil {
+				slog.Warn("Keeping current policies, unable to reload them", "path", e.path, "error", err.Error())
+			} else if reloaded {
+				slog.Info("Reloaded policies", "path", e.path)
+			}
+		}
+	}
+}
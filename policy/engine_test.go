@@ -0,0 +1,113 @@
+package policy_test
+
+import (
+	"github.com/stone1549/auth-service/policy"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const allowAll = `{
+  "policies": [{"id": "all", "effect": "allow", "actions": ["*"]}],
+  "tests": [{"name": "allowed", "input": {"action": "users:view"}, "expect": "allow"}]
+}`
+
+const failingTests = `{
+  "policies": [{"id": "all", "effect": "allow", "actions": ["*"]}],
+  "tests": [{"name": "denied", "input": {"action": "users:view"}, "expect": "deny"}]
+}`
+
+// TestNewEngine ensures the sample policies load and their tests pass.
+func TestNewEngine(t *testing.T) {
+	engine, err := policy.NewEngine("../data/policies")
+	ok(t, err)
+
+	results := engine.RunTests()
+	equals(t, 6, len(results))
+
+	for _, result := range results {
+		equals(t, true, result.Passed)
+	}
+
+	support := map[string]interface{}{"groups": []string{"support"},
+		"attributes": map[string]interface{}{"region": "eu"}}
+	decision, err := engine.Decide(policy.Document{
+		Action:      "users:view",
+		Subject:     support,
+		Resource:    map[string]interface{}{"region": "eu"},
+		Environment: map[string]interface{}{"hour": 11},
+	})
+	ok(t, err)
+	equals(t, policy.Decision{Effect: policy.Allow, PolicyIds: []string{"support-view-own-region"}}, decision)
+}
+
+// TestNewEngine_Empty ensures every action is denied when no policies are configured.
+func TestNewEngine_Empty(t *testing.T) {
+	engine, err := policy.NewEngine("")
+	ok(t, err)
+
+	decision, err := engine.Decide(policy.Document{Action: "users:view"})
+	ok(t, err)
+	equals(t, policy.Deny, decision.Effect)
+}
+
+// TestNewEngine_FailTests ensures policies whose tests fail aren't loaded.
+func TestNewEngine_FailTests(t *testing.T) {
+	dir, err := ioutil.TempDir("", "policies")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+
+	ok(t, ioutil.WriteFile(filepath.Join(dir, "policies.json"), []byte(failingTests), 0600))
+
+	_, err = policy.NewEngine(dir)
+	notOk(t, err)
+
+	set, err := policy.LoadSet(dir)
+	ok(t, err)
+
+	results := policy.RunTests(set)
+	equals(t, 1, len(results))
+	equals(t, false, results[0].Passed)
+	equals(t, policy.Allow, results[0].Actual)
+}
+
+// TestEngine_Reload ensures changed policies are loaded and invalid changes leave the current policies in place.
+func TestEngine_Reload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "policies")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "policies.json")
+	ok(t, ioutil.WriteFile(file, []byte(`{"policies": []}`), 0600))
+
+	engine, err := policy.NewEngine(dir)
+	ok(t, err)
+
+	reloaded, err := engine.Reload()
+	ok(t, err)
+	equals(t, false, reloaded)
+
+	ok(t, ioutil.WriteFile(file, []byte(allowAll), 0600))
+	ok(t, os.Chtimes(file, time.Now(), time.Now().Add(time.Minute)))
+
+	reloaded, err = engine.Reload()
+	ok(t, err)
+	equals(t, true, reloaded)
+
+	decision, err := engine.Decide(policy.Document{Action: "users:view"})
+	ok(t, err)
+	equals(t, policy.Allow, decision.Effect)
+
+	ok(t, ioutil.WriteFile(file, []byte(failingTests), 0600))
+	ok(t, os.Chtimes(file, time.Now(), time.Now().Add(2*time.Minute)))
+
+	reloaded, err = engine.Reload()
+	notOk(t, err)
+	equals(t, false, reloaded)
+
+	decision, err = engine.Decide(policy.Document{Action: "users:view"})
+	ok(t, err)
+	equals(t, policy.Allow, decision.Effect)
+}
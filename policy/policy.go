@@ -0,0 +1,458 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"reflect"
+	"strings"
+)
+
+// Effect represents the outcome a policy grants when it matches.
+type Effect string
+
+const (
+	// Allow grants the action unless a matching policy denies it.
+	Allow Effect = "allow"
+	// Deny refuses the action regardless of any matching allow policies.
+	Deny Effect = "deny"
+)
+
+// Policy is a declarative rule granting or refusing actions when all of its conditions hold.
+type Policy struct {
+	Id          string       `json:"id"`
+	Description string       `json:"description"`
+	Effect      Effect       `json:"effect"`
+	Actions     []string     `json:"actions"`
+	When        []Expression `json:"when"`
+}
+
+// Test is an expected decision for a request document, run against the policies it's loaded with.
+type Test struct {
+	Name   string   `json:"name"`
+	Input  Document `json:"input"`
+	Expect Effect   `json:"expect"`
+}
+
+// Document is the input to a decision: the action requested, the subject's token claims, the resource's attributes
+// and the environment.
+type Document struct {
+	Action      string                 `json:"action"`
+	Subject     map[string]interface{} `json:"subject"`
+	Resource    map[string]interface{} `json:"resource"`
+	Environment map[string]interface{} `json:"environment"`
+}
+
+// Decision is the result of evaluating a document against a set of policies.
+type Decision struct {
+	Effect Effect `json:"effect"`
+	// PolicyIds are the policies that determined the effect, empty when no policy matched.
+	PolicyIds []string `json:"policyIds"`
+}
+
+// Set is a collection of policies and the tests they're expected to pass.
+type Set struct {
+	Policies []Policy `json:"policies"`
+	Tests    []Test   `json:"tests"`
+}
+
+// Expression is a condition in JSON logic form, e.g. {"eq": [{"var": "resource.owner"}, {"var": "subject.sub"}]}.
+// Supported operators are var, eq, ne, lt, lte, gt, gte, between, in, contains, startsWith, exists, not, all and
+// any. A missing value is never equal or unequal to anything, so eq and ne are both false when an operand is missing
+// rather than matching two missing values.
+type Expression struct {
+	value interface{}
+}
+
+// UnmarshalJSON keeps the raw expression, it's validated when the policy set is checked.
+func (e *Expression) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, &e.value)
+}
+
+// MarshalJSON writes the expression back in its JSON logic form.
+func (e Expression) MarshalJSON() ([]byte, error) {
+	return json.Marshal(e.value)
+}
+
+var operatorArity = map[string][2]int{
+	"var":        {1, 1},
+	"eq":         {2, 2},
+	"ne":         {2, 2},
+	"lt":         {2, 2},
+	"lte":        {2, 2},
+	"gt":         {2, 2},
+	"gte":        {2, 2},
+	"between":    {3, 3},
+	"in":         {2, 2},
+	"contains":   {2, 2},
+	"startsWith": {2, 2},
+	"exists":     {1, 1},
+	"not":        {1, 1},
+	"all":        {0, -1},
+	"any":        {0, -1},
+}
+
+// ParseSet parses and validates a policy set from JSON.
+func ParseSet(data []byte) (Set, error) {
+	var set Set
+	err := json.Unmarshal(data, &set)
+
+	if err != nil {
+		return Set{}, err
+	}
+
+	return set, set.Validate()
+}
+
+// Validate ensures every policy has an id, a known effect, actions and well formed conditions.
+func (s Set) Validate() error {
+	ids := make(map[string]bool)
+
+	for _, policy := range s.Policies {
+		if policy.Id == "" {
+			return errors.New("policy id is required")
+		} else if ids[policy.Id] {
+			return errors.New(fmt.Sprintf("duplicate policy id %s", policy.Id))
+		}
+
+		ids[policy.Id] = true
+
+		if policy.Effect != Allow && policy.Effect != Deny {
+			return errors.New(fmt.Sprintf("policy %s: effect must be %s or %s", policy.Id, Allow, Deny))
+		}
+
+		if len(policy.Actions) == 0 {
+			return errors.New(fmt.Sprintf("policy %s: at least one action is required", policy.Id))
+		}
+
+		for _, expression := range policy.When {
+			err := validateExpression(expression.value)
+
+			if err != nil {
+				return errors.New(fmt.Sprintf("policy %s: %s", policy.Id, err.Error()))
+			}
+		}
+	}
+
+	for _, test := range s.Tests {
+		if test.Expect != Allow && test.Expect != Deny {
+			return errors.New(fmt.Sprintf("test %s: expect must be %s or %s", test.Name, Allow, Deny))
+		}
+	}
+
+	return nil
+}
+
+func validateExpression(value interface{}) error {
+	switch v := value.(type) {
+	case []interface{}:
+		for _, item := range v {
+			if err := validateExpression(item); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		if len(v) != 1 {
+			return errors.New("expressions must have exactly one operator")
+		}
+
+		for operator, args := range v {
+			arity, ok := operatorArity[operator]
+
+			if !ok {
+				return errors.New(fmt.Sprintf("unknown operator %s", operator))
+			}
+
+			argList := arguments(args)
+
+			if len(argList) < arity[0] || (arity[1] >= 0 && len(argList) > arity[1]) {
+				return errors.New(fmt.Sprintf("wrong number of arguments to %s", operator))
+			}
+
+			if operator == "var" {
+				if _, ok := argList[0].(string); !ok {
+					return errors.New("var requires a path")
+				}
+
+				continue
+			}
+
+			for _, arg := range argList {
+				if err := validateExpression(arg); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// arguments normalizes an operator's arguments to a list, allowing a single argument to be given bare.
+func arguments(args interface{}) []interface{} {
+	if list, ok := args.([]interface{}); ok {
+		return list
+	}
+
+	return []interface{}{args}
+}
+
+// Evaluate decides whether the document's action is allowed. A matching deny policy overrides any allow, and the
+// action is denied when no policy matches.
+func (s Set) Evaluate(doc Document) (Decision, error) {
+	input, err := doc.normalize()
+
+	if err != nil {
+		return Decision{}, err
+	}
+
+	allowIds := make([]string, 0)
+	denyIds := make([]string, 0)
+
+	for _, policy := range s.Policies {
+		if !matchesAction(policy.Actions, doc.Action) {
+			continue
+		}
+
+		matched := true
+
+		for _, expression := range policy.When {
+			result, err := evaluate(expression.value, input)
+
+			if err != nil {
+				return Decision{}, errors.New(fmt.Sprintf("policy %s: %s", policy.Id, err.Error()))
+			}
+
+			if !truthy(result) {
+				matched = false
+				break
+			}
+		}
+
+		if !matched {
+			continue
+		}
+
+		if policy.Effect == Deny {
+			denyIds = append(denyIds, policy.Id)
+		} else {
+			allowIds = append(allowIds, policy.Id)
+		}
+	}
+
+	if len(denyIds) > 0 {
+		return Decision{Deny, denyIds}, nil
+	} else if len(allowIds) > 0 {
+		return Decision{Allow, allowIds}, nil
+	}
+
+	return Decision{Deny, []string{}}, nil
+}
+
+// matchesAction reports whether an action is one of the given patterns, a pattern ending in * matches any action
+// with that prefix.
+func matchesAction(patterns []string, action string) bool {
+	for _, pattern := range patterns {
+		if pattern == action || (strings.HasSuffix(pattern, "*") && strings.HasPrefix(action,
+			strings.TrimSuffix(pattern, "*"))) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// normalize round trips the document through JSON so numbers and nested values have the same types policies are
+// written with.
+func (doc Document) normalize() (map[string]interface{}, error) {
+	data, err := json.Marshal(doc)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var input map[string]interface{}
+	err = json.Unmarshal(data, &input)
+
+	return input, err
+}
+
+func evaluate(value interface{}, input map[string]interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case []interface{}:
+		result := make([]interface{}, 0, len(v))
+
+		for _, item := range v {
+			itemResult, err := evaluate(item, input)
+
+			if err != nil {
+				return nil, err
+			}
+
+			result = append(result, itemResult)
+		}
+
+		return result, nil
+	case map[string]interface{}:
+		for operator, args := range v {
+			return apply(operator, arguments(args), input)
+		}
+	}
+
+	return value, nil
+}
+
+func apply(operator string, args []interface{}, input map[string]interface{}) (interface{}, error) {
+	switch operator {
+	case "var":
+		path, _ := args[0].(string)
+		return lookup(input, path), nil
+	case "all":
+		for _, arg := range args {
+			result, err := evaluate(arg, input)
+
+			if err != nil || !truthy(result) {
+				return false, err
+			}
+		}
+
+		return true, nil
+	case "any":
+		for _, arg := range args {
+			result, err := evaluate(arg, input)
+
+			if err != nil || truthy(result) {
+				return err == nil, err
+			}
+		}
+
+		return false, nil
+	}
+
+	values := make([]interface{}, 0, len(args))
+
+	for _, arg := range args {
+		result, err := evaluate(arg, input)
+
+		if err != nil {
+			return nil, err
+		}
+
+		values = append(values, result)
+	}
+
+	switch operator {
+	case "eq":
+		return values[0] != nil && values[1] != nil && reflect.DeepEqual(values[0], values[1]), nil
+	case "ne":
+		return values[0] != nil && values[1] != nil && !reflect.DeepEqual(values[0], values[1]), nil
+	case "lt", "lte", "gt", "gte":
+		return compare(operator, values[0], values[1]), nil
+	case "between":
+		return compare("gte", values[0], values[1]) && compare("lte", values[0], values[2]), nil
+	case "in":
+		return contains(values[1], values[0]), nil
+	case "contains":
+		return contains(values[0], values[1]), nil
+	case "startsWith":
+		str, ok := values[0].(string)
+		prefix, prefixOk := values[1].(string)
+		return ok && prefixOk && strings.HasPrefix(str, prefix), nil
+	case "exists":
+		return values[0] != nil, nil
+	case "not":
+		return !truthy(values[0]), nil
+	default:
+		return nil, errors.New(fmt.Sprintf("unknown operator %s", operator))
+	}
+}
+
+// lookup resolves a dotted path such as subject.groups within the input document, missing values are nil.
+func lookup(input map[string]interface{}, path string) interface{} {
+	var current interface{} = input
+
+	for _, key := range strings.Split(path, ".") {
+		object, ok := current.(map[string]interface{})
+
+		if !ok {
+			return nil
+		}
+
+		current = object[key]
+	}
+
+	return current
+}
+
+func compare(operator string, left, right interface{}) bool {
+	var cmp int
+
+	if l, ok := left.(float64); ok {
+		r, ok := right.(float64)
+
+		if !ok {
+			return false
+		}
+
+		switch {
+		case l < r:
+			cmp = -1
+		case l > r:
+			cmp = 1
+		}
+	} else if l, ok := left.(string); ok {
+		r, ok := right.(string)
+
+		if !ok {
+			return false
+		}
+
+		cmp = strings.Compare(l, r)
+	} else {
+		return false
+	}
+
+	switch operator {
+	case "lt":
+		return cmp < 0
+	case "lte":
+		return cmp <= 0
+	case "gt":
+		return cmp > 0
+	default:
+		return cmp >= 0
+	}
+}
+
+func contains(collection, item interface{}) bool {
+	switch c := collection.(type) {
+	case []interface{}:
+		for _, element := range c {
+			if reflect.DeepEqual(element, item) {
+				return true
+			}
+		}
+	case string:
+		str, ok := item.(string)
+		return ok && strings.Contains(c, str)
+	}
+
+	return false
+}
+
+func truthy(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	case []interface{}:
+		return len(v) > 0
+	default:
+		return true
+	}
+}
@@ -0,0 +1,138 @@
+package policy_test
+
+import (
+	"fmt"
+	"github.com/stone1549/auth-service/policy"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+const samplePolicies = `{
+  "policies": [
+    {
+      "id": "engineers-read",
+      "effect": "allow",
+      "actions": ["docs:read", "docs:list"],
+      "when": [
+        {"in": ["engineering", {"var": "subject.groups"}]},
+        {"lt": [{"var": "resource.classification"}, 3]}
+      ]
+    },
+    {
+      "id": "owners",
+      "effect": "allow",
+      "actions": ["docs:*"],
+      "when": [{"eq": [{"var": "resource.owner"}, {"var": "subject.sub"}]}]
+    },
+    {
+      "id": "no-contractors",
+      "effect": "deny",
+      "actions": ["docs:*"],
+      "when": [
+        {"startsWith": [{"var": "subject.email"}, "contractor."]},
+        {"not": {"exists": {"var": "resource.public"}}}
+      ]
+    }
+  ]
+}`
+
+// TestSet_Evaluate ensures matching allow policies grant actions, deny policies override them, unmatched actions
+// are denied and missing values never equal each other.
+func TestSet_Evaluate(t *testing.T) {
+	set, err := policy.ParseSet([]byte(samplePolicies))
+	ok(t, err)
+
+	engineer := map[string]interface{}{"sub": "1", "email": "jane@example.com", "groups": []string{"engineering"}}
+	contractor := map[string]interface{}{"sub": "2", "email": "contractor.bob@example.com",
+		"groups": []string{"engineering"}}
+
+	cases := []struct {
+		doc      policy.Document
+		expected policy.Decision
+	}{
+		{policy.Document{Action: "docs:read", Subject: engineer,
+			Resource: map[string]interface{}{"classification": 1}},
+			policy.Decision{Effect: policy.Allow, PolicyIds: []string{"engineers-read"}}},
+		{policy.Document{Action: "docs:read", Subject: engineer,
+			Resource: map[string]interface{}{"classification": 3}},
+			policy.Decision{Effect: policy.Deny, PolicyIds: []string{}}},
+		{policy.Document{Action: "docs:delete", Subject: engineer,
+			Resource: map[string]interface{}{"owner": "1", "classification": 1}},
+			policy.Decision{Effect: policy.Allow, PolicyIds: []string{"owners"}}},
+		{policy.Document{Action: "docs:read", Subject: contractor,
+			Resource: map[string]interface{}{"owner": "2", "classification": 1}},
+			policy.Decision{Effect: policy.Deny, PolicyIds: []string{"no-contractors"}}},
+		{policy.Document{Action: "docs:read", Subject: contractor,
+			Resource: map[string]interface{}{"classification": 1, "public": true}},
+			policy.Decision{Effect: policy.Allow, PolicyIds: []string{"engineers-read"}}},
+		{policy.Document{Action: "docs:delete", Subject: map[string]interface{}{"groups": []string{}},
+			Resource: map[string]interface{}{}},
+			policy.Decision{Effect: policy.Deny, PolicyIds: []string{}}},
+		{policy.Document{Action: "users:read", Subject: engineer,
+			Resource: map[string]interface{}{"owner": "1"}},
+			policy.Decision{Effect: policy.Deny, PolicyIds: []string{}}},
+	}
+
+	for _, c := range cases {
+		decision, err := set.Evaluate(c.doc)
+		ok(t, err)
+		equals(t, c.expected, decision)
+	}
+}
+
+// TestSet_EvaluateEmpty ensures every action is denied when there are no policies.
+func TestSet_EvaluateEmpty(t *testing.T) {
+	decision, err := policy.Set{}.Evaluate(policy.Document{Action: "docs:read"})
+	ok(t, err)
+	equals(t, policy.Deny, decision.Effect)
+}
+
+// TestParseSet_Fail ensures malformed policies are rejected.
+func TestParseSet_Fail(t *testing.T) {
+	invalid := []string{
+		`{"policies": [{"effect": "allow", "actions": ["a"]}]}`,
+		`{"policies": [{"id": "p", "effect": "maybe", "actions": ["a"]}]}`,
+		`{"policies": [{"id": "p", "effect": "allow", "actions": []}]}`,
+		`{"policies": [{"id": "p", "effect": "allow", "actions": ["a"]}, {"id": "p", "effect": "deny", "actions": ["a"]}]}`,
+		`{"policies": [{"id": "p", "effect": "allow", "actions": ["a"], "when": [{"matches": [1, 2]}]}]}`,
+		`{"policies": [{"id": "p", "effect": "allow", "actions": ["a"], "when": [{"eq": [1]}]}]}`,
+		`{"policies": [{"id": "p", "effect": "allow", "actions": ["a"], "when": [{"var": 1}]}]}`,
+		`{"policies": [{"id": "p", "effect": "allow", "actions": ["a"], "when": [{"eq": [1, 2], "ne": [1, 2]}]}]}`,
+		`{"tests": [{"name": "t", "expect": "perhaps"}]}`,
+		`{"policies": {}}`,
+	}
+
+	for _, src := range invalid {
+		_, err := policy.ParseSet([]byte(src))
+		notOk(t, err)
+	}
+}
+
+// ok fails the test if an err is not nil.
+func ok(tb testing.TB, err error) {
+	if err != nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: unexpected error: %s\033[39m\n\n", filepath.Base(file), line, err.Error())
+		tb.FailNow()
+	}
+}
+
+// notOk fails the test if an err is nil.
+func notOk(tb testing.TB, err error) {
+	if err == nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: unexpected lack of error: \033[39m\n\n", filepath.Base(file), line)
+		tb.FailNow()
+	}
+}
+
+// equals fails the test if exp is not equal to act.
+func equals(tb testing.TB, exp, act interface{}) {
+	if !reflect.DeepEqual(exp, act) {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d:\n\n\texp: %#v\n\n\tgot: %#v\033[39m\n\n", filepath.Base(file), line, exp, act)
+		tb.FailNow()
+	}
+}
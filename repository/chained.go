@@ -0,0 +1,161 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/stone1549/auth-service/common"
+)
+
+type chainedBackend struct {
+	repo   UserRepository
+	policy common.RepoBackend
+}
+
+// chainedUserRepository tries an ordered list of repositories, each serving only the operations it's configured
+// for. The first repository of the chain holds everything else, including the accounts identifying users of later
+// ones.
+type chainedUserRepository struct {
+	localStore
+	backends []chainedBackend
+}
+
+// NewUser adds a user to the first repository of the chain that serves signup. Users added to a later repository
+// are also given an account in the first, which identifies them.
+func (cr *chainedUserRepository) NewUser(ctx context.Context, tenantId, email, password string) (string, error) {
+	for i, backend := range cr.backends {
+		if !backend.policy.Signup {
+			continue
+		}
+
+		id, err := backend.repo.NewUser(ctx, tenantId, email, password)
+
+		if err != nil || i == 0 {
+			return id, err
+		}
+
+		return cr.localAccount(ctx, tenantId, email, true)
+	}
+
+	return "", newErrRepository("signup isn't served by any repository")
+}
+
+// Authenticate tries each repository serving authentication in order, the first to accept the credentials wins.
+// The next repository is only tried when a repository doesn't know the user or refuses their credentials, any other
+// error such as an unreachable directory is returned. Users authenticated by a later repository are identified by
+// their account in the first repository of the chain, which is created when the repository provisions them.
+func (cr *chainedUserRepository) Authenticate(ctx context.Context, tenantId, email, password string) (string,
+	error) {
+	for i, backend := range cr.backends {
+		if !backend.policy.Authenticate {
+			continue
+		}
+
+		id, err := backend.repo.Authenticate(ctx, tenantId, email, password)
+
+		if IsNotFound(err) || IsInvalidCredentials(err) {
+			continue
+		} else if err != nil {
+			return "", err
+		}
+
+		if i == 0 {
+			return id, nil
+		}
+
+		return cr.localAccount(ctx, tenantId, email, backend.policy.Provision)
+	}
+
+	return "", newErrInvalidCredentials("invalid username/password combo")
+}
+
+// Ping verifies every repository of the chain can be reached.
+func (cr *chainedUserRepository) Ping(ctx context.Context) error {
+	if err := ping(ctx, cr.localStore); err != nil {
+		return err
+	}
+
+	for _, backend := range cr.backends {
+		if err := ping(ctx, backend.repo); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close closes every repository of the chain, directories don't close the first repository they keep everything
+// else in so it's closed once.
+func (cr *chainedUserRepository) Close() error {
+	var firstErr error
+
+	for _, backend := range cr.backends {
+		if err := closeRepository(backend.repo); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// localAccount finds the local account of a user of another repository, creating it when create is set. Created
+// accounts get a random password nobody knows, so they can only be used through the other repository.
+func (cr *chainedUserRepository) localAccount(ctx context.Context, tenantId, email string, create bool) (string,
+	error) {
+	account, err := cr.localStore.GetUserByEmail(ctx, tenantId, email)
+
+	if IsNotFound(err) && !create {
+		return "", newErrNotFound("user has no account in the first repository of the chain")
+	} else if IsNotFound(err) {
+		var password string
+		password, err = randomPassword()
+
+		if err != nil {
+			return "", err
+		}
+
+		account, err = cr.localStore.CreateUser(ctx, common.UserAccount{TenantId: tenantId, Email: email,
+			Active: true}, password)
+	}
+
+	if err != nil {
+		return "", err
+	} else if !account.Active {
+		return "", newErrRepository("user is disabled")
+	}
+
+	return account.Id, nil
+}
+
+func randomPassword() (string, error) {
+	password := make([]byte, 32)
+	_, err := rand.Read(password)
+
+	if err != nil {
+		return "", newErrRepository("unable to generate password")
+	}
+
+	return hex.EncodeToString(password), nil
+}
+
+// MakeChainedUserRepository constructs a repository trying the given repositories in order, each serving the
+// operations of the backend at the same position. The first repository holds everything but users.
+func MakeChainedUserRepository(backends []common.RepoBackend, repos []UserRepository) (UserRepository, error) {
+	if len(backends) == 0 || len(backends) != len(repos) {
+		return nil, newErrRepository("repository chain requires one repository per backend")
+	}
+
+	store, ok := repos[0].(localStore)
+
+	if !ok {
+		return nil, newErrRepository("first repository of the chain doesn't support every repository capability")
+	}
+
+	chained := &chainedUserRepository{localStore: store}
+
+	for i, backend := range backends {
+		chained.backends = append(chained.backends, chainedBackend{repo: repos[i], policy: backend})
+	}
+
+	return chained, nil
+}
@@ -0,0 +1,162 @@
+package repository_test
+
+import (
+	"context"
+	"github.com/stone1549/auth-service/common"
+	"github.com/stone1549/auth-service/repository"
+	"io"
+	"testing"
+)
+
+func makeChainedRepo(t *testing.T, directory *testDirectory, directoryPolicy common.RepoBackend) (
+	repository.UserRepository, repository.UserAdminRepository) {
+	local := makeNewImRepo(t)
+	ldapRepo := makeLdapRepo(t, directory, false)
+	repo, err := repository.MakeChainedUserRepository([]common.RepoBackend{
+		{Type: common.InMemoryRepo, Authenticate: true, Signup: true},
+		directoryPolicy,
+	}, []repository.UserRepository{local, ldapRepo})
+	ok(t, err)
+	return repo, local.(repository.UserAdminRepository)
+}
+
+// TestChainedUserRepository_Authenticate ensures backends are tried in order and users authenticated by a backend
+// that doesn't provision them are identified by their existing local account, never by the backend's own id.
+func TestChainedUserRepository_Authenticate(t *testing.T) {
+	directory := startTestDirectory(t, jane)
+	defer directory.close()
+	repo, local := makeChainedRepo(t, directory, common.RepoBackend{Type: common.LdapRepo, Authenticate: true})
+	ctx := context.Background()
+
+	id, err := repo.NewUser(ctx, common.DefaultTenantId, "local@example.com", "password")
+	ok(t, err)
+
+	authenticatedId, err := repo.Authenticate(ctx, common.DefaultTenantId, "local@example.com", "password")
+	ok(t, err)
+	equals(t, id, authenticatedId)
+
+	_, err = repo.Authenticate(ctx, common.DefaultTenantId, "jane@example.com", "directory-password")
+	equals(t, true, repository.IsNotFound(err))
+
+	account, err := local.CreateUser(ctx, common.UserAccount{TenantId: common.DefaultTenantId,
+		Email: "jane@example.com", Active: true}, "local-password")
+	ok(t, err)
+
+	authenticatedId, err = repo.Authenticate(ctx, common.DefaultTenantId, "jane@example.com", "directory-password")
+	ok(t, err)
+	equals(t, account.Id, authenticatedId)
+
+	_, err = repo.Authenticate(ctx, common.DefaultTenantId, "jane@example.com", "wrong-password")
+	equals(t, true, repository.IsInvalidCredentials(err))
+}
+
+// TestChainedUserRepository_AuthenticateUnavailable ensures the next backend decides when a directory refuses the
+// user's credentials, but that a directory failing for other reasons stops the chain.
+func TestChainedUserRepository_AuthenticateUnavailable(t *testing.T) {
+	directory := startTestDirectory(t, jane)
+	ctx := context.Background()
+	local := makeNewImRepo(t)
+	secondary := makeNewImRepo(t)
+	_, err := secondary.NewUser(ctx, common.DefaultTenantId, "jane@example.com", "password")
+	ok(t, err)
+
+	repo, err := repository.MakeChainedUserRepository([]common.RepoBackend{
+		{Type: common.InMemoryRepo, Authenticate: true},
+		{Type: common.LdapRepo, Authenticate: true, Provision: true},
+		{Type: common.PostgreSqlRepo, Authenticate: true, Provision: true},
+	}, []repository.UserRepository{local, makeLdapRepo(t, directory, false), secondary})
+	ok(t, err)
+
+	_, err = repo.Authenticate(ctx, common.DefaultTenantId, "jane@example.com", "password")
+	ok(t, err)
+
+	directory.close()
+
+	_, err = repo.Authenticate(ctx, common.DefaultTenantId, "jane@example.com", "password")
+	notOk(t, err)
+	equals(t, false, repository.IsInvalidCredentials(err) || repository.IsNotFound(err))
+}
+
+// TestChainedUserRepository_Close ensures the first repository is closed exactly once, although directories keep
+// everything else in it.
+func TestChainedUserRepository_Close(t *testing.T) {
+	db, mock, primary, err := makeAndTestPgSmallRepo()
+	ok(t, err)
+	ldapRepo, err := repository.MakeLdapUserRepository(common.LdapConfig{}, primary)
+	ok(t, err)
+
+	repo, err := repository.MakeChainedUserRepository([]common.RepoBackend{
+		{Type: common.PostgreSqlRepo, Authenticate: true, Signup: true},
+		{Type: common.LdapRepo, Authenticate: true, Provision: true},
+	}, []repository.UserRepository{primary, ldapRepo})
+	ok(t, err)
+
+	mock.ExpectClose()
+	ok(t, repo.(io.Closer).Close())
+	ok(t, mock.ExpectationsWereMet())
+	notOk(t, db.Ping())
+}
+
+// TestChainedUserRepository_Provision ensures users authenticated by a provisioning backend are given a single
+// local account, and are refused once it's disabled.
+func TestChainedUserRepository_Provision(t *testing.T) {
+	directory := startTestDirectory(t, jane)
+	defer directory.close()
+	repo, local := makeChainedRepo(t, directory, common.RepoBackend{Type: common.LdapRepo, Authenticate: true,
+		Provision: true})
+	ctx := context.Background()
+
+	id, err := repo.Authenticate(ctx, common.DefaultTenantId, "jane@example.com", "directory-password")
+	ok(t, err)
+
+	account, err := local.GetUserByEmail(ctx, common.DefaultTenantId, "jane@example.com")
+	ok(t, err)
+	equals(t, id, account.Id)
+	equals(t, true, account.Active)
+
+	authenticatedId, err := repo.Authenticate(ctx, common.DefaultTenantId, "jane@example.com", "directory-password")
+	ok(t, err)
+	equals(t, id, authenticatedId)
+
+	account.Active = false
+	_, err = local.UpdateUser(ctx, account)
+	ok(t, err)
+
+	_, err = repo.Authenticate(ctx, common.DefaultTenantId, "jane@example.com", "directory-password")
+	notOk(t, err)
+}
+
+// TestChainedUserRepository_Signup ensures new users are added to the first backend serving signup, identified by
+// a local account, and refused when no backend does.
+func TestChainedUserRepository_Signup(t *testing.T) {
+	ctx := context.Background()
+	local := makeNewImRepo(t)
+	secondary := makeNewImRepo(t)
+
+	repo, err := repository.MakeChainedUserRepository([]common.RepoBackend{
+		{Type: common.InMemoryRepo, Authenticate: true},
+		{Type: common.PostgreSqlRepo, Authenticate: true, Signup: true},
+	}, []repository.UserRepository{local, secondary})
+	ok(t, err)
+
+	id, err := repo.NewUser(ctx, common.DefaultTenantId, "new@example.com", "password")
+	ok(t, err)
+
+	_, err = secondary.Authenticate(ctx, common.DefaultTenantId, "new@example.com", "password")
+	ok(t, err)
+
+	_, err = local.Authenticate(ctx, common.DefaultTenantId, "new@example.com", "password")
+	notOk(t, err)
+
+	authenticatedId, err := repo.Authenticate(ctx, common.DefaultTenantId, "new@example.com", "password")
+	ok(t, err)
+	equals(t, id, authenticatedId)
+
+	repo, err = repository.MakeChainedUserRepository([]common.RepoBackend{
+		{Type: common.InMemoryRepo, Authenticate: true},
+	}, []repository.UserRepository{local})
+	ok(t, err)
+
+	_, err = repo.NewUser(ctx, common.DefaultTenantId, "other@example.com", "password")
+	notOk(t, err)
+}
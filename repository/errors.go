@@ -13,3 +13,46 @@ func (er errRepository) Error() string {
 func newErrRepository(msg string) error {
 	return errRepository{errors.New(msg)}
 }
+
+type errNotFound struct {
+	errRepository
+}
+
+func newErrNotFound(msg string) error {
+	return errNotFound{errRepository{errors.New(msg)}}
+}
+
+// IsNotFound reports whether the given error was returned because a requested entity doesn't exist in the repo.
+func IsNotFound(err error) bool {
+	_, ok := err.(errNotFound)
+	return ok
+}
+
+type errConflict struct {
+	errRepository
+}
+
+func newErrConflict(msg string) error {
+	return errConflict{errRepository{errors.New(msg)}}
+}
+
+// IsConflict reports whether the given error was returned because a change conflicts with the current state of the
+// repo.
+func IsConflict(err error) bool {
+	_, ok := err.(errConflict)
+	return ok
+}
+
+type errInvalidCredentials struct {
+	errRepository
+}
+
+func newErrInvalidCredentials(msg string) error {
+	return errInvalidCredentials{errRepository{errors.New(msg)}}
+}
+
+// IsInvalidCredentials reports whether the given error was returned because a user's credentials were refused.
+func IsInvalidCredentials(err error) bool {
+	_, ok := err.(errInvalidCredentials)
+	return ok
+}
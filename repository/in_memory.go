@@ -5,25 +5,45 @@ import (
 	"encoding/json"
 	"github.com/stone1549/auth-service/common"
 	"github.com/twinj/uuid"
-	"golang.org/x/crypto/bcrypt"
 	"io/ioutil"
+	"sync"
 	"time"
 )
 
 type storedUser struct {
 	common.User
-	Id         string    `json:"id"`
-	SaltedHash string    `json:"saltedHash"`
-	CreatedAt  time.Time `json:"createdAt"`
-	UpdatedAt  time.Time `json:"updatedAt"`
+	Id          string            `json:"id"`
+	TenantId    string            `json:"tenantId"`
+	SaltedHash  string            `json:"saltedHash"`
+	ExternalId  string            `json:"externalId,omitempty"`
+	GivenName   string            `json:"givenName,omitempty"`
+	FamilyName  string            `json:"familyName,omitempty"`
+	DisplayName string            `json:"displayName,omitempty"`
+	Disabled    bool              `json:"disabled,omitempty"`
+	Attributes  map[string]string `json:"attributes,omitempty"`
+	CreatedAt   time.Time         `json:"createdAt"`
+	UpdatedAt   time.Time         `json:"updatedAt"`
 }
+
 type inMemoryUserRepository struct {
-	usersByEmail map[string]*storedUser
+	mutex         sync.RWMutex
+	usersByTenant map[string]map[string]*storedUser
+	groups        map[string]*common.Group
+	groupUsers    map[string]map[string]bool
+	subgroups     map[string]map[string]bool
+	tuples        map[string]map[string]map[string]bool
+	webhooks      map[string]*common.Webhook
+	deliveries    map[string]*common.WebhookDelivery
+	outbox        []*outboxEntry
+	sessions      map[string]*common.Session
+	devices       map[string]*common.Device
 }
 
 // NewUser adds a user to the repo.
-func (imr *inMemoryUserRepository) NewUser(ctx context.Context, email string, password string) (string, error) {
-	if email == "" {
+func (imr *inMemoryUserRepository) NewUser(ctx context.Context, tenantId, email, password string) (string, error) {
+	if tenantId == "" {
+		return "", newErrRepository("tenant is required")
+	} else if email == "" {
 		return "", newErrRepository("email is required")
 	} else if password == "" {
 		return "", newErrRepository("password is required")
@@ -31,58 +51,118 @@ func (imr *inMemoryUserRepository) NewUser(ctx context.Context, email string, pa
 
 	id := uuid.NewV4().String()
 
-	_, ok := imr.usersByEmail[email]
-	if ok {
-		return "", newErrRepository("user already exists")
-	}
-
-	saltedHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	saltedHash, err := hashPassword(ctx, password)
 
 	if err != nil {
 		return "", newErrRepository("unable to generate password")
 	}
 
+	imr.mutex.Lock()
+	defer imr.mutex.Unlock()
+
+	usersByEmail, ok := imr.usersByTenant[tenantId]
+	if !ok {
+		usersByEmail = make(map[string]*storedUser)
+		imr.usersByTenant[tenantId] = usersByEmail
+	}
+
+	_, ok = usersByEmail[email]
+	if ok {
+		return "", newErrRepository("user already exists")
+	}
+
 	createdAt := time.Now()
 	updatedAt := createdAt
 
-	imr.usersByEmail[email] = &storedUser{common.User{Email: email}, id, string(saltedHash),
-		createdAt, updatedAt}
+	err = imr.appendUserEvent(tenantId, id, email, common.UserCreatedEvent, createdAt)
+
+	if err != nil {
+		return "", err
+	}
+
+	usersByEmail[email] = &storedUser{User: common.User{Email: email}, Id: id, TenantId: tenantId,
+		SaltedHash: string(saltedHash), CreatedAt: createdAt, UpdatedAt: updatedAt}
 
 	return id, nil
 }
 
 // Authenticate compares the given email and password combination against the salted hash in the repo.
-func (imr *inMemoryUserRepository) Authenticate(ctx context.Context, email string, password string) (string, error) {
-	if email == "" {
+func (imr *inMemoryUserRepository) Authenticate(ctx context.Context, tenantId, email, password string) (string,
+	error) {
+	if tenantId == "" {
+		return "", newErrRepository("tenant is required")
+	} else if email == "" {
 		return "", newErrRepository("email is required")
 	} else if password == "" {
 		return "", newErrRepository("password is required")
 	}
 
-	user, ok := imr.usersByEmail[email]
+	// Copy the user so it can be compared without holding the lock while a concurrent update changes it.
+	imr.mutex.RLock()
+	stored, ok := imr.usersByTenant[tenantId][email]
+	var user storedUser
+
+	if ok {
+		user = *stored
+	}
+
+	imr.mutex.RUnlock()
+
 	if !ok {
-		return "", newErrRepository("user not found")
+		return "", newErrNotFound("user not found")
 	}
 
-	if bcrypt.CompareHashAndPassword([]byte(user.SaltedHash), []byte(password)) != nil {
-		return "", newErrRepository("invalid username/password combo")
+	if comparePassword(ctx, user.SaltedHash, password) != nil {
+		return "", newErrInvalidCredentials("invalid username/password combo")
+	} else if user.Disabled {
+		return "", newErrRepository("user is disabled")
 	}
 
 	return user.Id, nil
 }
 
+// Ping always succeeds, an in memory repository has no connection to lose.
+func (imr *inMemoryUserRepository) Ping(ctx context.Context) error {
+	return nil
+}
+
+// Close does nothing, an in memory repository holds no resources beyond memory.
+func (imr *inMemoryUserRepository) Close() error {
+	return nil
+}
+
 // MakeInMemoryRepository constructs an in memory backed UserRepository from the given configuration.
 func MakeInMemoryRepository(config common.Configuration) (UserRepository, error) {
 	var err error
 
-	usersByEmail, err := loadInitInMemoryDataset(config.GetInitDataSet())
+	usersByTenant, err := loadInitInMemoryDataset(config.GetInitDataSet())
+
+	return &inMemoryUserRepository{
+		usersByTenant: usersByTenant,
+		groups:        make(map[string]*common.Group),
+		groupUsers:    make(map[string]map[string]bool),
+		subgroups:     make(map[string]map[string]bool),
+		tuples:        make(map[string]map[string]map[string]bool),
+		webhooks:      make(map[string]*common.Webhook),
+		deliveries:    make(map[string]*common.WebhookDelivery),
+		sessions:      make(map[string]*common.Session),
+		devices:       make(map[string]*common.Device),
+	}, err
+}
+
+func (imr *inMemoryUserRepository) userById(tenantId, userId string) (*storedUser, bool) {
+	for _, user := range imr.usersByTenant[tenantId] {
+		if user.Id == userId {
+			return user, true
+		}
+	}
 
-	return &inMemoryUserRepository{usersByEmail}, err
+	return nil, false
 }
 
-func loadInitInMemoryDataset(dataset string) (map[string]*storedUser, error) {
+func loadInitInMemoryDataset(dataset string) (map[string]map[string]*storedUser, error) {
 	if dataset == "" {
-		return make(map[string]*storedUser), nil
+		return make(map[string]map[string]*storedUser), nil
 	}
 
 	var err error
@@ -103,11 +183,21 @@ func loadInitInMemoryDataset(dataset string) (map[string]*storedUser, error) {
 		return nil, err
 	}
 
-	usersByEmail := make(map[string]*storedUser)
+	usersByTenant := make(map[string]map[string]*storedUser)
+
+	for index := range storedUsers {
+		user := &storedUsers[index]
+
+		if user.TenantId == "" {
+			user.TenantId = common.DefaultTenantId
+		}
+
+		if _, ok := usersByTenant[user.TenantId]; !ok {
+			usersByTenant[user.TenantId] = make(map[string]*storedUser)
+		}
 
-	for index, storedUser := range storedUsers {
-		usersByEmail[storedUser.Email] = &storedUsers[index]
+		usersByTenant[user.TenantId][user.Email] = user
 	}
 
-	return usersByEmail, err
+	return usersByTenant, err
 }
@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"github.com/stone1549/auth-service/common"
+	"sort"
+	"time"
+)
+
+// ListDevices retrieves the devices a user has logged in from, most recently seen first.
+func (imr *inMemoryUserRepository) ListDevices(ctx context.Context, tenantId, userId string) ([]common.Device,
+	error) {
+	imr.mutex.RLock()
+	defer imr.mutex.RUnlock()
+
+	devices := make([]common.Device, 0)
+
+	for _, device := range imr.devices {
+		if device.TenantId == tenantId && device.UserId == userId {
+			devices = append(devices, *device)
+		}
+	}
+
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].LastSeenAt.After(devices[j].LastSeenAt)
+	})
+
+	return devices, nil
+}
+
+// SaveDevice remembers a device of the device's user, or records that a known one was seen again.
+func (imr *inMemoryUserRepository) SaveDevice(ctx context.Context, device common.Device) (common.Device, error) {
+	err := validateDevice(device)
+
+	if err != nil {
+		return common.Device{}, err
+	}
+
+	key := device.TenantId + "\n" + device.UserId + "\n" + device.Fingerprint
+	now := time.Now()
+
+	imr.mutex.Lock()
+	defer imr.mutex.Unlock()
+
+	if known, ok := imr.devices[key]; ok {
+		device.FirstSeenAt = known.FirstSeenAt
+	} else {
+		device.FirstSeenAt = now
+	}
+
+	device.LastSeenAt = now
+	imr.devices[key] = &device
+
+	return device, nil
+}
+
+func validateDevice(device common.Device) error {
+	if device.TenantId == "" {
+		return newErrRepository("tenant is required")
+	} else if device.UserId == "" {
+		return newErrRepository("user is required")
+	} else if device.Fingerprint == "" {
+		return newErrRepository("fingerprint is required")
+	}
+
+	return nil
+}
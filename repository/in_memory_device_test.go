@@ -0,0 +1,39 @@
+package repository_test
+
+import (
+	"context"
+	"github.com/stone1549/auth-service/common"
+	"github.com/stone1549/auth-service/repository"
+	"testing"
+)
+
+// TestInMemoryDeviceRepository_SaveDevice ensures devices are remembered per user, and seeing a known device again
+// keeps when it was first seen.
+func TestInMemoryDeviceRepository_SaveDevice(t *testing.T) {
+	repo, isDeviceRepo := makeNewImRepo(t).(repository.DeviceRepository)
+	assert(t, isDeviceRepo, "expected in memory repo to implement DeviceRepository")
+	ctx := context.Background()
+
+	laptop := common.Device{TenantId: common.DefaultTenantId, UserId: "jane", Fingerprint: "laptop",
+		Label: "Firefox on Linux", Network: "203.0.113.0/24"}
+	first, err := repo.SaveDevice(ctx, laptop)
+	ok(t, err)
+	_, err = repo.SaveDevice(ctx, common.Device{TenantId: common.DefaultTenantId, UserId: "john",
+		Fingerprint: "phone"})
+	ok(t, err)
+	_, err = repo.SaveDevice(ctx, common.Device{TenantId: common.DefaultTenantId, UserId: "jane"})
+	notOk(t, err)
+
+	again, err := repo.SaveDevice(ctx, laptop)
+	ok(t, err)
+	equals(t, first.FirstSeenAt, again.FirstSeenAt)
+
+	devices, err := repo.ListDevices(ctx, common.DefaultTenantId, "jane")
+	ok(t, err)
+	equals(t, 1, len(devices))
+	equals(t, "Firefox on Linux", devices[0].Label)
+
+	devices, err = repo.ListDevices(ctx, "acme", "jane")
+	ok(t, err)
+	equals(t, 0, len(devices))
+}
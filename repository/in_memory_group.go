@@ -0,0 +1,333 @@
+package repository
+
+import (
+	"context"
+	"github.com/stone1549/auth-service/common"
+	"github.com/twinj/uuid"
+	"sort"
+	"strings"
+	"time"
+)
+
+// NewGroup adds a group to the given tenant.
+func (imr *inMemoryUserRepository) NewGroup(ctx context.Context, tenantId, name, description string) (common.Group,
+	error) {
+	if tenantId == "" {
+		return common.Group{}, newErrRepository("tenant is required")
+	} else if strings.TrimSpace(name) == "" {
+		return common.Group{}, newErrRepository("name is required")
+	}
+
+	imr.mutex.Lock()
+	defer imr.mutex.Unlock()
+
+	if imr.groupByName(tenantId, name) != nil {
+		return common.Group{}, newErrConflict("group already exists")
+	}
+
+	createdAt := time.Now()
+	group := &common.Group{
+		Id:          uuid.NewV4().String(),
+		TenantId:    tenantId,
+		Name:        name,
+		Description: description,
+		CreatedAt:   createdAt,
+		UpdatedAt:   createdAt,
+	}
+
+	imr.groups[group.Id] = group
+
+	return *group, nil
+}
+
+// GetGroup retrieves a group by id.
+func (imr *inMemoryUserRepository) GetGroup(ctx context.Context, tenantId, groupId string) (common.Group, error) {
+	imr.mutex.RLock()
+	defer imr.mutex.RUnlock()
+
+	group, err := imr.group(tenantId, groupId)
+
+	if err != nil {
+		return common.Group{}, err
+	}
+
+	return *group, nil
+}
+
+// ListGroups retrieves all groups of the given tenant ordered by name.
+func (imr *inMemoryUserRepository) ListGroups(ctx context.Context, tenantId string) ([]common.Group, error) {
+	imr.mutex.RLock()
+	defer imr.mutex.RUnlock()
+
+	groups := make([]common.Group, 0)
+
+	for _, group := range imr.groups {
+		if group.TenantId == tenantId {
+			groups = append(groups, *group)
+		}
+	}
+
+	sortGroups(groups)
+
+	return groups, nil
+}
+
+// UpdateGroup changes the name and description of a group.
+func (imr *inMemoryUserRepository) UpdateGroup(ctx context.Context, tenantId, groupId, name,
+	description string) (common.Group, error) {
+	if strings.TrimSpace(name) == "" {
+		return common.Group{}, newErrRepository("name is required")
+	}
+
+	imr.mutex.Lock()
+	defer imr.mutex.Unlock()
+
+	group, err := imr.group(tenantId, groupId)
+
+	if err != nil {
+		return common.Group{}, err
+	}
+
+	if existing := imr.groupByName(tenantId, name); existing != nil && existing.Id != groupId {
+		return common.Group{}, newErrConflict("group already exists")
+	}
+
+	group.Name = name
+	group.Description = description
+	group.UpdatedAt = time.Now()
+
+	return *group, nil
+}
+
+// DeleteGroup removes a group and all memberships it takes part in.
+func (imr *inMemoryUserRepository) DeleteGroup(ctx context.Context, tenantId, groupId string) error {
+	imr.mutex.Lock()
+	defer imr.mutex.Unlock()
+
+	_, err := imr.group(tenantId, groupId)
+
+	if err != nil {
+		return err
+	}
+
+	delete(imr.groups, groupId)
+	delete(imr.groupUsers, groupId)
+	delete(imr.subgroups, groupId)
+
+	for _, members := range imr.subgroups {
+		delete(members, groupId)
+	}
+
+	return nil
+}
+
+// GetGroupMembers retrieves the direct members of a group.
+func (imr *inMemoryUserRepository) GetGroupMembers(ctx context.Context, tenantId, groupId string) (common.GroupMembers,
+	error) {
+	imr.mutex.RLock()
+	defer imr.mutex.RUnlock()
+
+	_, err := imr.group(tenantId, groupId)
+
+	if err != nil {
+		return common.GroupMembers{}, err
+	}
+
+	members := common.GroupMembers{UserIds: make([]string, 0), GroupIds: make([]string, 0)}
+
+	for userId := range imr.groupUsers[groupId] {
+		members.UserIds = append(members.UserIds, userId)
+	}
+
+	for memberGroupId := range imr.subgroups[groupId] {
+		members.GroupIds = append(members.GroupIds, memberGroupId)
+	}
+
+	sort.Strings(members.UserIds)
+	sort.Strings(members.GroupIds)
+
+	return members, nil
+}
+
+// AddGroupUser makes a user a direct member of a group.
+func (imr *inMemoryUserRepository) AddGroupUser(ctx context.Context, tenantId, groupId, userId string) error {
+	imr.mutex.Lock()
+	defer imr.mutex.Unlock()
+
+	_, err := imr.group(tenantId, groupId)
+
+	if err != nil {
+		return err
+	}
+
+	if _, ok := imr.userById(tenantId, userId); !ok {
+		return newErrNotFound("user not found")
+	}
+
+	if _, ok := imr.groupUsers[groupId]; !ok {
+		imr.groupUsers[groupId] = make(map[string]bool)
+	}
+
+	imr.groupUsers[groupId][userId] = true
+
+	return nil
+}
+
+// RemoveGroupUser removes a user from the direct members of a group.
+func (imr *inMemoryUserRepository) RemoveGroupUser(ctx context.Context, tenantId, groupId, userId string) error {
+	imr.mutex.Lock()
+	defer imr.mutex.Unlock()
+
+	_, err := imr.group(tenantId, groupId)
+
+	if err != nil {
+		return err
+	}
+
+	if !imr.groupUsers[groupId][userId] {
+		return newErrNotFound("user is not a member of group")
+	}
+
+	delete(imr.groupUsers[groupId], userId)
+
+	return nil
+}
+
+// AddSubgroup makes a group a direct member of another group, fails if this would create a cycle.
+func (imr *inMemoryUserRepository) AddSubgroup(ctx context.Context, tenantId, groupId, memberGroupId string) error {
+	imr.mutex.Lock()
+	defer imr.mutex.Unlock()
+
+	_, err := imr.group(tenantId, groupId)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = imr.group(tenantId, memberGroupId)
+
+	if err != nil {
+		return err
+	}
+
+	if groupId == memberGroupId || imr.isDescendant(memberGroupId, groupId) {
+		return newErrConflict("group membership would create a cycle")
+	}
+
+	if _, ok := imr.subgroups[groupId]; !ok {
+		imr.subgroups[groupId] = make(map[string]bool)
+	}
+
+	imr.subgroups[groupId][memberGroupId] = true
+
+	return nil
+}
+
+// RemoveSubgroup removes a group from the direct members of another group.
+func (imr *inMemoryUserRepository) RemoveSubgroup(ctx context.Context, tenantId, groupId, memberGroupId string) error {
+	imr.mutex.Lock()
+	defer imr.mutex.Unlock()
+
+	_, err := imr.group(tenantId, groupId)
+
+	if err != nil {
+		return err
+	}
+
+	if !imr.subgroups[groupId][memberGroupId] {
+		return newErrNotFound("group is not a member of group")
+	}
+
+	delete(imr.subgroups[groupId], memberGroupId)
+
+	return nil
+}
+
+// GetUserGroups retrieves every group a user is a member of, directly or through nested groups, ordered by name.
+func (imr *inMemoryUserRepository) GetUserGroups(ctx context.Context, tenantId, userId string) ([]common.Group,
+	error) {
+	imr.mutex.RLock()
+	defer imr.mutex.RUnlock()
+
+	memberOf := make(map[string]bool)
+	pending := make([]string, 0)
+
+	for groupId, users := range imr.groupUsers {
+		if users[userId] && imr.groups[groupId].TenantId == tenantId {
+			memberOf[groupId] = true
+			pending = append(pending, groupId)
+		}
+	}
+
+	for len(pending) > 0 {
+		childId := pending[0]
+		pending = pending[1:]
+
+		for parentId, members := range imr.subgroups {
+			if members[childId] && !memberOf[parentId] {
+				memberOf[parentId] = true
+				pending = append(pending, parentId)
+			}
+		}
+	}
+
+	groups := make([]common.Group, 0, len(memberOf))
+
+	for groupId := range memberOf {
+		groups = append(groups, *imr.groups[groupId])
+	}
+
+	sortGroups(groups)
+
+	return groups, nil
+}
+
+func (imr *inMemoryUserRepository) group(tenantId, groupId string) (*common.Group, error) {
+	group, ok := imr.groups[groupId]
+
+	if !ok || group.TenantId != tenantId {
+		return nil, newErrNotFound("group not found")
+	}
+
+	return group, nil
+}
+
+func (imr *inMemoryUserRepository) groupByName(tenantId, name string) *common.Group {
+	for _, group := range imr.groups {
+		if group.TenantId == tenantId && group.Name == name {
+			return group
+		}
+	}
+
+	return nil
+}
+
+// isDescendant reports whether target is reachable from groupId by following subgroup memberships.
+func (imr *inMemoryUserRepository) isDescendant(groupId, target string) bool {
+	visited := make(map[string]bool)
+	pending := []string{groupId}
+
+	for len(pending) > 0 {
+		current := pending[0]
+		pending = pending[1:]
+
+		for memberId := range imr.subgroups[current] {
+			if memberId == target {
+				return true
+			}
+
+			if !visited[memberId] {
+				visited[memberId] = true
+				pending = append(pending, memberId)
+			}
+		}
+	}
+
+	return false
+}
+
+func sortGroups(groups []common.Group) {
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Name < groups[j].Name
+	})
+}
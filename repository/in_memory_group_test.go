@@ -0,0 +1,111 @@
+package repository_test
+
+import (
+	"context"
+	"github.com/stone1549/auth-service/common"
+	"github.com/stone1549/auth-service/repository"
+	"testing"
+)
+
+func makeNewImGroupRepo(t *testing.T) repository.GroupRepository {
+	repo, ok := makeNewImRepo(t).(repository.GroupRepository)
+	assert(t, ok, "expected in memory repo to implement GroupRepository")
+	return repo
+}
+
+func groupNames(groups []common.Group) []string {
+	names := make([]string, 0, len(groups))
+	for _, group := range groups {
+		names = append(names, group.Name)
+	}
+	return names
+}
+
+// TestInMemoryGroupRepository_Crud ensures groups can be created, renamed, listed and deleted within a tenant.
+func TestInMemoryGroupRepository_Crud(t *testing.T) {
+	repo := makeNewImGroupRepo(t)
+	ctx := context.Background()
+
+	admins, err := repo.NewGroup(ctx, common.DefaultTenantId, "admins", "administrators")
+	ok(t, err)
+	_, err = repo.NewGroup(ctx, common.DefaultTenantId, "admins", "")
+	assert(t, repository.IsConflict(err), "expected conflict creating duplicate group, got %v", err)
+	_, err = repo.NewGroup(ctx, "acme", "admins", "")
+	ok(t, err)
+
+	renamed, err := repo.UpdateGroup(ctx, common.DefaultTenantId, admins.Id, "operators", "ops")
+	ok(t, err)
+	equals(t, "operators", renamed.Name)
+
+	groups, err := repo.ListGroups(ctx, common.DefaultTenantId)
+	ok(t, err)
+	equals(t, []string{"operators"}, groupNames(groups))
+
+	_, err = repo.GetGroup(ctx, "acme", admins.Id)
+	assert(t, repository.IsNotFound(err), "expected group to be hidden from other tenants, got %v", err)
+
+	ok(t, repo.DeleteGroup(ctx, common.DefaultTenantId, admins.Id))
+	_, err = repo.GetGroup(ctx, common.DefaultTenantId, admins.Id)
+	assert(t, repository.IsNotFound(err), "expected deleted group to be gone, got %v", err)
+}
+
+// TestInMemoryGroupRepository_NestedMembership ensures users are members of every group above their own.
+func TestInMemoryGroupRepository_NestedMembership(t *testing.T) {
+	repo := makeNewImGroupRepo(t)
+	ctx := context.Background()
+
+	staff, err := repo.NewGroup(ctx, common.DefaultTenantId, "staff", "")
+	ok(t, err)
+	engineering, err := repo.NewGroup(ctx, common.DefaultTenantId, "engineering", "")
+	ok(t, err)
+	backend, err := repo.NewGroup(ctx, common.DefaultTenantId, "backend", "")
+	ok(t, err)
+
+	ok(t, repo.AddSubgroup(ctx, common.DefaultTenantId, staff.Id, engineering.Id))
+	ok(t, repo.AddSubgroup(ctx, common.DefaultTenantId, engineering.Id, backend.Id))
+	ok(t, repo.AddGroupUser(ctx, common.DefaultTenantId, backend.Id, "3"))
+
+	err = repo.AddGroupUser(ctx, common.DefaultTenantId, backend.Id, "missing")
+	assert(t, repository.IsNotFound(err), "expected unknown user to be rejected, got %v", err)
+
+	groups, err := repo.GetUserGroups(ctx, common.DefaultTenantId, "3")
+	ok(t, err)
+	equals(t, []string{"backend", "engineering", "staff"}, groupNames(groups))
+
+	members, err := repo.GetGroupMembers(ctx, common.DefaultTenantId, engineering.Id)
+	ok(t, err)
+	equals(t, []string{backend.Id}, members.GroupIds)
+	equals(t, []string{}, members.UserIds)
+
+	ok(t, repo.RemoveSubgroup(ctx, common.DefaultTenantId, engineering.Id, backend.Id))
+	groups, err = repo.GetUserGroups(ctx, common.DefaultTenantId, "3")
+	ok(t, err)
+	equals(t, []string{"backend"}, groupNames(groups))
+
+	ok(t, repo.RemoveGroupUser(ctx, common.DefaultTenantId, backend.Id, "3"))
+	groups, err = repo.GetUserGroups(ctx, common.DefaultTenantId, "3")
+	ok(t, err)
+	equals(t, 0, len(groups))
+}
+
+// TestInMemoryGroupRepository_Cycle ensures group memberships that would form a cycle are rejected.
+func TestInMemoryGroupRepository_Cycle(t *testing.T) {
+	repo := makeNewImGroupRepo(t)
+	ctx := context.Background()
+
+	a, err := repo.NewGroup(ctx, common.DefaultTenantId, "a", "")
+	ok(t, err)
+	b, err := repo.NewGroup(ctx, common.DefaultTenantId, "b", "")
+	ok(t, err)
+	c, err := repo.NewGroup(ctx, common.DefaultTenantId, "c", "")
+	ok(t, err)
+
+	ok(t, repo.AddSubgroup(ctx, common.DefaultTenantId, a.Id, b.Id))
+	ok(t, repo.AddSubgroup(ctx, common.DefaultTenantId, b.Id, c.Id))
+
+	err = repo.AddSubgroup(ctx, common.DefaultTenantId, c.Id, a.Id)
+	assert(t, repository.IsConflict(err), "expected cycle to be rejected, got %v", err)
+
+	err = repo.AddSubgroup(ctx, common.DefaultTenantId, a.Id, a.Id)
+	assert(t, repository.IsConflict(err), "expected self membership to be rejected, got %v", err)
+}
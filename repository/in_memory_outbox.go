@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stone1549/auth-service/common"
+	"github.com/twinj/uuid"
+	"sort"
+	"time"
+)
+
+type outboxEntry struct {
+	common.OutboxEvent
+	nextAttemptAt time.Time
+	lastError     string
+	dead          bool
+}
+
+// userEventPayload is the payload of events about a user.
+func userEventPayload(userId, email string) map[string]string {
+	return map[string]string{"userId": userId, "email": email}
+}
+
+// appendUserEvent records an event about a user in the outbox, the caller must hold the write lock.
+func (imr *inMemoryUserRepository) appendUserEvent(tenantId, userId, email, eventType string, now time.Time) error {
+	payload, err := json.Marshal(userEventPayload(userId, email))
+
+	if err != nil {
+		return err
+	}
+
+	imr.outbox = append(imr.outbox, &outboxEntry{
+		OutboxEvent: common.OutboxEvent{
+			Id:          uuid.NewV4().String(),
+			TenantId:    tenantId,
+			AggregateId: userId,
+			Type:        eventType,
+			Payload:     payload,
+			CreatedAt:   now,
+		},
+		nextAttemptAt: now,
+	})
+
+	return nil
+}
+
+// ClaimOutbox retrieves events due by now that aren't dead, oldest first, hiding them from other claims for lease.
+func (imr *inMemoryUserRepository) ClaimOutbox(ctx context.Context, now time.Time, lease time.Duration,
+	limit int) ([]common.OutboxEvent, error) {
+	imr.mutex.Lock()
+	defer imr.mutex.Unlock()
+
+	due := make([]*outboxEntry, 0)
+
+	for _, entry := range imr.outbox {
+		if !entry.dead && !entry.nextAttemptAt.After(now) {
+			due = append(due, entry)
+		}
+	}
+
+	sort.SliceStable(due, func(i, j int) bool {
+		return due[i].CreatedAt.Before(due[j].CreatedAt)
+	})
+
+	events := make([]common.OutboxEvent, 0)
+
+	for _, entry := range due {
+		if len(events) == limit {
+			break
+		}
+
+		entry.nextAttemptAt = now.Add(lease)
+		events = append(events, entry.OutboxEvent)
+	}
+
+	return events, nil
+}
+
+// MarkPublished records that an event was published, published events are dropped from memory.
+func (imr *inMemoryUserRepository) MarkPublished(ctx context.Context, eventId string) error {
+	imr.mutex.Lock()
+	defer imr.mutex.Unlock()
+
+	for i, entry := range imr.outbox {
+		if entry.Id == eventId {
+			imr.outbox = append(imr.outbox[:i], imr.outbox[i+1:]...)
+			return nil
+		}
+	}
+
+	return newErrNotFound("event not found")
+}
+
+// MarkPublishFailed records a failed attempt to publish an event, scheduling the next attempt or marking it dead.
+func (imr *inMemoryUserRepository) MarkPublishFailed(ctx context.Context, eventId, lastError string,
+	nextAttemptAt time.Time, dead bool) error {
+	imr.mutex.Lock()
+	defer imr.mutex.Unlock()
+
+	for _, entry := range imr.outbox {
+		if entry.Id == eventId {
+			entry.Attempts++
+			entry.lastError = lastError
+			entry.nextAttemptAt = nextAttemptAt
+			entry.dead = dead
+			return nil
+		}
+	}
+
+	return newErrNotFound("event not found")
+}
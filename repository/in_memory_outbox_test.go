@@ -0,0 +1,86 @@
+package repository_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stone1549/auth-service/common"
+	"github.com/stone1549/auth-service/repository"
+	"testing"
+	"time"
+)
+
+// TestInMemoryOutboxRepository ensures new users record a user.created event that's hidden while claimed, claimable
+// again once the retry scheduled after a failure is due and gone once published.
+func TestInMemoryOutboxRepository(t *testing.T) {
+	userRepo := makeNewImRepo(t)
+	repo, isOutbox := userRepo.(repository.OutboxRepository)
+	assert(t, isOutbox, "expected in memory repo to implement OutboxRepository")
+	ctx := context.Background()
+
+	// Drain events of the initial dataset, if any.
+	_, err := repo.ClaimOutbox(ctx, time.Now(), time.Hour, 1000)
+	ok(t, err)
+
+	id, err := userRepo.NewUser(ctx, common.DefaultTenantId, "outbox@example.com", "password")
+	ok(t, err)
+
+	now := time.Now().Add(time.Second)
+	events, err := repo.ClaimOutbox(ctx, now, time.Minute, 10)
+	ok(t, err)
+	equals(t, 1, len(events))
+	equals(t, common.UserCreatedEvent, events[0].Type)
+	equals(t, id, events[0].AggregateId)
+
+	var payload map[string]string
+	ok(t, json.Unmarshal(events[0].Payload, &payload))
+	equals(t, map[string]string{"userId": id, "email": "outbox@example.com"}, payload)
+
+	claimed, err := repo.ClaimOutbox(ctx, now, time.Minute, 10)
+	ok(t, err)
+	equals(t, 0, len(claimed))
+
+	ok(t, repo.MarkPublishFailed(ctx, events[0].Id, "connection refused", now.Add(5*time.Minute), false))
+
+	claimed, err = repo.ClaimOutbox(ctx, now.Add(2*time.Minute), time.Minute, 10)
+	ok(t, err)
+	equals(t, 0, len(claimed))
+
+	claimed, err = repo.ClaimOutbox(ctx, now.Add(5*time.Minute), time.Minute, 10)
+	ok(t, err)
+	equals(t, 1, len(claimed))
+	equals(t, events[0].Id, claimed[0].Id)
+	equals(t, 1, claimed[0].Attempts)
+
+	ok(t, repo.MarkPublished(ctx, events[0].Id))
+
+	claimed, err = repo.ClaimOutbox(ctx, now.Add(time.Hour), time.Minute, 10)
+	ok(t, err)
+	equals(t, 0, len(claimed))
+
+	err = repo.MarkPublished(ctx, events[0].Id)
+	assert(t, repository.IsNotFound(err), "expected published event to be gone")
+}
+
+// TestInMemoryOutboxRepository_Dead ensures events marked dead are never claimed again.
+func TestInMemoryOutboxRepository_Dead(t *testing.T) {
+	userRepo := makeNewImRepo(t)
+	repo := userRepo.(repository.OutboxRepository)
+	ctx := context.Background()
+
+	_, err := repo.ClaimOutbox(ctx, time.Now(), time.Hour, 1000)
+	ok(t, err)
+
+	_, err = userRepo.NewUser(ctx, common.DefaultTenantId, "dead@example.com", "password")
+	ok(t, err)
+
+	now := time.Now().Add(time.Second)
+	events, err := repo.ClaimOutbox(ctx, now, time.Minute, 10)
+	ok(t, err)
+	equals(t, 1, len(events))
+
+	ok(t, repo.MarkPublishFailed(ctx, events[0].Id, "connection refused", now, true))
+
+	claimed, err := repo.ClaimOutbox(ctx, now.Add(time.Hour), time.Minute, 10)
+	ok(t, err)
+	equals(t, 0, len(claimed))
+}
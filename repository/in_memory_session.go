@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"context"
+	"github.com/stone1549/auth-service/common"
+	"github.com/twinj/uuid"
+	"sort"
+	"time"
+)
+
+// NewSession records a session of the session's user, expiring after its idle timeout or at its expiry.
+func (imr *inMemoryUserRepository) NewSession(ctx context.Context, session common.Session) (common.Session, error) {
+	err := validateSession(session)
+
+	if err != nil {
+		return common.Session{}, err
+	}
+
+	now := time.Now()
+	session.Id = uuid.NewV4().String()
+	session.CreatedAt = now
+	session.LastSeenAt = now
+
+	imr.mutex.Lock()
+	defer imr.mutex.Unlock()
+
+	imr.sessions[session.Id] = &session
+
+	return session, nil
+}
+
+// GetSession retrieves a session by id.
+func (imr *inMemoryUserRepository) GetSession(ctx context.Context, tenantId, sessionId string) (common.Session,
+	error) {
+	imr.mutex.RLock()
+	defer imr.mutex.RUnlock()
+
+	session, ok := imr.sessions[sessionId]
+
+	if !ok || session.TenantId != tenantId {
+		return common.Session{}, newErrNotFound("session not found")
+	}
+
+	return *session, nil
+}
+
+// ListSessions retrieves a user's sessions, most recently seen first.
+func (imr *inMemoryUserRepository) ListSessions(ctx context.Context, tenantId, userId string) ([]common.Session,
+	error) {
+	imr.mutex.RLock()
+	defer imr.mutex.RUnlock()
+
+	sessions := make([]common.Session, 0)
+
+	for _, session := range imr.sessions {
+		if session.TenantId == tenantId && session.UserId == userId {
+			sessions = append(sessions, *session)
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt)
+	})
+
+	return sessions, nil
+}
+
+// TouchSession records that a session was seen at the given time.
+func (imr *inMemoryUserRepository) TouchSession(ctx context.Context, tenantId, sessionId string,
+	seenAt time.Time) error {
+	imr.mutex.Lock()
+	defer imr.mutex.Unlock()
+
+	session, ok := imr.sessions[sessionId]
+
+	if !ok || session.TenantId != tenantId {
+		return newErrNotFound("session not found")
+	}
+
+	if seenAt.After(session.LastSeenAt) {
+		session.LastSeenAt = seenAt
+	}
+
+	return nil
+}
+
+// DeleteSession revokes one of a user's sessions.
+func (imr *inMemoryUserRepository) DeleteSession(ctx context.Context, tenantId, userId, sessionId string) error {
+	imr.mutex.Lock()
+	defer imr.mutex.Unlock()
+
+	session, ok := imr.sessions[sessionId]
+
+	if !ok || session.TenantId != tenantId || session.UserId != userId {
+		return newErrNotFound("session not found")
+	}
+
+	delete(imr.sessions, sessionId)
+
+	return nil
+}
+
+// DeleteExpiredSessions removes every session of any tenant expired by now, returning how many were removed.
+func (imr *inMemoryUserRepository) DeleteExpiredSessions(ctx context.Context, now time.Time) (int, error) {
+	imr.mutex.Lock()
+	defer imr.mutex.Unlock()
+
+	deleted := 0
+
+	for id, session := range imr.sessions {
+		if session.Expired(now) {
+			delete(imr.sessions, id)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+func validateSession(session common.Session) error {
+	if session.TenantId == "" {
+		return newErrRepository("tenant is required")
+	} else if session.UserId == "" {
+		return newErrRepository("user is required")
+	} else if session.IdleTimeout < 0 {
+		return newErrRepository("idle timeout can't be negative")
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package repository_test
+
+import (
+	"context"
+	"github.com/stone1549/auth-service/common"
+	"github.com/stone1549/auth-service/repository"
+	"testing"
+	"time"
+)
+
+func makeNewImSessionRepo(t *testing.T) repository.SessionRepository {
+	repo, ok := makeNewImRepo(t).(repository.SessionRepository)
+	assert(t, ok, "expected in memory repo to implement SessionRepository")
+	return repo
+}
+
+// TestInMemorySessionRepository_Crud ensures sessions can be recorded, touched, listed most recently seen first and
+// revoked only by their user within their tenant.
+func TestInMemorySessionRepository_Crud(t *testing.T) {
+	repo := makeNewImSessionRepo(t)
+	ctx := context.Background()
+
+	laptop, err := repo.NewSession(ctx, common.Session{TenantId: common.DefaultTenantId, UserId: "jane",
+		RemoteAddr: "10.0.0.1", UserAgent: "Mozilla/5.0", DeviceLabel: "Firefox on Linux"})
+	ok(t, err)
+	assert(t, laptop.Id != "", "expected session to be given an id")
+	phone, err := repo.NewSession(ctx, common.Session{TenantId: common.DefaultTenantId, UserId: "jane"})
+	ok(t, err)
+	_, err = repo.NewSession(ctx, common.Session{TenantId: common.DefaultTenantId, UserId: "john"})
+	ok(t, err)
+	_, err = repo.NewSession(ctx, common.Session{TenantId: common.DefaultTenantId})
+	notOk(t, err)
+
+	ok(t, repo.TouchSession(ctx, common.DefaultTenantId, laptop.Id, time.Now().Add(time.Minute)))
+	sessions, err := repo.ListSessions(ctx, common.DefaultTenantId, "jane")
+	ok(t, err)
+	equals(t, 2, len(sessions))
+	equals(t, laptop.Id, sessions[0].Id)
+	equals(t, "Firefox on Linux", sessions[0].DeviceLabel)
+	equals(t, phone.Id, sessions[1].Id)
+
+	_, err = repo.GetSession(ctx, "acme", laptop.Id)
+	assert(t, repository.IsNotFound(err), "expected session of another tenant not to be found")
+
+	err = repo.DeleteSession(ctx, common.DefaultTenantId, "john", laptop.Id)
+	assert(t, repository.IsNotFound(err), "expected session of another user not to be revoked")
+	ok(t, repo.DeleteSession(ctx, common.DefaultTenantId, "jane", laptop.Id))
+	_, err = repo.GetSession(ctx, common.DefaultTenantId, laptop.Id)
+	assert(t, repository.IsNotFound(err), "expected revoked session not to be found")
+}
+
+// TestInMemorySessionRepository_DeleteExpired ensures only sessions that went idle or outlived their lifetime are
+// deleted.
+func TestInMemorySessionRepository_DeleteExpired(t *testing.T) {
+	repo := makeNewImSessionRepo(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	idle, err := repo.NewSession(ctx, common.Session{TenantId: common.DefaultTenantId, UserId: "jane",
+		IdleTimeout: 30 * time.Minute})
+	ok(t, err)
+	_, err = repo.NewSession(ctx, common.Session{TenantId: common.DefaultTenantId, UserId: "jane",
+		ExpiresAt: now.Add(12 * time.Hour)})
+	ok(t, err)
+	unlimited, err := repo.NewSession(ctx, common.Session{TenantId: common.DefaultTenantId, UserId: "jane"})
+	ok(t, err)
+	_, err = repo.NewSession(ctx, common.Session{TenantId: common.DefaultTenantId, UserId: "jane",
+		IdleTimeout: -time.Minute})
+	notOk(t, err)
+
+	ok(t, repo.TouchSession(ctx, common.DefaultTenantId, idle.Id, now.Add(20*time.Minute)))
+	deleted, err := repo.DeleteExpiredSessions(ctx, now.Add(40*time.Minute))
+	ok(t, err)
+	equals(t, 0, deleted)
+
+	deleted, err = repo.DeleteExpiredSessions(ctx, now.Add(12*time.Hour))
+	ok(t, err)
+	equals(t, 2, deleted)
+
+	sessions, err := repo.ListSessions(ctx, common.DefaultTenantId, "jane")
+	ok(t, err)
+	equals(t, 1, len(sessions))
+	equals(t, unlimited.Id, sessions[0].Id)
+}
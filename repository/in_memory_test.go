@@ -1,6 +1,8 @@
 package repository_test
 
 import (
+	"context"
+	"github.com/stone1549/auth-service/common"
 	"github.com/stone1549/auth-service/repository"
 	"testing"
 )
@@ -11,3 +13,54 @@ func makeNewImRepo(t *testing.T) repository.UserRepository {
 	ok(t, err)
 	return repo
 }
+
+// TestInMemoryUserRepository_TenantIsolation ensures the same email can be registered in different tenants and that
+// users only authenticate against their own tenant.
+func TestInMemoryUserRepository_TenantIsolation(t *testing.T) {
+	repo := makeNewImRepo(t)
+	ctx := context.Background()
+
+	acmeId, err := repo.NewUser(ctx, "acme", "user@justinstone.net", "password1")
+	ok(t, err)
+
+	otherId, err := repo.NewUser(ctx, "other", "user@justinstone.net", "password2")
+	ok(t, err)
+	assert(t, acmeId != otherId, "expected distinct ids for users in different tenants")
+
+	_, err = repo.NewUser(ctx, "acme", "user@justinstone.net", "password3")
+	notOk(t, err)
+
+	id, err := repo.Authenticate(ctx, "acme", "user@justinstone.net", "password1")
+	ok(t, err)
+	equals(t, acmeId, id)
+
+	_, err = repo.Authenticate(ctx, "other", "user@justinstone.net", "password1")
+	notOk(t, err)
+
+	_, err = repo.Authenticate(ctx, "missing", "user@justinstone.net", "password1")
+	notOk(t, err)
+}
+
+// TestInMemoryUserRepository_Tuples ensures tuples are written, deleted and read per tenant.
+func TestInMemoryUserRepository_Tuples(t *testing.T) {
+	repo := makeNewImRepo(t).(repository.TupleRepository)
+	ctx := context.Background()
+	alice := common.Tuple{Object: "document:readme", Relation: "owner", Subject: "alice"}
+	bob := common.Tuple{Object: "document:readme", Relation: "owner", Subject: "bob"}
+
+	ok(t, repo.WriteTuples(ctx, common.DefaultTenantId, []common.Tuple{bob, alice, alice}, nil))
+	tuples, err := repo.ReadTuples(ctx, common.DefaultTenantId, "document:readme", "owner")
+	ok(t, err)
+	equals(t, []common.Tuple{alice, bob}, tuples)
+
+	tuples, err = repo.ReadTuples(ctx, "acme", "document:readme", "owner")
+	ok(t, err)
+	equals(t, 0, len(tuples))
+
+	ok(t, repo.WriteTuples(ctx, common.DefaultTenantId, nil, []common.Tuple{alice}))
+	tuples, err = repo.ReadTuples(ctx, common.DefaultTenantId, "document:readme", "owner")
+	ok(t, err)
+	equals(t, []common.Tuple{bob}, tuples)
+
+	notOk(t, repo.WriteTuples(ctx, common.DefaultTenantId, []common.Tuple{{Object: "document:readme"}}, nil))
+}
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+	"github.com/stone1549/auth-service/common"
+	"sort"
+)
+
+// WriteTuples atomically adds and removes the given tuples within a tenant.
+func (imr *inMemoryUserRepository) WriteTuples(ctx context.Context, tenantId string, writes []common.Tuple,
+	deletes []common.Tuple) error {
+	if tenantId == "" {
+		return newErrRepository("tenant is required")
+	}
+
+	err := validateTuples(writes, deletes)
+
+	if err != nil {
+		return err
+	}
+
+	imr.mutex.Lock()
+	defer imr.mutex.Unlock()
+
+	tuples, ok := imr.tuples[tenantId]
+	if !ok {
+		tuples = make(map[string]map[string]bool)
+		imr.tuples[tenantId] = tuples
+	}
+
+	for _, tuple := range deletes {
+		delete(tuples[tuple.Object+"#"+tuple.Relation], tuple.Subject)
+	}
+
+	for _, tuple := range writes {
+		key := tuple.Object + "#" + tuple.Relation
+
+		if _, ok := tuples[key]; !ok {
+			tuples[key] = make(map[string]bool)
+		}
+
+		tuples[key][tuple.Subject] = true
+	}
+
+	return nil
+}
+
+// ReadTuples retrieves every tuple of a tenant with the given object and relation ordered by subject.
+func (imr *inMemoryUserRepository) ReadTuples(ctx context.Context, tenantId, object, relation string) ([]common.Tuple,
+	error) {
+	imr.mutex.RLock()
+	defer imr.mutex.RUnlock()
+
+	subjects := make([]string, 0)
+
+	for subject := range imr.tuples[tenantId][object+"#"+relation] {
+		subjects = append(subjects, subject)
+	}
+
+	sort.Strings(subjects)
+
+	tuples := make([]common.Tuple, 0, len(subjects))
+
+	for _, subject := range subjects {
+		tuples = append(tuples, common.Tuple{Object: object, Relation: relation, Subject: subject})
+	}
+
+	return tuples, nil
+}
+
+func validateTuples(tupleLists ...[]common.Tuple) error {
+	for _, tuples := range tupleLists {
+		for _, tuple := range tuples {
+			if tuple.Object == "" || tuple.Relation == "" || tuple.Subject == "" {
+				return newErrRepository("tuple object, relation and subject are required")
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,238 @@
+package repository
+
+import (
+	"context"
+	"github.com/stone1549/auth-service/common"
+	"github.com/twinj/uuid"
+	"sort"
+	"time"
+)
+
+func (user *storedUser) account() common.UserAccount {
+	return common.UserAccount{
+		Id:          user.Id,
+		TenantId:    user.TenantId,
+		Email:       user.Email,
+		ExternalId:  user.ExternalId,
+		GivenName:   user.GivenName,
+		FamilyName:  user.FamilyName,
+		DisplayName: user.DisplayName,
+		Active:      !user.Disabled,
+		Attributes:  copyAttributes(user.Attributes),
+		CreatedAt:   user.CreatedAt,
+		UpdatedAt:   user.UpdatedAt,
+	}
+}
+
+// CreateUser adds a user to the account's tenant with the given password.
+func (imr *inMemoryUserRepository) CreateUser(ctx context.Context, account common.UserAccount,
+	password string) (common.UserAccount, error) {
+	if account.TenantId == "" {
+		return common.UserAccount{}, newErrRepository("tenant is required")
+	} else if account.Email == "" {
+		return common.UserAccount{}, newErrRepository("email is required")
+	} else if password == "" {
+		return common.UserAccount{}, newErrRepository("password is required")
+	}
+
+	saltedHash, err := hashPassword(ctx, password)
+
+	if err != nil {
+		return common.UserAccount{}, newErrRepository("unable to generate password")
+	}
+
+	imr.mutex.Lock()
+	defer imr.mutex.Unlock()
+
+	usersByEmail, ok := imr.usersByTenant[account.TenantId]
+
+	if !ok {
+		usersByEmail = make(map[string]*storedUser)
+		imr.usersByTenant[account.TenantId] = usersByEmail
+	}
+
+	if _, ok = usersByEmail[account.Email]; ok {
+		return common.UserAccount{}, newErrConflict("user already exists")
+	}
+
+	now := time.Now()
+	user := &storedUser{
+		User:        common.User{Email: account.Email},
+		Id:          uuid.NewV4().String(),
+		TenantId:    account.TenantId,
+		SaltedHash:  string(saltedHash),
+		ExternalId:  account.ExternalId,
+		GivenName:   account.GivenName,
+		FamilyName:  account.FamilyName,
+		DisplayName: account.DisplayName,
+		Disabled:    !account.Active,
+		Attributes:  copyAttributes(account.Attributes),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	err = imr.appendUserEvent(user.TenantId, user.Id, user.Email, common.UserCreatedEvent, now)
+
+	if err != nil {
+		return common.UserAccount{}, err
+	}
+
+	usersByEmail[user.Email] = user
+
+	return user.account(), nil
+}
+
+// GetUser retrieves a user by id.
+func (imr *inMemoryUserRepository) GetUser(ctx context.Context, tenantId, userId string) (common.UserAccount,
+	error) {
+	imr.mutex.RLock()
+	defer imr.mutex.RUnlock()
+
+	user, ok := imr.userById(tenantId, userId)
+
+	if !ok {
+		return common.UserAccount{}, newErrNotFound("user not found")
+	}
+
+	return user.account(), nil
+}
+
+// GetUserByEmail retrieves a user by email.
+func (imr *inMemoryUserRepository) GetUserByEmail(ctx context.Context, tenantId, email string) (common.UserAccount,
+	error) {
+	imr.mutex.RLock()
+	defer imr.mutex.RUnlock()
+
+	user, ok := imr.usersByTenant[tenantId][email]
+
+	if !ok {
+		return common.UserAccount{}, newErrNotFound("user not found")
+	}
+
+	return user.account(), nil
+}
+
+// ListUsers retrieves all users of the given tenant ordered by email.
+func (imr *inMemoryUserRepository) ListUsers(ctx context.Context, tenantId string) ([]common.UserAccount, error) {
+	imr.mutex.RLock()
+	defer imr.mutex.RUnlock()
+
+	accounts := make([]common.UserAccount, 0, len(imr.usersByTenant[tenantId]))
+
+	for _, user := range imr.usersByTenant[tenantId] {
+		accounts = append(accounts, user.account())
+	}
+
+	sort.Slice(accounts, func(i, j int) bool {
+		return accounts[i].Email < accounts[j].Email
+	})
+
+	return accounts, nil
+}
+
+// UpdateUser changes the details of the user identified by the account's tenant and id.
+func (imr *inMemoryUserRepository) UpdateUser(ctx context.Context, account common.UserAccount) (common.UserAccount,
+	error) {
+	if account.Email == "" {
+		return common.UserAccount{}, newErrRepository("email is required")
+	}
+
+	imr.mutex.Lock()
+	defer imr.mutex.Unlock()
+
+	user, ok := imr.userById(account.TenantId, account.Id)
+
+	if !ok {
+		return common.UserAccount{}, newErrNotFound("user not found")
+	}
+
+	usersByEmail := imr.usersByTenant[account.TenantId]
+
+	if account.Email != user.Email {
+		if _, ok = usersByEmail[account.Email]; ok {
+			return common.UserAccount{}, newErrConflict("user already exists")
+		}
+
+		delete(usersByEmail, user.Email)
+		user.Email = account.Email
+		usersByEmail[user.Email] = user
+	}
+
+	user.ExternalId = account.ExternalId
+	user.GivenName = account.GivenName
+	user.FamilyName = account.FamilyName
+	user.DisplayName = account.DisplayName
+	user.Disabled = !account.Active
+	user.Attributes = copyAttributes(account.Attributes)
+	user.UpdatedAt = time.Now()
+
+	return user.account(), nil
+}
+
+// SetPassword changes a user's password.
+func (imr *inMemoryUserRepository) SetPassword(ctx context.Context, tenantId, userId, password string) error {
+	if password == "" {
+		return newErrRepository("password is required")
+	}
+
+	saltedHash, err := hashPassword(ctx, password)
+
+	if err != nil {
+		return newErrRepository("unable to generate password")
+	}
+
+	imr.mutex.Lock()
+	defer imr.mutex.Unlock()
+
+	user, ok := imr.userById(tenantId, userId)
+
+	if !ok {
+		return newErrNotFound("user not found")
+	}
+
+	user.SaltedHash = string(saltedHash)
+	user.UpdatedAt = time.Now()
+
+	return nil
+}
+
+// DeleteUser removes a user and their group memberships.
+func (imr *inMemoryUserRepository) DeleteUser(ctx context.Context, tenantId, userId string) error {
+	imr.mutex.Lock()
+	defer imr.mutex.Unlock()
+
+	user, ok := imr.userById(tenantId, userId)
+
+	if !ok {
+		return newErrNotFound("user not found")
+	}
+
+	err := imr.appendUserEvent(tenantId, userId, user.Email, common.UserDeletedEvent, time.Now())
+
+	if err != nil {
+		return err
+	}
+
+	delete(imr.usersByTenant[tenantId], user.Email)
+
+	for _, members := range imr.groupUsers {
+		delete(members, userId)
+	}
+
+	return nil
+}
+
+// copyAttributes copies a user's attributes so that the stored user can't be changed through an account.
+func copyAttributes(attributes map[string]string) map[string]string {
+	if len(attributes) == 0 {
+		return nil
+	}
+
+	copied := make(map[string]string, len(attributes))
+
+	for key, value := range attributes {
+		copied[key] = value
+	}
+
+	return copied
+}
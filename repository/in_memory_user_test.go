@@ -0,0 +1,73 @@
+package repository_test
+
+import (
+	"context"
+	"github.com/stone1549/auth-service/common"
+	"github.com/stone1549/auth-service/repository"
+	"testing"
+)
+
+func makeNewImUserAdminRepo(t *testing.T) repository.UserAdminRepository {
+	repo, ok := makeNewImRepo(t).(repository.UserAdminRepository)
+	assert(t, ok, "expected in memory repo to implement UserAdminRepository")
+	return repo
+}
+
+// TestInMemoryUserAdminRepository_Crud ensures users can be provisioned, updated, listed and deleted within a tenant.
+func TestInMemoryUserAdminRepository_Crud(t *testing.T) {
+	repo := makeNewImUserAdminRepo(t)
+	ctx := context.Background()
+
+	created, err := repo.CreateUser(ctx, common.UserAccount{TenantId: "acme", Email: "jane@example.com",
+		ExternalId: "00u1", GivenName: "Jane", Active: true}, "password1")
+	ok(t, err)
+	equals(t, "Jane", created.GivenName)
+	equals(t, true, created.Active)
+
+	_, err = repo.CreateUser(ctx, common.UserAccount{TenantId: "acme", Email: "jane@example.com"}, "password1")
+	assert(t, repository.IsConflict(err), "expected conflict creating duplicate user, got %v", err)
+
+	created.Email = "jane.doe@example.com"
+	created.Active = false
+	updated, err := repo.UpdateUser(ctx, created)
+	ok(t, err)
+	equals(t, "jane.doe@example.com", updated.Email)
+	equals(t, false, updated.Active)
+
+	users, err := repo.ListUsers(ctx, "acme")
+	ok(t, err)
+	equals(t, 1, len(users))
+	equals(t, "00u1", users[0].ExternalId)
+
+	_, err = repo.GetUser(ctx, common.DefaultTenantId, created.Id)
+	assert(t, repository.IsNotFound(err), "expected user to be hidden from other tenants, got %v", err)
+
+	ok(t, repo.DeleteUser(ctx, "acme", created.Id))
+	_, err = repo.GetUser(ctx, "acme", created.Id)
+	assert(t, repository.IsNotFound(err), "expected deleted user to be gone, got %v", err)
+}
+
+// TestInMemoryUserAdminRepository_Disabled ensures disabled users can't authenticate until they're reactivated.
+func TestInMemoryUserAdminRepository_Disabled(t *testing.T) {
+	repo := makeNewImRepo(t)
+	adminRepo := repo.(repository.UserAdminRepository)
+	ctx := context.Background()
+
+	created, err := adminRepo.CreateUser(ctx, common.UserAccount{TenantId: "acme", Email: "jane@example.com"},
+		"password1")
+	ok(t, err)
+
+	_, err = repo.Authenticate(ctx, "acme", "jane@example.com", "password1")
+	notOk(t, err)
+
+	created.Active = true
+	_, err = adminRepo.UpdateUser(ctx, created)
+	ok(t, err)
+	ok(t, adminRepo.SetPassword(ctx, "acme", created.Id, "password2"))
+
+	_, err = repo.Authenticate(ctx, "acme", "jane@example.com", "password1")
+	notOk(t, err)
+	id, err := repo.Authenticate(ctx, "acme", "jane@example.com", "password2")
+	ok(t, err)
+	equals(t, created.Id, id)
+}
@@ -0,0 +1,266 @@
+package repository
+
+import (
+	"context"
+	"github.com/stone1549/auth-service/common"
+	"github.com/twinj/uuid"
+	"sort"
+	"time"
+)
+
+// NewWebhook subscribes a URL to the given event types of a tenant.
+func (imr *inMemoryUserRepository) NewWebhook(ctx context.Context, tenantId, url, secret string,
+	events []string) (common.Webhook, error) {
+	err := validateWebhook(tenantId, url, secret, events)
+
+	if err != nil {
+		return common.Webhook{}, err
+	}
+
+	webhook := &common.Webhook{
+		Id:        uuid.NewV4().String(),
+		TenantId:  tenantId,
+		Url:       url,
+		Secret:    secret,
+		Events:    append([]string{}, events...),
+		CreatedAt: time.Now(),
+	}
+
+	imr.mutex.Lock()
+	defer imr.mutex.Unlock()
+
+	imr.webhooks[webhook.Id] = webhook
+
+	return copyWebhook(webhook), nil
+}
+
+// GetWebhook retrieves a webhook by id.
+func (imr *inMemoryUserRepository) GetWebhook(ctx context.Context, tenantId, webhookId string) (common.Webhook,
+	error) {
+	imr.mutex.RLock()
+	defer imr.mutex.RUnlock()
+
+	webhook, ok := imr.webhooks[webhookId]
+
+	if !ok || webhook.TenantId != tenantId {
+		return common.Webhook{}, newErrNotFound("webhook not found")
+	}
+
+	return copyWebhook(webhook), nil
+}
+
+// ListWebhooks retrieves all webhooks of the given tenant ordered by creation.
+func (imr *inMemoryUserRepository) ListWebhooks(ctx context.Context, tenantId string) ([]common.Webhook, error) {
+	imr.mutex.RLock()
+	defer imr.mutex.RUnlock()
+
+	webhooks := make([]common.Webhook, 0)
+
+	for _, webhook := range imr.webhooks {
+		if webhook.TenantId == tenantId {
+			webhooks = append(webhooks, copyWebhook(webhook))
+		}
+	}
+
+	sort.Slice(webhooks, func(i, j int) bool {
+		return webhooks[i].CreatedAt.Before(webhooks[j].CreatedAt)
+	})
+
+	return webhooks, nil
+}
+
+// DeleteWebhook removes a webhook and its deliveries.
+func (imr *inMemoryUserRepository) DeleteWebhook(ctx context.Context, tenantId, webhookId string) error {
+	imr.mutex.Lock()
+	defer imr.mutex.Unlock()
+
+	webhook, ok := imr.webhooks[webhookId]
+
+	if !ok || webhook.TenantId != tenantId {
+		return newErrNotFound("webhook not found")
+	}
+
+	delete(imr.webhooks, webhookId)
+
+	for id, delivery := range imr.deliveries {
+		if delivery.WebhookId == webhookId {
+			delete(imr.deliveries, id)
+		}
+	}
+
+	return nil
+}
+
+// EnqueueWebhookEvent queues a pending delivery of the payload to every subscribed webhook of the tenant.
+func (imr *inMemoryUserRepository) EnqueueWebhookEvent(ctx context.Context, tenantId, eventType string,
+	payload []byte) ([]common.WebhookDelivery, error) {
+	imr.mutex.Lock()
+	defer imr.mutex.Unlock()
+
+	now := time.Now()
+	deliveries := make([]common.WebhookDelivery, 0)
+
+	for _, webhook := range imr.webhooks {
+		if webhook.TenantId != tenantId || !webhook.Subscribes(eventType) {
+			continue
+		}
+
+		delivery := &common.WebhookDelivery{
+			Id:            uuid.NewV4().String(),
+			TenantId:      tenantId,
+			WebhookId:     webhook.Id,
+			EventType:     eventType,
+			Payload:       append([]byte{}, payload...),
+			Status:        common.PendingDelivery,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		}
+
+		imr.deliveries[delivery.Id] = delivery
+		deliveries = append(deliveries, *delivery)
+	}
+
+	return deliveries, nil
+}
+
+// ClaimDueDeliveries retrieves pending deliveries due by now, oldest first, deferring their next attempt by lease.
+func (imr *inMemoryUserRepository) ClaimDueDeliveries(ctx context.Context, now time.Time, lease time.Duration,
+	limit int) ([]common.WebhookDelivery, error) {
+	imr.mutex.Lock()
+	defer imr.mutex.Unlock()
+
+	due := make([]*common.WebhookDelivery, 0)
+
+	for _, delivery := range imr.deliveries {
+		if delivery.Status == common.PendingDelivery && !delivery.NextAttemptAt.After(now) {
+			due = append(due, delivery)
+		}
+	}
+
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].NextAttemptAt.Before(due[j].NextAttemptAt)
+	})
+
+	claimed := make([]common.WebhookDelivery, 0)
+
+	for _, delivery := range due {
+		if len(claimed) == limit {
+			break
+		}
+
+		delivery.NextAttemptAt = now.Add(lease)
+		claimed = append(claimed, *delivery)
+	}
+
+	return claimed, nil
+}
+
+// CompleteDelivery records a successful attempt of a delivery.
+func (imr *inMemoryUserRepository) CompleteDelivery(ctx context.Context, deliveryId string) error {
+	imr.mutex.Lock()
+	defer imr.mutex.Unlock()
+
+	delivery, ok := imr.deliveries[deliveryId]
+
+	if !ok {
+		return newErrNotFound("delivery not found")
+	}
+
+	delivery.Attempts++
+	delivery.Status = common.DeliveredDelivery
+	delivery.LastError = ""
+	delivery.UpdatedAt = time.Now()
+
+	return nil
+}
+
+// FailDelivery records a failed attempt of a delivery, scheduling the next attempt or dead lettering it.
+func (imr *inMemoryUserRepository) FailDelivery(ctx context.Context, deliveryId, lastError string,
+	nextAttemptAt time.Time, dead bool) error {
+	imr.mutex.Lock()
+	defer imr.mutex.Unlock()
+
+	delivery, ok := imr.deliveries[deliveryId]
+
+	if !ok {
+		return newErrNotFound("delivery not found")
+	}
+
+	delivery.Attempts++
+	delivery.LastError = lastError
+	delivery.NextAttemptAt = nextAttemptAt
+	delivery.UpdatedAt = time.Now()
+
+	if dead {
+		delivery.Status = common.DeadDelivery
+	}
+
+	return nil
+}
+
+// ListDeliveries retrieves the deliveries of a tenant with the given status, or any status when empty, newest first.
+func (imr *inMemoryUserRepository) ListDeliveries(ctx context.Context, tenantId string,
+	status common.DeliveryStatus) ([]common.WebhookDelivery, error) {
+	imr.mutex.RLock()
+	defer imr.mutex.RUnlock()
+
+	deliveries := make([]common.WebhookDelivery, 0)
+
+	for _, delivery := range imr.deliveries {
+		if delivery.TenantId == tenantId && (status == "" || delivery.Status == status) {
+			deliveries = append(deliveries, *delivery)
+		}
+	}
+
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].CreatedAt.After(deliveries[j].CreatedAt)
+	})
+
+	return deliveries, nil
+}
+
+// ReplayDelivery queues a delivery that isn't pending for immediate delivery with its attempts reset.
+func (imr *inMemoryUserRepository) ReplayDelivery(ctx context.Context, tenantId,
+	deliveryId string) (common.WebhookDelivery, error) {
+	imr.mutex.Lock()
+	defer imr.mutex.Unlock()
+
+	delivery, ok := imr.deliveries[deliveryId]
+
+	if !ok || delivery.TenantId != tenantId {
+		return common.WebhookDelivery{}, newErrNotFound("delivery not found")
+	} else if delivery.Status == common.PendingDelivery {
+		return common.WebhookDelivery{}, newErrConflict("delivery is already pending")
+	}
+
+	now := time.Now()
+	delivery.Status = common.PendingDelivery
+	delivery.Attempts = 0
+	delivery.LastError = ""
+	delivery.NextAttemptAt = now
+	delivery.UpdatedAt = now
+
+	return *delivery, nil
+}
+
+func copyWebhook(webhook *common.Webhook) common.Webhook {
+	copied := *webhook
+	copied.Events = append([]string{}, webhook.Events...)
+
+	return copied
+}
+
+func validateWebhook(tenantId, url, secret string, events []string) error {
+	if tenantId == "" {
+		return newErrRepository("tenant is required")
+	} else if url == "" {
+		return newErrRepository("url is required")
+	} else if secret == "" {
+		return newErrRepository("secret is required")
+	} else if len(events) == 0 {
+		return newErrRepository("at least one event is required")
+	}
+
+	return nil
+}
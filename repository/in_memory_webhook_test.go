@@ -0,0 +1,120 @@
+package repository_test
+
+import (
+	"context"
+	"github.com/stone1549/auth-service/common"
+	"github.com/stone1549/auth-service/repository"
+	"testing"
+	"time"
+)
+
+func makeNewImWebhookRepo(t *testing.T) repository.WebhookRepository {
+	repo, ok := makeNewImRepo(t).(repository.WebhookRepository)
+	assert(t, ok, "expected in memory repo to implement WebhookRepository")
+	return repo
+}
+
+// TestInMemoryWebhookRepository_Crud ensures webhooks can be created, listed and deleted within a tenant.
+func TestInMemoryWebhookRepository_Crud(t *testing.T) {
+	repo := makeNewImWebhookRepo(t)
+	ctx := context.Background()
+
+	crm, err := repo.NewWebhook(ctx, common.DefaultTenantId, "https://crm.example.com/hook", "s3cret",
+		[]string{"user.created"})
+	ok(t, err)
+	equals(t, "s3cret", crm.Secret)
+
+	_, err = repo.NewWebhook(ctx, "acme", "https://billing.example.com/hook", "s3cret", []string{"*"})
+	ok(t, err)
+
+	_, err = repo.NewWebhook(ctx, common.DefaultTenantId, "https://crm.example.com/hook", "s3cret", []string{})
+	notOk(t, err)
+
+	webhooks, err := repo.ListWebhooks(ctx, common.DefaultTenantId)
+	ok(t, err)
+	equals(t, 1, len(webhooks))
+	equals(t, crm.Id, webhooks[0].Id)
+
+	_, err = repo.GetWebhook(ctx, "acme", crm.Id)
+	assert(t, repository.IsNotFound(err), "expected webhook of another tenant not to be found")
+
+	ok(t, repo.DeleteWebhook(ctx, common.DefaultTenantId, crm.Id))
+	err = repo.DeleteWebhook(ctx, common.DefaultTenantId, crm.Id)
+	assert(t, repository.IsNotFound(err), "expected deleted webhook not to be found")
+}
+
+// TestInMemoryWebhookRepository_Queue ensures events are queued for subscribed webhooks only, claimed deliveries
+// are hidden until their lease expires, failures are rescheduled or dead lettered and dead deliveries can be
+// replayed.
+func TestInMemoryWebhookRepository_Queue(t *testing.T) {
+	repo := makeNewImWebhookRepo(t)
+	ctx := context.Background()
+
+	crm, err := repo.NewWebhook(ctx, common.DefaultTenantId, "https://crm.example.com/hook", "s3cret",
+		[]string{"user.created"})
+	ok(t, err)
+	_, err = repo.NewWebhook(ctx, common.DefaultTenantId, "https://billing.example.com/hook", "s3cret",
+		[]string{"user.deleted"})
+	ok(t, err)
+
+	deliveries, err := repo.EnqueueWebhookEvent(ctx, common.DefaultTenantId, "user.created", []byte(`{}`))
+	ok(t, err)
+	equals(t, 1, len(deliveries))
+	equals(t, crm.Id, deliveries[0].WebhookId)
+	equals(t, common.PendingDelivery, deliveries[0].Status)
+
+	now := time.Now().Add(time.Second)
+	claimed, err := repo.ClaimDueDeliveries(ctx, now, time.Minute, 10)
+	ok(t, err)
+	equals(t, 1, len(claimed))
+
+	claimed, err = repo.ClaimDueDeliveries(ctx, now, time.Minute, 10)
+	ok(t, err)
+	equals(t, 0, len(claimed))
+
+	id := deliveries[0].Id
+	ok(t, repo.FailDelivery(ctx, id, "connection refused", now, false))
+
+	claimed, err = repo.ClaimDueDeliveries(ctx, now, time.Minute, 10)
+	ok(t, err)
+	equals(t, 1, len(claimed))
+	equals(t, 1, claimed[0].Attempts)
+	equals(t, "connection refused", claimed[0].LastError)
+
+	_, err = repo.ReplayDelivery(ctx, common.DefaultTenantId, id)
+	assert(t, repository.IsConflict(err), "expected pending delivery not to be replayable")
+
+	ok(t, repo.FailDelivery(ctx, id, "503", now, true))
+
+	dead, err := repo.ListDeliveries(ctx, common.DefaultTenantId, common.DeadDelivery)
+	ok(t, err)
+	equals(t, 1, len(dead))
+	equals(t, 2, dead[0].Attempts)
+
+	claimed, err = repo.ClaimDueDeliveries(ctx, now.Add(time.Hour), time.Minute, 10)
+	ok(t, err)
+	equals(t, 0, len(claimed))
+
+	replayed, err := repo.ReplayDelivery(ctx, common.DefaultTenantId, id)
+	ok(t, err)
+	equals(t, common.PendingDelivery, replayed.Status)
+	equals(t, 0, replayed.Attempts)
+
+	_, err = repo.ReplayDelivery(ctx, "acme", id)
+	assert(t, repository.IsNotFound(err), "expected delivery of another tenant not to be found")
+
+	claimed, err = repo.ClaimDueDeliveries(ctx, time.Now().Add(time.Second), time.Minute, 10)
+	ok(t, err)
+	equals(t, 1, len(claimed))
+	ok(t, repo.CompleteDelivery(ctx, id))
+
+	delivered, err := repo.ListDeliveries(ctx, common.DefaultTenantId, common.DeliveredDelivery)
+	ok(t, err)
+	equals(t, 1, len(delivered))
+
+	ok(t, repo.DeleteWebhook(ctx, common.DefaultTenantId, crm.Id))
+
+	all, err := repo.ListDeliveries(ctx, common.DefaultTenantId, "")
+	ok(t, err)
+	equals(t, 0, len(all))
+}
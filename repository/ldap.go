@@ -0,0 +1,241 @@
+package repository
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"github.com/stone1549/auth-service/common"
+	"gopkg.in/ldap.v2"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const ldapTimeout = 10 * time.Second
+
+// localStore is a repository holding everything a directory doesn't, such as groups, tuples, webhooks, the outbox
+// and users administered locally.
+type localStore interface {
+	UserRepository
+	UserAdminRepository
+	GroupRepository
+	TupleRepository
+	WebhookRepository
+	OutboxRepository
+	SessionRepository
+	DeviceRepository
+}
+
+type directoryUser struct {
+	common.User
+	Id string
+	Dn string
+}
+
+type ldapUserRepository struct {
+	localStore
+	config common.LdapConfig
+}
+
+// NewUser adds a user to the local repository when signup is allowed, the directory itself is never written to.
+func (lr *ldapUserRepository) NewUser(ctx context.Context, tenantId, email, password string) (string, error) {
+	if !lr.config.AllowSignup {
+		return "", newErrRepository("users are managed by the directory")
+	}
+
+	_, found, err := lr.findUser(tenantId, email)
+
+	if err != nil {
+		return "", err
+	} else if found {
+		return "", newErrConflict("user already exists")
+	}
+
+	return lr.localStore.NewUser(ctx, tenantId, email, password)
+}
+
+// Authenticate searches the directory for the user's entry with the configured credentials, then binds as that
+// entry with the given password. Users missing from the directory, or of another tenant, are authenticated by the
+// local repository when signup is allowed.
+func (lr *ldapUserRepository) Authenticate(ctx context.Context, tenantId, email, password string) (string, error) {
+	// A simple bind with an empty password is an unauthenticated bind, which most directories accept.
+	if password == "" {
+		return "", newErrInvalidCredentials("invalid username/password combo")
+	}
+
+	user, found, err := lr.findUser(tenantId, email)
+
+	if err != nil {
+		return "", err
+	} else if !found && lr.config.AllowSignup {
+		return lr.localStore.Authenticate(ctx, tenantId, email, password)
+	} else if !found {
+		return "", newErrNotFound("user not found")
+	}
+
+	conn, err := lr.dial()
+
+	if err != nil {
+		return "", err
+	}
+
+	defer conn.Close()
+
+	err = conn.Bind(user.Dn, password)
+
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+		return "", newErrInvalidCredentials("invalid username/password combo")
+	} else if err != nil {
+		return "", newErrRepository(fmt.Sprintf("unable to bind to directory: %s", err.Error()))
+	}
+
+	return user.Id, nil
+}
+
+// findUser searches the directory for the single entry matching the user filter, users of tenants other than the
+// directory's are never found.
+func (lr *ldapUserRepository) findUser(tenantId, email string) (directoryUser, bool, error) {
+	if tenantId != lr.config.TenantId {
+		return directoryUser{}, false, nil
+	}
+
+	conn, err := lr.dial()
+
+	if err != nil {
+		return directoryUser{}, false, err
+	}
+
+	defer conn.Close()
+
+	if lr.config.BindDn != "" {
+		err = conn.Bind(lr.config.BindDn, lr.config.BindPassword)
+
+		if err != nil {
+			return directoryUser{}, false, newErrRepository(fmt.Sprintf("unable to bind to directory: %s",
+				err.Error()))
+		}
+	}
+
+	result, err := conn.Search(ldap.NewSearchRequest(lr.config.BaseDn, ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases, 2, int(ldapTimeout.Seconds()), false,
+		fmt.Sprintf(lr.config.UserFilter, escapeFilter(email)),
+		[]string{lr.config.IdAttribute, lr.config.EmailAttribute}, nil))
+
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return directoryUser{}, false, newErrRepository("user filter matches more than one entry")
+	} else if err != nil {
+		return directoryUser{}, false, newErrRepository(fmt.Sprintf("unable to search directory: %s",
+			err.Error()))
+	}
+
+	if len(result.Entries) == 0 {
+		return directoryUser{}, false, nil
+	} else if len(result.Entries) > 1 {
+		return directoryUser{}, false, newErrRepository("user filter matches more than one entry")
+	}
+
+	return lr.mapEntry(result.Entries[0]), true, nil
+}
+
+// mapEntry maps the attributes of a directory entry to a user.
+func (lr *ldapUserRepository) mapEntry(entry *ldap.Entry) directoryUser {
+	user := directoryUser{
+		User: common.User{Email: entry.GetAttributeValue(lr.config.EmailAttribute)},
+		Id:   entry.GetAttributeValue(lr.config.IdAttribute),
+		Dn:   entry.DN,
+	}
+
+	if user.Id == "" {
+		user.Id = entry.DN
+	}
+
+	return user
+}
+
+// Ping verifies both the local repository and the directory can be reached.
+func (lr *ldapUserRepository) Ping(ctx context.Context) error {
+	if err := ping(ctx, lr.localStore); err != nil {
+		return err
+	}
+
+	conn, err := lr.dial()
+
+	if err != nil {
+		return err
+	}
+
+	conn.Close()
+
+	return nil
+}
+
+// Close does nothing, directory connections aren't kept open between requests and the local repository is closed by
+// whoever constructed it.
+func (lr *ldapUserRepository) Close() error {
+	return nil
+}
+
+func (lr *ldapUserRepository) dial() (*ldap.Conn, error) {
+	target, err := url.Parse(lr.config.Url)
+
+	if err != nil {
+		return nil, newErrRepository(fmt.Sprintf("invalid directory url: %s", err.Error()))
+	}
+
+	host := target.Host
+	var conn *ldap.Conn
+
+	switch target.Scheme {
+	case "ldaps":
+		if target.Port() == "" {
+			host = net.JoinHostPort(target.Hostname(), "636")
+		}
+
+		conn, err = ldap.DialTLS("tcp", host, &tls.Config{ServerName: target.Hostname()})
+	case "ldap":
+		if target.Port() == "" {
+			host = net.JoinHostPort(target.Hostname(), "389")
+		}
+
+		conn, err = ldap.Dial("tcp", host)
+	default:
+		return nil, newErrRepository(fmt.Sprintf("unsupported directory url scheme %s", target.Scheme))
+	}
+
+	if err != nil {
+		return nil, newErrRepository(fmt.Sprintf("unable to connect to directory: %s", err.Error()))
+	}
+
+	conn.SetTimeout(ldapTimeout)
+
+	return conn, nil
+}
+
+// escapeFilter escapes the characters of a value that are special in search filters, see RFC 4515.
+func escapeFilter(value string) string {
+	var escaped strings.Builder
+
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; c {
+		case '\\', '*', '(', ')', 0:
+			escaped.WriteString(fmt.Sprintf("\\%02x", c))
+		default:
+			escaped.WriteByte(c)
+		}
+	}
+
+	return escaped.String()
+}
+
+// MakeLdapUserRepository constructs a repository that authenticates users against the configured directory and
+// keeps everything else in the given local repository, which it doesn't close.
+func MakeLdapUserRepository(config common.LdapConfig, local UserRepository) (UserRepository, error) {
+	store, ok := local.(localStore)
+
+	if !ok {
+		return nil, newErrRepository("local repository doesn't support every repository capability")
+	}
+
+	return &ldapUserRepository{localStore: store, config: config}, nil
+}
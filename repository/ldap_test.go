@@ -0,0 +1,289 @@
+package repository_test
+
+import (
+	"context"
+	"github.com/stone1549/auth-service/common"
+	"github.com/stone1549/auth-service/repository"
+	"gopkg.in/asn1-ber.v1"
+	"gopkg.in/ldap.v2"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const (
+	testServiceDn       = "cn=auth-service,ou=services,dc=example,dc=com"
+	testServicePassword = "service-secret"
+)
+
+type testEntry struct {
+	dn         string
+	password   string
+	attributes map[string][]string
+}
+
+// testDirectory is an in process LDAP server answering simple binds and searches for entries by mail, searches
+// are only answered for the service account.
+type testDirectory struct {
+	listener net.Listener
+	entries  []testEntry
+	mutex    sync.Mutex
+	binds    []string
+}
+
+func startTestDirectory(t *testing.T, entries ...testEntry) *testDirectory {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	ok(t, err)
+
+	directory := &testDirectory{listener: listener, entries: entries}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+
+			if err != nil {
+				return
+			}
+
+			go directory.serve(conn)
+		}
+	}()
+
+	return directory
+}
+
+func (td *testDirectory) url() string {
+	return "ldap://" + td.listener.Addr().String()
+}
+
+func (td *testDirectory) close() {
+	td.listener.Close()
+}
+
+func (td *testDirectory) boundDns() []string {
+	td.mutex.Lock()
+	defer td.mutex.Unlock()
+	return append([]string{}, td.binds...)
+}
+
+func (td *testDirectory) serve(conn net.Conn) {
+	defer conn.Close()
+	boundDn := ""
+
+	for {
+		packet, err := ber.ReadPacket(conn)
+
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+
+		messageId := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			dn := op.Children[1].Value.(string)
+			password := op.Children[2].Data.String()
+			code := uint8(ldap.LDAPResultInvalidCredentials)
+
+			if (dn == testServiceDn && password == testServicePassword) || td.checkPassword(dn, password) {
+				code = ldap.LDAPResultSuccess
+				boundDn = dn
+			}
+
+			td.mutex.Lock()
+			td.binds = append(td.binds, dn)
+			td.mutex.Unlock()
+
+			conn.Write(ldapResult(messageId, ldap.ApplicationBindResponse, code).Bytes())
+		case ldap.ApplicationSearchRequest:
+			if boundDn != testServiceDn {
+				conn.Write(ldapResult(messageId, ldap.ApplicationSearchResultDone,
+					ldap.LDAPResultInsufficientAccessRights).Bytes())
+				continue
+			}
+
+			filter, _ := ldap.DecompileFilter(op.Children[6])
+
+			for _, entry := range td.entries {
+				if strings.Contains(filter, "(mail="+entry.attributes["mail"][0]+")") {
+					conn.Write(ldapEntry(messageId, entry).Bytes())
+				}
+			}
+
+			conn.Write(ldapResult(messageId, ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess).Bytes())
+		default:
+			return
+		}
+	}
+}
+
+func (td *testDirectory) checkPassword(dn, password string) bool {
+	for _, entry := range td.entries {
+		if entry.dn == dn && entry.password == password {
+			return true
+		}
+	}
+
+	return false
+}
+
+func ldapMessage(messageId int64, op *ber.Packet) *ber.Packet {
+	envelope := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	envelope.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageId, "MessageID"))
+	envelope.AppendChild(op)
+	return envelope
+}
+
+func ldapResult(messageId int64, tag ber.Tag, code uint8) *ber.Packet {
+	result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Result")
+	result.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code),
+		"resultCode"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matchedDN"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "",
+		"diagnosticMessage"))
+	return ldapMessage(messageId, result)
+}
+
+func ldapEntry(messageId int64, entry testEntry) *ber.Packet {
+	result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Entry")
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.dn, "DN"))
+	attributes := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+
+	for name, values := range entry.attributes {
+		attribute := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+		attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+
+		for _, value := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "Value"))
+		}
+
+		attribute.AppendChild(set)
+		attributes.AppendChild(attribute)
+	}
+
+	result.AppendChild(attributes)
+	return ldapMessage(messageId, result)
+}
+
+var jane = testEntry{
+	dn:       "uid=jane,ou=people,dc=example,dc=com",
+	password: "directory-password",
+	attributes: map[string][]string{
+		"mail":      {"jane@example.com"},
+		"entryUUID": {"6c4f3d1e-0000-4000-8000-000000000001"},
+	},
+}
+
+var bob = testEntry{
+	dn:         "uid=bob,ou=people,dc=example,dc=com",
+	password:   "bobs-password",
+	attributes: map[string][]string{"mail": {"bob@example.com"}},
+}
+
+func makeLdapRepo(t *testing.T, directory *testDirectory, allowSignup bool) repository.UserRepository {
+	repo, err := repository.MakeLdapUserRepository(common.LdapConfig{
+		Url:            directory.url(),
+		BaseDn:         "dc=example,dc=com",
+		BindDn:         testServiceDn,
+		BindPassword:   testServicePassword,
+		UserFilter:     "(&(objectClass=person)(mail=%s))",
+		IdAttribute:    "entryUUID",
+		EmailAttribute: "mail",
+		AllowSignup:    allowSignup,
+		TenantId:       common.DefaultTenantId,
+	}, makeNewImRepo(t))
+	ok(t, err)
+	return repo
+}
+
+// TestLdapUserRepository_Authenticate ensures users are found with the service account and authenticated by
+// binding as their entry, identified by their id attribute or else their DN.
+func TestLdapUserRepository_Authenticate(t *testing.T) {
+	directory := startTestDirectory(t, jane, bob)
+	defer directory.close()
+	repo := makeLdapRepo(t, directory, false)
+	ctx := context.Background()
+
+	id, err := repo.Authenticate(ctx, common.DefaultTenantId, "jane@example.com", "directory-password")
+	ok(t, err)
+	equals(t, "6c4f3d1e-0000-4000-8000-000000000001", id)
+	equals(t, []string{testServiceDn, jane.dn}, directory.boundDns())
+
+	id, err = repo.Authenticate(ctx, common.DefaultTenantId, "bob@example.com", "bobs-password")
+	ok(t, err)
+	equals(t, bob.dn, id)
+
+	_, err = repo.Authenticate(ctx, common.DefaultTenantId, "jane@example.com", "wrong-password")
+	notOk(t, err)
+
+	_, err = repo.Authenticate(ctx, common.DefaultTenantId, "jane@example.com", "")
+	notOk(t, err)
+
+	_, err = repo.Authenticate(ctx, common.DefaultTenantId, "*", "directory-password")
+	notOk(t, err)
+
+	_, err = repo.Authenticate(ctx, common.DefaultTenantId, "nobody@example.com", "directory-password")
+	notOk(t, err)
+}
+
+// TestLdapUserRepository_OtherTenant ensures users of tenants other than the directory's are never looked up in it.
+func TestLdapUserRepository_OtherTenant(t *testing.T) {
+	directory := startTestDirectory(t, jane)
+	defer directory.close()
+	ctx := context.Background()
+
+	_, err := makeLdapRepo(t, directory, false).Authenticate(ctx, "other", "jane@example.com", "directory-password")
+	notOk(t, err)
+	equals(t, 0, len(directory.boundDns()))
+
+	repo := makeLdapRepo(t, directory, true)
+	_, err = repo.NewUser(ctx, "other", "jane@example.com", "local-password")
+	ok(t, err)
+
+	_, err = repo.Authenticate(ctx, "other", "jane@example.com", "directory-password")
+	notOk(t, err)
+
+	_, err = repo.Authenticate(ctx, "other", "jane@example.com", "local-password")
+	ok(t, err)
+	equals(t, 0, len(directory.boundDns()))
+}
+
+// TestLdapUserRepository_NewUser ensures new users are refused unless signup is allowed, in which case they're added
+// to the local repository and authenticated there.
+func TestLdapUserRepository_NewUser(t *testing.T) {
+	directory := startTestDirectory(t, jane)
+	defer directory.close()
+	ctx := context.Background()
+
+	_, err := makeLdapRepo(t, directory, false).NewUser(ctx, common.DefaultTenantId, "new@example.com", "password")
+	notOk(t, err)
+
+	repo := makeLdapRepo(t, directory, true)
+
+	_, err = repo.NewUser(ctx, common.DefaultTenantId, "jane@example.com", "password")
+	assert(t, repository.IsConflict(err), "expected directory user to conflict, got %v", err)
+
+	id, err := repo.NewUser(ctx, common.DefaultTenantId, "new@example.com", "password")
+	ok(t, err)
+
+	authenticatedId, err := repo.Authenticate(ctx, common.DefaultTenantId, "new@example.com", "password")
+	ok(t, err)
+	equals(t, id, authenticatedId)
+
+	_, isGroupRepo := repo.(repository.GroupRepository)
+	assert(t, isGroupRepo, "expected ldap repo to keep groups in the local repository")
+}
+
+// TestLdapUserRepository_Unavailable ensures authentication fails when the directory can't be reached.
+func TestLdapUserRepository_Unavailable(t *testing.T) {
+	directory := startTestDirectory(t, jane)
+	repo := makeLdapRepo(t, directory, false)
+	directory.close()
+
+	_, err := repo.Authenticate(context.Background(), common.DefaultTenantId, "jane@example.com",
+		"directory-password")
+	notOk(t, err)
+}
@@ -4,16 +4,15 @@ import (
 	"context"
 	"database/sql"
 	_ "github.com/lib/pq"
-	"github.com/pkg/errors"
 	"github.com/stone1549/auth-service/common"
 	"github.com/twinj/uuid"
-	"golang.org/x/crypto/bcrypt"
 )
 
 const (
-	insertLogin       = "INSERT INTO login (id, email, salted_hash) VALUES ($1, $2, $3)"
-	authenticate      = "SELECT salted_hash, id FROM login WHERE email=$1"
-	insertStoredLogin = "INSERT INTO login (id, email, salted_hash, created_at, updated_at) VALUES ($1, $2, $3, $4, $5)"
+	insertLogin       = "INSERT INTO login (id, tenant_id, email, salted_hash) VALUES ($1, $2, $3, $4)"
+	authenticate      = "SELECT salted_hash, id, active FROM login WHERE tenant_id=$1 AND email=$2"
+	insertStoredLogin = "INSERT INTO login (id, tenant_id, email, salted_hash, created_at, updated_at) " +
+		"VALUES ($1, $2, $3, $4, $5, $6)"
 )
 
 type postgresqlUserRepository struct {
@@ -21,26 +20,54 @@ type postgresqlUserRepository struct {
 }
 
 // NewUser adds a user to the repo.
-func (impr *postgresqlUserRepository) NewUser(ctx context.Context, email string, password string) (string, error) {
+func (impr *postgresqlUserRepository) NewUser(ctx context.Context, tenantId, email, password string) (string,
+	error) {
+	if tenantId == "" {
+		return "", newErrRepository("tenant is required")
+	}
+
 	if email == "" {
 		return "", newErrRepository("email is required")
 	}
 
 	id := uuid.NewV4().String()
 
-	saltedHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	saltedHash, err := hashPassword(ctx, password)
 
 	if err != nil {
 		return "", newErrRepository("unable to generate password")
 	}
 
-	_, err = impr.db.ExecContext(ctx, insertLogin, id, email, saltedHash)
+	txn, err := impr.db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return "", err
+	}
+
+	_, err = txn.ExecContext(ctx, insertLogin, id, tenantId, email, saltedHash)
+
+	if err != nil {
+		txn.Rollback()
+		return "", err
+	}
+
+	err = insertUserEvent(ctx, txn, tenantId, id, email, common.UserCreatedEvent)
+
+	if err != nil {
+		txn.Rollback()
+		return "", err
+	}
 
-	return id, err
+	return id, txn.Commit()
 }
 
 // Authenticate compares a given email and password combination against the salted hash in the repo.
-func (impr *postgresqlUserRepository) Authenticate(ctx context.Context, email string, password string) (string, error) {
+func (impr *postgresqlUserRepository) Authenticate(ctx context.Context, tenantId, email, password string) (string,
+	error) {
+	if tenantId == "" {
+		return "", newErrRepository("tenant is required")
+	}
+
 	if email == "" {
 		return "", newErrRepository("email is required")
 	}
@@ -49,29 +76,42 @@ func (impr *postgresqlUserRepository) Authenticate(ctx context.Context, email st
 		return "", newErrRepository("password is required")
 	}
 
-	row := impr.db.QueryRowContext(ctx, authenticate, email)
+	row := impr.db.QueryRowContext(ctx, authenticate, tenantId, email)
 	var saltedHash string
 	var id string
+	var active bool
 
-	err := row.Scan(&saltedHash, &id)
+	err := row.Scan(&saltedHash, &id, &active)
 
 	if err == sql.ErrNoRows {
-		return "", newErrRepository("user not found")
-	} else {
+		return "", newErrNotFound("user not found")
+	} else if err != nil {
 		return "", err
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(saltedHash), []byte(password))
+	err = comparePassword(ctx, saltedHash, password)
 
 	if err != nil {
-		return "", errors.New("invalid username/password combo")
+		return "", newErrInvalidCredentials("invalid username/password combo")
+	} else if !active {
+		return "", newErrRepository("user is disabled")
 	}
 
 	return id, nil
 }
 
+// Ping verifies the database can be reached.
+func (impr *postgresqlUserRepository) Ping(ctx context.Context) error {
+	return impr.db.PingContext(ctx)
+}
+
+// Close closes the database's connections.
+func (impr *postgresqlUserRepository) Close() error {
+	return impr.db.Close()
+}
+
 func loadInitPostgresqlData(db *sql.DB, dataset string) error {
-	users, err := loadInitInMemoryDataset(dataset)
+	usersByTenant, err := loadInitInMemoryDataset(dataset)
 
 	if err != nil {
 		return err
@@ -83,11 +123,15 @@ func loadInitPostgresqlData(db *sql.DB, dataset string) error {
 		return err
 	}
 
-	for id, user := range users {
-		_, err = txn.Exec(insertStoredLogin, id, user.Email, user.SaltedHash, user.CreatedAt, user.UpdatedAt)
+	for _, users := range usersByTenant {
+		for _, user := range users {
+			_, err = txn.Exec(insertStoredLogin, user.Id, user.TenantId, user.Email, user.SaltedHash, user.CreatedAt,
+				user.UpdatedAt)
 
-		if err != nil {
-			return err
+			if err != nil {
+				txn.Rollback()
+				return err
+			}
 		}
 	}
 
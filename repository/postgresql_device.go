@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"github.com/stone1549/auth-service/common"
+)
+
+const (
+	deviceColumns = "tenant_id, user_id, fingerprint, label, network, first_seen_at, last_seen_at"
+	selectDevices = "SELECT " + deviceColumns + " FROM login_device WHERE tenant_id=$1 AND user_id=$2 " +
+		"ORDER BY last_seen_at DESC"
+	upsertDevice = "INSERT INTO login_device (tenant_id, user_id, fingerprint, label, network) " +
+		"VALUES ($1, $2, $3, $4, $5) ON CONFLICT (tenant_id, user_id, fingerprint) DO UPDATE SET " +
+		"label=EXCLUDED.label, network=EXCLUDED.network, last_seen_at=(NOW() AT TIME ZONE 'UTC') " +
+		"RETURNING " + deviceColumns
+)
+
+// ListDevices retrieves the devices a user has logged in from, most recently seen first.
+func (impr *postgresqlUserRepository) ListDevices(ctx context.Context, tenantId, userId string) ([]common.Device,
+	error) {
+	rows, err := impr.db.QueryContext(ctx, selectDevices, tenantId, userId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	devices := make([]common.Device, 0)
+
+	for rows.Next() {
+		device, err := scanDevice(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		devices = append(devices, device)
+	}
+
+	return devices, rows.Err()
+}
+
+// SaveDevice remembers a device of the device's user, or records that a known one was seen again.
+func (impr *postgresqlUserRepository) SaveDevice(ctx context.Context, device common.Device) (common.Device,
+	error) {
+	err := validateDevice(device)
+
+	if err != nil {
+		return common.Device{}, err
+	}
+
+	return scanDevice(impr.db.QueryRowContext(ctx, upsertDevice, device.TenantId, device.UserId, device.Fingerprint,
+		device.Label, device.Network))
+}
+
+func scanDevice(row rowScanner) (common.Device, error) {
+	device := common.Device{}
+	err := row.Scan(&device.TenantId, &device.UserId, &device.Fingerprint, &device.Label, &device.Network,
+		&device.FirstSeenAt, &device.LastSeenAt)
+
+	if err != nil {
+		return common.Device{}, err
+	}
+
+	return device, nil
+}
@@ -0,0 +1,297 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"github.com/lib/pq"
+	"github.com/stone1549/auth-service/common"
+	"github.com/twinj/uuid"
+	"strings"
+)
+
+const (
+	groupColumns = "id, tenant_id, name, description, created_at, updated_at"
+	insertGroup  = "INSERT INTO login_group (id, tenant_id, name, description) VALUES ($1, $2, $3, $4) " +
+		"RETURNING " + groupColumns
+	selectGroup  = "SELECT " + groupColumns + " FROM login_group WHERE tenant_id=$1 AND id=$2"
+	selectGroups = "SELECT " + groupColumns + " FROM login_group WHERE tenant_id=$1 ORDER BY name"
+	updateGroup  = "UPDATE login_group SET name=$3, description=$4 WHERE tenant_id=$1 AND id=$2 " +
+		"RETURNING " + groupColumns
+	deleteGroup      = "DELETE FROM login_group WHERE tenant_id=$1 AND id=$2"
+	selectGroupUsers = "SELECT login_id FROM login_group_user WHERE group_id=$1 ORDER BY login_id"
+	selectSubgroups  = "SELECT member_group_id FROM login_group_group WHERE group_id=$1 ORDER BY member_group_id"
+	insertGroupUser  = "INSERT INTO login_group_user (group_id, login_id) SELECT $2, id FROM login " +
+		"WHERE tenant_id=$1 AND id=$3 ON CONFLICT DO NOTHING"
+	selectLoginExists  = "SELECT EXISTS (SELECT 1 FROM login WHERE tenant_id=$1 AND id=$2)"
+	deleteGroupUser    = "DELETE FROM login_group_user WHERE group_id=$1 AND login_id=$2"
+	insertSubgroup     = "INSERT INTO login_group_group (group_id, member_group_id) VALUES ($1, $2) ON CONFLICT DO NOTHING"
+	deleteSubgroup     = "DELETE FROM login_group_group WHERE group_id=$1 AND member_group_id=$2"
+	lockGroupHierarchy = "LOCK TABLE login_group_group IN SHARE ROW EXCLUSIVE MODE"
+	selectIsDescendant = "WITH RECURSIVE descendant(id) AS (" +
+		"SELECT member_group_id FROM login_group_group WHERE group_id=$1 " +
+		"UNION SELECT gg.member_group_id FROM login_group_group gg JOIN descendant d ON gg.group_id=d.id" +
+		") SELECT EXISTS (SELECT 1 FROM descendant WHERE id=$2)"
+	selectUserGroups = "WITH RECURSIVE member_of(id) AS (" +
+		"SELECT group_id FROM login_group_user WHERE login_id=$2 " +
+		"UNION SELECT gg.group_id FROM login_group_group gg JOIN member_of m ON gg.member_group_id=m.id" +
+		") SELECT g.id, g.tenant_id, g.name, g.description, g.created_at, g.updated_at FROM login_group g " +
+		"JOIN member_of m ON g.id=m.id WHERE g.tenant_id=$1 ORDER BY g.name"
+)
+
+const pgUniqueViolation = "23505"
+
+// NewGroup adds a group to the given tenant.
+func (impr *postgresqlUserRepository) NewGroup(ctx context.Context, tenantId, name, description string) (common.Group,
+	error) {
+	if tenantId == "" {
+		return common.Group{}, newErrRepository("tenant is required")
+	} else if strings.TrimSpace(name) == "" {
+		return common.Group{}, newErrRepository("name is required")
+	}
+
+	row := impr.db.QueryRowContext(ctx, insertGroup, uuid.NewV4().String(), tenantId, name, description)
+
+	return scanGroup(row)
+}
+
+// GetGroup retrieves a group by id.
+func (impr *postgresqlUserRepository) GetGroup(ctx context.Context, tenantId, groupId string) (common.Group, error) {
+	return scanGroup(impr.db.QueryRowContext(ctx, selectGroup, tenantId, groupId))
+}
+
+// ListGroups retrieves all groups of the given tenant ordered by name.
+func (impr *postgresqlUserRepository) ListGroups(ctx context.Context, tenantId string) ([]common.Group, error) {
+	return queryGroups(ctx, impr.db, selectGroups, tenantId)
+}
+
+// UpdateGroup changes the name and description of a group.
+func (impr *postgresqlUserRepository) UpdateGroup(ctx context.Context, tenantId, groupId, name,
+	description string) (common.Group, error) {
+	if strings.TrimSpace(name) == "" {
+		return common.Group{}, newErrRepository("name is required")
+	}
+
+	return scanGroup(impr.db.QueryRowContext(ctx, updateGroup, tenantId, groupId, name, description))
+}
+
+// DeleteGroup removes a group and all memberships it takes part in.
+func (impr *postgresqlUserRepository) DeleteGroup(ctx context.Context, tenantId, groupId string) error {
+	result, err := impr.db.ExecContext(ctx, deleteGroup, tenantId, groupId)
+
+	return expectAffected(result, err, "group not found")
+}
+
+// GetGroupMembers retrieves the direct members of a group.
+func (impr *postgresqlUserRepository) GetGroupMembers(ctx context.Context, tenantId,
+	groupId string) (common.GroupMembers, error) {
+	_, err := impr.GetGroup(ctx, tenantId, groupId)
+
+	if err != nil {
+		return common.GroupMembers{}, err
+	}
+
+	members := common.GroupMembers{}
+	members.UserIds, err = queryStrings(ctx, impr.db, selectGroupUsers, groupId)
+
+	if err != nil {
+		return common.GroupMembers{}, err
+	}
+
+	members.GroupIds, err = queryStrings(ctx, impr.db, selectSubgroups, groupId)
+
+	if err != nil {
+		return common.GroupMembers{}, err
+	}
+
+	return members, nil
+}
+
+// AddGroupUser makes a user a direct member of a group.
+func (impr *postgresqlUserRepository) AddGroupUser(ctx context.Context, tenantId, groupId, userId string) error {
+	_, err := impr.GetGroup(ctx, tenantId, groupId)
+
+	if err != nil {
+		return err
+	}
+
+	var exists bool
+	err = impr.db.QueryRowContext(ctx, selectLoginExists, tenantId, userId).Scan(&exists)
+
+	if err != nil {
+		return err
+	} else if !exists {
+		return newErrNotFound("user not found")
+	}
+
+	_, err = impr.db.ExecContext(ctx, insertGroupUser, tenantId, groupId, userId)
+
+	return err
+}
+
+// RemoveGroupUser removes a user from the direct members of a group.
+func (impr *postgresqlUserRepository) RemoveGroupUser(ctx context.Context, tenantId, groupId, userId string) error {
+	_, err := impr.GetGroup(ctx, tenantId, groupId)
+
+	if err != nil {
+		return err
+	}
+
+	result, err := impr.db.ExecContext(ctx, deleteGroupUser, groupId, userId)
+
+	return expectAffected(result, err, "user is not a member of group")
+}
+
+// AddSubgroup makes a group a direct member of another group, fails if this would create a cycle.
+func (impr *postgresqlUserRepository) AddSubgroup(ctx context.Context, tenantId, groupId, memberGroupId string) error {
+	if groupId == memberGroupId {
+		return newErrConflict("group membership would create a cycle")
+	}
+
+	_, err := impr.GetGroup(ctx, tenantId, groupId)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = impr.GetGroup(ctx, tenantId, memberGroupId)
+
+	if err != nil {
+		return err
+	}
+
+	txn, err := impr.db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	// Serialize hierarchy changes so concurrent additions can't together form a cycle.
+	_, err = txn.ExecContext(ctx, lockGroupHierarchy)
+
+	if err != nil {
+		txn.Rollback()
+		return err
+	}
+
+	var cycle bool
+	err = txn.QueryRowContext(ctx, selectIsDescendant, memberGroupId, groupId).Scan(&cycle)
+
+	if err != nil {
+		txn.Rollback()
+		return err
+	} else if cycle {
+		txn.Rollback()
+		return newErrConflict("group membership would create a cycle")
+	}
+
+	_, err = txn.ExecContext(ctx, insertSubgroup, groupId, memberGroupId)
+
+	if err != nil {
+		txn.Rollback()
+		return err
+	}
+
+	return txn.Commit()
+}
+
+// RemoveSubgroup removes a group from the direct members of another group.
+func (impr *postgresqlUserRepository) RemoveSubgroup(ctx context.Context, tenantId, groupId,
+	memberGroupId string) error {
+	_, err := impr.GetGroup(ctx, tenantId, groupId)
+
+	if err != nil {
+		return err
+	}
+
+	result, err := impr.db.ExecContext(ctx, deleteSubgroup, groupId, memberGroupId)
+
+	return expectAffected(result, err, "group is not a member of group")
+}
+
+// GetUserGroups retrieves every group a user is a member of, directly or through nested groups, ordered by name.
+func (impr *postgresqlUserRepository) GetUserGroups(ctx context.Context, tenantId, userId string) ([]common.Group,
+	error) {
+	return queryGroups(ctx, impr.db, selectUserGroups, tenantId, userId)
+}
+
+func scanGroup(row *sql.Row) (common.Group, error) {
+	group := common.Group{}
+	err := row.Scan(&group.Id, &group.TenantId, &group.Name, &group.Description, &group.CreatedAt, &group.UpdatedAt)
+
+	if err == sql.ErrNoRows {
+		return common.Group{}, newErrNotFound("group not found")
+	} else if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == pgUniqueViolation {
+		return common.Group{}, newErrConflict("group already exists")
+	} else if err != nil {
+		return common.Group{}, err
+	}
+
+	return group, nil
+}
+
+func queryGroups(ctx context.Context, db *sql.DB, query string, args ...interface{}) ([]common.Group, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	groups := make([]common.Group, 0)
+
+	for rows.Next() {
+		group := common.Group{}
+		err = rows.Scan(&group.Id, &group.TenantId, &group.Name, &group.Description, &group.CreatedAt,
+			&group.UpdatedAt)
+
+		if err != nil {
+			return nil, err
+		}
+
+		groups = append(groups, group)
+	}
+
+	return groups, rows.Err()
+}
+
+func queryStrings(ctx context.Context, db *sql.DB, query string, args ...interface{}) ([]string, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	values := make([]string, 0)
+
+	for rows.Next() {
+		var value string
+		err = rows.Scan(&value)
+
+		if err != nil {
+			return nil, err
+		}
+
+		values = append(values, value)
+	}
+
+	return values, rows.Err()
+}
+
+func expectAffected(result sql.Result, err error, notFoundMsg string) error {
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	} else if affected == 0 {
+		return newErrNotFound(notFoundMsg)
+	}
+
+	return nil
+}
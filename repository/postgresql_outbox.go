@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/stone1549/auth-service/common"
+	"github.com/twinj/uuid"
+	"time"
+)
+
+const (
+	outboxColumns     = "id, tenant_id, aggregate_id, event_type, payload, attempts, created_at"
+	insertOutboxEvent = "INSERT INTO outbox (id, tenant_id, aggregate_id, event_type, payload) " +
+		"VALUES ($1, $2, $3, $4, $5)"
+	claimOutbox = "UPDATE outbox SET next_attempt_at=$2 WHERE id IN (" +
+		"SELECT id FROM outbox WHERE published_at IS NULL AND dead_at IS NULL AND next_attempt_at<=$1 " +
+		"ORDER BY created_at LIMIT $3 FOR UPDATE SKIP LOCKED) RETURNING " + outboxColumns
+	markPublished     = "UPDATE outbox SET published_at=NOW() AT TIME ZONE 'UTC', attempts=attempts+1 WHERE id=$1"
+	markPublishFailed = "UPDATE outbox SET attempts=attempts+1, last_error=$2, next_attempt_at=$3, " +
+		"dead_at=CASE WHEN $4 THEN NOW() AT TIME ZONE 'UTC' END WHERE id=$1"
+)
+
+// insertUserEvent records an event about a user in the outbox as part of txn.
+func insertUserEvent(ctx context.Context, txn *sql.Tx, tenantId, userId, email, eventType string) error {
+	payload, err := json.Marshal(userEventPayload(userId, email))
+
+	if err != nil {
+		return err
+	}
+
+	_, err = txn.ExecContext(ctx, insertOutboxEvent, uuid.NewV4().String(), tenantId, userId, eventType,
+		string(payload))
+
+	return err
+}
+
+// ClaimOutbox retrieves unpublished events due by now that aren't dead, oldest first, hiding them from other claims
+// for lease. Rows locked by another claim are skipped so several relays can publish from the same outbox.
+func (impr *postgresqlUserRepository) ClaimOutbox(ctx context.Context, now time.Time, lease time.Duration,
+	limit int) ([]common.OutboxEvent, error) {
+	rows, err := impr.db.QueryContext(ctx, claimOutbox, now, now.Add(lease), limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	events := make([]common.OutboxEvent, 0)
+
+	for rows.Next() {
+		event := common.OutboxEvent{}
+		var payload []byte
+
+		err = rows.Scan(&event.Id, &event.TenantId, &event.AggregateId, &event.Type, &payload, &event.Attempts,
+			&event.CreatedAt)
+
+		if err != nil {
+			return nil, err
+		}
+
+		event.Payload = payload
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+// MarkPublished records that an event was published.
+func (impr *postgresqlUserRepository) MarkPublished(ctx context.Context, eventId string) error {
+	result, err := impr.db.ExecContext(ctx, markPublished, eventId)
+
+	return expectAffected(result, err, "event not found")
+}
+
+// MarkPublishFailed records a failed attempt to publish an event, scheduling the next attempt or marking it dead.
+func (impr *postgresqlUserRepository) MarkPublishFailed(ctx context.Context, eventId, lastError string,
+	nextAttemptAt time.Time, dead bool) error {
+	result, err := impr.db.ExecContext(ctx, markPublishFailed, eventId, lastError, nextAttemptAt, dead)
+
+	return expectAffected(result, err, "event not found")
+}
@@ -0,0 +1,129 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"github.com/lib/pq"
+	"github.com/stone1549/auth-service/common"
+	"github.com/twinj/uuid"
+	"time"
+)
+
+const (
+	sessionColumns = "id, tenant_id, user_id, remote_addr, user_agent, device_label, remember_me, created_at, " +
+		"last_seen_at, idle_timeout_seconds, expires_at"
+	insertSession = "INSERT INTO login_session (id, tenant_id, user_id, remote_addr, user_agent, device_label, " +
+		"remember_me, idle_timeout_seconds, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING " +
+		sessionColumns
+	selectSession  = "SELECT " + sessionColumns + " FROM login_session WHERE tenant_id=$1 AND id=$2"
+	selectSessions = "SELECT " + sessionColumns + " FROM login_session WHERE tenant_id=$1 AND user_id=$2 " +
+		"ORDER BY last_seen_at DESC"
+	touchSession          = "UPDATE login_session SET last_seen_at=GREATEST(last_seen_at, $3) WHERE tenant_id=$1 AND id=$2"
+	deleteSession         = "DELETE FROM login_session WHERE tenant_id=$1 AND user_id=$2 AND id=$3"
+	deleteExpiredSessions = "DELETE FROM login_session WHERE expires_at<=$1 OR (idle_timeout_seconds>0 AND " +
+		"last_seen_at+idle_timeout_seconds*INTERVAL '1 second'<=$1)"
+)
+
+// NewSession records a session of the session's user, expiring after its idle timeout or at its expiry.
+func (impr *postgresqlUserRepository) NewSession(ctx context.Context, session common.Session) (common.Session,
+	error) {
+	err := validateSession(session)
+
+	if err != nil {
+		return common.Session{}, err
+	}
+
+	row := impr.db.QueryRowContext(ctx, insertSession, uuid.NewV4().String(), session.TenantId, session.UserId,
+		nullString(session.RemoteAddr), nullString(session.UserAgent), nullString(session.DeviceLabel),
+		session.RememberMe, int64(session.IdleTimeout/time.Second), nullTime(session.ExpiresAt))
+
+	return scanSession(row, "session not found")
+}
+
+// GetSession retrieves a session by id.
+func (impr *postgresqlUserRepository) GetSession(ctx context.Context, tenantId, sessionId string) (common.Session,
+	error) {
+	return scanSession(impr.db.QueryRowContext(ctx, selectSession, tenantId, sessionId), "session not found")
+}
+
+// ListSessions retrieves a user's sessions, most recently seen first.
+func (impr *postgresqlUserRepository) ListSessions(ctx context.Context, tenantId, userId string) ([]common.Session,
+	error) {
+	rows, err := impr.db.QueryContext(ctx, selectSessions, tenantId, userId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	sessions := make([]common.Session, 0)
+
+	for rows.Next() {
+		session, err := scanSession(rows, "")
+
+		if err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// TouchSession records that a session was seen at the given time.
+func (impr *postgresqlUserRepository) TouchSession(ctx context.Context, tenantId, sessionId string,
+	seenAt time.Time) error {
+	result, err := impr.db.ExecContext(ctx, touchSession, tenantId, sessionId, seenAt.UTC())
+
+	return expectAffected(result, err, "session not found")
+}
+
+// DeleteSession revokes one of a user's sessions.
+func (impr *postgresqlUserRepository) DeleteSession(ctx context.Context, tenantId, userId, sessionId string) error {
+	result, err := impr.db.ExecContext(ctx, deleteSession, tenantId, userId, sessionId)
+
+	return expectAffected(result, err, "session not found")
+}
+
+// DeleteExpiredSessions removes every session of any tenant expired by now, returning how many were removed.
+func (impr *postgresqlUserRepository) DeleteExpiredSessions(ctx context.Context, now time.Time) (int, error) {
+	result, err := impr.db.ExecContext(ctx, deleteExpiredSessions, now.UTC())
+
+	if err != nil {
+		return 0, err
+	}
+
+	deleted, err := result.RowsAffected()
+
+	return int(deleted), err
+}
+
+func nullTime(value time.Time) pq.NullTime {
+	return pq.NullTime{Time: value.UTC(), Valid: !value.IsZero()}
+}
+
+func scanSession(row rowScanner, notFoundMsg string) (common.Session, error) {
+	session := common.Session{}
+	var remoteAddr, userAgent, deviceLabel sql.NullString
+	var idleTimeout int64
+	var expiresAt pq.NullTime
+
+	err := row.Scan(&session.Id, &session.TenantId, &session.UserId, &remoteAddr, &userAgent, &deviceLabel,
+		&session.RememberMe, &session.CreatedAt, &session.LastSeenAt, &idleTimeout, &expiresAt)
+
+	if err == sql.ErrNoRows {
+		return common.Session{}, newErrNotFound(notFoundMsg)
+	} else if err != nil {
+		return common.Session{}, err
+	}
+
+	session.RemoteAddr = remoteAddr.String
+	session.UserAgent = userAgent.String
+	session.DeviceLabel = deviceLabel.String
+	session.IdleTimeout = time.Duration(idleTimeout) * time.Second
+	session.ExpiresAt = expiresAt.Time
+
+	return session, nil
+}
@@ -1,6 +1,7 @@
 package repository_test
 
 import (
+	"context"
 	"database/sql"
 	"github.com/stone1549/auth-service/repository"
 	"gopkg.in/DATA-DOG/go-sqlmock.v2"
@@ -119,3 +120,94 @@ func addExpectedUserId5Row(rows *sqlmock.Rows) *sqlmock.Rows {
 		updatedAt,
 	)
 }
+
+// TestPostgresqlGroupRepository_Cycle ensures a subgroup is rejected when the parent is already one of its
+// descendants.
+func TestPostgresqlGroupRepository_Cycle(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	ok(t, err)
+	defer db.Close()
+
+	repo, err := repository.MakePostgresqlUserRespository(pgEmpty, db)
+	ok(t, err)
+	groupRepo := repo.(repository.GroupRepository)
+
+	groupColumns := []string{"id", "tenant_id", "name", "description", "created_at", "updated_at"}
+	now := time.Now()
+	mock.ExpectQuery("SELECT (.+) FROM login_group").WithArgs("default", "c").
+		WillReturnRows(sqlmock.NewRows(groupColumns).AddRow("c", "default", "c", "", now, now))
+	mock.ExpectQuery("SELECT (.+) FROM login_group").WithArgs("default", "a").
+		WillReturnRows(sqlmock.NewRows(groupColumns).AddRow("a", "default", "a", "", now, now))
+	mock.ExpectBegin()
+	mock.ExpectExec("LOCK TABLE login_group_group").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("WITH RECURSIVE descendant").WithArgs("a", "c").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectRollback()
+
+	err = groupRepo.AddSubgroup(context.Background(), "default", "c", "a")
+	assert(t, repository.IsConflict(err), "expected cycle to be rejected, got %v", err)
+	ok(t, mock.ExpectationsWereMet())
+}
+
+// TestPostgresqlUserRepository_NewUserOutbox ensures a new user and its user.created outbox event are written in the
+// same transaction, and neither is kept when the event can't be written.
+func TestPostgresqlUserRepository_NewUserOutbox(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	ok(t, err)
+	defer db.Close()
+
+	repo, err := repository.MakePostgresqlUserRespository(pgEmpty, db)
+	ok(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO login").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO outbox").
+		WithArgs(sqlmock.AnyArg(), "default", sqlmock.AnyArg(), "user.created", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	id, err := repo.NewUser(context.Background(), "default", "jane@example.com", "password")
+	ok(t, err)
+	assert(t, id != "", "expected new user id")
+	ok(t, mock.ExpectationsWereMet())
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO login").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO outbox").WillReturnError(sql.ErrConnDone)
+	mock.ExpectRollback()
+
+	_, err = repo.NewUser(context.Background(), "default", "john@example.com", "password")
+	notOk(t, err)
+	ok(t, mock.ExpectationsWereMet())
+}
+
+// TestPostgresqlUserRepository_DeleteUserOutbox ensures a deleted user's user.deleted outbox event is written in the
+// same transaction, and unknown users aren't deleted.
+func TestPostgresqlUserRepository_DeleteUserOutbox(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	ok(t, err)
+	defer db.Close()
+
+	repo, err := repository.MakePostgresqlUserRespository(pgEmpty, db)
+	ok(t, err)
+	adminRepo := repo.(repository.UserAdminRepository)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("DELETE FROM login").WithArgs("default", "1").
+		WillReturnRows(sqlmock.NewRows([]string{"email"}).AddRow("jane@example.com"))
+	mock.ExpectExec("INSERT INTO outbox").
+		WithArgs(sqlmock.AnyArg(), "default", "1", "user.deleted", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	ok(t, adminRepo.DeleteUser(context.Background(), "default", "1"))
+	ok(t, mock.ExpectationsWereMet())
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("DELETE FROM login").WithArgs("default", "2").WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	err = adminRepo.DeleteUser(context.Background(), "default", "2")
+	assert(t, repository.IsNotFound(err), "expected unknown user to be not found, got %v", err)
+	ok(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"github.com/stone1549/auth-service/common"
+)
+
+const (
+	insertTuple = "INSERT INTO relation_tuple (tenant_id, object, relation, subject) VALUES ($1, $2, $3, $4) " +
+		"ON CONFLICT DO NOTHING"
+	deleteTuple  = "DELETE FROM relation_tuple WHERE tenant_id=$1 AND object=$2 AND relation=$3 AND subject=$4"
+	selectTuples = "SELECT subject FROM relation_tuple WHERE tenant_id=$1 AND object=$2 AND relation=$3 " +
+		"ORDER BY subject"
+)
+
+// WriteTuples atomically adds and removes the given tuples within a tenant.
+func (impr *postgresqlUserRepository) WriteTuples(ctx context.Context, tenantId string, writes []common.Tuple,
+	deletes []common.Tuple) error {
+	if tenantId == "" {
+		return newErrRepository("tenant is required")
+	}
+
+	err := validateTuples(writes, deletes)
+
+	if err != nil {
+		return err
+	}
+
+	txn, err := impr.db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	for _, tuple := range deletes {
+		_, err = txn.ExecContext(ctx, deleteTuple, tenantId, tuple.Object, tuple.Relation, tuple.Subject)
+
+		if err != nil {
+			txn.Rollback()
+			return err
+		}
+	}
+
+	for _, tuple := range writes {
+		_, err = txn.ExecContext(ctx, insertTuple, tenantId, tuple.Object, tuple.Relation, tuple.Subject)
+
+		if err != nil {
+			txn.Rollback()
+			return err
+		}
+	}
+
+	return txn.Commit()
+}
+
+// ReadTuples retrieves every tuple of a tenant with the given object and relation ordered by subject.
+func (impr *postgresqlUserRepository) ReadTuples(ctx context.Context, tenantId, object,
+	relation string) ([]common.Tuple, error) {
+	subjects, err := queryStrings(ctx, impr.db, selectTuples, tenantId, object, relation)
+
+	if err != nil {
+		return nil, err
+	}
+
+	tuples := make([]common.Tuple, 0, len(subjects))
+
+	for _, subject := range subjects {
+		tuples = append(tuples, common.Tuple{Object: object, Relation: relation, Subject: subject})
+	}
+
+	return tuples, nil
+}
@@ -0,0 +1,221 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/lib/pq"
+	"github.com/stone1549/auth-service/common"
+	"github.com/twinj/uuid"
+)
+
+const (
+	accountColumns = "id, tenant_id, email, external_id, given_name, family_name, display_name, active, " +
+		"attributes, created_at, updated_at"
+	insertAccount = "INSERT INTO login (id, tenant_id, email, salted_hash, external_id, given_name, family_name, " +
+		"display_name, active, attributes) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING " +
+		accountColumns
+	selectAccount        = "SELECT " + accountColumns + " FROM login WHERE tenant_id=$1 AND id=$2"
+	selectAccountByEmail = "SELECT " + accountColumns + " FROM login WHERE tenant_id=$1 AND email=$2"
+	selectAccounts       = "SELECT " + accountColumns + " FROM login WHERE tenant_id=$1 ORDER BY email"
+	updateAccount        = "UPDATE login SET email=$3, external_id=$4, given_name=$5, family_name=$6, display_name=$7, " +
+		"active=$8, attributes=$9, updated_at=NOW() AT TIME ZONE 'UTC' WHERE tenant_id=$1 AND id=$2 RETURNING " +
+		accountColumns
+	updatePassword = "UPDATE login SET salted_hash=$3, updated_at=NOW() AT TIME ZONE 'UTC' WHERE tenant_id=$1 AND id=$2"
+	deleteLogin    = "DELETE FROM login WHERE tenant_id=$1 AND id=$2 RETURNING email"
+)
+
+// CreateUser adds a user to the account's tenant with the given password, recording a user.created event in the
+// same transaction.
+func (impr *postgresqlUserRepository) CreateUser(ctx context.Context, account common.UserAccount,
+	password string) (common.UserAccount, error) {
+	if account.TenantId == "" {
+		return common.UserAccount{}, newErrRepository("tenant is required")
+	} else if account.Email == "" {
+		return common.UserAccount{}, newErrRepository("email is required")
+	} else if password == "" {
+		return common.UserAccount{}, newErrRepository("password is required")
+	}
+
+	saltedHash, err := hashPassword(ctx, password)
+
+	if err != nil {
+		return common.UserAccount{}, newErrRepository("unable to generate password")
+	}
+
+	attributes, err := marshalAttributes(account.Attributes)
+
+	if err != nil {
+		return common.UserAccount{}, err
+	}
+
+	txn, err := impr.db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return common.UserAccount{}, err
+	}
+
+	created, err := scanAccount(txn.QueryRowContext(ctx, insertAccount, uuid.NewV4().String(), account.TenantId,
+		account.Email, string(saltedHash), nullString(account.ExternalId), nullString(account.GivenName),
+		nullString(account.FamilyName), nullString(account.DisplayName), account.Active, attributes))
+
+	if err != nil {
+		txn.Rollback()
+		return common.UserAccount{}, err
+	}
+
+	err = insertUserEvent(ctx, txn, created.TenantId, created.Id, created.Email, common.UserCreatedEvent)
+
+	if err != nil {
+		txn.Rollback()
+		return common.UserAccount{}, err
+	}
+
+	return created, txn.Commit()
+}
+
+// GetUser retrieves a user by id.
+func (impr *postgresqlUserRepository) GetUser(ctx context.Context, tenantId, userId string) (common.UserAccount,
+	error) {
+	return scanAccount(impr.db.QueryRowContext(ctx, selectAccount, tenantId, userId))
+}
+
+// GetUserByEmail retrieves a user by email.
+func (impr *postgresqlUserRepository) GetUserByEmail(ctx context.Context, tenantId, email string) (common.UserAccount,
+	error) {
+	return scanAccount(impr.db.QueryRowContext(ctx, selectAccountByEmail, tenantId, email))
+}
+
+// ListUsers retrieves all users of the given tenant ordered by email.
+func (impr *postgresqlUserRepository) ListUsers(ctx context.Context, tenantId string) ([]common.UserAccount,
+	error) {
+	rows, err := impr.db.QueryContext(ctx, selectAccounts, tenantId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	accounts := make([]common.UserAccount, 0)
+
+	for rows.Next() {
+		account, err := scanAccount(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		accounts = append(accounts, account)
+	}
+
+	return accounts, rows.Err()
+}
+
+// UpdateUser changes the details of the user identified by the account's tenant and id.
+func (impr *postgresqlUserRepository) UpdateUser(ctx context.Context,
+	account common.UserAccount) (common.UserAccount, error) {
+	if account.Email == "" {
+		return common.UserAccount{}, newErrRepository("email is required")
+	}
+
+	attributes, err := marshalAttributes(account.Attributes)
+
+	if err != nil {
+		return common.UserAccount{}, err
+	}
+
+	return scanAccount(impr.db.QueryRowContext(ctx, updateAccount, account.TenantId, account.Id, account.Email,
+		nullString(account.ExternalId), nullString(account.GivenName), nullString(account.FamilyName),
+		nullString(account.DisplayName), account.Active, attributes))
+}
+
+// SetPassword changes a user's password.
+func (impr *postgresqlUserRepository) SetPassword(ctx context.Context, tenantId, userId, password string) error {
+	if password == "" {
+		return newErrRepository("password is required")
+	}
+
+	saltedHash, err := hashPassword(ctx, password)
+
+	if err != nil {
+		return newErrRepository("unable to generate password")
+	}
+
+	result, err := impr.db.ExecContext(ctx, updatePassword, tenantId, userId, string(saltedHash))
+
+	return expectAffected(result, err, "user not found")
+}
+
+// DeleteUser removes a user, and through cascading foreign keys their group memberships, recording a user.deleted
+// event in the same transaction.
+func (impr *postgresqlUserRepository) DeleteUser(ctx context.Context, tenantId, userId string) error {
+	txn, err := impr.db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	var email string
+	err = txn.QueryRowContext(ctx, deleteLogin, tenantId, userId).Scan(&email)
+
+	if err == sql.ErrNoRows {
+		txn.Rollback()
+		return newErrNotFound("user not found")
+	} else if err != nil {
+		txn.Rollback()
+		return err
+	}
+
+	err = insertUserEvent(ctx, txn, tenantId, userId, email, common.UserDeletedEvent)
+
+	if err != nil {
+		txn.Rollback()
+		return err
+	}
+
+	return txn.Commit()
+}
+
+func scanAccount(row rowScanner) (common.UserAccount, error) {
+	account := common.UserAccount{}
+	var externalId, givenName, familyName, displayName sql.NullString
+	var attributes []byte
+
+	err := row.Scan(&account.Id, &account.TenantId, &account.Email, &externalId, &givenName, &familyName,
+		&displayName, &account.Active, &attributes, &account.CreatedAt, &account.UpdatedAt)
+
+	if err == sql.ErrNoRows {
+		return common.UserAccount{}, newErrNotFound("user not found")
+	} else if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == pgUniqueViolation {
+		return common.UserAccount{}, newErrConflict("user already exists")
+	} else if err != nil {
+		return common.UserAccount{}, err
+	}
+
+	account.ExternalId = externalId.String
+	account.GivenName = givenName.String
+	account.FamilyName = familyName.String
+	account.DisplayName = displayName.String
+
+	if err = json.Unmarshal(attributes, &account.Attributes); err != nil {
+		return common.UserAccount{}, err
+	}
+
+	return account, nil
+}
+
+// marshalAttributes encodes a user's attributes as a JSON object, empty when the user has none.
+func marshalAttributes(attributes map[string]string) (string, error) {
+	if attributes == nil {
+		return "{}", nil
+	}
+
+	encoded, err := json.Marshal(attributes)
+
+	return string(encoded), err
+}
+
+func nullString(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
@@ -0,0 +1,248 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"github.com/lib/pq"
+	"github.com/stone1549/auth-service/common"
+	"github.com/twinj/uuid"
+	"time"
+)
+
+const (
+	webhookColumns = "id, tenant_id, url, secret, events, created_at"
+	insertWebhook  = "INSERT INTO webhook (id, tenant_id, url, secret, events) VALUES ($1, $2, $3, $4, $5) " +
+		"RETURNING " + webhookColumns
+	selectWebhook         = "SELECT " + webhookColumns + " FROM webhook WHERE tenant_id=$1 AND id=$2"
+	selectWebhooks        = "SELECT " + webhookColumns + " FROM webhook WHERE tenant_id=$1 ORDER BY created_at"
+	selectSubscribedHooks = "SELECT id FROM webhook WHERE tenant_id=$1 AND ($2=ANY(events) OR '*'=ANY(events))"
+	deleteWebhook         = "DELETE FROM webhook WHERE tenant_id=$1 AND id=$2"
+	deliveryColumns       = "id, tenant_id, webhook_id, event_type, payload, status, attempts, last_error, " +
+		"next_attempt_at, created_at, updated_at"
+	insertDelivery = "INSERT INTO webhook_delivery (id, tenant_id, webhook_id, event_type, payload, status, " +
+		"next_attempt_at) VALUES ($1, $2, $3, $4, $5, 'pending', $6) RETURNING " + deliveryColumns
+	claimDeliveries = "UPDATE webhook_delivery SET next_attempt_at=$2 WHERE id IN (" +
+		"SELECT id FROM webhook_delivery WHERE status='pending' AND next_attempt_at<=$1 " +
+		"ORDER BY next_attempt_at LIMIT $3 FOR UPDATE SKIP LOCKED) RETURNING " + deliveryColumns
+	completeDelivery = "UPDATE webhook_delivery SET status='delivered', attempts=attempts+1, last_error=NULL " +
+		"WHERE id=$1"
+	failDelivery = "UPDATE webhook_delivery SET status=$2, attempts=attempts+1, last_error=$3, " +
+		"next_attempt_at=$4 WHERE id=$1"
+	selectDeliveries = "SELECT " + deliveryColumns + " FROM webhook_delivery WHERE tenant_id=$1 " +
+		"AND ($2='' OR status=$2) ORDER BY created_at DESC"
+	replayDelivery = "UPDATE webhook_delivery SET status='pending', attempts=0, last_error=NULL, " +
+		"next_attempt_at=$3 WHERE tenant_id=$1 AND id=$2 AND status<>'pending' RETURNING " + deliveryColumns
+	selectDeliveryExists = "SELECT EXISTS (SELECT 1 FROM webhook_delivery WHERE tenant_id=$1 AND id=$2)"
+)
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// NewWebhook subscribes a URL to the given event types of a tenant.
+func (impr *postgresqlUserRepository) NewWebhook(ctx context.Context, tenantId, url, secret string,
+	events []string) (common.Webhook, error) {
+	err := validateWebhook(tenantId, url, secret, events)
+
+	if err != nil {
+		return common.Webhook{}, err
+	}
+
+	row := impr.db.QueryRowContext(ctx, insertWebhook, uuid.NewV4().String(), tenantId, url, secret,
+		pq.Array(events))
+
+	return scanWebhook(row, "webhook not found")
+}
+
+// GetWebhook retrieves a webhook by id.
+func (impr *postgresqlUserRepository) GetWebhook(ctx context.Context, tenantId, webhookId string) (common.Webhook,
+	error) {
+	return scanWebhook(impr.db.QueryRowContext(ctx, selectWebhook, tenantId, webhookId), "webhook not found")
+}
+
+// ListWebhooks retrieves all webhooks of the given tenant ordered by creation.
+func (impr *postgresqlUserRepository) ListWebhooks(ctx context.Context, tenantId string) ([]common.Webhook, error) {
+	rows, err := impr.db.QueryContext(ctx, selectWebhooks, tenantId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	webhooks := make([]common.Webhook, 0)
+
+	for rows.Next() {
+		webhook, err := scanWebhook(rows, "")
+
+		if err != nil {
+			return nil, err
+		}
+
+		webhooks = append(webhooks, webhook)
+	}
+
+	return webhooks, rows.Err()
+}
+
+// DeleteWebhook removes a webhook and, through the cascading foreign key, its deliveries.
+func (impr *postgresqlUserRepository) DeleteWebhook(ctx context.Context, tenantId, webhookId string) error {
+	result, err := impr.db.ExecContext(ctx, deleteWebhook, tenantId, webhookId)
+
+	return expectAffected(result, err, "webhook not found")
+}
+
+// EnqueueWebhookEvent queues a pending delivery of the payload to every subscribed webhook of the tenant.
+func (impr *postgresqlUserRepository) EnqueueWebhookEvent(ctx context.Context, tenantId, eventType string,
+	payload []byte) ([]common.WebhookDelivery, error) {
+	webhookIds, err := queryStrings(ctx, impr.db, selectSubscribedHooks, tenantId, eventType)
+
+	if err != nil || len(webhookIds) == 0 {
+		return []common.WebhookDelivery{}, err
+	}
+
+	txn, err := impr.db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := make([]common.WebhookDelivery, 0, len(webhookIds))
+	now := time.Now().UTC()
+
+	for _, webhookId := range webhookIds {
+		row := txn.QueryRowContext(ctx, insertDelivery, uuid.NewV4().String(), tenantId, webhookId, eventType,
+			string(payload), now)
+		delivery, err := scanDelivery(row)
+
+		if err != nil {
+			txn.Rollback()
+			return nil, err
+		}
+
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, txn.Commit()
+}
+
+// ClaimDueDeliveries retrieves pending deliveries due by now, oldest first, deferring their next attempt by lease.
+// Rows locked by another claim are skipped so several instances can deliver from the same queue.
+func (impr *postgresqlUserRepository) ClaimDueDeliveries(ctx context.Context, now time.Time, lease time.Duration,
+	limit int) ([]common.WebhookDelivery, error) {
+	rows, err := impr.db.QueryContext(ctx, claimDeliveries, now, now.Add(lease), limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return scanDeliveries(rows)
+}
+
+// CompleteDelivery records a successful attempt of a delivery.
+func (impr *postgresqlUserRepository) CompleteDelivery(ctx context.Context, deliveryId string) error {
+	result, err := impr.db.ExecContext(ctx, completeDelivery, deliveryId)
+
+	return expectAffected(result, err, "delivery not found")
+}
+
+// FailDelivery records a failed attempt of a delivery, scheduling the next attempt or dead lettering it.
+func (impr *postgresqlUserRepository) FailDelivery(ctx context.Context, deliveryId, lastError string,
+	nextAttemptAt time.Time, dead bool) error {
+	status := common.PendingDelivery
+
+	if dead {
+		status = common.DeadDelivery
+	}
+
+	result, err := impr.db.ExecContext(ctx, failDelivery, deliveryId, string(status), lastError, nextAttemptAt)
+
+	return expectAffected(result, err, "delivery not found")
+}
+
+// ListDeliveries retrieves the deliveries of a tenant with the given status, or any status when empty, newest first.
+func (impr *postgresqlUserRepository) ListDeliveries(ctx context.Context, tenantId string,
+	status common.DeliveryStatus) ([]common.WebhookDelivery, error) {
+	rows, err := impr.db.QueryContext(ctx, selectDeliveries, tenantId, string(status))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return scanDeliveries(rows)
+}
+
+// ReplayDelivery queues a delivery that isn't pending for immediate delivery with its attempts reset.
+func (impr *postgresqlUserRepository) ReplayDelivery(ctx context.Context, tenantId,
+	deliveryId string) (common.WebhookDelivery, error) {
+	delivery, err := scanDelivery(impr.db.QueryRowContext(ctx, replayDelivery, tenantId, deliveryId,
+		time.Now().UTC()))
+
+	if err != sql.ErrNoRows {
+		return delivery, err
+	}
+
+	var exists bool
+	err = impr.db.QueryRowContext(ctx, selectDeliveryExists, tenantId, deliveryId).Scan(&exists)
+
+	if err != nil {
+		return common.WebhookDelivery{}, err
+	} else if exists {
+		return common.WebhookDelivery{}, newErrConflict("delivery is already pending")
+	}
+
+	return common.WebhookDelivery{}, newErrNotFound("delivery not found")
+}
+
+func scanWebhook(row rowScanner, notFoundMsg string) (common.Webhook, error) {
+	webhook := common.Webhook{}
+	err := row.Scan(&webhook.Id, &webhook.TenantId, &webhook.Url, &webhook.Secret, pq.Array(&webhook.Events),
+		&webhook.CreatedAt)
+
+	if err == sql.ErrNoRows {
+		return common.Webhook{}, newErrNotFound(notFoundMsg)
+	} else if err != nil {
+		return common.Webhook{}, err
+	}
+
+	return webhook, nil
+}
+
+// scanDelivery scans a delivery, returning sql.ErrNoRows as is for callers to tell apart.
+func scanDelivery(row rowScanner) (common.WebhookDelivery, error) {
+	delivery := common.WebhookDelivery{}
+	var payload []byte
+	var status string
+	var lastError sql.NullString
+
+	err := row.Scan(&delivery.Id, &delivery.TenantId, &delivery.WebhookId, &delivery.EventType, &payload, &status,
+		&delivery.Attempts, &lastError, &delivery.NextAttemptAt, &delivery.CreatedAt, &delivery.UpdatedAt)
+
+	if err != nil {
+		return common.WebhookDelivery{}, err
+	}
+
+	delivery.Payload = payload
+	delivery.Status = common.DeliveryStatus(status)
+	delivery.LastError = lastError.String
+
+	return delivery, nil
+}
+
+func scanDeliveries(rows *sql.Rows) ([]common.WebhookDelivery, error) {
+	defer rows.Close()
+
+	deliveries := make([]common.WebhookDelivery, 0)
+
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, rows.Err()
+}
@@ -4,35 +4,286 @@ import (
 	"context"
 	"database/sql"
 	"github.com/stone1549/auth-service/common"
+	"github.com/stone1549/auth-service/metrics"
+	"github.com/stone1549/auth-service/tracing"
+	"golang.org/x/crypto/bcrypt"
+	"io"
+	"time"
 )
 
 // UserRepository represents a data source through which users can be managed.
 type UserRepository interface {
-	// NewUser adds a user to the repo.
-	NewUser(ctx context.Context, email string, password string) (string, error)
-	// Authenticate validates email and password combo with what is stored in the repo. Returns users unique id on
-	// success
-	Authenticate(ctx context.Context, email string, password string) (string, error)
+	// NewUser adds a user to the given tenant's namespace in the repo.
+	NewUser(ctx context.Context, tenantId, email, password string) (string, error)
+	// Authenticate validates email and password combo with what is stored in the repo for the given tenant. Returns
+	// users unique id on success
+	Authenticate(ctx context.Context, tenantId, email, password string) (string, error)
+}
+
+// UserAdminRepository represents a data source through which users can be administered, such as by provisioning
+// from an identity provider.
+type UserAdminRepository interface {
+	// CreateUser adds a user to the account's tenant with the given password.
+	CreateUser(ctx context.Context, account common.UserAccount, password string) (common.UserAccount, error)
+	// GetUser retrieves a user by id.
+	GetUser(ctx context.Context, tenantId, userId string) (common.UserAccount, error)
+	// GetUserByEmail retrieves a user by email.
+	GetUserByEmail(ctx context.Context, tenantId, email string) (common.UserAccount, error)
+	// ListUsers retrieves all users of the given tenant ordered by email.
+	ListUsers(ctx context.Context, tenantId string) ([]common.UserAccount, error)
+	// UpdateUser changes the details of the user identified by the account's tenant and id.
+	UpdateUser(ctx context.Context, account common.UserAccount) (common.UserAccount, error)
+	// SetPassword changes a user's password.
+	SetPassword(ctx context.Context, tenantId, userId, password string) error
+	// DeleteUser removes a user and their group memberships.
+	DeleteUser(ctx context.Context, tenantId, userId string) error
+}
+
+// GroupRepository represents a data source through which groups and group membership can be managed. Groups may
+// contain users and other groups, membership is transitive.
+type GroupRepository interface {
+	// NewGroup adds a group to the given tenant.
+	NewGroup(ctx context.Context, tenantId, name, description string) (common.Group, error)
+	// GetGroup retrieves a group by id.
+	GetGroup(ctx context.Context, tenantId, groupId string) (common.Group, error)
+	// ListGroups retrieves all groups of the given tenant ordered by name.
+	ListGroups(ctx context.Context, tenantId string) ([]common.Group, error)
+	// UpdateGroup changes the name and description of a group.
+	UpdateGroup(ctx context.Context, tenantId, groupId, name, description string) (common.Group, error)
+	// DeleteGroup removes a group and all memberships it takes part in.
+	DeleteGroup(ctx context.Context, tenantId, groupId string) error
+	// GetGroupMembers retrieves the direct members of a group.
+	GetGroupMembers(ctx context.Context, tenantId, groupId string) (common.GroupMembers, error)
+	// AddGroupUser makes a user a direct member of a group.
+	AddGroupUser(ctx context.Context, tenantId, groupId, userId string) error
+	// RemoveGroupUser removes a user from the direct members of a group.
+	RemoveGroupUser(ctx context.Context, tenantId, groupId, userId string) error
+	// AddSubgroup makes a group a direct member of another group, fails if this would create a cycle.
+	AddSubgroup(ctx context.Context, tenantId, groupId, memberGroupId string) error
+	// RemoveSubgroup removes a group from the direct members of another group.
+	RemoveSubgroup(ctx context.Context, tenantId, groupId, memberGroupId string) error
+	// GetUserGroups retrieves every group a user is a member of, directly or through nested groups, ordered by name.
+	GetUserGroups(ctx context.Context, tenantId, userId string) ([]common.Group, error)
+}
+
+// WebhookRepository represents a data source through which webhook subscriptions and their queue of deliveries are
+// managed. Deliveries survive restarts, they're retried until delivered or dead lettered.
+type WebhookRepository interface {
+	// NewWebhook subscribes a URL to the given event types of a tenant.
+	NewWebhook(ctx context.Context, tenantId, url, secret string, events []string) (common.Webhook, error)
+	// GetWebhook retrieves a webhook by id.
+	GetWebhook(ctx context.Context, tenantId, webhookId string) (common.Webhook, error)
+	// ListWebhooks retrieves all webhooks of the given tenant ordered by creation.
+	ListWebhooks(ctx context.Context, tenantId string) ([]common.Webhook, error)
+	// DeleteWebhook removes a webhook and its deliveries.
+	DeleteWebhook(ctx context.Context, tenantId, webhookId string) error
+	// EnqueueWebhookEvent queues a pending delivery of the payload to every webhook of the tenant subscribed to the
+	// event type.
+	EnqueueWebhookEvent(ctx context.Context, tenantId, eventType string, payload []byte) ([]common.WebhookDelivery,
+		error)
+	// ClaimDueDeliveries retrieves up to limit pending deliveries of any tenant due by now, oldest first, and defers
+	// their next attempt by lease so they aren't claimed again while being attempted.
+	ClaimDueDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]common.WebhookDelivery,
+		error)
+	// CompleteDelivery records a successful attempt of a delivery.
+	CompleteDelivery(ctx context.Context, deliveryId string) error
+	// FailDelivery records a failed attempt of a delivery, scheduling the next attempt or dead lettering it.
+	FailDelivery(ctx context.Context, deliveryId, lastError string, nextAttemptAt time.Time, dead bool) error
+	// ListDeliveries retrieves the deliveries of a tenant with the given status, or any status when empty, newest
+	// first.
+	ListDeliveries(ctx context.Context, tenantId string, status common.DeliveryStatus) ([]common.WebhookDelivery,
+		error)
+	// ReplayDelivery queues a delivery that isn't pending for immediate delivery with its attempts reset.
+	ReplayDelivery(ctx context.Context, tenantId, deliveryId string) (common.WebhookDelivery, error)
+}
+
+// OutboxRepository represents a data source whose mutations record events in an outbox within the same
+// transaction, for a relay to publish at least once or until it gives up on them.
+type OutboxRepository interface {
+	// ClaimOutbox retrieves up to limit unpublished events due by now that aren't dead, oldest first, and hides them
+	// from other claims for lease.
+	ClaimOutbox(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]common.OutboxEvent, error)
+	// MarkPublished records that an event was published.
+	MarkPublished(ctx context.Context, eventId string) error
+	// MarkPublishFailed records a failed attempt to publish an event, scheduling the next attempt or marking it dead
+	// so it's never retried.
+	MarkPublishFailed(ctx context.Context, eventId, lastError string, nextAttemptAt time.Time, dead bool) error
+}
+
+// SessionRepository represents a data source through which the sessions users are logged in with are tracked.
+type SessionRepository interface {
+	// NewSession records a session of the session's user, expiring after its idle timeout or at its expiry.
+	NewSession(ctx context.Context, session common.Session) (common.Session, error)
+	// GetSession retrieves a session by id.
+	GetSession(ctx context.Context, tenantId, sessionId string) (common.Session, error)
+	// ListSessions retrieves a user's sessions, most recently seen first.
+	ListSessions(ctx context.Context, tenantId, userId string) ([]common.Session, error)
+	// TouchSession records that a session was seen at the given time.
+	TouchSession(ctx context.Context, tenantId, sessionId string, seenAt time.Time) error
+	// DeleteSession revokes one of a user's sessions.
+	DeleteSession(ctx context.Context, tenantId, userId, sessionId string) error
+	// DeleteExpiredSessions removes every session of any tenant expired by now, returning how many were removed.
+	DeleteExpiredSessions(ctx context.Context, now time.Time) (int, error)
+}
+
+// DeviceRepository represents a data source through which the devices users have logged in from are remembered.
+type DeviceRepository interface {
+	// ListDevices retrieves the devices a user has logged in from, most recently seen first.
+	ListDevices(ctx context.Context, tenantId, userId string) ([]common.Device, error)
+	// SaveDevice remembers a device of the device's user, or records that a known one was seen again.
+	SaveDevice(ctx context.Context, device common.Device) (common.Device, error)
+}
+
+// pinger is implemented by repositories holding a connection that can fail.
+type pinger interface {
+	// Ping verifies the connection is usable.
+	Ping(ctx context.Context) error
+}
+
+// ping verifies a repository's connection is usable, when it has one.
+func ping(ctx context.Context, repo interface{}) error {
+	if p, ok := repo.(pinger); ok {
+		return p.Ping(ctx)
+	}
+
+	return nil
+}
+
+// closeRepository releases the resources held by a repository, when it holds any.
+func closeRepository(repo interface{}) error {
+	if closer, ok := repo.(io.Closer); ok {
+		return closer.Close()
+	}
+
+	return nil
 }
 
 // NewUserRepository constructs a UserRepository from the given configuration.
 func NewUserRepository(config common.Configuration) (UserRepository, error) {
 	var err error
 	var repo UserRepository
-	var db *sql.DB
 	switch config.GetRepoType() {
-	case common.InMemoryRepo:
-		repo, err = MakeInMemoryRepository(config)
-	case common.PostgreSqlRepo:
-		db, err = sql.Open("postgres", config.GetPgUrl())
+	case common.InMemoryRepo, common.PostgreSqlRepo:
+		repo, err = makeStore(config, config.GetRepoType())
+	case common.LdapRepo:
+		var local UserRepository
+		local, err = makeStore(config, config.GetLdapConfig().LocalRepoType)
 
 		if err != nil {
 			return nil, err
 		}
-		repo, err = MakePostgresqlUserRespository(config, db)
+
+		repo, err = MakeLdapUserRepository(config.GetLdapConfig(), local)
+
+		if err == nil {
+			repo = &storeOwner{repo.(localStore), local}
+		}
+	case common.ChainedRepo:
+		repo, err = makeChainedRepository(config)
 	default:
 		err = newErrRepository("repository type unimplemented")
 	}
 
+	if store, ok := repo.(localStore); ok && err == nil {
+		repo = &tracedRepository{store}
+	}
+
 	return repo, err
 }
+
+// storeOwner closes the local repository a directory keeps everything else in, which the directory doesn't own.
+type storeOwner struct {
+	localStore
+	local UserRepository
+}
+
+// Close closes the local repository.
+func (so *storeOwner) Close() error {
+	return closeRepository(so.local)
+}
+
+// makeStore constructs a repository that stores users itself.
+func makeStore(config common.Configuration, repoType common.UserRepositoryType) (UserRepository, error) {
+	switch repoType {
+	case common.InMemoryRepo:
+		return MakeInMemoryRepository(config)
+	case common.PostgreSqlRepo:
+		db, err := sql.Open("postgres", config.GetPgUrl())
+
+		if err != nil {
+			return nil, err
+		}
+
+		metrics.RegisterDB("repository", db)
+		return MakePostgresqlUserRespository(config, db)
+	default:
+		return nil, newErrRepository("repository type unimplemented")
+	}
+}
+
+// makeChainedRepository constructs the configured chain, directories keep what they don't hold in the chain's first
+// backend.
+func makeChainedRepository(config common.Configuration) (UserRepository, error) {
+	backends := config.GetRepoChain()
+
+	if len(backends) == 0 {
+		return nil, newErrRepository("repository chain is empty")
+	}
+
+	primary, err := makeStore(config, backends[0].Type)
+
+	if err != nil {
+		return nil, err
+	}
+
+	repos := []UserRepository{primary}
+
+	for _, backend := range backends[1:] {
+		var repo UserRepository
+
+		if backend.Type == common.LdapRepo {
+			ldapConfig := config.GetLdapConfig()
+			// The chain decides which backend new users are added to.
+			ldapConfig.AllowSignup = false
+			repo, err = MakeLdapUserRepository(ldapConfig, primary)
+		} else {
+			repo, err = makeStore(config, backend.Type)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		repos = append(repos, repo)
+	}
+
+	return MakeChainedUserRepository(backends, repos)
+}
+
+// TupleRepository represents a data source through which relationship tuples can be managed.
+type TupleRepository interface {
+	// WriteTuples atomically adds and removes the given tuples within a tenant, writing a tuple that already exists
+	// or deleting one that doesn't is not an error.
+	WriteTuples(ctx context.Context, tenantId string, writes []common.Tuple, deletes []common.Tuple) error
+	// ReadTuples retrieves every tuple of a tenant with the given object and relation ordered by subject.
+	ReadTuples(ctx context.Context, tenantId, object, relation string) ([]common.Tuple, error)
+}
+
+// hashPassword salts and hashes a password with bcrypt, timing it for the metrics and traces.
+func hashPassword(ctx context.Context, password string) ([]byte, error) {
+	defer metrics.ObservePasswordHash("hash", time.Now())
+	_, span := tracing.Start(ctx, "bcrypt.hash")
+	saltedHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	tracing.End(span, err)
+
+	return saltedHash, err
+}
+
+// comparePassword checks a password against its bcrypt hash, timing it for the metrics and traces.
+func comparePassword(ctx context.Context, saltedHash, password string) error {
+	defer metrics.ObservePasswordHash("compare", time.Now())
+	_, span := tracing.Start(ctx, "bcrypt.compare")
+	defer span.End()
+
+	return bcrypt.CompareHashAndPassword([]byte(saltedHash), []byte(password))
+}
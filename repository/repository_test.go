@@ -7,6 +7,8 @@ import (
 	"github.com/stone1549/auth-service/common"
 	"github.com/stone1549/auth-service/repository"
 	"io/ioutil"
+	"log/slog"
+	"net"
 	"path/filepath"
 	"reflect"
 	"runtime"
@@ -123,6 +125,14 @@ func (c configuration) GetPgUrl() string {
 	}
 }
 
+func (c configuration) GetLdapConfig() common.LdapConfig {
+	return common.LdapConfig{}
+}
+
+func (c configuration) GetRepoChain() []common.RepoBackend {
+	return nil
+}
+
 func (c configuration) GetTokenSecretKey() string {
 	switch c {
 	case inMemorySmall:
@@ -194,6 +204,126 @@ func (c configuration) GetTokenPublicKey() *rsa.PublicKey {
 	}
 }
 
+func (c configuration) GetTenants() map[string]common.Tenant {
+	return map[string]common.Tenant{common.DefaultTenantId: common.NewDefaultTenant()}
+}
+
+func (c configuration) GetTenantSelector() common.TenantSelector {
+	return common.HeaderTenantSelector
+}
+
+func (c configuration) GetAuthzNamespaces() string {
+	return ""
+}
+
+func (c configuration) GetOidcProviders() string {
+	return ""
+}
+
+func (c configuration) GetSamlConfig() string {
+	return ""
+}
+
+func (c configuration) GetForwardAuthLoginUrl() string {
+	return ""
+}
+
+func (c configuration) GetForwardAuthRedirectHosts() []string {
+	return []string{}
+}
+
+func (c configuration) GetSessionCleanupInterval() time.Duration {
+	return 0
+}
+
+func (c configuration) GetGeoIpDatabase() string {
+	return ""
+}
+
+func (c configuration) GetSmtpUrl() string {
+	return ""
+}
+
+func (c configuration) GetSmtpFrom() string {
+	return ""
+}
+
+func (c configuration) GetTraceExporterType() common.TraceExporterType {
+	return common.NoTraceExporter
+}
+
+func (c configuration) GetTraceEndpoint() string {
+	return ""
+}
+
+func (c configuration) GetLogLevel() slog.Level {
+	return slog.LevelInfo
+}
+
+func (c configuration) GetShutdownGracePeriod() time.Duration {
+	return 0
+}
+
+func (c configuration) GetShutdownDrainDelay() time.Duration {
+	return 0
+}
+
+func (c configuration) GetTlsConfig() common.TlsConfig {
+	return common.TlsConfig{}
+}
+
+func (c configuration) GetIssuer() string {
+	return ""
+}
+
+func (c configuration) GetTrustedProxies() []*net.IPNet {
+	return []*net.IPNet{}
+}
+
+func (c configuration) GetDpopWindow() time.Duration {
+	return 5 * time.Minute
+}
+
+func (c configuration) GetPolicyPath() string {
+	return ""
+}
+
+func (c configuration) GetPolicyReloadInterval() time.Duration {
+	return 0
+}
+
+func (c configuration) GetAuditSinkType() common.AuditSinkType {
+	return common.NoAuditSink
+}
+
+func (c configuration) GetAuditFile() string {
+	return ""
+}
+
+func (c configuration) GetWebhookMaxAttempts() int {
+	return 8
+}
+
+func (c configuration) GetWebhookPollInterval() time.Duration {
+	return 0
+}
+
+func (c configuration) GetOutboxPublisherType() common.OutboxPublisherType {
+	return common.LogOutboxPublisher
+}
+
+func (c configuration) GetOutboxTarget() string {
+	return ""
+}
+
+func (c configuration) GetOutboxPollInterval() time.Duration {
+	return 0
+}
+
+func (c configuration) GetOutboxMaxAttempts() int {
+	return 8
+}
+
 // TestNewUserRepository_ImSuccessEmpty ensures an empty in memory repo can be constructed
 func TestNewUserRepository_ImSuccessEmpty(t *testing.T) {
 	_, err := repository.NewUserRepository(inMemoryEmpty)
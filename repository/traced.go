@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"context"
+	"github.com/stone1549/auth-service/common"
+	"github.com/stone1549/auth-service/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// tracedRepository wraps a repository, tracing each of its user methods as a span of the request that called it.
+type tracedRepository struct {
+	localStore
+}
+
+// Ping verifies the wrapped repository can be reached.
+func (tr *tracedRepository) Ping(ctx context.Context) error {
+	return ping(ctx, tr.localStore)
+}
+
+// Close closes the wrapped repository.
+func (tr *tracedRepository) Close() error {
+	return closeRepository(tr.localStore)
+}
+
+// NewUser adds a user to the repo within a span.
+func (tr *tracedRepository) NewUser(ctx context.Context, tenantId, email, password string) (string, error) {
+	ctx, span := tracing.Start(ctx, "UserRepository.NewUser", attribute.String("tenant.id", tenantId))
+	id, err := tr.localStore.NewUser(ctx, tenantId, email, password)
+	tracing.End(span, err)
+
+	return id, err
+}
+
+// Authenticate validates an email and password combo within a span.
+func (tr *tracedRepository) Authenticate(ctx context.Context, tenantId, email, password string) (string, error) {
+	ctx, span := tracing.Start(ctx, "UserRepository.Authenticate", attribute.String("tenant.id", tenantId))
+	id, err := tr.localStore.Authenticate(ctx, tenantId, email, password)
+	tracing.End(span, err)
+
+	return id, err
+}
+
+// CreateUser adds a user to the account's tenant within a span.
+func (tr *tracedRepository) CreateUser(ctx context.Context, account common.UserAccount,
+	password string) (common.UserAccount, error) {
+	ctx, span := tracing.Start(ctx, "UserAdminRepository.CreateUser", attribute.String("tenant.id", account.TenantId))
+	created, err := tr.localStore.CreateUser(ctx, account, password)
+	tracing.End(span, err)
+
+	return created, err
+}
+
+// GetUser retrieves a user by id within a span.
+func (tr *tracedRepository) GetUser(ctx context.Context, tenantId, userId string) (common.UserAccount, error) {
+	ctx, span := tracing.Start(ctx, "UserAdminRepository.GetUser", attribute.String("tenant.id", tenantId))
+	account, err := tr.localStore.GetUser(ctx, tenantId, userId)
+	tracing.End(span, err)
+
+	return account, err
+}
+
+// GetUserByEmail retrieves a user by email within a span.
+func (tr *tracedRepository) GetUserByEmail(ctx context.Context, tenantId, email string) (common.UserAccount, error) {
+	ctx, span := tracing.Start(ctx, "UserAdminRepository.GetUserByEmail", attribute.String("tenant.id", tenantId))
+	account, err := tr.localStore.GetUserByEmail(ctx, tenantId, email)
+	tracing.End(span, err)
+
+	return account, err
+}
+
+// ListUsers retrieves all users of the given tenant within a span.
+func (tr *tracedRepository) ListUsers(ctx context.Context, tenantId string) ([]common.UserAccount, error) {
+	ctx, span := tracing.Start(ctx, "UserAdminRepository.ListUsers", attribute.String("tenant.id", tenantId))
+	accounts, err := tr.localStore.ListUsers(ctx, tenantId)
+	tracing.End(span, err)
+
+	return accounts, err
+}
+
+// UpdateUser changes the details of a user within a span.
+func (tr *tracedRepository) UpdateUser(ctx context.Context, account common.UserAccount) (common.UserAccount, error) {
+	ctx, span := tracing.Start(ctx, "UserAdminRepository.UpdateUser", attribute.String("tenant.id", account.TenantId))
+	updated, err := tr.localStore.UpdateUser(ctx, account)
+	tracing.End(span, err)
+
+	return updated, err
+}
+
+// SetPassword changes a user's password within a span.
+func (tr *tracedRepository) SetPassword(ctx context.Context, tenantId, userId, password string) error {
+	ctx, span := tracing.Start(ctx, "UserAdminRepository.SetPassword", attribute.String("tenant.id", tenantId))
+	err := tr.localStore.SetPassword(ctx, tenantId, userId, password)
+	tracing.End(span, err)
+
+	return err
+}
+
+// DeleteUser removes a user within a span.
+func (tr *tracedRepository) DeleteUser(ctx context.Context, tenantId, userId string) error {
+	ctx, span := tracing.Start(ctx, "UserAdminRepository.DeleteUser", attribute.String("tenant.id", tenantId))
+	err := tr.localStore.DeleteUser(ctx, tenantId, userId)
+	tracing.End(span, err)
+
+	return err
+}
@@ -0,0 +1,126 @@
+package saml
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+type keyDescriptor struct {
+	Use          string   `xml:"use,attr"`
+	Certificates []string `xml:"http://www.w3.org/2000/09/xmldsig# KeyInfo>X509Data>X509Certificate"`
+}
+
+type endpoint struct {
+	Binding  string `xml:"Binding,attr"`
+	Location string `xml:"Location,attr"`
+}
+
+type idpDescriptor struct {
+	KeyDescriptors      []keyDescriptor `xml:"urn:oasis:names:tc:SAML:2.0:metadata KeyDescriptor"`
+	SingleSignOnService []endpoint      `xml:"urn:oasis:names:tc:SAML:2.0:metadata SingleSignOnService"`
+}
+
+type entityDescriptor struct {
+	XMLName          xml.Name        `xml:"urn:oasis:names:tc:SAML:2.0:metadata EntityDescriptor"`
+	EntityId         string          `xml:"entityID,attr"`
+	IdpSsoDescriptor []idpDescriptor `xml:"urn:oasis:names:tc:SAML:2.0:metadata IDPSSODescriptor"`
+}
+
+// readMetadata reads the identity provider's entity id, signing certificates and single sign on URL from its
+// metadata.
+func (idp *IdentityProvider) readMetadata(metadata []byte) error {
+	var entity entityDescriptor
+	err := xml.Unmarshal(metadata, &entity)
+
+	if err != nil {
+		return err
+	} else if entity.EntityId == "" {
+		return errors.New("entity id is missing")
+	} else if len(entity.IdpSsoDescriptor) == 0 {
+		return errors.New("identity provider descriptor is missing")
+	}
+
+	idp.entityId = entity.EntityId
+
+	for _, descriptor := range entity.IdpSsoDescriptor {
+		for _, key := range descriptor.KeyDescriptors {
+			if key.Use != "" && key.Use != "signing" {
+				continue
+			}
+
+			for _, encoded := range key.Certificates {
+				der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(encoded), ""))
+
+				if err != nil {
+					return errors.New("invalid signing certificate")
+				}
+
+				cert, err := x509.ParseCertificate(der)
+
+				if err != nil {
+					return errors.New("invalid signing certificate")
+				}
+
+				idp.certs = append(idp.certs, cert)
+			}
+		}
+
+		for _, sso := range descriptor.SingleSignOnService {
+			if sso.Binding == HttpRedirectBinding && idp.ssoUrl == "" {
+				idp.ssoUrl = sso.Location
+			}
+		}
+	}
+
+	if len(idp.certs) == 0 {
+		return errors.New("no signing certificate")
+	}
+
+	return nil
+}
+
+type spEndpoint struct {
+	Binding  string `xml:"Binding,attr"`
+	Location string `xml:"Location,attr"`
+	Index    int    `xml:"index,attr"`
+}
+
+type spDescriptor struct {
+	AuthnRequestsSigned        bool         `xml:"AuthnRequestsSigned,attr"`
+	WantAssertionsSigned       bool         `xml:"WantAssertionsSigned,attr"`
+	ProtocolSupportEnumeration string       `xml:"protocolSupportEnumeration,attr"`
+	NameIdFormat               string       `xml:"md:NameIDFormat"`
+	AssertionConsumerService   []spEndpoint `xml:"md:AssertionConsumerService"`
+}
+
+type spEntityDescriptor struct {
+	XMLName         xml.Name     `xml:"md:EntityDescriptor"`
+	Namespace       string       `xml:"xmlns:md,attr"`
+	EntityId        string       `xml:"entityID,attr"`
+	SpSsoDescriptor spDescriptor `xml:"md:SPSSODescriptor"`
+}
+
+// Metadata is the service provider's metadata for the identity provider, describing its entity id and where
+// responses are POSTed. Assertions must be signed.
+func (idp *IdentityProvider) Metadata() ([]byte, error) {
+	metadata, err := xml.MarshalIndent(spEntityDescriptor{
+		Namespace: MetadataNamespace,
+		EntityId:  idp.EntityId(),
+		SpSsoDescriptor: spDescriptor{
+			WantAssertionsSigned:       true,
+			ProtocolSupportEnumeration: ProtocolNamespace,
+			NameIdFormat:               EmailNameIdFormat,
+			AssertionConsumerService: []spEndpoint{{Binding: HttpPostBinding, Location: idp.AcsUrl(),
+				Index: 0}},
+		},
+	}, "", "  ")
+
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), metadata...), nil
+}
@@ -0,0 +1,89 @@
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"github.com/beevik/etree"
+	"github.com/pkg/errors"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// maxPendingRequests caps the logins awaiting a response, new logins are refused when there are more.
+const maxPendingRequests = 10000
+
+// LoginUrl begins a login, returning the URL of the identity provider to send the user to with an authentication
+// request, using the HTTP-Redirect binding.
+func (idp *IdentityProvider) LoginUrl() (string, error) {
+	if idp.ssoUrl == "" {
+		return "", errors.New("identity provider has no HTTP-Redirect single sign on service")
+	}
+
+	random := make([]byte, 20)
+
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+
+	// Ids must not start with a digit.
+	id := "_" + hex.EncodeToString(random)
+	now := time.Now().UTC()
+
+	request := etree.NewElement("samlp:AuthnRequest")
+	request.CreateAttr("xmlns:samlp", ProtocolNamespace)
+	request.CreateAttr("xmlns:saml", AssertionNamespace)
+	request.CreateAttr("ID", id)
+	request.CreateAttr("Version", "2.0")
+	request.CreateAttr("IssueInstant", now.Format(time.RFC3339))
+	request.CreateAttr("Destination", idp.ssoUrl)
+	request.CreateAttr("AssertionConsumerServiceURL", idp.AcsUrl())
+	request.CreateAttr("ProtocolBinding", HttpPostBinding)
+	request.CreateElement("saml:Issuer").SetText(idp.EntityId())
+	request.CreateElement("samlp:NameIDPolicy").CreateAttr("AllowCreate", "true")
+
+	doc := etree.NewDocument()
+	doc.SetRoot(request)
+	src, err := doc.WriteToBytes()
+
+	if err != nil {
+		return "", err
+	}
+
+	var deflated bytes.Buffer
+	writer, err := flate.NewWriter(&deflated, flate.BestCompression)
+
+	if err != nil {
+		return "", err
+	}
+
+	writer.Write(src)
+	writer.Close()
+
+	idp.mutex.Lock()
+
+	if len(idp.requests) >= maxPendingRequests {
+		forgetExpired(idp.requests, now)
+	}
+
+	if len(idp.requests) >= maxPendingRequests {
+		idp.mutex.Unlock()
+		return "", errors.New("too many logins in progress")
+	}
+
+	remember(idp.requests, id, now.Add(RequestTimeout))
+	idp.mutex.Unlock()
+
+	query := url.Values{"SAMLRequest": {base64.StdEncoding.EncodeToString(deflated.Bytes())}}
+
+	separator := "?"
+
+	if strings.Contains(idp.ssoUrl, "?") {
+		separator = "&"
+	}
+
+	return idp.ssoUrl + separator + query.Encode(), nil
+}
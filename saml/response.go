@@ -0,0 +1,305 @@
+package saml
+
+import (
+	"encoding/base64"
+	"fmt"
+	"github.com/beevik/etree"
+	"github.com/pkg/errors"
+	"github.com/russellhaering/goxmldsig"
+	"github.com/russellhaering/goxmldsig/etreeutils"
+	"strings"
+	"time"
+)
+
+// Assertion is what an identity provider asserts about a user in a validated response.
+type Assertion struct {
+	Id           string
+	NameId       string
+	NameIdFormat string
+	SessionIndex string
+	// Email is the user's email from the configured attribute, or else their NameID.
+	Email string
+	// Name is the user's display name from the configured attribute.
+	Name       string
+	Attributes map[string][]string
+}
+
+// ParseResponse validates a base64 encoded response POSTed to the assertion consumer service and returns its
+// assertion. The response or its assertion must be signed with one of the identity provider's certificates, the
+// assertion must be issued by it for this service provider, be within its conditions, answer a login we began
+// unless the identity provider may begin them, and not have been consumed before.
+func (idp *IdentityProvider) ParseResponse(encoded string) (Assertion, error) {
+	src, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(encoded), ""))
+
+	if err != nil {
+		return Assertion{}, errors.New("response isn't base64 encoded")
+	}
+
+	doc := etree.NewDocument()
+	err = doc.ReadFromBytes(src)
+
+	if err != nil || doc.Root() == nil {
+		return Assertion{}, errors.New("response isn't XML")
+	}
+
+	response := doc.Root()
+
+	if !is(response, ProtocolNamespace, "Response") {
+		return Assertion{}, errors.New("document isn't a SAML response")
+	}
+
+	if destination := response.SelectAttrValue("Destination", ""); destination != "" &&
+		destination != idp.AcsUrl() {
+		return Assertion{}, errors.New("response was sent to another destination")
+	}
+
+	status := child(child(response, ProtocolNamespace, "Status"), ProtocolNamespace, "StatusCode")
+
+	if status == nil || status.SelectAttrValue("Value", "") != SuccessStatus {
+		return Assertion{}, errors.New("identity provider didn't authenticate the user")
+	}
+
+	validator := dsig.NewDefaultValidationContext(&dsig.MemoryX509CertificateStore{Roots: idp.certs})
+	responseSigned := child(response, SignatureNamespace, "Signature") != nil
+
+	if responseSigned {
+		response, err = validator.Validate(response)
+
+		if err != nil {
+			return Assertion{}, errors.New(fmt.Sprintf("invalid response signature: %s", err.Error()))
+		}
+	}
+
+	if len(children(response, AssertionNamespace, "EncryptedAssertion")) > 0 {
+		return Assertion{}, errors.New("encrypted assertions aren't supported")
+	}
+
+	assertions := children(response, AssertionNamespace, "Assertion")
+
+	if len(assertions) != 1 {
+		return Assertion{}, errors.New("response must contain exactly one assertion")
+	}
+
+	assertion := assertions[0]
+
+	if !responseSigned {
+		assertion, err = validateDetached(validator, assertion)
+
+		if err != nil {
+			return Assertion{}, errors.New(fmt.Sprintf("invalid assertion signature: %s", err.Error()))
+		}
+	}
+
+	return idp.readAssertion(assertion)
+}
+
+// validateDetached validates the signature of an element within a document, along with the namespaces it inherits.
+func validateDetached(validator *dsig.ValidationContext, el *etree.Element) (*etree.Element, error) {
+	ctx, err := etreeutils.NSBuildParentContext(el)
+
+	if err != nil {
+		return nil, err
+	}
+
+	detached, err := etreeutils.NSDetatch(ctx, el)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return validator.Validate(detached)
+}
+
+// readAssertion checks a signed assertion and reads what it asserts.
+func (idp *IdentityProvider) readAssertion(el *etree.Element) (Assertion, error) {
+	now := time.Now()
+	assertion := Assertion{Id: el.SelectAttrValue("ID", ""), Attributes: make(map[string][]string)}
+
+	if assertion.Id == "" {
+		return Assertion{}, errors.New("assertion has no id")
+	}
+
+	if issuer := child(el, AssertionNamespace, "Issuer"); issuer == nil || issuer.Text() != idp.entityId {
+		return Assertion{}, errors.New("assertion wasn't issued by the identity provider")
+	}
+
+	issued, err := time.Parse(time.RFC3339, el.SelectAttrValue("IssueInstant", ""))
+
+	if err != nil {
+		return Assertion{}, errors.New("assertion has no issue instant")
+	} else if now.Add(ClockSkew).Before(issued) || now.After(issued.Add(MaxAssertionAge+ClockSkew)) {
+		return Assertion{}, errors.New("assertion is too old")
+	}
+
+	err = idp.checkConditions(child(el, AssertionNamespace, "Conditions"), now)
+
+	if err != nil {
+		return Assertion{}, err
+	}
+
+	subject := child(el, AssertionNamespace, "Subject")
+	nameId := child(subject, AssertionNamespace, "NameID")
+
+	if nameId == nil || strings.TrimSpace(nameId.Text()) == "" {
+		return Assertion{}, errors.New("assertion has no subject")
+	}
+
+	assertion.NameId = strings.TrimSpace(nameId.Text())
+	assertion.NameIdFormat = nameId.SelectAttrValue("Format", "")
+
+	inResponseTo, err := idp.checkConfirmation(subject, now)
+
+	if err != nil {
+		return Assertion{}, err
+	}
+
+	if statement := child(el, AssertionNamespace, "AuthnStatement"); statement != nil {
+		assertion.SessionIndex = statement.SelectAttrValue("SessionIndex", "")
+	}
+
+	for _, statement := range children(el, AssertionNamespace, "AttributeStatement") {
+		for _, attribute := range children(statement, AssertionNamespace, "Attribute") {
+			name := attribute.SelectAttrValue("Name", "")
+
+			for _, value := range children(attribute, AssertionNamespace, "AttributeValue") {
+				assertion.Attributes[name] = append(assertion.Attributes[name], strings.TrimSpace(value.Text()))
+			}
+		}
+	}
+
+	assertion.Email = assertion.NameId
+
+	if idp.config.EmailAttribute != "" {
+		assertion.Email = first(assertion.Attributes[idp.config.EmailAttribute])
+	}
+
+	if idp.config.NameAttribute != "" {
+		assertion.Name = first(assertion.Attributes[idp.config.NameAttribute])
+	}
+
+	idp.mutex.Lock()
+	defer idp.mutex.Unlock()
+
+	if inResponseTo != "" {
+		expiry, ok := idp.requests[inResponseTo]
+
+		if !ok || !now.Before(expiry) {
+			return Assertion{}, errors.New("assertion doesn't answer a login in progress")
+		}
+	} else if !idp.config.AllowIdpInitiated {
+		return Assertion{}, errors.New("logins begun by the identity provider aren't allowed")
+	}
+
+	if !remember(idp.consumed, assertion.Id, issued.Add(MaxAssertionAge+ClockSkew)) {
+		return Assertion{}, errors.New("assertion was already consumed")
+	}
+
+	delete(idp.requests, inResponseTo)
+
+	return assertion, nil
+}
+
+// checkConditions checks the assertion is within its validity period and restricted to this service provider.
+func (idp *IdentityProvider) checkConditions(conditions *etree.Element, now time.Time) error {
+	if conditions == nil {
+		return errors.New("assertion has no conditions")
+	}
+
+	if notBefore := conditions.SelectAttrValue("NotBefore", ""); notBefore != "" {
+		at, err := time.Parse(time.RFC3339, notBefore)
+
+		if err != nil || now.Add(ClockSkew).Before(at) {
+			return errors.New("assertion isn't valid yet")
+		}
+	}
+
+	if notOnOrAfter := conditions.SelectAttrValue("NotOnOrAfter", ""); notOnOrAfter != "" {
+		at, err := time.Parse(time.RFC3339, notOnOrAfter)
+
+		if err != nil || !now.Add(-ClockSkew).Before(at) {
+			return errors.New("assertion has expired")
+		}
+	}
+
+	restrictions := children(conditions, AssertionNamespace, "AudienceRestriction")
+
+	if len(restrictions) == 0 {
+		return errors.New("assertion isn't restricted to an audience")
+	}
+
+	// Every restriction must be met, each is met by any of its audiences.
+	for _, restriction := range restrictions {
+		met := false
+
+		for _, audience := range children(restriction, AssertionNamespace, "Audience") {
+			met = met || strings.TrimSpace(audience.Text()) == idp.EntityId()
+		}
+
+		if !met {
+			return errors.New("assertion wasn't issued for this service provider")
+		}
+	}
+
+	return nil
+}
+
+// checkConfirmation checks the subject is confirmed as the bearer of the assertion at our assertion consumer
+// service, returning the id of the request it answers.
+func (idp *IdentityProvider) checkConfirmation(subject *etree.Element, now time.Time) (string, error) {
+	for _, confirmation := range children(subject, AssertionNamespace, "SubjectConfirmation") {
+		data := child(confirmation, AssertionNamespace, "SubjectConfirmationData")
+
+		if confirmation.SelectAttrValue("Method", "") != BearerConfirmation || data == nil ||
+			data.SelectAttrValue("Recipient", "") != idp.AcsUrl() {
+			continue
+		}
+
+		notOnOrAfter, err := time.Parse(time.RFC3339, data.SelectAttrValue("NotOnOrAfter", ""))
+
+		if err != nil || !now.Add(-ClockSkew).Before(notOnOrAfter) {
+			continue
+		}
+
+		return data.SelectAttrValue("InResponseTo", ""), nil
+	}
+
+	return "", errors.New("subject isn't confirmed as the bearer of the assertion")
+}
+
+func is(el *etree.Element, namespace, tag string) bool {
+	return el != nil && el.Tag == tag && el.NamespaceURI() == namespace
+}
+
+func children(el *etree.Element, namespace, tag string) []*etree.Element {
+	if el == nil {
+		return nil
+	}
+
+	var matches []*etree.Element
+
+	for _, c := range el.ChildElements() {
+		if is(c, namespace, tag) {
+			matches = append(matches, c)
+		}
+	}
+
+	return matches
+}
+
+func child(el *etree.Element, namespace, tag string) *etree.Element {
+	matches := children(el, namespace, tag)
+
+	if len(matches) == 0 {
+		return nil
+	}
+
+	return matches[0]
+}
+
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+
+	return values[0]
+}
@@ -0,0 +1,214 @@
+package saml
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Namespaces of the SAML and XML signature elements read and written.
+const (
+	ProtocolNamespace  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	AssertionNamespace = "urn:oasis:names:tc:SAML:2.0:assertion"
+	MetadataNamespace  = "urn:oasis:names:tc:SAML:2.0:metadata"
+	SignatureNamespace = "http://www.w3.org/2000/09/xmldsig#"
+)
+
+// Bindings and formats the service provider supports.
+const (
+	HttpPostBinding     = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+	HttpRedirectBinding = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect"
+	EmailNameIdFormat   = "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"
+	BearerConfirmation  = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+	SuccessStatus       = "urn:oasis:names:tc:SAML:2.0:status:Success"
+)
+
+const (
+	// ClockSkew is how far the identity provider's clock may be from ours.
+	ClockSkew = 2 * time.Minute
+	// MaxAssertionAge is how long after it's issued an assertion is accepted, and remembered to refuse replays.
+	MaxAssertionAge = 5 * time.Minute
+	// RequestTimeout is how long a user has to complete a login the service provider began.
+	RequestTimeout = 10 * time.Minute
+)
+
+// IdentityProviderConfig is the configuration of an identity provider users can log in with.
+type IdentityProviderConfig struct {
+	// Name identifies the identity provider in URLs, such as okta in /saml/okta/acs.
+	Name string `json:"name"`
+	// TenantId restricts the identity provider to a tenant's users, any tenant's when empty.
+	TenantId string `json:"tenantId"`
+	// MetadataPath is the identity provider's metadata XML, relative to the configuration file.
+	MetadataPath string `json:"metadataPath"`
+	// BaseUrl overrides the service's base URL for this identity provider, such as to add a /tenant/{tenantId}
+	// prefix.
+	BaseUrl string `json:"baseUrl"`
+	// EmailAttribute names the attribute holding the user's email, the NameID is used when empty.
+	EmailAttribute string `json:"emailAttribute"`
+	// NameAttribute names the attribute holding the user's display name.
+	NameAttribute string `json:"nameAttribute"`
+	// AllowIdpInitiated accepts logins the identity provider began, which can't be tied to a request of ours.
+	AllowIdpInitiated bool `json:"allowIdpInitiated"`
+}
+
+// Config is the configuration of the service provider.
+type Config struct {
+	// BaseUrl is the absolute URL the service is reached at, entity ids and endpoints are located under it.
+	BaseUrl           string                   `json:"baseUrl"`
+	IdentityProviders []IdentityProviderConfig `json:"identityProviders"`
+}
+
+// ServiceProvider holds the identity providers users can log in with.
+type ServiceProvider struct {
+	idps map[string]*IdentityProvider
+}
+
+// NewServiceProvider constructs a ServiceProvider trusting the given identity providers.
+func NewServiceProvider(idps ...*IdentityProvider) (*ServiceProvider, error) {
+	sp := &ServiceProvider{idps: make(map[string]*IdentityProvider)}
+
+	for _, idp := range idps {
+		if _, ok := sp.idps[idp.config.Name]; ok {
+			return nil, errors.New(fmt.Sprintf("identity provider %s is configured more than once",
+				idp.config.Name))
+		}
+
+		sp.idps[idp.config.Name] = idp
+	}
+
+	return sp, nil
+}
+
+// LoadServiceProvider reads the service provider's JSON configuration and the metadata of its identity providers,
+// no identity providers are trusted when path is empty.
+func LoadServiceProvider(path string) (*ServiceProvider, error) {
+	if path == "" {
+		return NewServiceProvider()
+	}
+
+	src, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var config Config
+	err = json.Unmarshal(src, &config)
+
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("invalid SAML configuration: %s", err.Error()))
+	}
+
+	idps := make([]*IdentityProvider, 0, len(config.IdentityProviders))
+
+	for _, idpConfig := range config.IdentityProviders {
+		if idpConfig.BaseUrl == "" {
+			idpConfig.BaseUrl = config.BaseUrl
+		}
+
+		metadataPath := idpConfig.MetadataPath
+
+		if !filepath.IsAbs(metadataPath) {
+			metadataPath = filepath.Join(filepath.Dir(path), metadataPath)
+		}
+
+		metadata, err := ioutil.ReadFile(metadataPath)
+
+		if err != nil {
+			return nil, err
+		}
+
+		idp, err := NewIdentityProvider(idpConfig, metadata)
+
+		if err != nil {
+			return nil, err
+		}
+
+		idps = append(idps, idp)
+	}
+
+	return NewServiceProvider(idps...)
+}
+
+// IdentityProvider finds a trusted identity provider by name.
+func (sp *ServiceProvider) IdentityProvider(name string) (*IdentityProvider, bool) {
+	idp, ok := sp.idps[name]
+	return idp, ok
+}
+
+// IdentityProvider is an identity provider trusted to assert who users are, along with the logins begun with it
+// and the assertions it has issued that were already consumed.
+type IdentityProvider struct {
+	config   IdentityProviderConfig
+	entityId string
+	ssoUrl   string
+	certs    []*x509.Certificate
+	mutex    sync.Mutex
+	requests map[string]time.Time
+	consumed map[string]time.Time
+}
+
+// NewIdentityProvider constructs an IdentityProvider from its configuration and metadata XML.
+func NewIdentityProvider(config IdentityProviderConfig, metadata []byte) (*IdentityProvider, error) {
+	if config.Name == "" {
+		return nil, errors.New("identity provider name is required")
+	} else if config.BaseUrl == "" {
+		return nil, errors.New(fmt.Sprintf("identity provider %s requires a base url", config.Name))
+	}
+
+	config.BaseUrl = strings.TrimSuffix(config.BaseUrl, "/")
+	idp := &IdentityProvider{config: config, requests: make(map[string]time.Time),
+		consumed: make(map[string]time.Time)}
+
+	err := idp.readMetadata(metadata)
+
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("invalid metadata for identity provider %s: %s", config.Name,
+			err.Error()))
+	}
+
+	return idp, nil
+}
+
+// TenantId is the tenant the identity provider is restricted to, empty when it serves every tenant.
+func (idp *IdentityProvider) TenantId() string {
+	return idp.config.TenantId
+}
+
+// EntityId is the service provider's entity id for this identity provider, which is its metadata URL.
+func (idp *IdentityProvider) EntityId() string {
+	return idp.config.BaseUrl + "/saml/" + idp.config.Name + "/metadata"
+}
+
+// AcsUrl is the URL of the assertion consumer service the identity provider POSTs responses to.
+func (idp *IdentityProvider) AcsUrl() string {
+	return idp.config.BaseUrl + "/saml/" + idp.config.Name + "/acs"
+}
+
+// remember records an id until it expires, returning false when it's already remembered. Expired ids are forgotten
+// as others are remembered.
+func remember(ids map[string]time.Time, id string, expires time.Time) bool {
+	now := time.Now()
+
+	if expiry, ok := ids[id]; ok && now.Before(expiry) {
+		return false
+	}
+
+	forgetExpired(ids, now)
+	ids[id] = expires
+	return true
+}
+
+func forgetExpired(ids map[string]time.Time, now time.Time) {
+	for id, expiry := range ids {
+		if !now.Before(expiry) {
+			delete(ids, id)
+		}
+	}
+}
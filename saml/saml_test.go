@@ -0,0 +1,339 @@
+package saml_test
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/base64"
+	"fmt"
+	"github.com/beevik/etree"
+	"github.com/russellhaering/goxmldsig"
+	"github.com/stone1549/auth-service/saml"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testIdpEntityId = "https://idp.example.com/metadata"
+	testBaseUrl     = "https://auth.example.com"
+	testEntityId    = testBaseUrl + "/saml/okta/metadata"
+	testAcsUrl      = testBaseUrl + "/saml/okta/acs"
+)
+
+// testIdp is an identity provider signing responses with a random key.
+type testIdp struct {
+	keyStore dsig.X509KeyStore
+	cert     []byte
+}
+
+func newTestIdp(t *testing.T) *testIdp {
+	keyStore := dsig.RandomKeyStoreForTest()
+	_, cert, err := keyStore.GetKeyPair()
+	ok(t, err)
+	return &testIdp{keyStore: keyStore, cert: cert}
+}
+
+func (ti *testIdp) metadata() []byte {
+	return []byte(fmt.Sprintf(`<?xml version="1.0"?>
+<md:EntityDescriptor xmlns:md="urn:oasis:names:tc:SAML:2.0:metadata" entityID="%s">
+  <md:IDPSSODescriptor protocolSupportEnumeration="urn:oasis:names:tc:SAML:2.0:protocol">
+    <md:KeyDescriptor use="signing">
+      <ds:KeyInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#">
+        <ds:X509Data><ds:X509Certificate>%s</ds:X509Certificate></ds:X509Data>
+      </ds:KeyInfo>
+    </md:KeyDescriptor>
+    <md:SingleSignOnService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect"
+      Location="https://idp.example.com/sso"/>
+  </md:IDPSSODescriptor>
+</md:EntityDescriptor>`, testIdpEntityId, base64.StdEncoding.EncodeToString(ti.cert)))
+}
+
+func (ti *testIdp) identityProvider(t *testing.T, allowIdpInitiated bool) *saml.IdentityProvider {
+	idp, err := saml.NewIdentityProvider(saml.IdentityProviderConfig{
+		Name:              "okta",
+		BaseUrl:           testBaseUrl,
+		EmailAttribute:    "email",
+		NameAttribute:     "displayName",
+		AllowIdpInitiated: allowIdpInitiated,
+	}, ti.metadata())
+	ok(t, err)
+	return idp
+}
+
+// response describes the response to build, zero values are valid.
+type response struct {
+	id           string
+	inResponseTo string
+	issuer       string
+	audience     string
+	recipient    string
+	issued       time.Time
+	notOnOrAfter time.Time
+	signResponse bool
+	unsigned     bool
+}
+
+func (ti *testIdp) response(t *testing.T, options response) string {
+	now := time.Now().UTC()
+
+	if options.id == "" {
+		options.id = fmt.Sprintf("_assertion%d", now.UnixNano())
+	}
+
+	if options.issuer == "" {
+		options.issuer = testIdpEntityId
+	}
+
+	if options.audience == "" {
+		options.audience = testEntityId
+	}
+
+	if options.recipient == "" {
+		options.recipient = testAcsUrl
+	}
+
+	if options.issued.IsZero() {
+		options.issued = now
+	}
+
+	if options.notOnOrAfter.IsZero() {
+		options.notOnOrAfter = now.Add(5 * time.Minute)
+	}
+
+	assertionDoc := etree.NewDocument()
+	err := assertionDoc.ReadFromString(fmt.Sprintf(`<saml:Assertion xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="%s" Version="2.0" IssueInstant="%s">
+<saml:Issuer>%s</saml:Issuer>
+<saml:Subject>
+  <saml:NameID Format="urn:oasis:names:tc:SAML:2.0:nameid-format:persistent">00u1jane</saml:NameID>
+  <saml:SubjectConfirmation Method="urn:oasis:names:tc:SAML:2.0:cm:bearer">
+    <saml:SubjectConfirmationData InResponseTo="%s" Recipient="%s" NotOnOrAfter="%s"/>
+  </saml:SubjectConfirmation>
+</saml:Subject>
+<saml:Conditions NotBefore="%s" NotOnOrAfter="%s">
+  <saml:AudienceRestriction><saml:Audience>%s</saml:Audience></saml:AudienceRestriction>
+</saml:Conditions>
+<saml:AuthnStatement AuthnInstant="%s" SessionIndex="_session"/>
+<saml:AttributeStatement>
+  <saml:Attribute Name="email"><saml:AttributeValue>jane@example.com</saml:AttributeValue></saml:Attribute>
+  <saml:Attribute Name="displayName"><saml:AttributeValue>Jane Doe</saml:AttributeValue></saml:Attribute>
+</saml:AttributeStatement>
+</saml:Assertion>`, options.id, options.issued.Format(time.RFC3339), options.issuer, options.inResponseTo,
+		options.recipient, options.notOnOrAfter.Format(time.RFC3339), options.issued.Format(time.RFC3339),
+		options.notOnOrAfter.Format(time.RFC3339), options.audience, options.issued.Format(time.RFC3339)))
+	ok(t, err)
+
+	// Identity providers sign with exclusive canonicalization, so signatures survive embedding the assertion.
+	signer := dsig.NewDefaultSigningContext(ti.keyStore)
+	signer.Canonicalizer = dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList("")
+	assertion := assertionDoc.Root()
+
+	if !options.signResponse && !options.unsigned {
+		assertion, err = signer.SignEnveloped(assertion)
+		ok(t, err)
+	}
+
+	responseDoc := etree.NewDocument()
+	err = responseDoc.ReadFromString(fmt.Sprintf(`<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" ID="_response%d" Version="2.0" IssueInstant="%s" Destination="%s">
+<samlp:Status><samlp:StatusCode Value="urn:oasis:names:tc:SAML:2.0:status:Success"/></samlp:Status>
+</samlp:Response>`, now.UnixNano(), now.Format(time.RFC3339), testAcsUrl))
+	ok(t, err)
+
+	root := responseDoc.Root()
+	root.AddChild(assertion)
+
+	if options.signResponse {
+		root, err = signer.SignEnveloped(root)
+		ok(t, err)
+		responseDoc.SetRoot(root)
+	}
+
+	src, err := responseDoc.WriteToBytes()
+	ok(t, err)
+	return base64.StdEncoding.EncodeToString(src)
+}
+
+// requestId begins a login and returns the id of the authentication request the user was sent with.
+func requestId(t *testing.T, idp *saml.IdentityProvider) string {
+	loginUrl, err := idp.LoginUrl()
+	ok(t, err)
+	parsed, err := url.Parse(loginUrl)
+	ok(t, err)
+	equals(t, "idp.example.com", parsed.Host)
+
+	deflated, err := base64.StdEncoding.DecodeString(parsed.Query().Get("SAMLRequest"))
+	ok(t, err)
+	src, err := ioutil.ReadAll(flate.NewReader(bytes.NewReader(deflated)))
+	ok(t, err)
+
+	doc := etree.NewDocument()
+	ok(t, doc.ReadFromBytes(src))
+	equals(t, testAcsUrl, doc.Root().SelectAttrValue("AssertionConsumerServiceURL", ""))
+	equals(t, testEntityId, doc.Root().SelectElement("Issuer").Text())
+	return doc.Root().SelectAttrValue("ID", "")
+}
+
+// TestIdentityProvider_ParseResponse ensures a response to a login we began is accepted once, whether its assertion
+// or the response itself is signed.
+func TestIdentityProvider_ParseResponse(t *testing.T) {
+	ti := newTestIdp(t)
+	idp := ti.identityProvider(t, false)
+
+	encoded := ti.response(t, response{id: "_jane", inResponseTo: requestId(t, idp)})
+	assertion, err := idp.ParseResponse(encoded)
+	ok(t, err)
+	equals(t, saml.Assertion{
+		Id:           "_jane",
+		NameId:       "00u1jane",
+		NameIdFormat: "urn:oasis:names:tc:SAML:2.0:nameid-format:persistent",
+		SessionIndex: "_session",
+		Email:        "jane@example.com",
+		Name:         "Jane Doe",
+		Attributes:   map[string][]string{"email": {"jane@example.com"}, "displayName": {"Jane Doe"}},
+	}, assertion)
+
+	_, err = idp.ParseResponse(encoded)
+	notOk(t, err)
+
+	assertion, err = idp.ParseResponse(ti.response(t, response{inResponseTo: requestId(t, idp),
+		signResponse: true}))
+	ok(t, err)
+	equals(t, "jane@example.com", assertion.Email)
+}
+
+// TestIdentityProvider_ParseResponseInvalid ensures responses are refused unless they're signed by the identity
+// provider, issued for this service provider, within their conditions and answer a login we began.
+func TestIdentityProvider_ParseResponseInvalid(t *testing.T) {
+	ti := newTestIdp(t)
+	idp := ti.identityProvider(t, false)
+	now := time.Now()
+
+	for _, options := range []response{
+		{unsigned: true},
+		{issuer: "https://evil.example.com"},
+		{audience: "https://other.example.com"},
+		{recipient: "https://other.example.com/acs"},
+		{notOnOrAfter: now.Add(-10 * time.Minute)},
+		{issued: now.Add(-time.Hour), notOnOrAfter: now.Add(time.Hour)},
+		{issued: now.Add(time.Hour), notOnOrAfter: now.Add(2 * time.Hour)},
+	} {
+		options.inResponseTo = requestId(t, idp)
+		_, err := idp.ParseResponse(ti.response(t, options))
+		notOk(t, err)
+	}
+
+	_, err := idp.ParseResponse(ti.response(t, response{}))
+	notOk(t, err)
+
+	_, err = idp.ParseResponse(ti.response(t, response{inResponseTo: "_unknown"}))
+	notOk(t, err)
+
+	_, err = newTestIdp(t).identityProvider(t, true).ParseResponse(ti.response(t, response{}))
+	notOk(t, err)
+
+	tampered, err := base64.StdEncoding.DecodeString(ti.response(t, response{inResponseTo: requestId(t, idp)}))
+	ok(t, err)
+	_, err = idp.ParseResponse(base64.StdEncoding.EncodeToString(
+		[]byte(strings.Replace(string(tampered), "jane@example.com", "admin@example.com", 1))))
+	notOk(t, err)
+
+	_, err = idp.ParseResponse("not base64")
+	notOk(t, err)
+}
+
+// TestIdentityProvider_IdpInitiated ensures logins the identity provider began are accepted only when allowed.
+func TestIdentityProvider_IdpInitiated(t *testing.T) {
+	ti := newTestIdp(t)
+
+	assertion, err := ti.identityProvider(t, true).ParseResponse(ti.response(t, response{}))
+	ok(t, err)
+	equals(t, "jane@example.com", assertion.Email)
+}
+
+// TestIdentityProvider_Metadata ensures the service provider's metadata names its entity id and assertion consumer
+// service.
+func TestIdentityProvider_Metadata(t *testing.T) {
+	idp := newTestIdp(t).identityProvider(t, false)
+	metadata, err := idp.Metadata()
+	ok(t, err)
+
+	doc := etree.NewDocument()
+	ok(t, doc.ReadFromBytes(metadata))
+	equals(t, testEntityId, doc.Root().SelectAttrValue("entityID", ""))
+
+	acs := doc.Root().FindElement("./SPSSODescriptor/AssertionConsumerService")
+	assert(t, acs != nil, "expected an assertion consumer service")
+	equals(t, saml.HttpPostBinding, acs.SelectAttrValue("Binding", ""))
+	equals(t, testAcsUrl, acs.SelectAttrValue("Location", ""))
+}
+
+// TestLoadServiceProvider ensures identity providers are loaded with metadata relative to the configuration, and
+// refused when their metadata is invalid.
+func TestLoadServiceProvider(t *testing.T) {
+	sp, err := saml.LoadServiceProvider("")
+	ok(t, err)
+	_, found := sp.IdentityProvider("okta")
+	equals(t, false, found)
+
+	dir, err := ioutil.TempDir("", "saml")
+	ok(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "saml.json")
+	ok(t, ioutil.WriteFile(filepath.Join(dir, "okta.xml"), newTestIdp(t).metadata(), 0600))
+	ok(t, ioutil.WriteFile(path, []byte(`{"baseUrl": "https://auth.example.com", "identityProviders": [`+
+		`{"name": "okta", "tenantId": "acme", "metadataPath": "okta.xml"}]}`), 0600))
+
+	sp, err = saml.LoadServiceProvider(path)
+	ok(t, err)
+	idp, found := sp.IdentityProvider("okta")
+	equals(t, true, found)
+	equals(t, "acme", idp.TenantId())
+	equals(t, testAcsUrl, idp.AcsUrl())
+
+	ok(t, ioutil.WriteFile(filepath.Join(dir, "okta.xml"), []byte(`<md:EntityDescriptor `+
+		`xmlns:md="urn:oasis:names:tc:SAML:2.0:metadata" entityID="x"/>`), 0600))
+	_, err = saml.LoadServiceProvider(path)
+	notOk(t, err)
+}
+
+// assert fails the test if the condition is false.
+func assert(tb testing.TB, condition bool, msg string, v ...interface{}) {
+	if !condition {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: "+msg+"\033[39m\n\n", append([]interface{}{filepath.Base(file), line}, v...)...)
+		tb.FailNow()
+	}
+}
+
+// ok fails the test if an err is not nil.
+func ok(tb testing.TB, err error) {
+	if err != nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: unexpected error: %s\033[39m\n\n", filepath.Base(file), line, err.Error())
+		tb.FailNow()
+	}
+}
+
+// notOk fails the test if an err is nil.
+func notOk(tb testing.TB, err error) {
+	if err == nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: expected error\033[39m\n\n", filepath.Base(file), line)
+		tb.FailNow()
+	}
+}
+
+// equals fails the test if exp is not equal to act.
+func equals(tb testing.TB, exp, act interface{}) {
+	if !reflect.DeepEqual(exp, act) {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d:\n\n\texp: %#v\n\n\tgot: %#v\033[39m\n\n", filepath.Base(file), line, exp, act)
+		tb.FailNow()
+	}
+}
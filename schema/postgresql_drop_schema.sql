@@ -1,4 +1,37 @@
-DROP INDEX login_email_idx;
+DROP TABLE login_device;
+
+DROP INDEX login_session_expires_at_idx;
+DROP INDEX login_session_user_id_idx;
+DROP TABLE login_session;
+
+DROP INDEX outbox_unpublished_idx;
+DROP TABLE outbox;
+
+DROP INDEX webhook_delivery_tenant_id_status_idx;
+DROP INDEX webhook_delivery_due_idx;
+DROP TRIGGER webhook_delivery_set_updated_at_trg ON webhook_delivery;
+DROP TABLE webhook_delivery;
+
+DROP INDEX webhook_tenant_id_idx;
+DROP TABLE webhook;
+
+DROP INDEX audit_event_user_id_idx;
+DROP INDEX audit_event_tenant_id_created_at_idx;
+DROP TABLE audit_event;
+
+DROP INDEX relation_tuple_subject_idx;
+DROP TABLE relation_tuple;
+
+DROP INDEX login_group_group_member_group_id_idx;
+DROP TABLE login_group_group;
+
+DROP INDEX login_group_user_login_id_idx;
+DROP TABLE login_group_user;
+
+DROP TRIGGER login_group_set_updated_at_trg ON login_group;
+DROP TABLE login_group;
+
+DROP INDEX login_tenant_id_email_idx;
 DROP INDEX login_created_at_idx;
 DROP INDEX login_updated_at_idx;
 
@@ -1,12 +1,20 @@
 CREATE TABLE login (
   id text PRIMARY KEY,
-  email text UNIQUE NOT NULL,
+  tenant_id text NOT NULL DEFAULT 'default',
+  email text NOT NULL,
   salted_hash text NOT NULL,
+  external_id text,
+  given_name text,
+  family_name text,
+  display_name text,
+  active boolean NOT NULL DEFAULT true,
+  attributes jsonb NOT NULL DEFAULT '{}',
   created_at TIMESTAMP WITHOUT TIME ZONE DEFAULT (NOW() AT TIME ZONE 'UTC'),
-  updated_at TIMESTAMP WITHOUT TIME ZONE DEFAULT (NOW() AT TIME ZONE 'UTC')
+  updated_at TIMESTAMP WITHOUT TIME ZONE DEFAULT (NOW() AT TIME ZONE 'UTC'),
+  UNIQUE (tenant_id, email)
 );
 
-CREATE INDEX login_email_idx ON login (email);
+CREATE INDEX login_tenant_id_email_idx ON login (tenant_id, email);
 CREATE INDEX login_created_at_idx ON login (created_at);
 CREATE INDEX login_updated_at_idx ON login (updated_at);
 
@@ -22,3 +30,141 @@ CREATE TRIGGER login_set_updated_at_trg
   BEFORE UPDATE ON login
   FOR EACH ROW
 EXECUTE PROCEDURE set_updated_at();
+
+CREATE TABLE login_group (
+  id text PRIMARY KEY,
+  tenant_id text NOT NULL,
+  name text NOT NULL,
+  description text NOT NULL DEFAULT '',
+  created_at TIMESTAMP WITHOUT TIME ZONE DEFAULT (NOW() AT TIME ZONE 'UTC'),
+  updated_at TIMESTAMP WITHOUT TIME ZONE DEFAULT (NOW() AT TIME ZONE 'UTC'),
+  UNIQUE (tenant_id, name)
+);
+
+CREATE TRIGGER login_group_set_updated_at_trg
+  BEFORE UPDATE ON login_group
+  FOR EACH ROW
+EXECUTE PROCEDURE set_updated_at();
+
+CREATE TABLE login_group_user (
+  group_id text NOT NULL REFERENCES login_group (id) ON DELETE CASCADE,
+  login_id text NOT NULL REFERENCES login (id) ON DELETE CASCADE,
+  PRIMARY KEY (group_id, login_id)
+);
+
+CREATE INDEX login_group_user_login_id_idx ON login_group_user (login_id);
+
+CREATE TABLE login_group_group (
+  group_id text NOT NULL REFERENCES login_group (id) ON DELETE CASCADE,
+  member_group_id text NOT NULL REFERENCES login_group (id) ON DELETE CASCADE,
+  PRIMARY KEY (group_id, member_group_id),
+  CHECK (group_id <> member_group_id)
+);
+
+CREATE INDEX login_group_group_member_group_id_idx ON login_group_group (member_group_id);
+
+CREATE TABLE relation_tuple (
+  tenant_id text NOT NULL,
+  object text NOT NULL,
+  relation text NOT NULL,
+  subject text NOT NULL,
+  created_at TIMESTAMP WITHOUT TIME ZONE DEFAULT (NOW() AT TIME ZONE 'UTC'),
+  PRIMARY KEY (tenant_id, object, relation, subject)
+);
+
+CREATE INDEX relation_tuple_subject_idx ON relation_tuple (tenant_id, subject);
+
+CREATE TABLE audit_event (
+  id text PRIMARY KEY,
+  tenant_id text NOT NULL,
+  type text NOT NULL,
+  actor_id text,
+  user_id text,
+  email text,
+  success boolean NOT NULL,
+  reason text,
+  remote_addr text,
+  request_id text,
+  details jsonb,
+  created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL
+);
+
+CREATE INDEX audit_event_tenant_id_created_at_idx ON audit_event (tenant_id, created_at);
+CREATE INDEX audit_event_user_id_idx ON audit_event (tenant_id, user_id);
+
+CREATE TABLE webhook (
+  id text PRIMARY KEY,
+  tenant_id text NOT NULL,
+  url text NOT NULL,
+  secret text NOT NULL,
+  events text[] NOT NULL,
+  created_at TIMESTAMP WITHOUT TIME ZONE DEFAULT (NOW() AT TIME ZONE 'UTC')
+);
+
+CREATE INDEX webhook_tenant_id_idx ON webhook (tenant_id);
+
+CREATE TABLE webhook_delivery (
+  id text PRIMARY KEY,
+  tenant_id text NOT NULL,
+  webhook_id text NOT NULL REFERENCES webhook (id) ON DELETE CASCADE,
+  event_type text NOT NULL,
+  payload jsonb NOT NULL,
+  status text NOT NULL CHECK (status IN ('pending', 'delivered', 'dead')),
+  attempts integer NOT NULL DEFAULT 0,
+  last_error text,
+  next_attempt_at TIMESTAMP WITHOUT TIME ZONE NOT NULL,
+  created_at TIMESTAMP WITHOUT TIME ZONE DEFAULT (NOW() AT TIME ZONE 'UTC'),
+  updated_at TIMESTAMP WITHOUT TIME ZONE DEFAULT (NOW() AT TIME ZONE 'UTC')
+);
+
+CREATE TRIGGER webhook_delivery_set_updated_at_trg
+  BEFORE UPDATE ON webhook_delivery
+  FOR EACH ROW
+EXECUTE PROCEDURE set_updated_at();
+
+CREATE INDEX webhook_delivery_due_idx ON webhook_delivery (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX webhook_delivery_tenant_id_status_idx ON webhook_delivery (tenant_id, status, created_at);
+
+CREATE TABLE outbox (
+  id text PRIMARY KEY,
+  tenant_id text NOT NULL,
+  aggregate_id text NOT NULL,
+  event_type text NOT NULL,
+  payload jsonb NOT NULL,
+  attempts integer NOT NULL DEFAULT 0,
+  last_error text,
+  next_attempt_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT (NOW() AT TIME ZONE 'UTC'),
+  published_at TIMESTAMP WITHOUT TIME ZONE,
+  dead_at TIMESTAMP WITHOUT TIME ZONE,
+  created_at TIMESTAMP WITHOUT TIME ZONE DEFAULT (NOW() AT TIME ZONE 'UTC')
+);
+
+CREATE INDEX outbox_unpublished_idx ON outbox (next_attempt_at) WHERE published_at IS NULL AND dead_at IS NULL;
+
+CREATE TABLE login_session (
+  id text PRIMARY KEY,
+  tenant_id text NOT NULL,
+  user_id text NOT NULL,
+  remote_addr text,
+  user_agent text,
+  device_label text,
+  remember_me boolean NOT NULL DEFAULT false,
+  created_at TIMESTAMP WITHOUT TIME ZONE DEFAULT (NOW() AT TIME ZONE 'UTC'),
+  last_seen_at TIMESTAMP WITHOUT TIME ZONE DEFAULT (NOW() AT TIME ZONE 'UTC'),
+  idle_timeout_seconds integer NOT NULL DEFAULT 0,
+  expires_at TIMESTAMP WITHOUT TIME ZONE
+);
+
+CREATE INDEX login_session_user_id_idx ON login_session (tenant_id, user_id);
+CREATE INDEX login_session_expires_at_idx ON login_session (expires_at);
+
+CREATE TABLE login_device (
+  tenant_id text NOT NULL,
+  user_id text NOT NULL,
+  fingerprint text NOT NULL,
+  label text NOT NULL,
+  network text NOT NULL,
+  first_seen_at TIMESTAMP WITHOUT TIME ZONE DEFAULT (NOW() AT TIME ZONE 'UTC'),
+  last_seen_at TIMESTAMP WITHOUT TIME ZONE DEFAULT (NOW() AT TIME ZONE 'UTC'),
+  PRIMARY KEY (tenant_id, user_id, fingerprint)
+);
@@ -0,0 +1,202 @@
+package scim
+
+// Supported describes whether an optional feature is supported.
+type Supported struct {
+	Supported bool `json:"supported"`
+}
+
+// FilterSupport describes filtering support.
+type FilterSupport struct {
+	Supported  bool `json:"supported"`
+	MaxResults int  `json:"maxResults"`
+}
+
+// BulkSupport describes bulk operation support.
+type BulkSupport struct {
+	Supported      bool `json:"supported"`
+	MaxOperations  int  `json:"maxOperations"`
+	MaxPayloadSize int  `json:"maxPayloadSize"`
+}
+
+// AuthenticationScheme describes how clients authenticate.
+type AuthenticationScheme struct {
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Primary     bool   `json:"primary"`
+}
+
+// ServiceProviderConfig describes the SCIM features the service supports.
+type ServiceProviderConfig struct {
+	Schemas               []string               `json:"schemas"`
+	Patch                 Supported              `json:"patch"`
+	Bulk                  BulkSupport            `json:"bulk"`
+	Filter                FilterSupport          `json:"filter"`
+	ChangePassword        Supported              `json:"changePassword"`
+	Sort                  Supported              `json:"sort"`
+	Etag                  Supported              `json:"etag"`
+	AuthenticationSchemes []AuthenticationScheme `json:"authenticationSchemes"`
+	Meta                  Meta                   `json:"meta"`
+}
+
+// SchemaExtension names a schema extending the resources of a resource type.
+type SchemaExtension struct {
+	Schema   string `json:"schema"`
+	Required bool   `json:"required"`
+}
+
+// ResourceType describes an endpoint and the schema of its resources.
+type ResourceType struct {
+	Schemas          []string          `json:"schemas"`
+	Id               string            `json:"id"`
+	Name             string            `json:"name"`
+	Endpoint         string            `json:"endpoint"`
+	Description      string            `json:"description"`
+	Schema           string            `json:"schema"`
+	SchemaExtensions []SchemaExtension `json:"schemaExtensions,omitempty"`
+	Meta             Meta              `json:"meta"`
+}
+
+// Attribute describes an attribute of a schema.
+type Attribute struct {
+	Name          string      `json:"name"`
+	Type          string      `json:"type"`
+	MultiValued   bool        `json:"multiValued"`
+	Required      bool        `json:"required"`
+	CaseExact     bool        `json:"caseExact"`
+	Mutability    string      `json:"mutability"`
+	Returned      string      `json:"returned"`
+	Uniqueness    string      `json:"uniqueness"`
+	SubAttributes []Attribute `json:"subAttributes,omitempty"`
+}
+
+// Schema describes the attributes of a resource.
+type Schema struct {
+	Schemas     []string    `json:"schemas"`
+	Id          string      `json:"id"`
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Attributes  []Attribute `json:"attributes"`
+	Meta        Meta        `json:"meta"`
+}
+
+func attribute(name, attributeType string, required bool, uniqueness string) Attribute {
+	return Attribute{
+		Name:       name,
+		Type:       attributeType,
+		Required:   required,
+		Mutability: "readWrite",
+		Returned:   "default",
+		Uniqueness: uniqueness,
+	}
+}
+
+func multiValued(name string, subAttributes ...Attribute) Attribute {
+	multi := attribute(name, "complex", false, "none")
+	multi.MultiValued = true
+	multi.SubAttributes = subAttributes
+	return multi
+}
+
+// NewServiceProviderConfig describes the service's SCIM features, located under the SCIM base URL.
+func NewServiceProviderConfig(baseUrl string) ServiceProviderConfig {
+	return ServiceProviderConfig{
+		Schemas: []string{ServiceProviderConfigSchema},
+		Patch:   Supported{true},
+		Filter:  FilterSupport{Supported: true, MaxResults: MaxCount},
+		AuthenticationSchemes: []AuthenticationScheme{{
+			Type:        "oauthbearertoken",
+			Name:        "Service token",
+			Description: "Authentication with a bearer service token",
+			Primary:     true,
+		}},
+		ChangePassword: Supported{true},
+		Meta:           Meta{ResourceType: "ServiceProviderConfig", Location: baseUrl + "/ServiceProviderConfig"},
+	}
+}
+
+// NewResourceTypes describes the user and group endpoints, located under the SCIM base URL.
+func NewResourceTypes(baseUrl string) []ResourceType {
+	return []ResourceType{
+		{
+			Schemas:          []string{ResourceTypeSchema},
+			Id:               UserMember,
+			Name:             UserMember,
+			Endpoint:         "/Users",
+			Description:      "User Account",
+			Schema:           UserSchema,
+			SchemaExtensions: []SchemaExtension{{Schema: AttributesSchema}},
+			Meta:             Meta{ResourceType: "ResourceType", Location: baseUrl + "/ResourceTypes/User"},
+		},
+		{
+			Schemas:     []string{ResourceTypeSchema},
+			Id:          GroupMember,
+			Name:        GroupMember,
+			Endpoint:    "/Groups",
+			Description: "Group",
+			Schema:      GroupSchema,
+			Meta:        Meta{ResourceType: "ResourceType", Location: baseUrl + "/ResourceTypes/Group"},
+		},
+	}
+}
+
+// NewSchemas describes the supported attributes of users and groups, located under the SCIM base URL.
+func NewSchemas(baseUrl string) []Schema {
+	password := attribute("password", "string", false, "none")
+	password.Mutability = "writeOnly"
+	password.Returned = "never"
+
+	id := attribute("id", "string", false, "server")
+	id.Mutability = "readOnly"
+	id.Returned = "always"
+	id.CaseExact = true
+
+	name := attribute("name", "complex", false, "none")
+	name.SubAttributes = []Attribute{
+		attribute("formatted", "string", false, "none"),
+		attribute("givenName", "string", false, "none"),
+		attribute("familyName", "string", false, "none"),
+	}
+
+	return []Schema{
+		{
+			Schemas:     []string{SchemaSchema},
+			Id:          UserSchema,
+			Name:        UserMember,
+			Description: "User Account",
+			Attributes: []Attribute{
+				id,
+				attribute("externalId", "string", false, "none"),
+				attribute("userName", "string", true, "server"),
+				name,
+				attribute("displayName", "string", false, "none"),
+				multiValued("emails", attribute("value", "string", false, "none"),
+					attribute("type", "string", false, "none"), attribute("primary", "boolean", false, "none")),
+				attribute("active", "boolean", false, "none"),
+				password,
+			},
+			Meta: Meta{ResourceType: "Schema", Location: baseUrl + "/Schemas/" + UserSchema},
+		},
+		{
+			Schemas:     []string{SchemaSchema},
+			Id:          AttributesSchema,
+			Name:        "Attributes",
+			Description: "Further string attributes of a user, such as their region, named as the client chooses",
+			Attributes:  []Attribute{},
+			Meta:        Meta{ResourceType: "Schema", Location: baseUrl + "/Schemas/" + AttributesSchema},
+		},
+		{
+			Schemas:     []string{SchemaSchema},
+			Id:          GroupSchema,
+			Name:        GroupMember,
+			Description: "Group",
+			Attributes: []Attribute{
+				id,
+				attribute("displayName", "string", true, "server"),
+				multiValued("members", attribute("value", "string", false, "none"),
+					attribute("type", "string", false, "none"), attribute("$ref", "reference", false, "none")),
+			},
+			Meta: Meta{ResourceType: "Schema", Location: baseUrl + "/Schemas/" + GroupSchema},
+		},
+	}
+}
@@ -0,0 +1,427 @@
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Filter selects resources, represented as decoded JSON objects, as described by RFC 7644 section 3.4.2.2.
+type Filter interface {
+	// Matches reports whether the resource satisfies the filter.
+	Matches(resource map[string]interface{}) bool
+}
+
+type logicalFilter struct {
+	and         bool
+	left, right Filter
+}
+
+func (lf logicalFilter) Matches(resource map[string]interface{}) bool {
+	if lf.and {
+		return lf.left.Matches(resource) && lf.right.Matches(resource)
+	}
+
+	return lf.left.Matches(resource) || lf.right.Matches(resource)
+}
+
+type notFilter struct {
+	filter Filter
+}
+
+func (nf notFilter) Matches(resource map[string]interface{}) bool {
+	return !nf.filter.Matches(resource)
+}
+
+type compareFilter struct {
+	path  []string
+	op    string
+	value interface{}
+}
+
+func (cf compareFilter) Matches(resource map[string]interface{}) bool {
+	for _, value := range resolve(resource, cf.path) {
+		if (cf.op == "pr" && value != "") || compare(value, cf.op, cf.value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type valuePathFilter struct {
+	attribute string
+	filter    Filter
+}
+
+func (vpf valuePathFilter) Matches(resource map[string]interface{}) bool {
+	for _, value := range values(lookup(resource, vpf.attribute)) {
+		if element, ok := value.(map[string]interface{}); ok && vpf.filter.Matches(element) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ParseFilter parses a filter expression such as:
+//
+//	userName eq "jane@example.com" and (emails[type eq "work" and value co "@example.com"] or not (active pr))
+//
+// Attribute names are case insensitive and may be prefixed with their schema URN. String comparisons ignore case.
+func ParseFilter(src string) (Filter, error) {
+	tokens, err := tokenize(src)
+
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	filter, err := p.or()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.done() {
+		return nil, errors.New(fmt.Sprintf("unexpected %q", p.peek()))
+	}
+
+	return filter, nil
+}
+
+func tokenize(src string) ([]string, error) {
+	tokens := make([]string, 0)
+	runes := []rune(src)
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+
+		switch {
+		case unicode.IsSpace(r):
+		case strings.ContainsRune("()[]", r):
+			tokens = append(tokens, string(r))
+		case r == '"':
+			start := i
+
+			for i++; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' {
+					i++
+				}
+			}
+
+			if i >= len(runes) {
+				return nil, errors.New("unterminated string")
+			}
+
+			tokens = append(tokens, string(runes[start:i+1]))
+		default:
+			start := i
+
+			for i+1 < len(runes) && !unicode.IsSpace(runes[i+1]) && !strings.ContainsRune("()[]\"", runes[i+1]) {
+				i++
+			}
+
+			tokens = append(tokens, string(runes[start:i+1]))
+		}
+	}
+
+	return tokens, nil
+}
+
+type parser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *parser) peek() string {
+	if p.done() {
+		return ""
+	}
+
+	return p.tokens[p.pos]
+}
+
+func (p *parser) keyword(word string) bool {
+	if strings.EqualFold(p.peek(), word) {
+		p.pos++
+		return true
+	}
+
+	return false
+}
+
+func (p *parser) expect(text string) error {
+	if p.peek() != text {
+		return errors.New(fmt.Sprintf("expected %q, found %q", text, p.peek()))
+	}
+
+	p.pos++
+	return nil
+}
+
+func (p *parser) or() (Filter, error) {
+	left, err := p.and()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for p.keyword("or") {
+		right, err := p.and()
+
+		if err != nil {
+			return nil, err
+		}
+
+		left = logicalFilter{left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) and() (Filter, error) {
+	left, err := p.term()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for p.keyword("and") {
+		right, err := p.term()
+
+		if err != nil {
+			return nil, err
+		}
+
+		left = logicalFilter{and: true, left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) term() (Filter, error) {
+	if p.keyword("not") {
+		err := p.expect("(")
+
+		if err != nil {
+			return nil, err
+		}
+
+		filter, err := p.or()
+
+		if err != nil {
+			return nil, err
+		}
+
+		return notFilter{filter}, p.expect(")")
+	}
+
+	if p.peek() == "(" {
+		p.pos++
+		filter, err := p.or()
+
+		if err != nil {
+			return nil, err
+		}
+
+		return filter, p.expect(")")
+	}
+
+	attribute := p.peek()
+
+	if attribute == "" || strings.ContainsAny(attribute[:1], "\"()[]") {
+		return nil, errors.New(fmt.Sprintf("expected attribute, found %q", attribute))
+	}
+
+	p.pos++
+
+	if p.peek() == "[" {
+		p.pos++
+		filter, err := p.or()
+
+		if err != nil {
+			return nil, err
+		}
+
+		return valuePathFilter{stripSchema(attribute), filter}, p.expect("]")
+	}
+
+	op := strings.ToLower(p.peek())
+	p.pos++
+
+	switch op {
+	case "pr":
+		return compareFilter{path: splitPath(attribute), op: op}, nil
+	case "eq", "ne", "co", "sw", "ew", "gt", "ge", "lt", "le":
+	default:
+		return nil, errors.New(fmt.Sprintf("unknown operator %q", op))
+	}
+
+	value, err := literal(p.peek())
+
+	if err != nil {
+		return nil, err
+	}
+
+	p.pos++
+
+	return compareFilter{path: splitPath(attribute), op: op, value: value}, nil
+}
+
+func literal(text string) (interface{}, error) {
+	switch {
+	case strings.HasPrefix(text, "\""):
+		var value string
+		err := json.Unmarshal([]byte(text), &value)
+
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("invalid string %s", text))
+		}
+
+		return value, nil
+	case text == "true":
+		return true, nil
+	case text == "false":
+		return false, nil
+	case text == "null":
+		return nil, nil
+	}
+
+	value, err := strconv.ParseFloat(text, 64)
+
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("invalid value %q", text))
+	}
+
+	return value, nil
+}
+
+// stripSchema removes the schema URN an attribute name may be qualified with.
+func stripSchema(attribute string) string {
+	if i := strings.LastIndex(attribute, ":"); i >= 0 {
+		return attribute[i+1:]
+	}
+
+	return attribute
+}
+
+func splitPath(attribute string) []string {
+	return strings.Split(stripSchema(attribute), ".")
+}
+
+// lookup retrieves an attribute of a resource ignoring the case of its name.
+func lookup(resource map[string]interface{}, name string) interface{} {
+	if value, ok := resource[name]; ok {
+		return value
+	}
+
+	for key, value := range resource {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+
+	return nil
+}
+
+func values(value interface{}) []interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return v
+	default:
+		return []interface{}{v}
+	}
+}
+
+// resolve collects the values at an attribute path, flattening multi-valued attributes along the way.
+func resolve(resource map[string]interface{}, path []string) []interface{} {
+	current := values(lookup(resource, path[0]))
+
+	for _, name := range path[1:] {
+		next := make([]interface{}, 0)
+
+		for _, value := range current {
+			if object, ok := value.(map[string]interface{}); ok {
+				next = append(next, values(lookup(object, name))...)
+			}
+		}
+
+		current = next
+	}
+
+	return current
+}
+
+func compare(actual interface{}, op string, expected interface{}) bool {
+	switch a := actual.(type) {
+	case string:
+		e, ok := expected.(string)
+
+		if !ok {
+			return op == "ne"
+		}
+
+		a, e = strings.ToLower(a), strings.ToLower(e)
+
+		switch op {
+		case "eq":
+			return a == e
+		case "ne":
+			return a != e
+		case "co":
+			return strings.Contains(a, e)
+		case "sw":
+			return strings.HasPrefix(a, e)
+		case "ew":
+			return strings.HasSuffix(a, e)
+		case "gt":
+			return a > e
+		case "ge":
+			return a >= e
+		case "lt":
+			return a < e
+		case "le":
+			return a <= e
+		}
+	case float64:
+		e, ok := expected.(float64)
+
+		if !ok {
+			return op == "ne"
+		}
+
+		switch op {
+		case "eq":
+			return a == e
+		case "ne":
+			return a != e
+		case "gt":
+			return a > e
+		case "ge":
+			return a >= e
+		case "lt":
+			return a < e
+		case "le":
+			return a <= e
+		}
+	case bool:
+		switch op {
+		case "eq":
+			return actual == expected
+		case "ne":
+			return actual != expected
+		}
+	}
+
+	return false
+}
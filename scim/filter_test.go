@@ -0,0 +1,75 @@
+package scim_test
+
+import (
+	"encoding/json"
+	"github.com/stone1549/auth-service/scim"
+	"testing"
+)
+
+const sampleUser = `{
+  "schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+  "id": "1",
+  "userName": "Jane@Example.com",
+  "name": {"givenName": "Jane", "familyName": "Doe"},
+  "emails": [
+    {"value": "jane@example.com", "type": "work", "primary": true},
+    {"value": "jane@home.example", "type": "home"}
+  ],
+  "active": true,
+  "meta": {"lastModified": "2018-05-02T10:00:00Z"}
+}`
+
+func decodeSample(t *testing.T, src string) map[string]interface{} {
+	resource := make(map[string]interface{})
+	ok(t, json.Unmarshal([]byte(src), &resource))
+	return resource
+}
+
+// TestParseFilter ensures filter expressions match resources as described by RFC 7644.
+func TestParseFilter(t *testing.T) {
+	user := decodeSample(t, sampleUser)
+
+	cases := []struct {
+		filter   string
+		expected bool
+	}{
+		{`userName eq "jane@example.com"`, true},
+		{`USERNAME Eq "jane@example.com"`, true},
+		{`urn:ietf:params:scim:schemas:core:2.0:User:userName eq "jane@example.com"`, true},
+		{`userName ne "jane@example.com"`, false},
+		{`userName sw "jane" and userName ew ".com"`, true},
+		{`name.familyName co "oe"`, true},
+		{`emails.value eq "jane@home.example"`, true},
+		{`emails[type eq "work" and value co "@example.com"]`, true},
+		{`emails[type eq "other"]`, false},
+		{`externalId pr`, false},
+		{`name pr and not (externalId pr)`, true},
+		{`active eq false or (name.givenName eq "Jane" and active eq true)`, true},
+		{`meta.lastModified gt "2018-05-01T00:00:00Z"`, true},
+		{`meta.lastModified lt "2018-05-01T00:00:00Z"`, false},
+	}
+
+	for _, c := range cases {
+		filter, err := scim.ParseFilter(c.filter)
+		ok(t, err)
+		equals(t, c.expected, filter.Matches(user))
+	}
+}
+
+// TestParseFilter_Fail ensures malformed filter expressions are rejected.
+func TestParseFilter_Fail(t *testing.T) {
+	for _, src := range []string{
+		``,
+		`userName`,
+		`userName is "jane"`,
+		`userName eq "jane`,
+		`userName eq jane`,
+		`(userName eq "jane"`,
+		`emails[type eq "work"`,
+		`userName eq "jane" extra`,
+		`not userName eq "jane"`,
+	} {
+		_, err := scim.ParseFilter(src)
+		notOk(t, err)
+	}
+}
@@ -0,0 +1,323 @@
+package scim
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// PatchRequest is the body of a PATCH request.
+type PatchRequest struct {
+	Schemas    []string         `json:"schemas"`
+	Operations []PatchOperation `json:"Operations"`
+}
+
+// PatchOperation adds, replaces or removes the value at a path of a resource.
+type PatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+type patchPath struct {
+	attribute string
+	filter    Filter
+	sub       string
+}
+
+func parsePath(text string) (patchPath, error) {
+	text = strings.TrimSpace(text)
+
+	// Attributes of the attributes extension stay nested under its schema URN, as they're arbitrary names.
+	if len(text) >= len(AttributesSchema) && strings.EqualFold(text[:len(AttributesSchema)], AttributesSchema) {
+		path := patchPath{attribute: AttributesSchema, sub: strings.TrimPrefix(text[len(AttributesSchema):], ":")}
+
+		if strings.ContainsAny(path.sub, ".[") {
+			return patchPath{}, NewError(http.StatusBadRequest, InvalidPath, fmt.Sprintf("invalid path %q", text))
+		}
+
+		return path, nil
+	}
+
+	if i := strings.Index(text, "["); i >= 0 {
+		j := strings.LastIndex(text, "]")
+
+		if j < i {
+			return patchPath{}, NewError(http.StatusBadRequest, InvalidPath, fmt.Sprintf("invalid path %q", text))
+		}
+
+		filter, err := ParseFilter(text[i+1 : j])
+
+		if err != nil {
+			return patchPath{}, NewError(http.StatusBadRequest, InvalidPath, err.Error())
+		}
+
+		path := patchPath{attribute: stripSchema(text[:i]), filter: filter}
+		rest := text[j+1:]
+
+		if rest != "" {
+			if !strings.HasPrefix(rest, ".") || len(rest) == 1 {
+				return patchPath{}, NewError(http.StatusBadRequest, InvalidPath, fmt.Sprintf("invalid path %q", text))
+			}
+
+			path.sub = rest[1:]
+		}
+
+		return path, nil
+	}
+
+	names := strings.SplitN(stripSchema(text), ".", 2)
+
+	if names[0] == "" {
+		return patchPath{}, NewError(http.StatusBadRequest, InvalidPath, fmt.Sprintf("invalid path %q", text))
+	}
+
+	path := patchPath{attribute: names[0]}
+
+	if len(names) == 2 {
+		path.sub = names[1]
+	}
+
+	return path, nil
+}
+
+// ApplyPatch applies PATCH operations in order to a resource represented as a decoded JSON object, as described
+// by RFC 7644 section 3.5.2. Operations without a path merge their object value into the resource.
+func ApplyPatch(resource map[string]interface{}, operations []PatchOperation) error {
+	for _, operation := range operations {
+		op := strings.ToLower(operation.Op)
+
+		if op != "add" && op != "replace" && op != "remove" {
+			return NewError(http.StatusBadRequest, InvalidSyntax, fmt.Sprintf("unknown op %q", operation.Op))
+		}
+
+		if operation.Path != "" {
+			path, err := parsePath(operation.Path)
+
+			if err != nil {
+				return err
+			}
+
+			err = applyAt(resource, path, op, operation.Value)
+
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if op == "remove" {
+			return NewError(http.StatusBadRequest, NoTarget, "remove requires a path")
+		}
+
+		object, ok := operation.Value.(map[string]interface{})
+
+		if !ok {
+			return NewError(http.StatusBadRequest, InvalidValue, "an object value is required without a path")
+		}
+
+		err := mergeObject(resource, op, object)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func mergeObject(resource map[string]interface{}, op string, object map[string]interface{}) error {
+	for name, value := range object {
+		// Extension attributes are nested under their schema URN, they're treated as attributes of the resource
+		// except for those of the attributes extension, which are kept apart.
+		if extension, ok := value.(map[string]interface{}); ok && strings.HasPrefix(name, "urn:") &&
+			!strings.EqualFold(name, AttributesSchema) {
+			err := mergeObject(resource, op, extension)
+
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		path, err := parsePath(name)
+
+		if err != nil {
+			return err
+		}
+
+		err = applyAt(resource, path, op, value)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// key finds the name an attribute is stored under ignoring case, or the given name when it isn't present.
+func key(resource map[string]interface{}, name string) string {
+	if _, ok := resource[name]; ok {
+		return name
+	}
+
+	for key := range resource {
+		if strings.EqualFold(key, name) {
+			return key
+		}
+	}
+
+	return name
+}
+
+func applyAt(resource map[string]interface{}, path patchPath, op string, value interface{}) error {
+	name := key(resource, path.attribute)
+	existing := resource[name]
+
+	if path.filter != nil {
+		return applyFiltered(resource, name, path, op, value)
+	}
+
+	if path.sub != "" {
+		switch current := existing.(type) {
+		case []interface{}:
+			for _, element := range current {
+				if object, ok := element.(map[string]interface{}); ok {
+					err := applyAt(object, patchPath{attribute: path.sub}, op, value)
+
+					if err != nil {
+						return err
+					}
+				}
+			}
+		case map[string]interface{}:
+			return applyAt(current, patchPath{attribute: path.sub}, op, value)
+		case nil:
+			if op != "remove" {
+				object := make(map[string]interface{})
+				resource[name] = object
+				return applyAt(object, patchPath{attribute: path.sub}, op, value)
+			}
+		default:
+			return NewError(http.StatusBadRequest, InvalidPath, fmt.Sprintf("%s has no sub-attributes", name))
+		}
+
+		return nil
+	}
+
+	switch op {
+	case "remove":
+		if current, ok := existing.([]interface{}); ok && value != nil {
+			resource[name] = removeValues(current, values(value))
+		} else {
+			delete(resource, name)
+		}
+	case "add":
+		if current, ok := existing.([]interface{}); ok {
+			resource[name] = append(current, values(value)...)
+		} else if current, ok := existing.(map[string]interface{}); ok {
+			if object, ok := value.(map[string]interface{}); ok {
+				return mergeObject(current, op, object)
+			}
+
+			resource[name] = value
+		} else {
+			resource[name] = value
+		}
+	case "replace":
+		if current, ok := existing.(map[string]interface{}); ok {
+			if object, ok := value.(map[string]interface{}); ok {
+				return mergeObject(current, op, object)
+			}
+		}
+
+		resource[name] = value
+	}
+
+	return nil
+}
+
+func applyFiltered(resource map[string]interface{}, name string, path patchPath, op string,
+	value interface{}) error {
+	elements := values(resource[name])
+	result := make([]interface{}, 0, len(elements))
+	matched := false
+
+	for _, element := range elements {
+		object, ok := element.(map[string]interface{})
+
+		if !ok || !path.filter.Matches(object) {
+			result = append(result, element)
+			continue
+		}
+
+		matched = true
+
+		if path.sub != "" {
+			err := applyAt(object, patchPath{attribute: path.sub}, op, value)
+
+			if err != nil {
+				return err
+			}
+
+			result = append(result, object)
+			continue
+		}
+
+		switch op {
+		case "remove":
+		case "add":
+			if replacement, ok := value.(map[string]interface{}); ok {
+				err := mergeObject(object, op, replacement)
+
+				if err != nil {
+					return err
+				}
+			}
+
+			result = append(result, object)
+		case "replace":
+			result = append(result, value)
+		}
+	}
+
+	if !matched && op != "remove" {
+		return NewError(http.StatusBadRequest, NoTarget, fmt.Sprintf("no %s match the filter", name))
+	}
+
+	resource[name] = result
+
+	return nil
+}
+
+// removeValues removes the elements of a multi-valued attribute whose value matches one of the given values.
+func removeValues(elements []interface{}, removals []interface{}) []interface{} {
+	removed := make(map[string]bool)
+
+	for _, removal := range removals {
+		if object, ok := removal.(map[string]interface{}); ok {
+			removal = lookup(object, "value")
+		}
+
+		removed[fmt.Sprint(removal)] = true
+	}
+
+	result := make([]interface{}, 0, len(elements))
+
+	for _, element := range elements {
+		value := element
+
+		if object, ok := element.(map[string]interface{}); ok {
+			value = lookup(object, "value")
+		}
+
+		if !removed[fmt.Sprint(value)] {
+			result = append(result, element)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,100 @@
+package scim_test
+
+import (
+	"github.com/stone1549/auth-service/common"
+	"github.com/stone1549/auth-service/scim"
+	"testing"
+)
+
+const sampleGroup = `{
+  "schemas": ["urn:ietf:params:scim:schemas:core:2.0:Group"],
+  "id": "g1",
+  "displayName": "Engineering",
+  "members": [{"value": "1", "type": "User"}, {"value": "2", "type": "User"}]
+}`
+
+// TestApplyPatch_User ensures operations with and without paths change a user.
+func TestApplyPatch_User(t *testing.T) {
+	resource := decodeSample(t, sampleUser)
+
+	err := scim.ApplyPatch(resource, []scim.PatchOperation{
+		{Op: "Replace", Path: "active", Value: "False"},
+		{Op: "replace", Path: "name.givenName", Value: "Janet"},
+		{Op: "add", Value: map[string]interface{}{"displayName": "Janet Doe", "externalId": "00u1"}},
+		{Op: "replace", Path: `emails[type eq "work"].value`, Value: "janet@example.com"},
+		{Op: "remove", Path: `emails[type eq "home"]`},
+		{Op: "add", Path: "password", Value: "s3cret!"},
+	})
+	ok(t, err)
+
+	user, err := scim.DecodeUser(resource)
+	ok(t, err)
+	equals(t, false, *user.Active)
+	equals(t, "Janet", user.Name.GivenName)
+	equals(t, "Doe", user.Name.FamilyName)
+	equals(t, "Janet Doe", user.DisplayName)
+	equals(t, "00u1", user.ExternalId)
+	equals(t, []scim.MultiValue{{Value: "janet@example.com", Type: "work", Primary: true}}, user.Emails)
+	equals(t, "s3cret!", user.Password)
+}
+
+// TestApplyPatch_Attributes ensures attributes of the attributes extension are changed by qualified paths and by
+// objects without a path, and stay apart from the user's core attributes.
+func TestApplyPatch_Attributes(t *testing.T) {
+	resource := decodeSample(t, sampleUser)
+
+	err := scim.ApplyPatch(resource, []scim.PatchOperation{
+		{Op: "add", Path: scim.AttributesSchema + ":region", Value: "eu"},
+		{Op: "add", Value: map[string]interface{}{
+			scim.AttributesSchema: map[string]interface{}{"costCenter": "42", "displayName": "Support"}}},
+		{Op: "remove", Path: scim.AttributesSchema + ":displayName"},
+	})
+	ok(t, err)
+
+	user, err := scim.DecodeUser(resource)
+	ok(t, err)
+	equals(t, map[string]string{"region": "eu", "costCenter": "42"}, user.Attributes)
+	equals(t, "eu", user.Account(common.UserAccount{}).Attributes["region"])
+	equals(t, "", user.DisplayName)
+}
+
+// TestApplyPatch_Members ensures members can be added and removed by value or filter.
+func TestApplyPatch_Members(t *testing.T) {
+	resource := decodeSample(t, sampleGroup)
+
+	err := scim.ApplyPatch(resource, []scim.PatchOperation{
+		{Op: "add", Path: "members", Value: []interface{}{map[string]interface{}{"value": "3"}}},
+		{Op: "remove", Path: `members[value eq "1"]`},
+		{Op: "remove", Path: "members", Value: []interface{}{map[string]interface{}{"value": "2"}}},
+		{Op: "replace", Path: "displayName", Value: "Platform"},
+	})
+	ok(t, err)
+
+	group, err := scim.DecodeGroup(resource)
+	ok(t, err)
+	equals(t, "Platform", group.DisplayName)
+	equals(t, []scim.MultiValue{{Value: "3"}}, group.Members)
+}
+
+// TestApplyPatch_Fail ensures invalid operations are rejected with the appropriate error type.
+func TestApplyPatch_Fail(t *testing.T) {
+	cases := []struct {
+		operation scim.PatchOperation
+		scimType  string
+	}{
+		{scim.PatchOperation{Op: "move", Path: "displayName"}, scim.InvalidSyntax},
+		{scim.PatchOperation{Op: "remove"}, scim.NoTarget},
+		{scim.PatchOperation{Op: "replace", Value: "Platform"}, scim.InvalidValue},
+		{scim.PatchOperation{Op: "replace", Path: `members[value eq "9"]`, Value: "x"}, scim.NoTarget},
+		{scim.PatchOperation{Op: "replace", Path: `members[value eq`, Value: "x"}, scim.InvalidPath},
+		{scim.PatchOperation{Op: "add", Path: "displayName.value", Value: "x"}, scim.InvalidPath},
+	}
+
+	for _, c := range cases {
+		err := scim.ApplyPatch(decodeSample(t, sampleGroup), []scim.PatchOperation{c.operation})
+		scimErr, isScimErr := err.(*scim.Error)
+		equals(t, true, isScimErr)
+		equals(t, c.scimType, scimErr.ScimType)
+		equals(t, "400", scimErr.Status)
+	}
+}
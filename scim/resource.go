@@ -0,0 +1,210 @@
+package scim
+
+import (
+	"encoding/json"
+	"github.com/stone1549/auth-service/common"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Member types of group members.
+const (
+	UserMember  = "User"
+	GroupMember = "Group"
+)
+
+// Meta holds a resource's metadata.
+type Meta struct {
+	ResourceType string     `json:"resourceType"`
+	Created      *time.Time `json:"created,omitempty"`
+	LastModified *time.Time `json:"lastModified,omitempty"`
+	Location     string     `json:"location,omitempty"`
+}
+
+// Name holds the components of a user's name.
+type Name struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+// MultiValue is an element of a multi-valued attribute such as emails or members.
+type MultiValue struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+// User is a user resource. UserName is the user's email, which is also reported as their primary email.
+type User struct {
+	Schemas     []string     `json:"schemas"`
+	Id          string       `json:"id,omitempty"`
+	ExternalId  string       `json:"externalId,omitempty"`
+	UserName    string       `json:"userName"`
+	Name        *Name        `json:"name,omitempty"`
+	DisplayName string       `json:"displayName,omitempty"`
+	Emails      []MultiValue `json:"emails,omitempty"`
+	Active      *bool        `json:"active,omitempty"`
+	Password    string       `json:"password,omitempty"`
+	Meta        *Meta        `json:"meta,omitempty"`
+	// Attributes are the user's further attributes, given under the attributes extension's schema.
+	Attributes map[string]string `json:"urn:stone1549:params:scim:schemas:extension:attributes:2.0:User,omitempty"`
+}
+
+// NewUser creates the user resource of an account, located under the SCIM base URL.
+func NewUser(account common.UserAccount, baseUrl string) User {
+	user := User{
+		Schemas:     []string{UserSchema},
+		Id:          account.Id,
+		ExternalId:  account.ExternalId,
+		UserName:    account.Email,
+		DisplayName: account.DisplayName,
+		Emails:      []MultiValue{{Value: account.Email, Type: "work", Primary: true}},
+		Active:      &account.Active,
+		Meta:        newMeta(UserMember, account.CreatedAt, account.UpdatedAt, baseUrl+"/Users/"+account.Id),
+	}
+
+	if len(account.Attributes) > 0 {
+		user.Schemas = append(user.Schemas, AttributesSchema)
+		user.Attributes = account.Attributes
+	}
+
+	if account.GivenName != "" || account.FamilyName != "" {
+		user.Name = &Name{
+			Formatted:  strings.TrimSpace(account.GivenName + " " + account.FamilyName),
+			GivenName:  account.GivenName,
+			FamilyName: account.FamilyName,
+		}
+	}
+
+	return user
+}
+
+// Account applies the user's attributes to an account, users are active unless they say otherwise.
+func (u User) Account(account common.UserAccount) common.UserAccount {
+	account.Email = u.UserName
+	account.ExternalId = u.ExternalId
+	account.DisplayName = u.DisplayName
+	account.GivenName = ""
+	account.FamilyName = ""
+	account.Active = u.Active == nil || *u.Active
+	account.Attributes = u.Attributes
+
+	if u.Name != nil {
+		account.GivenName = u.Name.GivenName
+		account.FamilyName = u.Name.FamilyName
+	}
+
+	return account
+}
+
+// DecodeUser converts a user represented as a decoded JSON object, such as a patched user, to a user resource.
+// Booleans sent as strings by some identity providers are accepted.
+func DecodeUser(resource map[string]interface{}) (User, error) {
+	name := key(resource, "active")
+
+	if text, ok := resource[name].(string); ok {
+		active, err := strconv.ParseBool(text)
+
+		if err != nil {
+			return User{}, NewError(http.StatusBadRequest, InvalidValue, "active must be a boolean")
+		}
+
+		resource[name] = active
+	}
+
+	var user User
+	err := convert(resource, &user)
+
+	if err != nil {
+		return User{}, NewError(http.StatusBadRequest, InvalidValue, err.Error())
+	}
+
+	if user.UserName == "" {
+		return User{}, NewError(http.StatusBadRequest, InvalidValue, "userName is required")
+	}
+
+	return user, nil
+}
+
+// Group is a group resource, its members are users and other groups.
+type Group struct {
+	Schemas     []string     `json:"schemas"`
+	Id          string       `json:"id,omitempty"`
+	DisplayName string       `json:"displayName"`
+	Members     []MultiValue `json:"members,omitempty"`
+	Meta        *Meta        `json:"meta,omitempty"`
+}
+
+// NewGroup creates the group resource of a group and its direct members, located under the SCIM base URL.
+func NewGroup(group common.Group, members common.GroupMembers, baseUrl string) Group {
+	resource := Group{
+		Schemas:     []string{GroupSchema},
+		Id:          group.Id,
+		DisplayName: group.Name,
+		Members:     make([]MultiValue, 0, len(members.UserIds)+len(members.GroupIds)),
+		Meta:        newMeta(GroupMember, group.CreatedAt, group.UpdatedAt, baseUrl+"/Groups/"+group.Id),
+	}
+
+	for _, userId := range members.UserIds {
+		resource.Members = append(resource.Members, MultiValue{Value: userId, Type: UserMember,
+			Ref: baseUrl + "/Users/" + userId})
+	}
+
+	for _, groupId := range members.GroupIds {
+		resource.Members = append(resource.Members, MultiValue{Value: groupId, Type: GroupMember,
+			Ref: baseUrl + "/Groups/" + groupId})
+	}
+
+	return resource
+}
+
+// DecodeGroup converts a group represented as a decoded JSON object, such as a patched group, to a group resource.
+func DecodeGroup(resource map[string]interface{}) (Group, error) {
+	var group Group
+	err := convert(resource, &group)
+
+	if err != nil {
+		return Group{}, NewError(http.StatusBadRequest, InvalidValue, err.Error())
+	}
+
+	if group.DisplayName == "" {
+		return Group{}, NewError(http.StatusBadRequest, InvalidValue, "displayName is required")
+	}
+
+	return group, nil
+}
+
+// ToMap represents a resource as a decoded JSON object, for filtering and patching.
+func ToMap(resource interface{}) (map[string]interface{}, error) {
+	object := make(map[string]interface{})
+	return object, convert(resource, &object)
+}
+
+func convert(from, to interface{}) error {
+	data, err := json.Marshal(from)
+
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, to)
+}
+
+func newMeta(resourceType string, created, lastModified time.Time, location string) *Meta {
+	meta := &Meta{ResourceType: resourceType, Location: location}
+
+	if !created.IsZero() {
+		meta.Created = &created
+	}
+
+	if !lastModified.IsZero() {
+		meta.LastModified = &lastModified
+	}
+
+	return meta
+}
@@ -0,0 +1,49 @@
+package scim_test
+
+import (
+	"github.com/stone1549/auth-service/common"
+	"github.com/stone1549/auth-service/scim"
+	"testing"
+	"time"
+)
+
+// TestNewUser ensures accounts are represented as user resources and back.
+func TestNewUser(t *testing.T) {
+	now := time.Now()
+	account := common.UserAccount{Id: "1", TenantId: "acme", Email: "jane@example.com", GivenName: "Jane",
+		FamilyName: "Doe", Active: true, CreatedAt: now, UpdatedAt: now}
+
+	user := scim.NewUser(account, "https://auth.example.com/scim/v2")
+	equals(t, "jane@example.com", user.UserName)
+	equals(t, "Jane Doe", user.Name.Formatted)
+	equals(t, "https://auth.example.com/scim/v2/Users/1", user.Meta.Location)
+	equals(t, []scim.MultiValue{{Value: "jane@example.com", Type: "work", Primary: true}}, user.Emails)
+
+	resource, err := scim.ToMap(user)
+	ok(t, err)
+	decoded, err := scim.DecodeUser(resource)
+	ok(t, err)
+	equals(t, account, decoded.Account(common.UserAccount{Id: "1", TenantId: "acme", CreatedAt: now,
+		UpdatedAt: now}))
+}
+
+// TestDecodeUser_Fail ensures users without a userName or with an invalid active flag are rejected.
+func TestDecodeUser_Fail(t *testing.T) {
+	_, err := scim.DecodeUser(map[string]interface{}{"active": true})
+	notOk(t, err)
+
+	_, err = scim.DecodeUser(map[string]interface{}{"userName": "jane@example.com", "active": "maybe"})
+	notOk(t, err)
+}
+
+// TestNewGroup ensures groups are represented with their user and group members.
+func TestNewGroup(t *testing.T) {
+	group := scim.NewGroup(common.Group{Id: "g1", Name: "engineering"},
+		common.GroupMembers{UserIds: []string{"1"}, GroupIds: []string{"g2"}}, "/scim/v2")
+
+	equals(t, "engineering", group.DisplayName)
+	equals(t, []scim.MultiValue{
+		{Value: "1", Type: scim.UserMember, Ref: "/scim/v2/Users/1"},
+		{Value: "g2", Type: scim.GroupMember, Ref: "/scim/v2/Groups/g2"},
+	}, group.Members)
+}
@@ -0,0 +1,132 @@
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+const (
+	// ContentType is the media type of SCIM requests and responses.
+	ContentType = "application/scim+json"
+
+	// UserSchema identifies the core user resource schema.
+	UserSchema = "urn:ietf:params:scim:schemas:core:2.0:User"
+	// AttributesSchema identifies the extension holding a user's further attributes, such as their region.
+	AttributesSchema = "urn:stone1549:params:scim:schemas:extension:attributes:2.0:User"
+	// GroupSchema identifies the core group resource schema.
+	GroupSchema = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	// ListResponseSchema identifies query responses.
+	ListResponseSchema = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	// PatchOpSchema identifies PATCH requests.
+	PatchOpSchema = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	// ErrorSchema identifies error responses.
+	ErrorSchema = "urn:ietf:params:scim:api:messages:2.0:Error"
+	// ServiceProviderConfigSchema identifies the service provider configuration.
+	ServiceProviderConfigSchema = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	// ResourceTypeSchema identifies resource type descriptions.
+	ResourceTypeSchema = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+	// SchemaSchema identifies schema descriptions.
+	SchemaSchema = "urn:ietf:params:scim:schemas:core:2.0:Schema"
+
+	// DefaultCount is the number of resources returned by a query that doesn't ask for a count.
+	DefaultCount = 100
+	// MaxCount is the most resources returned by a single query.
+	MaxCount = 200
+)
+
+// Error types, see RFC 7644 section 3.12.
+const (
+	InvalidFilter = "invalidFilter"
+	InvalidPath   = "invalidPath"
+	InvalidSyntax = "invalidSyntax"
+	InvalidValue  = "invalidValue"
+	NoTarget      = "noTarget"
+	Uniqueness    = "uniqueness"
+)
+
+// Error is a SCIM error response.
+type Error struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+}
+
+// NewError creates an error response with the given HTTP status, SCIM error type (which may be empty) and detail.
+func NewError(status int, scimType, detail string) *Error {
+	return &Error{
+		Schemas:  []string{ErrorSchema},
+		Status:   strconv.Itoa(status),
+		ScimType: scimType,
+		Detail:   detail,
+	}
+}
+
+func (e *Error) Error() string {
+	if e.ScimType != "" {
+		return fmt.Sprintf("%s: %s", e.ScimType, e.Detail)
+	}
+
+	return e.Detail
+}
+
+// StatusCode is the HTTP status of the error.
+func (e *Error) StatusCode() int {
+	status, err := strconv.Atoi(e.Status)
+
+	if err != nil {
+		return http.StatusInternalServerError
+	}
+
+	return status
+}
+
+// Write responds with a SCIM document.
+func Write(w http.ResponseWriter, status int, document interface{}) {
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(document)
+}
+
+// WriteError responds with a SCIM error.
+func WriteError(w http.ResponseWriter, err *Error) {
+	Write(w, err.StatusCode(), err)
+}
+
+// ListResponse is the response to a query.
+type ListResponse struct {
+	Schemas      []string      `json:"schemas"`
+	TotalResults int           `json:"totalResults"`
+	StartIndex   int           `json:"startIndex"`
+	ItemsPerPage int           `json:"itemsPerPage"`
+	Resources    []interface{} `json:"Resources"`
+}
+
+// NewListResponse pages resources, startIndex is 1 based.
+func NewListResponse(resources []interface{}, startIndex, count int) ListResponse {
+	if startIndex < 1 {
+		startIndex = 1
+	}
+
+	page := make([]interface{}, 0)
+
+	if startIndex <= len(resources) {
+		end := startIndex - 1 + count
+
+		if end > len(resources) {
+			end = len(resources)
+		}
+
+		page = resources[startIndex-1 : end]
+	}
+
+	return ListResponse{
+		Schemas:      []string{ListResponseSchema},
+		TotalResults: len(resources),
+		StartIndex:   startIndex,
+		ItemsPerPage: len(page),
+		Resources:    page,
+	}
+}
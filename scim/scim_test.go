@@ -0,0 +1,56 @@
+package scim_test
+
+import (
+	"fmt"
+	"github.com/stone1549/auth-service/scim"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+// TestNewListResponse ensures resources are paged from a 1 based start index.
+func TestNewListResponse(t *testing.T) {
+	resources := []interface{}{"a", "b", "c", "d", "e"}
+
+	page := scim.NewListResponse(resources, 2, 2)
+	equals(t, 5, page.TotalResults)
+	equals(t, 2, page.StartIndex)
+	equals(t, 2, page.ItemsPerPage)
+	equals(t, []interface{}{"b", "c"}, page.Resources)
+
+	page = scim.NewListResponse(resources, 0, 10)
+	equals(t, 1, page.StartIndex)
+	equals(t, 5, page.ItemsPerPage)
+
+	page = scim.NewListResponse(resources, 6, 10)
+	equals(t, 0, page.ItemsPerPage)
+	equals(t, []interface{}{}, page.Resources)
+}
+
+// ok fails the test if an err is not nil.
+func ok(tb testing.TB, err error) {
+	if err != nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: unexpected error: %s\033[39m\n\n", filepath.Base(file), line, err.Error())
+		tb.FailNow()
+	}
+}
+
+// notOk fails the test if an err is nil.
+func notOk(tb testing.TB, err error) {
+	if err == nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: unexpected lack of error: \033[39m\n\n", filepath.Base(file), line)
+		tb.FailNow()
+	}
+}
+
+// equals fails the test if exp is not equal to act.
+func equals(tb testing.TB, exp, act interface{}) {
+	if !reflect.DeepEqual(exp, act) {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d:\n\n\texp: %#v\n\n\tgot: %#v\033[39m\n\n", filepath.Base(file), line, exp, act)
+		tb.FailNow()
+	}
+}
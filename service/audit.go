@@ -0,0 +1,181 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"github.com/stone1549/auth-service/audit"
+	"github.com/stone1549/auth-service/common"
+	"github.com/stone1549/auth-service/forwarded"
+	"github.com/stone1549/auth-service/logging"
+	"github.com/stone1549/auth-service/metrics"
+	"github.com/twinj/uuid"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxAuditLimit bounds how many events a single audit query may return.
+const maxAuditLimit = 1000
+
+type auditResponse struct {
+	Events []audit.Event `json:"events"`
+}
+
+func (ar auditResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// clientIp retrieves the address of the client that made the request, believing X-Forwarded-For when the request
+// was forwarded by one of the trusted proxies in context.
+func clientIp(r *http.Request) string {
+	proxies, _ := r.Context().Value("trustedProxies").([]*net.IPNet)
+
+	return forwarded.ClientIp(r, proxies)
+}
+
+// recordAudit completes an event with the details of the request and records it to the audit sink in context,
+// counting logins and signups in the metrics. Failing to record is logged rather than failing the request.
+func recordAudit(r *http.Request, event audit.Event) {
+	switch event.Type {
+	case audit.LoginSucceeded:
+		metrics.LoginSucceeded()
+	case audit.LoginFailed:
+		metrics.LoginFailed(event.Reason)
+	case audit.Signup:
+		metrics.SignedUp()
+	}
+
+	sink, ok := r.Context().Value("audit").(audit.Sink)
+
+	if !ok {
+		return
+	}
+
+	if tenant, ok := r.Context().Value("tenant").(common.Tenant); ok {
+		event.TenantId = tenant.Id
+	}
+
+	event.Id = uuid.NewV4().String()
+	event.RemoteAddr = clientIp(r)
+	event.RequestId = middleware.GetReqID(r.Context())
+	event.CreatedAt = time.Now().UTC()
+
+	err := sink.Record(r.Context(), event)
+
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Unable to record audit event", "type", string(event.Type),
+			"error", err.Error())
+	}
+}
+
+// AuditAdminMiddleware records an admin action audit event for every request that changes something, after it's
+// handled, with the route and response status.
+func AuditAdminMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		details := map[string]string{
+			"method": r.Method,
+			"path":   r.URL.Path,
+			"status": strconv.Itoa(status),
+		}
+
+		if rctx := chi.RouteContext(r.Context()); rctx != nil {
+			details["route"] = rctx.RoutePattern()
+
+			for i, key := range rctx.URLParams.Keys {
+				details[key] = rctx.URLParams.Values[i]
+			}
+		}
+
+		event := audit.Event{
+			Type:    audit.AdminAction,
+			ActorId: audit.ServiceActor,
+			UserId:  details["userId"],
+			Success: status < http.StatusBadRequest,
+			Details: details,
+		}
+
+		recordAudit(r, event)
+	})
+}
+
+// QueryAudit responds with the audit events of the request's tenant, filtered by the userId, type (repeatable or
+// comma separated), from and to (RFC 3339) and limit query parameters.
+func QueryAudit(w http.ResponseWriter, r *http.Request) {
+	tenant, ok := r.Context().Value("tenant").(common.Tenant)
+
+	if !ok {
+		render.Render(w, r, errUnknown(errors.New("tenant not found in context")))
+		return
+	}
+
+	sink, ok := r.Context().Value("audit").(audit.Sink)
+
+	if !ok {
+		render.Render(w, r, errUnknown(errors.New("audit sink not found in context")))
+		return
+	}
+
+	params := r.URL.Query()
+	query := audit.Query{TenantId: tenant.Id, UserId: params.Get("userId")}
+
+	for _, value := range params["type"] {
+		for _, eventType := range strings.Split(value, ",") {
+			if strings.TrimSpace(eventType) != "" {
+				query.Types = append(query.Types, audit.EventType(strings.TrimSpace(eventType)))
+			}
+		}
+	}
+
+	var err error
+
+	for param, dest := range map[string]*time.Time{"from": &query.From, "to": &query.To} {
+		if params.Get(param) == "" {
+			continue
+		}
+
+		*dest, err = time.Parse(time.RFC3339, params.Get(param))
+
+		if err != nil {
+			render.Render(w, r, errInvalidRequest(errors.New(fmt.Sprintf("%s must be an RFC 3339 time", param))))
+			return
+		}
+	}
+
+	if params.Get("limit") != "" {
+		query.Limit, err = strconv.Atoi(params.Get("limit"))
+
+		if err != nil || query.Limit < 1 || query.Limit > maxAuditLimit {
+			render.Render(w, r, errInvalidRequest(errors.New(fmt.Sprintf("limit must be between 1 and %d",
+				maxAuditLimit))))
+			return
+		}
+	}
+
+	events, err := sink.Query(r.Context(), query)
+
+	if err != nil {
+		render.Render(w, r, errUnknown(err))
+		return
+	}
+
+	render.Render(w, r, auditResponse{events})
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/x509"
+	"errors"
+	"github.com/go-chi/render"
+	"github.com/stone1549/auth-service/common"
+	"github.com/stone1549/auth-service/logging"
+	"github.com/stone1549/auth-service/tracing"
+	"net/http"
+	"strings"
+)
+
+// bearerToken extracts the token from a request's Authorization header.
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+
+	if len(header) > 7 && strings.EqualFold(header[:7], "bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+
+	return ""
+}
+
+// dpopToken extracts a token bound to a DPoP key from a request's Authorization header.
+func dpopToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+
+	if len(header) > 5 && strings.EqualFold(header[:5], "dpop ") {
+		return strings.TrimSpace(header[5:])
+	}
+
+	return ""
+}
+
+// ServiceTokenMiddleware only admits requests bearing one of the service tokens of the request's tenant, so a token
+// can't manage any other tenant.
+func ServiceTokenMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := bearerToken(r)
+
+		if token == "" {
+			render.Render(w, r, errUnauthorized(errors.New("service token is required")))
+			return
+		}
+
+		tenant, ok := r.Context().Value("tenant").(common.Tenant)
+
+		if !ok {
+			render.Render(w, r, errUnknown(errors.New("tenant not found in context")))
+			return
+		}
+
+		for _, serviceToken := range tenant.ServiceTokens {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(serviceToken)) == 1 {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		render.Render(w, r, errUnauthorized(errors.New("invalid service token")))
+	})
+}
+
+// AuthenticatedMiddleware middleware to validate the bearer token or session cookie of a request and add its claims
+// to the context. Tokens are only accepted by the tenant they were issued for, and state changing requests
+// authenticated by a session cookie must echo its CSRF token.
+func AuthenticatedMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := requestToken(r)
+
+		if token == "" {
+			render.Render(w, r, errUnauthorized(errors.New("token is required")))
+			return
+		}
+
+		if err := checkCsrf(r); err != nil {
+			render.Render(w, r, errForbidden(err))
+			return
+		}
+
+		claims, errRender := tokenClaims(r, token)
+
+		if errRender != nil {
+			render.Render(w, r, errRender)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), "claims", claims)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// tokenClaims validates a token presented with a request and returns its claims, or the error to respond with.
+// Tokens are only accepted by the tenant they were issued for, while the session they were issued for exists, and
+// over connections authenticated with the client certificate they're bound to, if any. Tokens bound to a DPoP key
+// must be presented with the DPoP scheme and a proof signed with it.
+func tokenClaims(r *http.Request, token string) (Claims, render.Renderer) {
+	tokenFactory, ok := r.Context().Value("tokenFactory").(TokenFactory)
+
+	if !ok {
+		return Claims{}, errUnknown(errors.New("token factory not found in context"))
+	}
+
+	_, span := tracing.Start(r.Context(), "TokenFactory.ParseToken")
+	claims, err := tokenFactory.ParseToken(token)
+	tracing.End(span, err)
+
+	if err != nil {
+		return Claims{}, errUnauthorized(err)
+	}
+
+	tenant, ok := r.Context().Value("tenant").(common.Tenant)
+
+	if !ok {
+		return Claims{}, errUnknown(errors.New("tenant not found in context"))
+	}
+
+	if claims.TenantId != tenant.Id {
+		return Claims{}, errUnauthorized(errors.New("token was not issued for this tenant"))
+	}
+
+	if claims.CertThumbprint != "" {
+		cert, ok := r.Context().Value("clientCert").(*x509.Certificate)
+
+		if !ok || subtle.ConstantTimeCompare([]byte(certThumbprint(cert)), []byte(claims.CertThumbprint)) != 1 {
+			return Claims{}, errUnauthorized(errors.New("token is bound to a different client certificate"))
+		}
+	}
+
+	if errRender := checkProofOfPossession(r, token, claims); errRender != nil {
+		return Claims{}, errRender
+	}
+
+	if errRender := checkSession(r, claims); errRender != nil {
+		return Claims{}, errRender
+	}
+
+	logging.SetUser(r.Context(), claims.Sub)
+
+	return claims, nil
+}
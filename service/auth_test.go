@@ -0,0 +1,118 @@
+package service_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/stone1549/auth-service/common"
+	"github.com/stone1549/auth-service/service"
+	"github.com/stone1549/auth-service/tlsserver"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// clientCert creates a self signed client certificate for the given common name.
+func clientCert(t *testing.T, name string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ok(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	ok(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	ok(t, err)
+
+	return cert
+}
+
+// overMutualTls makes a request arrive over a connection the client authenticated with cert.
+func overMutualTls(req *http.Request, cert *x509.Certificate) *http.Request {
+	req.TLS = &tls.ConnectionState{HandshakeComplete: true, VerifiedChains: [][]*x509.Certificate{{cert}}}
+
+	return req
+}
+
+// TestCertificateBoundToken ensures tokens issued over mutual TLS carry the client certificate's thumbprint in their
+// cnf claim, and are only accepted over connections authenticated with the same certificate.
+func TestCertificateBoundToken(t *testing.T) {
+	ts := newTestService(t, common.TenantPolicy{})
+	ts.newUser(t, "user@example.com")
+	cert := clientCert(t, "client")
+	other := clientCert(t, "other")
+	login := func(req *http.Request) string {
+		return responseToken(t, ts.serve(tlsserver.ClientCertMiddleware(service.NewSessionMiddleware(
+			http.HandlerFunc(service.NewSession))), req))
+	}
+	protected := func(req *http.Request) int {
+		return ts.serve(tlsserver.ClientCertMiddleware(sessionRouter()), req).Code
+	}
+	token := login(overMutualTls(loginRequest("user@example.com"), cert))
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.Split(token, ".")[1])
+	ok(t, err)
+
+	var claims struct {
+		Cnf map[string]string `json:"cnf"`
+	}
+
+	ok(t, json.Unmarshal(payload, &claims))
+	thumbprint := sha256.Sum256(cert.Raw)
+	equals(t, map[string]string{"x5t#S256": base64.RawURLEncoding.EncodeToString(thumbprint[:])}, claims.Cnf)
+
+	url := "https://auth.example.com/protected"
+	equals(t, http.StatusOK, protected(overMutualTls(authenticated("GET", url, token, nil), cert)))
+	equals(t, http.StatusUnauthorized, protected(authenticated("GET", url, token, nil)))
+	equals(t, http.StatusUnauthorized, protected(overMutualTls(authenticated("GET", url, token, nil), other)))
+
+	unbound := login(loginRequest("user@example.com"))
+	equals(t, http.StatusOK, protected(authenticated("GET", url, unbound, nil)))
+}
+
+// TestServiceTokenMiddleware ensures service tokens are only accepted by the tenant they belong to, whichever tenant
+// the request names.
+func TestServiceTokenMiddleware(t *testing.T) {
+	ts := newTestService(t, common.TenantPolicy{})
+	tenants := map[string]common.Tenant{
+		"acme":   {Id: "acme", ServiceTokens: []string{"acme-token"}},
+		"globex": {Id: "globex", ServiceTokens: []string{"globex-token"}},
+	}
+	handler := service.TenantMiddleware(tenants, common.HeaderTenantSelector)(service.ServiceTokenMiddleware(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})))
+	manage := func(tenantId, token string) int {
+		req := httptest.NewRequest("GET", "https://auth.example.com/group", nil)
+		req.Header.Set("X-Tenant-ID", tenantId)
+
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		return ts.serve(handler, req).Code
+	}
+
+	equals(t, http.StatusOK, manage("acme", "acme-token"))
+	equals(t, http.StatusOK, manage("globex", "globex-token"))
+	equals(t, http.StatusUnauthorized, manage("globex", "acme-token"))
+	equals(t, http.StatusUnauthorized, manage("acme", "globex-token"))
+	equals(t, http.StatusUnauthorized, manage("acme", ""))
+}
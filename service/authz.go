@@ -0,0 +1,183 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/render"
+	"github.com/stone1549/auth-service/authz"
+	"github.com/stone1549/auth-service/common"
+	"github.com/stone1549/auth-service/repository"
+	"net/http"
+)
+
+type checkRequest struct {
+	Object   string `json:"object"`
+	Relation string `json:"relation"`
+	Subject  string `json:"subject"`
+}
+
+type checkResponse struct {
+	Allowed bool `json:"allowed"`
+}
+
+func (cr checkResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+type expandRequest struct {
+	Object   string `json:"object"`
+	Relation string `json:"relation"`
+}
+
+type expandResponse struct {
+	Tree *authz.ExpandNode `json:"tree"`
+}
+
+func (er expandResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+type writeRequest struct {
+	Writes  []common.Tuple `json:"writes"`
+	Deletes []common.Tuple `json:"deletes"`
+}
+
+// authzRequestContext retrieves the tenant and checker that relationship authorization requests operate on.
+func authzRequestContext(w http.ResponseWriter, r *http.Request) (common.Tenant, authz.Checker, bool) {
+	tenant, ok := r.Context().Value("tenant").(common.Tenant)
+
+	if !ok {
+		render.Render(w, r, errUnknown(errors.New("tenant not found in context")))
+		return common.Tenant{}, nil, false
+	}
+
+	checker, ok := r.Context().Value("authz").(authz.Checker)
+
+	if !ok {
+		render.Render(w, r, errUnknown(errors.New("authz checker not found in context")))
+		return common.Tenant{}, nil, false
+	}
+
+	return tenant, checker, true
+}
+
+// Check responds with whether the subject has the relation to the object in the request.
+func Check(w http.ResponseWriter, r *http.Request) {
+	var req checkRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		render.Render(w, r, errInvalidRequest(err))
+		return
+	}
+
+	if req.Object == "" || req.Relation == "" || req.Subject == "" {
+		render.Render(w, r, errInvalidRequest(errors.New("object, relation and subject are required")))
+		return
+	}
+
+	tenant, checker, ok := authzRequestContext(w, r)
+
+	if !ok {
+		return
+	}
+
+	err = checker.Validate(common.Tuple{Object: req.Object, Relation: req.Relation, Subject: req.Subject})
+
+	if err != nil {
+		render.Render(w, r, errInvalidRequest(err))
+		return
+	}
+
+	allowed, err := checker.Check(r.Context(), tenant.Id, req.Object, req.Relation, req.Subject)
+
+	if err != nil {
+		render.Render(w, r, errRepository(err))
+		return
+	}
+
+	render.Render(w, r, checkResponse{allowed})
+}
+
+// Expand responds with the tree of subjects that have the relation to the object in the request.
+func Expand(w http.ResponseWriter, r *http.Request) {
+	var req expandRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		render.Render(w, r, errInvalidRequest(err))
+		return
+	}
+
+	if req.Object == "" || req.Relation == "" {
+		render.Render(w, r, errInvalidRequest(errors.New("object and relation are required")))
+		return
+	}
+
+	tenant, checker, ok := authzRequestContext(w, r)
+
+	if !ok {
+		return
+	}
+
+	err = checker.Validate(common.Tuple{Object: req.Object, Relation: req.Relation, Subject: "*"})
+
+	if err != nil {
+		render.Render(w, r, errInvalidRequest(err))
+		return
+	}
+
+	tree, err := checker.Expand(r.Context(), tenant.Id, req.Object, req.Relation)
+
+	if err != nil {
+		render.Render(w, r, errRepository(err))
+		return
+	}
+
+	render.Render(w, r, expandResponse{tree})
+}
+
+// WriteTuples atomically adds and removes the relationship tuples in the request.
+func WriteTuples(w http.ResponseWriter, r *http.Request) {
+	var req writeRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		render.Render(w, r, errInvalidRequest(err))
+		return
+	}
+
+	if len(req.Writes) == 0 && len(req.Deletes) == 0 {
+		render.Render(w, r, errInvalidRequest(errors.New("writes or deletes are required")))
+		return
+	}
+
+	tenant, checker, ok := authzRequestContext(w, r)
+
+	if !ok {
+		return
+	}
+
+	for _, tuple := range req.Writes {
+		if err = checker.Validate(tuple); err != nil {
+			render.Render(w, r, errInvalidRequest(err))
+			return
+		}
+	}
+
+	tupleRepo, ok := r.Context().Value("repo").(repository.TupleRepository)
+
+	if !ok {
+		render.Render(w, r, errRepository(errors.New("TupleRepository not found in context")))
+		return
+	}
+
+	err = tupleRepo.WriteTuples(r.Context(), tenant.Id, req.Writes, req.Deletes)
+
+	if err != nil {
+		render.Render(w, r, errFromRepository(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,122 @@
+package service_test
+
+import (
+	"encoding/json"
+	"github.com/go-chi/chi"
+	"github.com/stone1549/auth-service/authz"
+	"github.com/stone1549/auth-service/common"
+	"github.com/stone1549/auth-service/repository"
+	"github.com/stone1549/auth-service/service"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// authzRouter routes relationship authorization requests as the service does, leaving out the service token and
+// audit middleware in front of them.
+func authzRouter() http.Handler {
+	r := chi.NewRouter()
+	r.Post("/authz/check", service.Check)
+	r.Post("/authz/expand", service.Expand)
+	r.Post("/authz/write", service.WriteTuples)
+
+	return r
+}
+
+// newAuthzService constructs a test service checking relationships against the sample namespaces.
+func newAuthzService(t *testing.T) *testService {
+	ts := newTestService(t, common.TenantPolicy{})
+	namespaces, err := authz.LoadNamespaces("../data/namespaces.authz")
+	ok(t, err)
+	ts.values["authz"] = authz.NewChecker(namespaces, ts.repo.(repository.TupleRepository))
+
+	return ts
+}
+
+// postAuthz posts a relationship authorization request.
+func postAuthz(ts *testService, path, body string) *httptest.ResponseRecorder {
+	return ts.serve(authzRouter(), httptest.NewRequest("POST", "https://auth.example.com/authz"+path,
+		strings.NewReader(body)))
+}
+
+// checkAllowed posts a check for the tuple, failing the test unless it succeeds, and reports whether it's allowed.
+func checkAllowed(t *testing.T, ts *testService, object, relation, subject string) bool {
+	resp := postAuthz(ts, "/check",
+		`{"object": "`+object+`", "relation": "`+relation+`", "subject": "`+subject+`"}`)
+	equals(t, http.StatusOK, resp.Code)
+
+	var body struct {
+		Allowed bool `json:"allowed"`
+	}
+	ok(t, json.NewDecoder(resp.Body).Decode(&body))
+
+	return body.Allowed
+}
+
+// TestCheck_Written ensures tuples written through the service are followed by checks, including through tupleset
+// relations, and that checks only see the tuples of their own tenant.
+func TestCheck_Written(t *testing.T) {
+	ts := newAuthzService(t)
+
+	equals(t, false, checkAllowed(t, ts, "document:readme", "viewer", "alice"))
+
+	resp := postAuthz(ts, "/write", `{"writes": [
+		{"object": "document:readme", "relation": "parent", "subject": "folder:docs"},
+		{"object": "folder:docs", "relation": "owner", "subject": "alice"}]}`)
+	equals(t, http.StatusNoContent, resp.Code)
+
+	equals(t, true, checkAllowed(t, ts, "document:readme", "viewer", "alice"))
+	equals(t, false, checkAllowed(t, ts, "document:readme", "editor", "alice"))
+
+	ts.tenant.Id = "other"
+	equals(t, false, checkAllowed(t, ts, "document:readme", "viewer", "alice"))
+}
+
+// TestWriteTuples_Invalid ensures tuples that don't fit the namespaces are refused without writing any of the
+// request.
+func TestWriteTuples_Invalid(t *testing.T) {
+	ts := newAuthzService(t)
+
+	equals(t, http.StatusBadRequest, postAuthz(ts, "/write", `{}`).Code)
+	equals(t, http.StatusBadRequest, postAuthz(ts, "/write", `{"writes": [
+		{"object": "document:readme", "relation": "owner", "subject": "alice"},
+		{"object": "document:readme", "relation": "parent", "subject": "alice"}]}`).Code)
+	equals(t, http.StatusBadRequest, postAuthz(ts, "/write", `{"writes": [
+		{"object": "document:readme", "relation": "approver", "subject": "alice"}]}`).Code)
+
+	equals(t, false, checkAllowed(t, ts, "document:readme", "owner", "alice"))
+}
+
+// TestCheck_Invalid ensures incomplete checks and checks of unknown relations are refused, and that requests are
+// refused when the service hasn't configured a checker.
+func TestCheck_Invalid(t *testing.T) {
+	ts := newAuthzService(t)
+
+	equals(t, http.StatusBadRequest, postAuthz(ts, "/check", `{"object": "document:readme"}`).Code)
+	equals(t, http.StatusBadRequest, postAuthz(ts, "/check",
+		`{"object": "document:readme", "relation": "approver", "subject": "alice"}`).Code)
+	equals(t, http.StatusBadRequest, postAuthz(ts, "/expand", `{"object": "spreadsheet:1", "relation": "owner"}`).Code)
+
+	delete(ts.values, "authz")
+	equals(t, http.StatusInternalServerError, postAuthz(ts, "/check",
+		`{"object": "document:readme", "relation": "owner", "subject": "alice"}`).Code)
+}
+
+// TestExpand ensures the tree of a relation describes the tuples written for it.
+func TestExpand(t *testing.T) {
+	ts := newAuthzService(t)
+
+	resp := postAuthz(ts, "/write", `{"writes": [
+		{"object": "folder:docs", "relation": "owner", "subject": "alice"}]}`)
+	equals(t, http.StatusNoContent, resp.Code)
+
+	resp = postAuthz(ts, "/expand", `{"object": "folder:docs", "relation": "owner"}`)
+	equals(t, http.StatusOK, resp.Code)
+
+	var body struct {
+		Tree authz.ExpandNode `json:"tree"`
+	}
+	ok(t, json.NewDecoder(resp.Body).Decode(&body))
+	equals(t, []string{"alice"}, body.Tree.Subjects)
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"github.com/go-chi/render"
+	"github.com/stone1549/auth-service/audit"
+	"github.com/stone1549/auth-service/common"
+	"github.com/stone1549/auth-service/repository"
+	"net/http"
+	"strings"
+)
+
+// certificateEmail retrieves the email a client certificate identifies its holder by, the first email address in
+// its subject alternative names or else its common name when that's an email.
+func certificateEmail(cert *x509.Certificate) string {
+	if len(cert.EmailAddresses) > 0 {
+		return cert.EmailAddresses[0]
+	} else if strings.Contains(cert.Subject.CommonName, "@") {
+		return cert.Subject.CommonName
+	}
+
+	return ""
+}
+
+// NewSessionCertificateMiddleware logs in the user identified by the verified client certificate the connection was
+// authenticated with, adding a token for them to the context. Only existing, active users can log in this way.
+func NewSessionCertificateMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cert, ok := r.Context().Value("clientCert").(*x509.Certificate)
+
+		if !ok {
+			render.Render(w, r, errUnauthorized(errors.New("a verified client certificate is required")))
+			return
+		}
+
+		tenant, ok := r.Context().Value("tenant").(common.Tenant)
+
+		if !ok {
+			render.Render(w, r, errUnknown(errors.New("tenant not found in context")))
+			return
+		}
+
+		userRepo, ok := r.Context().Value("repo").(repository.UserAdminRepository)
+
+		if !ok {
+			render.Render(w, r, errRepository(errors.New("UserAdminRepository not found in context")))
+			return
+		}
+
+		details := map[string]string{"method": "certificate", "subject": cert.Subject.String()}
+		email := certificateEmail(cert)
+
+		if email == "" {
+			recordAudit(r, audit.Event{Type: audit.LoginFailed, Reason: "certificate names no email",
+				Details: details})
+			render.Render(w, r, errUnauthorized(errors.New("client certificate doesn't name an email")))
+			return
+		}
+
+		account, err := userRepo.GetUserByEmail(r.Context(), tenant.Id, email)
+
+		if err == nil && !account.Active {
+			err = errors.New("user is disabled")
+		}
+
+		if err != nil {
+			recordAudit(r, audit.Event{Type: audit.LoginFailed, Email: email, Reason: err.Error(), Details: details})
+			render.Render(w, r, errUnauthorized(errors.New("no active user for client certificate")))
+			return
+		}
+
+		if !checkDevice(w, r, tenant, account.Id, email, false) {
+			return
+		}
+
+		token, errRender := newSessionToken(r, tenant, account.Id, email, false)
+
+		if errRender != nil {
+			render.Render(w, r, errRender)
+			return
+		}
+
+		recordAudit(r, audit.Event{Type: audit.LoginSucceeded, ActorId: account.Id, UserId: account.Id, Email: email,
+			Success: true, Details: details})
+
+		ctx := context.WithValue(r.Context(), "token", token)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
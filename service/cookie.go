@@ -0,0 +1,152 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"github.com/go-chi/render"
+	"github.com/stone1549/auth-service/repository"
+	"net/http"
+	"time"
+)
+
+const (
+	// csrfCookie carries the CSRF token browsers with a session cookie must echo in the CsrfHeader.
+	csrfCookie = "csrf_token"
+	// CsrfHeader is the request header state changing requests authenticated by a session cookie echo the
+	// csrf_token cookie in.
+	CsrfHeader = "X-CSRF-Token"
+)
+
+// setSessionCookies keeps a session's token in an HttpOnly cookie, along with a CSRF token scripts can read,
+// returning the CSRF token.
+func setSessionCookies(w http.ResponseWriter, token string, maxAge int) (string, error) {
+	csrf := make([]byte, 32)
+
+	if _, err := rand.Read(csrf); err != nil {
+		return "", err
+	}
+
+	csrfToken := base64.RawURLEncoding.EncodeToString(csrf)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookie,
+		Value:    csrfToken,
+		Path:     "/",
+		MaxAge:   maxAge,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return csrfToken, nil
+}
+
+// sessionCookieMaxAge is how many seconds a browser keeps the cookies of a token: until its session outlives its
+// lifetime, or until the token expires when it has no session or its session has no lifetime.
+func sessionCookieMaxAge(r *http.Request, token string) (int, error) {
+	tokenFactory, ok := r.Context().Value("tokenFactory").(TokenFactory)
+
+	if !ok {
+		return 0, errors.New("token factory not found in context")
+	}
+
+	claims, err := tokenFactory.ParseToken(token)
+
+	if err != nil {
+		return 0, err
+	}
+
+	expiresAt := time.Unix(claims.Exp, 0)
+	sessionRepo, ok := r.Context().Value("repo").(repository.SessionRepository)
+
+	if ok && claims.Sid != "" {
+		session, err := sessionRepo.GetSession(r.Context(), claims.TenantId, claims.Sid)
+
+		if err != nil {
+			return 0, err
+		} else if !session.ExpiresAt.IsZero() {
+			expiresAt = session.ExpiresAt
+		}
+	}
+
+	return int(time.Until(expiresAt).Seconds()), nil
+}
+
+func clearSessionCookies(w http.ResponseWriter) {
+	for _, name := range []string{sessionCookie, csrfCookie} {
+		http.SetCookie(w, &http.Cookie{
+			Name:     name,
+			Path:     "/",
+			MaxAge:   -1,
+			HttpOnly: name == sessionCookie,
+			Secure:   true,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+}
+
+// isStateChanging is whether a request's method may change state, so must be protected from cross site forgery.
+func isStateChanging(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return false
+	default:
+		return true
+	}
+}
+
+// checkCsrf ensures a state changing request authenticated by a session cookie echoes its CSRF cookie in the
+// CsrfHeader. Requests bearing their token in the Authorization header can't be forged by another site.
+func checkCsrf(r *http.Request) error {
+	if !isStateChanging(r) || bearerToken(r) != "" {
+		return nil
+	}
+
+	if _, err := r.Cookie(sessionCookie); err != nil {
+		return nil
+	}
+
+	cookie, err := r.Cookie(csrfCookie)
+	header := r.Header.Get(CsrfHeader)
+
+	if err != nil || cookie.Value == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(header)) != 1 {
+		return errors.New("CSRF token doesn't match")
+	}
+
+	return nil
+}
+
+// Logout ends the session of the request's token, and a browser's cookie session by clearing its cookies.
+func Logout(w http.ResponseWriter, r *http.Request) {
+	if err := checkCsrf(r); err != nil {
+		render.Render(w, r, errForbidden(err))
+		return
+	}
+
+	if token := requestToken(r); token != "" {
+		claims, errRender := tokenClaims(r, token)
+		sessionRepo, ok := r.Context().Value("repo").(repository.SessionRepository)
+
+		if errRender == nil && ok && claims.Sid != "" {
+			err := revokeSession(r, sessionRepo, claims, claims.Sid)
+
+			if err != nil && !repository.IsNotFound(err) {
+				render.Render(w, r, errRepository(err))
+				return
+			}
+		}
+	}
+
+	clearSessionCookies(w)
+	w.WriteHeader(http.StatusNoContent)
+}
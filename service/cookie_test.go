@@ -0,0 +1,128 @@
+package service_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/stone1549/auth-service/common"
+	"github.com/stone1549/auth-service/service"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// cookieTestPolicy keeps sessions in cookies, with sessions and remembered sessions outliving their tokens.
+var cookieTestPolicy = common.TenantPolicy{CookieSessions: true, SessionLifetime: 8 * time.Hour,
+	RememberMeLifetime: 30 * 24 * time.Hour}
+
+// cookieLogin logs a user in to a tenant with cookie sessions, returning the session and CSRF cookies and the CSRF
+// token it responded with.
+func cookieLogin(t *testing.T, ts *testService, email string, rememberMe bool) (*http.Cookie, *http.Cookie,
+	string) {
+	resp := ts.login(t, httptest.NewRequest("POST", "https://auth.example.com/session", strings.NewReader(
+		fmt.Sprintf(`{"email": "%s", "password": "%s", "rememberMe": %t}`, email, testPassword, rememberMe))))
+	equals(t, http.StatusOK, resp.Code)
+
+	var body struct {
+		Token     string `json:"token"`
+		CsrfToken string `json:"csrfToken"`
+	}
+
+	ok(t, json.NewDecoder(resp.Body).Decode(&body))
+	equals(t, "", body.Token)
+	cookies := make(map[string]*http.Cookie)
+
+	for _, cookie := range resp.Result().Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+
+	equals(t, 2, len(cookies))
+	equals(t, body.CsrfToken, cookies["csrf_token"].Value)
+
+	return cookies["session"], cookies["csrf_token"], body.CsrfToken
+}
+
+// withCookies adds the session and CSRF cookies to a request.
+func withCookies(req *http.Request, session, csrf *http.Cookie) *http.Request {
+	req.AddCookie(&http.Cookie{Name: session.Name, Value: session.Value})
+	req.AddCookie(&http.Cookie{Name: csrf.Name, Value: csrf.Value})
+
+	return req
+}
+
+// about fails the test unless the number of seconds act is within a few seconds of exp.
+func about(t *testing.T, exp time.Duration, act int) {
+	if diff := exp - time.Duration(act)*time.Second; diff < 0 || diff > 5*time.Second {
+		equals(t, int(exp.Seconds()), act)
+	}
+}
+
+// TestNewSession_Cookies ensures sessions are kept in a secure HttpOnly cookie, with a CSRF cookie scripts can read,
+// both lasting as long as the session rather than its token.
+func TestNewSession_Cookies(t *testing.T) {
+	ts := newTestService(t, cookieTestPolicy)
+	ts.newUser(t, "user@example.com")
+
+	session, csrf, _ := cookieLogin(t, ts, "user@example.com", false)
+	equals(t, true, session.HttpOnly)
+	equals(t, true, session.Secure)
+	equals(t, http.SameSiteLaxMode, session.SameSite)
+	equals(t, "/", session.Path)
+	about(t, cookieTestPolicy.SessionLifetime, session.MaxAge)
+	equals(t, false, csrf.HttpOnly)
+	equals(t, true, csrf.Secure)
+	equals(t, http.SameSiteLaxMode, csrf.SameSite)
+	about(t, cookieTestPolicy.SessionLifetime, csrf.MaxAge)
+
+	session, csrf, _ = cookieLogin(t, ts, "user@example.com", true)
+	about(t, cookieTestPolicy.RememberMeLifetime, session.MaxAge)
+	about(t, cookieTestPolicy.RememberMeLifetime, csrf.MaxAge)
+}
+
+// TestLogout_Csrf ensures state changing requests authenticated by the session cookie must echo the CSRF token, and
+// that logging out revokes the session and clears both cookies.
+func TestLogout_Csrf(t *testing.T) {
+	ts := newTestService(t, cookieTestPolicy)
+	ts.newUser(t, "user@example.com")
+	session, csrf, csrfToken := cookieLogin(t, ts, "user@example.com", false)
+	logout := http.HandlerFunc(service.Logout)
+	logoutRequest := func(header string) *http.Request {
+		req := withCookies(httptest.NewRequest("DELETE", "https://auth.example.com/session", nil), session, csrf)
+
+		if header != "" {
+			req.Header.Set(service.CsrfHeader, header)
+		}
+
+		return req
+	}
+
+	equals(t, http.StatusForbidden, ts.serve(logout, logoutRequest("")).Code)
+	equals(t, http.StatusForbidden, ts.serve(logout, logoutRequest("forged")).Code)
+
+	sessions := service.AuthenticatedMiddleware(http.HandlerFunc(service.GetMySessions))
+	getSessions := withCookies(httptest.NewRequest("GET", "https://auth.example.com/me/sessions", nil), session,
+		csrf)
+	equals(t, http.StatusOK, ts.serve(sessions, getSessions).Code)
+
+	revoke := service.AuthenticatedMiddleware(http.HandlerFunc(service.RevokeMySession))
+	revokeRequest := withCookies(httptest.NewRequest("DELETE", "https://auth.example.com/me/sessions/unknown", nil),
+		session, csrf)
+	equals(t, http.StatusForbidden, ts.serve(revoke, revokeRequest).Code)
+
+	resp := ts.serve(logout, logoutRequest(csrfToken))
+	equals(t, http.StatusNoContent, resp.Code)
+	cleared := make(map[string]bool)
+
+	for _, cookie := range resp.Result().Cookies() {
+		equals(t, "", cookie.Value)
+		equals(t, -1, cookie.MaxAge)
+		equals(t, true, cookie.Secure)
+		cleared[cookie.Name] = true
+	}
+
+	equals(t, map[string]bool{"session": true, "csrf_token": true}, cleared)
+
+	getSessions = withCookies(httptest.NewRequest("GET", "https://auth.example.com/me/sessions", nil), session, csrf)
+	equals(t, http.StatusUnauthorized, ts.serve(sessions, getSessions).Code)
+}
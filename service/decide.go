@@ -0,0 +1,165 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/render"
+	"github.com/stone1549/auth-service/common"
+	"github.com/stone1549/auth-service/policy"
+	"github.com/stone1549/auth-service/repository"
+	"net/http"
+	"time"
+)
+
+type decideRequest struct {
+	Action      string                 `json:"action"`
+	Subject     map[string]interface{} `json:"subject"`
+	Resource    map[string]interface{} `json:"resource"`
+	Environment map[string]interface{} `json:"environment"`
+}
+
+type decideResponse struct {
+	policy.Decision
+	Allowed bool `json:"allowed"`
+}
+
+func (dr decideResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// Decide evaluates the request's action against the attribute based authorization policies. The subject is made of
+// the bearer token's claims, the user's groups and the attributes of their account, never from the request, and the
+// environment is completed with the current time and the client's address.
+func Decide(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value("claims").(Claims)
+
+	if !ok {
+		render.Render(w, r, errUnauthorized(errors.New("token is required")))
+		return
+	}
+
+	var req decideRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		render.Render(w, r, errInvalidRequest(err))
+		return
+	}
+
+	if req.Action == "" {
+		render.Render(w, r, errInvalidRequest(errors.New("action is required")))
+		return
+	} else if req.Subject != nil {
+		render.Render(w, r, errInvalidRequest(errors.New("subject is taken from the token and can't be given")))
+		return
+	}
+
+	engine, ok := r.Context().Value("policy").(policy.Engine)
+
+	if !ok {
+		render.Render(w, r, errUnknown(errors.New("policy engine not found in context")))
+		return
+	}
+
+	subject, errRender := decisionSubject(r, claims)
+
+	if errRender != nil {
+		render.Render(w, r, errRender)
+		return
+	}
+
+	doc := policy.Document{
+		Action:      req.Action,
+		Subject:     subject,
+		Resource:    req.Resource,
+		Environment: req.Environment,
+	}
+
+	if doc.Environment == nil {
+		doc.Environment = make(map[string]interface{})
+	}
+
+	now := time.Now().UTC()
+	doc.Environment["time"] = now.Format(time.RFC3339)
+	doc.Environment["hour"] = now.Hour()
+	doc.Environment["weekday"] = now.Weekday().String()
+
+	doc.Environment["ip"] = clientIp(r)
+
+	decision, err := engine.Decide(doc)
+
+	if err != nil {
+		render.Render(w, r, errUnknown(err))
+		return
+	}
+
+	render.Render(w, r, decideResponse{decision, decision.Effect == policy.Allow})
+}
+
+// decisionSubject describes the authenticated user from data the service holds: their token's claims, the groups
+// they're a member of and the details of their account, when the repository has one for them. The account's
+// attributes are kept under subject.attributes so that none of them can stand in for a claim or a group.
+func decisionSubject(r *http.Request, claims Claims) (map[string]interface{}, render.Renderer) {
+	subject := make(map[string]interface{})
+
+	for key, value := range claims.mapClaims() {
+		subject[key] = value
+	}
+
+	tenant, ok := r.Context().Value("tenant").(common.Tenant)
+
+	if !ok {
+		return nil, errUnknown(errors.New("tenant not found in context"))
+	}
+
+	groups := claims.Groups
+
+	if groupRepo, ok := r.Context().Value("repo").(repository.GroupRepository); ok {
+		userGroups, err := groupRepo.GetUserGroups(r.Context(), tenant.Id, claims.Sub)
+
+		if err != nil {
+			return nil, errRepository(err)
+		}
+
+		groups = make([]string, 0, len(userGroups))
+
+		for _, group := range userGroups {
+			groups = append(groups, group.Name)
+		}
+	}
+
+	if groups == nil {
+		groups = []string{}
+	}
+
+	subject["groups"] = groups
+
+	if userRepo, ok := r.Context().Value("repo").(repository.UserAdminRepository); ok {
+		account, err := userRepo.GetUser(r.Context(), tenant.Id, claims.Sub)
+
+		if err != nil && !repository.IsNotFound(err) {
+			return nil, errRepository(err)
+		} else if err == nil {
+			subject["email"] = account.Email
+			subject["externalId"] = account.ExternalId
+			subject["givenName"] = account.GivenName
+			subject["familyName"] = account.FamilyName
+			subject["displayName"] = account.DisplayName
+			subject["active"] = account.Active
+			subject["attributes"] = accountAttributes(account)
+		}
+	}
+
+	return subject, nil
+}
+
+// accountAttributes converts an account's attributes to the values of a policy document.
+func accountAttributes(account common.UserAccount) map[string]interface{} {
+	attributes := make(map[string]interface{}, len(account.Attributes))
+
+	for key, value := range account.Attributes {
+		attributes[key] = value
+	}
+
+	return attributes
+}
@@ -0,0 +1,108 @@
+package service_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stone1549/auth-service/common"
+	"github.com/stone1549/auth-service/policy"
+	"github.com/stone1549/auth-service/repository"
+	"github.com/stone1549/auth-service/service"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestDecide ensures the subject of a decision is built from the user's groups in the repository, and that subjects
+// given in the request are refused rather than trusted.
+func TestDecide(t *testing.T) {
+	ts := newTestService(t, common.TenantPolicy{})
+	engine, err := policy.NewEngine("../data/policies")
+	ok(t, err)
+	ts.values["policy"] = engine
+
+	userId := ts.newUser(t, "admin@example.com")
+	token := responseToken(t, ts.login(t, loginRequest("admin@example.com")))
+	handler := service.AuthenticatedMiddleware(http.HandlerFunc(service.Decide))
+	decide := func(body string) *http.Request {
+		return authenticated("POST", "https://auth.example.com/authz/decide", token, strings.NewReader(body))
+	}
+	allowed := func(resp *httptest.ResponseRecorder) bool {
+		var body struct {
+			Allowed bool `json:"allowed"`
+		}
+		ok(t, json.NewDecoder(resp.Body).Decode(&body))
+		return body.Allowed
+	}
+
+	resp := ts.serve(handler, decide(`{"action": "users:delete", "subject": {"groups": ["admins"]},
+		"resource": {"id": "2"}}`))
+	equals(t, http.StatusBadRequest, resp.Code)
+
+	resp = ts.serve(handler, decide(`{"action": "users:delete", "resource": {"id": "2"}}`))
+	equals(t, http.StatusOK, resp.Code)
+	equals(t, false, allowed(resp))
+
+	groupRepo := ts.repo.(repository.GroupRepository)
+	group, err := groupRepo.NewGroup(context.Background(), ts.tenant.Id, "admins", "")
+	ok(t, err)
+	ok(t, groupRepo.AddGroupUser(context.Background(), ts.tenant.Id, group.Id, userId))
+
+	resp = ts.serve(handler, decide(`{"action": "users:delete", "resource": {"id": "2"}}`))
+	equals(t, http.StatusOK, resp.Code)
+	equals(t, true, allowed(resp))
+}
+
+// TestDecide_AccountAttributes ensures policies compare resources with the attributes of the user's account, and
+// that a user without an attribute isn't allowed whatever the resource is missing.
+func TestDecide_AccountAttributes(t *testing.T) {
+	dir := t.TempDir()
+	ok(t, ioutil.WriteFile(filepath.Join(dir, "users.json"), []byte(`{"policies": [{
+		"id": "support-view-own-region", "effect": "allow", "actions": ["users:view"],
+		"when": [
+			{"contains": [{"var": "subject.groups"}, "support"]},
+			{"eq": [{"var": "resource.region"}, {"var": "subject.attributes.region"}]}
+		]}]}`), 0600))
+
+	ts := newTestService(t, common.TenantPolicy{})
+	engine, err := policy.NewEngine(dir)
+	ok(t, err)
+	ts.values["policy"] = engine
+
+	userId := ts.newUser(t, "support@example.com")
+	groupRepo := ts.repo.(repository.GroupRepository)
+	group, err := groupRepo.NewGroup(context.Background(), ts.tenant.Id, "support", "")
+	ok(t, err)
+	ok(t, groupRepo.AddGroupUser(context.Background(), ts.tenant.Id, group.Id, userId))
+
+	token := responseToken(t, ts.login(t, loginRequest("support@example.com")))
+	view := func(resource string) bool {
+		resp := ts.serve(service.AuthenticatedMiddleware(http.HandlerFunc(service.Decide)),
+			authenticated("POST", "https://auth.example.com/authz/decide", token,
+				strings.NewReader(`{"action": "users:view", "resource": `+resource+`}`)))
+		equals(t, http.StatusOK, resp.Code)
+
+		var body struct {
+			Allowed bool `json:"allowed"`
+		}
+		ok(t, json.NewDecoder(resp.Body).Decode(&body))
+
+		return body.Allowed
+	}
+
+	equals(t, false, view(`{"id": "2"}`))
+	equals(t, false, view(`{"id": "2", "region": "eu"}`))
+
+	userRepo := ts.repo.(repository.UserAdminRepository)
+	account, err := userRepo.GetUser(context.Background(), ts.tenant.Id, userId)
+	ok(t, err)
+	account.Attributes = map[string]string{"region": "eu"}
+	_, err = userRepo.UpdateUser(context.Background(), account)
+	ok(t, err)
+
+	equals(t, true, view(`{"id": "2", "region": "eu"}`))
+	equals(t, false, view(`{"id": "2", "region": "us"}`))
+	equals(t, false, view(`{"id": "2"}`))
+}
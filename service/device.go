@@ -0,0 +1,196 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/render"
+	"github.com/stone1549/auth-service/audit"
+	"github.com/stone1549/auth-service/common"
+	"github.com/stone1549/auth-service/device"
+	"github.com/stone1549/auth-service/logging"
+	"github.com/stone1549/auth-service/mail"
+	"github.com/stone1549/auth-service/repository"
+	"net/http"
+	"time"
+)
+
+type challengeResponse struct {
+	StatusText  string `json:"status"`
+	ErrorText   string `json:"error"`
+	ChallengeId string `json:"challengeId"`
+}
+
+func (cr challengeResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	render.Status(r, http.StatusUnauthorized)
+	return nil
+}
+
+type challengeRequest struct {
+	ChallengeId string `json:"challengeId"`
+	Code        string `json:"code"`
+}
+
+// checkDevice compares the device a user logged in from against those they've used before, when the tenant watches
+// for new devices. Logins from a new device are recorded, and the user is emailed about them, or must confirm them
+// with an emailed code when the tenant asks for step up. A user's first device isn't considered new. Returns whether
+// the login may go ahead, having rendered the response when it can't.
+func checkDevice(w http.ResponseWriter, r *http.Request, tenant common.Tenant, userId, email string,
+	rememberMe bool) bool {
+	if !tenant.Policy.NewDeviceAlerts && !tenant.Policy.NewDeviceStepUp {
+		return true
+	}
+
+	detector, ok := r.Context().Value("devices").(*device.Detector)
+
+	if !ok {
+		render.Render(w, r, errUnknown(errors.New("device detector not found in context")))
+		return false
+	}
+
+	deviceRepo, ok := r.Context().Value("repo").(repository.DeviceRepository)
+
+	if !ok {
+		render.Render(w, r, errRepository(errors.New("DeviceRepository not found in context")))
+		return false
+	}
+
+	seen := detector.Fingerprint(tenant.Id, userId, clientIp(r), r.UserAgent())
+	known, err := deviceRepo.ListDevices(r.Context(), tenant.Id, userId)
+
+	if err != nil {
+		render.Render(w, r, errRepository(err))
+		return false
+	}
+
+	isNew := len(known) > 0
+
+	for _, knownDevice := range known {
+		isNew = isNew && knownDevice.Fingerprint != seen.Fingerprint
+	}
+
+	if isNew {
+		recordAudit(r, audit.Event{Type: audit.NewDevice, ActorId: userId, UserId: userId, Email: email,
+			Success: true, Details: map[string]string{"device": seen.Label, "network": seen.Network}})
+	}
+
+	if isNew && tenant.Policy.NewDeviceStepUp {
+		challengeId, code, err := detector.Challenges.Begin(device.Challenge{Email: email, Device: seen,
+			RememberMe: rememberMe})
+
+		if err != nil {
+			render.Render(w, r, errUnknown(err))
+			return false
+		}
+
+		sendEmail(r, email, "Confirm your login", fmt.Sprintf("Someone logged in to your account from %s (%s). "+
+			"If it was you, enter this code to continue: %s\n\nIt expires in %d minutes. If it wasn't you, change "+
+			"your password.", seen.Label, seen.Network, code, int(device.ChallengeTimeout.Minutes())))
+		render.Render(w, r, challengeResponse{StatusText: "Step up required.",
+			ErrorText:   "login from a new device must be confirmed with the code emailed to the user",
+			ChallengeId: challengeId})
+		return false
+	}
+
+	_, err = deviceRepo.SaveDevice(r.Context(), seen)
+
+	if err != nil {
+		render.Render(w, r, errRepository(err))
+		return false
+	}
+
+	if isNew && tenant.Policy.NewDeviceAlerts {
+		sendEmail(r, email, "New login to your account", fmt.Sprintf("Someone logged in to your account from %s "+
+			"(%s) at %s. If it wasn't you, revoke the session and change your password.", seen.Label, seen.Network,
+			time.Now().UTC().Format(time.RFC1123)))
+	}
+
+	return true
+}
+
+// sendEmail emails a user in the background, so logins don't wait on the mail server.
+func sendEmail(r *http.Request, to, subject, body string) {
+	mailer, ok := r.Context().Value("mailer").(mail.Mailer)
+
+	if !ok {
+		logging.FromContext(r.Context()).Error("Unable to email user, mailer not found in context")
+		return
+	}
+
+	logger := logging.FromContext(r.Context())
+
+	go func() {
+		if err := mailer.Send(to, subject, body); err != nil {
+			logger.Error("Unable to email user", "error", err.Error())
+		}
+	}()
+}
+
+// NewSessionChallengeMiddleware completes a login from a new device with the code emailed to the user, remembering
+// the device and adding a token for the user to the context.
+func NewSessionChallengeMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req challengeRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+
+		if err != nil {
+			render.Render(w, r, errInvalidRequest(err))
+			return
+		} else if req.ChallengeId == "" || req.Code == "" {
+			render.Render(w, r, errInvalidRequest(errors.New("challengeId and code are required")))
+			return
+		}
+
+		tenant, ok := r.Context().Value("tenant").(common.Tenant)
+
+		if !ok {
+			render.Render(w, r, errUnknown(errors.New("tenant not found in context")))
+			return
+		}
+
+		detector, ok := r.Context().Value("devices").(*device.Detector)
+
+		if !ok {
+			render.Render(w, r, errUnknown(errors.New("device detector not found in context")))
+			return
+		}
+
+		deviceRepo, ok := r.Context().Value("repo").(repository.DeviceRepository)
+
+		if !ok {
+			render.Render(w, r, errRepository(errors.New("DeviceRepository not found in context")))
+			return
+		}
+
+		challenge, err := detector.Challenges.Complete(tenant.Id, req.ChallengeId, req.Code)
+
+		if err != nil {
+			recordAudit(r, audit.Event{Type: audit.LoginFailed, Reason: err.Error(),
+				Details: map[string]string{"challengeId": req.ChallengeId}})
+			render.Render(w, r, errUnauthorized(err))
+			return
+		}
+
+		userId := challenge.Device.UserId
+		_, err = deviceRepo.SaveDevice(r.Context(), challenge.Device)
+
+		if err != nil {
+			render.Render(w, r, errRepository(err))
+			return
+		}
+
+		token, errRender := newSessionToken(r, tenant, userId, challenge.Email, challenge.RememberMe)
+
+		if errRender != nil {
+			render.Render(w, r, errRender)
+			return
+		}
+
+		recordAudit(r, audit.Event{Type: audit.LoginSucceeded, ActorId: userId, UserId: userId,
+			Email: challenge.Email, Success: true, Details: map[string]string{"device": challenge.Device.Label}})
+
+		ctx := context.WithValue(r.Context(), "token", token)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
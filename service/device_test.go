@@ -0,0 +1,196 @@
+package service_test
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"github.com/go-chi/chi"
+	"github.com/stone1549/auth-service/common"
+	"github.com/stone1549/auth-service/device"
+	"github.com/stone1549/auth-service/service"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sentEmail is an email a test mailer was asked to send.
+type sentEmail struct {
+	to      string
+	subject string
+	body    string
+}
+
+// testMailer hands the emails it's asked to send to the test, as they're sent in the background.
+type testMailer chan sentEmail
+
+func (tm testMailer) Send(to, subject, body string) error {
+	tm <- sentEmail{to: to, subject: subject, body: body}
+	return nil
+}
+
+// received waits for the next email sent, failing the test when none is sent in time.
+func (tm testMailer) received(t *testing.T) sentEmail {
+	select {
+	case email := <-tm:
+		return email
+	case <-time.After(5 * time.Second):
+		t.Fatal("no email sent")
+		return sentEmail{}
+	}
+}
+
+// deviceRouter routes the logins new devices are checked for as the service does, leaving out the middleware adding
+// the detector and mailer to the context.
+func deviceRouter() http.Handler {
+	r := chi.NewRouter()
+	r.With(service.NewSessionMiddleware).Post("/session", service.NewSession)
+	r.With(service.NewSessionChallengeMiddleware).Post("/session/challenge", service.NewSession)
+	r.With(service.NewSessionCertificateMiddleware).Post("/session/certificate", service.NewSession)
+
+	return r
+}
+
+// newDeviceService constructs a test service watching for new devices with the policy, returning the mailer users
+// are emailed through.
+func newDeviceService(t *testing.T, policy common.TenantPolicy) (*testService, testMailer) {
+	ts := newTestService(t, policy)
+	detector, err := device.NewDetector("")
+	ok(t, err)
+
+	mailer := make(testMailer, 10)
+	ts.values["devices"] = detector
+	ts.values["mailer"] = mailer
+
+	return ts, mailer
+}
+
+// loginFrom makes a request logging a user in with their password from an address.
+func loginFrom(email, remoteAddr string) *http.Request {
+	req := loginRequest(email)
+	req.RemoteAddr = remoteAddr
+	req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64) Firefox/118.0")
+
+	return req
+}
+
+// challengeId retrieves the id of the challenge a login was held with.
+func challengeId(t *testing.T, resp *httptest.ResponseRecorder) string {
+	equals(t, http.StatusUnauthorized, resp.Code)
+
+	var body struct {
+		ChallengeId string `json:"challengeId"`
+	}
+
+	ok(t, json.NewDecoder(resp.Body).Decode(&body))
+	equals(t, true, body.ChallengeId != "")
+
+	return body.ChallengeId
+}
+
+// completeChallenge posts the code of a challenge.
+func completeChallenge(ts *testService, challengeId, code string) *httptest.ResponseRecorder {
+	return ts.serve(deviceRouter(), httptest.NewRequest("POST", "https://auth.example.com/session/challenge",
+		strings.NewReader(`{"challengeId": "`+challengeId+`", "code": "`+code+`"}`)))
+}
+
+// challengeCode is how the code appears in the email sent for a challenge.
+var challengeCode = regexp.MustCompile(`enter this code to continue: (\d{6})`)
+
+// TestDevice_Alerts ensures users are emailed about logins from a new device, but not about their first device or
+// devices they've used before.
+func TestDevice_Alerts(t *testing.T) {
+	ts, mailer := newDeviceService(t, common.TenantPolicy{NewDeviceAlerts: true})
+	ts.newUser(t, "user@example.com")
+
+	responseToken(t, ts.serve(deviceRouter(), loginFrom("user@example.com", "192.0.2.1:1234")))
+	responseToken(t, ts.serve(deviceRouter(), loginFrom("user@example.com", "192.0.2.2:1234")))
+	responseToken(t, ts.serve(deviceRouter(), loginFrom("user@example.com", "198.51.100.1:1234")))
+
+	email := mailer.received(t)
+	equals(t, "user@example.com", email.to)
+	equals(t, "New login to your account", email.subject)
+	equals(t, true, strings.Contains(email.body, "198.51.100.0/24"))
+}
+
+// TestDevice_StepUp ensures logins from a new device are held until the code emailed to the user is entered, within
+// the tenant the login was made in, after which the device is known.
+func TestDevice_StepUp(t *testing.T) {
+	ts, mailer := newDeviceService(t, common.TenantPolicy{NewDeviceStepUp: true})
+	ts.newUser(t, "user@example.com")
+
+	responseToken(t, ts.serve(deviceRouter(), loginFrom("user@example.com", "192.0.2.1:1234")))
+	id := challengeId(t, ts.serve(deviceRouter(), loginFrom("user@example.com", "198.51.100.1:1234")))
+
+	email := mailer.received(t)
+	equals(t, "Confirm your login", email.subject)
+	code := challengeCode.FindStringSubmatch(email.body)
+	equals(t, 2, len(code))
+
+	equals(t, http.StatusBadRequest, completeChallenge(ts, id, "").Code)
+	equals(t, http.StatusUnauthorized, completeChallenge(ts, id, "abcdef").Code)
+
+	tenantId := ts.tenant.Id
+	ts.tenant.Id = "other"
+	equals(t, http.StatusUnauthorized, completeChallenge(ts, id, code[1]).Code)
+
+	ts.tenant.Id = tenantId
+	responseToken(t, completeChallenge(ts, id, code[1]))
+	equals(t, http.StatusUnauthorized, completeChallenge(ts, id, code[1]).Code)
+
+	responseToken(t, ts.serve(deviceRouter(), loginFrom("user@example.com", "198.51.100.1:1234")))
+}
+
+// TestDevice_TrustedProxies ensures the device of a login forwarded by a trusted proxy is placed by the client's
+// address, and that other requests can't claim to be forwarded.
+func TestDevice_TrustedProxies(t *testing.T) {
+	ts, _ := newDeviceService(t, common.TenantPolicy{NewDeviceStepUp: true})
+	ts.newUser(t, "user@example.com")
+	_, proxies, err := net.ParseCIDR("10.0.0.0/8")
+	ok(t, err)
+	ts.values["trustedProxies"] = []*net.IPNet{proxies}
+
+	responseToken(t, ts.serve(deviceRouter(), loginFrom("user@example.com", "192.0.2.1:1234")))
+
+	req := loginFrom("user@example.com", "10.0.0.2:1234")
+	req.Header.Set("X-Forwarded-For", "192.0.2.1")
+	responseToken(t, ts.serve(deviceRouter(), req))
+
+	req = loginFrom("user@example.com", "198.51.100.1:1234")
+	req.Header.Set("X-Forwarded-For", "192.0.2.1")
+	challengeId(t, ts.serve(deviceRouter(), req))
+}
+
+// TestDevice_Certificate ensures certificate logins from a new device are held like password logins.
+func TestDevice_Certificate(t *testing.T) {
+	ts, _ := newDeviceService(t, common.TenantPolicy{NewDeviceStepUp: true})
+	ts.newUser(t, "user@example.com")
+	ts.values["clientCert"] = &x509.Certificate{EmailAddresses: []string{"user@example.com"}}
+
+	certificateLogin := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "https://auth.example.com/session/certificate", nil)
+		req.RemoteAddr = remoteAddr
+
+		return ts.serve(deviceRouter(), req)
+	}
+
+	responseToken(t, certificateLogin("192.0.2.1:1234"))
+	challengeId(t, certificateLogin("198.51.100.1:1234"))
+}
+
+// TestDevice_MissingDetector ensures logins fail rather than panic when the tenant watches for new devices but the
+// service hasn't configured a detector, and go ahead without one when it doesn't.
+func TestDevice_MissingDetector(t *testing.T) {
+	ts, _ := newDeviceService(t, common.TenantPolicy{NewDeviceAlerts: true})
+	ts.newUser(t, "user@example.com")
+	delete(ts.values, "devices")
+
+	equals(t, http.StatusInternalServerError,
+		ts.serve(deviceRouter(), loginFrom("user@example.com", "192.0.2.1:1234")).Code)
+	equals(t, http.StatusInternalServerError, completeChallenge(ts, "id", "123456").Code)
+
+	ts.tenant.Policy.NewDeviceAlerts = false
+	responseToken(t, ts.serve(deviceRouter(), loginFrom("user@example.com", "192.0.2.1:1234")))
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-chi/render"
+	"github.com/stone1549/auth-service/dpop"
+	"net/http"
+	"strings"
+)
+
+// DpopMiddleware constructs middleware validating the DPoP proof a request carries, if any, and adding it to the
+// context as "dpopProof". Requests with an invalid proof are refused, each proof is only accepted once.
+func DpopMiddleware(verifier *dpop.Verifier) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			proofs := r.Header.Values(dpop.Header)
+
+			if len(proofs) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			var proof dpop.Proof
+			err := errors.New("only one DPoP proof may be sent")
+
+			if len(proofs) == 1 {
+				proof, err = verifier.Verify(proofs[0], r.Method, verifier.RequestUrl(r))
+			}
+
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`DPoP error="invalid_dpop_proof", algs="%s"`,
+					strings.Join(dpop.SigningAlgorithms, " ")))
+				render.Render(w, r, errUnauthorized(err))
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), "dpopProof", proof)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// checkProofOfPossession refuses tokens bound to a DPoP key unless presented with the DPoP scheme and a proof signed
+// with the key for the token, and refuses unbound tokens presented with the DPoP scheme.
+func checkProofOfPossession(r *http.Request, token string, claims Claims) render.Renderer {
+	proof, hasProof := r.Context().Value("dpopProof").(dpop.Proof)
+	dpopScheme := dpopToken(r) != ""
+
+	if claims.KeyThumbprint == "" {
+		if dpopScheme {
+			return errUnauthorized(errors.New("token isn't bound to a DPoP key"))
+		}
+
+		return nil
+	}
+
+	if !dpopScheme || !hasProof {
+		return errUnauthorized(errors.New("token is bound to a DPoP key, present it with a DPoP proof"))
+	} else if proof.Thumbprint != claims.KeyThumbprint {
+		return errUnauthorized(errors.New("DPoP proof wasn't signed with the key the token is bound to"))
+	} else if proof.AccessTokenHash != dpop.AccessTokenHash(token) {
+		return errUnauthorized(errors.New("DPoP proof wasn't made for the token"))
+	}
+
+	return nil
+}
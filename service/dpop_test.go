@@ -0,0 +1,146 @@
+package service_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stone1549/auth-service/common"
+	"github.com/stone1549/auth-service/dpop"
+	"github.com/stone1549/auth-service/service"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const protectedUrl = "https://auth.example.com/protected"
+
+// dpopClient signs DPoP proofs with its key, each with a new id.
+type dpopClient struct {
+	t   *testing.T
+	key *ecdsa.PrivateKey
+	jti int
+}
+
+func newDpopClient(t *testing.T) *dpopClient {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ok(t, err)
+
+	return &dpopClient{t: t, key: key}
+}
+
+// proof signs a proof for a request, presenting token when it isn't empty.
+func (dc *dpopClient) proof(method, url, token string) string {
+	dc.jti++
+	claims := jwt.MapClaims{"htm": method, "htu": url, "iat": time.Now().Unix(), "jti": fmt.Sprint(dc.jti)}
+
+	if token != "" {
+		claims["ath"] = dpop.AccessTokenHash(token)
+	}
+
+	proof := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	proof.Header["typ"] = "dpop+jwt"
+	proof.Header["jwk"] = map[string]interface{}{
+		"kty": "EC",
+		"crv": "P-256",
+		"x":   base64.RawURLEncoding.EncodeToString(dc.key.X.FillBytes(make([]byte, 32))),
+		"y":   base64.RawURLEncoding.EncodeToString(dc.key.Y.FillBytes(make([]byte, 32))),
+	}
+	signed, err := proof.SignedString(dc.key)
+	ok(dc.t, err)
+
+	return signed
+}
+
+// withProof adds a DPoP proof to a request, presenting its token with the given scheme.
+func withProof(req *http.Request, scheme, token, proof string) *http.Request {
+	req.Header.Set("Authorization", scheme+" "+token)
+
+	if proof != "" {
+		req.Header.Set(dpop.Header, proof)
+	}
+
+	return req
+}
+
+// TestDpop ensures tokens requested with a DPoP proof are bound to its key, and only accepted with the DPoP scheme
+// and a fresh proof signed with the key for the token.
+func TestDpop(t *testing.T) {
+	ts := newTestService(t, common.TenantPolicy{})
+	ts.newUser(t, "user@example.com")
+	verifier := dpop.NewVerifier(time.Minute, nil)
+	client := newDpopClient(t)
+	serve := func(next http.Handler, req *http.Request) int {
+		return ts.serve(service.DpopMiddleware(verifier)(next), req).Code
+	}
+
+	login := loginRequest("user@example.com")
+	login.Header.Set(dpop.Header, client.proof("POST", "https://auth.example.com/session", ""))
+	token := responseToken(t, ts.serve(service.DpopMiddleware(verifier)(
+		service.NewSessionMiddleware(http.HandlerFunc(service.NewSession))), login))
+
+	claims, err := ts.tokens.ParseToken(token)
+	ok(t, err)
+	equals(t, false, claims.KeyThumbprint == "")
+
+	get := func(scheme, proof string) *http.Request {
+		return withProof(httptest.NewRequest("GET", protectedUrl, nil), scheme, token, proof)
+	}
+
+	equals(t, http.StatusOK, serve(sessionRouter(), get("DPoP", client.proof("GET", protectedUrl, token))))
+
+	equals(t, http.StatusUnauthorized, serve(sessionRouter(), get("DPoP", "")))
+
+	reused := client.proof("GET", protectedUrl, token)
+	equals(t, http.StatusOK, serve(sessionRouter(), get("DPoP", reused)))
+	equals(t, http.StatusUnauthorized, serve(sessionRouter(), get("DPoP", reused)))
+
+	equals(t, http.StatusUnauthorized, serve(sessionRouter(), get("DPoP", client.proof("GET", protectedUrl,
+		"another token"))))
+	equals(t, http.StatusUnauthorized, serve(sessionRouter(), get("DPoP", newDpopClient(t).proof("GET",
+		protectedUrl, token))))
+	equals(t, http.StatusUnauthorized, serve(sessionRouter(), get("Bearer", client.proof("GET", protectedUrl,
+		token))))
+	equals(t, http.StatusUnauthorized, serve(sessionRouter(), get("Bearer", "")))
+}
+
+// TestDpop_TokenRequest ensures proofs requesting a token at login can't carry an access token hash.
+func TestDpop_TokenRequest(t *testing.T) {
+	ts := newTestService(t, common.TenantPolicy{})
+	ts.newUser(t, "user@example.com")
+	client := newDpopClient(t)
+
+	login := loginRequest("user@example.com")
+	login.Header.Set(dpop.Header, client.proof("POST", "https://auth.example.com/session", "some token"))
+	resp := ts.serve(service.DpopMiddleware(dpop.NewVerifier(time.Minute, nil))(
+		service.NewSessionMiddleware(http.HandlerFunc(service.NewSession))), login)
+	equals(t, http.StatusBadRequest, resp.Code)
+}
+
+// TestServerMetadata ensures the metadata names the configured issuer, not the host the request was made to.
+func TestServerMetadata(t *testing.T) {
+	ts := newTestService(t, common.TenantPolicy{})
+	metadata := func(url string) map[string]interface{} {
+		resp := ts.serve(service.ServerMetadata("https://auth.example.com", true), httptest.NewRequest("GET", url,
+			nil))
+		equals(t, http.StatusOK, resp.Code)
+
+		var body map[string]interface{}
+		ok(t, json.NewDecoder(resp.Body).Decode(&body))
+
+		return body
+	}
+
+	body := metadata("http://evil.example.net" + service.MetadataPath)
+	equals(t, "https://auth.example.com", body["issuer"])
+	equals(t, "https://auth.example.com/session", body["token_endpoint"])
+	equals(t, true, body["tls_client_certificate_bound_access_tokens"])
+
+	body = metadata("http://evil.example.net/tenant/acme" + service.MetadataPath)
+	equals(t, "https://auth.example.com/tenant/acme", body["issuer"])
+	equals(t, "https://auth.example.com/tenant/acme/session", body["token_endpoint"])
+}
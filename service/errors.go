@@ -2,6 +2,7 @@ package service
 
 import (
 	"github.com/go-chi/render"
+	"github.com/stone1549/auth-service/repository"
 	"net/http"
 )
 
@@ -28,6 +29,24 @@ func errInvalidRequest(err error) render.Renderer {
 	}
 }
 
+func errUnauthorized(err error) render.Renderer {
+	return &errResponse{
+		Err:            err,
+		HTTPStatusCode: 401,
+		StatusText:     "Unauthorized.",
+		ErrorText:      err.Error(),
+	}
+}
+
+func errForbidden(err error) render.Renderer {
+	return &errResponse{
+		Err:            err,
+		HTTPStatusCode: 403,
+		StatusText:     "Forbidden.",
+		ErrorText:      err.Error(),
+	}
+}
+
 func errRepository(err error) render.Renderer {
 	return &errResponse{
 		Err:            err,
@@ -37,6 +56,31 @@ func errRepository(err error) render.Renderer {
 	}
 }
 
+func errConflict(err error) render.Renderer {
+	return &errResponse{
+		Err:            err,
+		HTTPStatusCode: 409,
+		StatusText:     "Conflict.",
+		ErrorText:      err.Error(),
+	}
+}
+
+// errFromRepository maps errors returned by a repository to the appropriate response.
+func errFromRepository(err error) render.Renderer {
+	if repository.IsNotFound(err) {
+		return &errResponse{
+			Err:            err,
+			HTTPStatusCode: 404,
+			StatusText:     "Resource not found.",
+			ErrorText:      err.Error(),
+		}
+	} else if repository.IsConflict(err) {
+		return errConflict(err)
+	}
+
+	return errRepository(err)
+}
+
 func errUnknown(err error) render.Renderer {
 	return &errResponse{
 		Err:            err,
@@ -0,0 +1,316 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/stone1549/auth-service/common"
+	"github.com/stone1549/auth-service/repository"
+	"net/http"
+)
+
+type groupRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type groupResponse struct {
+	common.Group
+	status int
+}
+
+func (gr groupResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	if gr.status != 0 {
+		render.Status(r, gr.status)
+	}
+
+	return nil
+}
+
+type groupListResponse struct {
+	Groups []common.Group `json:"groups"`
+}
+
+func (glr groupListResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+type groupMembersResponse struct {
+	common.GroupMembers
+}
+
+func (gmr groupMembersResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// groupRequestContext retrieves the tenant and group repository that requests for groups operate on.
+func groupRequestContext(w http.ResponseWriter, r *http.Request) (common.Tenant, repository.GroupRepository, bool) {
+	tenant, ok := r.Context().Value("tenant").(common.Tenant)
+
+	if !ok {
+		render.Render(w, r, errUnknown(errors.New("tenant not found in context")))
+		return common.Tenant{}, nil, false
+	}
+
+	groupRepo, ok := r.Context().Value("repo").(repository.GroupRepository)
+
+	if !ok {
+		render.Render(w, r, errRepository(errors.New("GroupRepository not found in context")))
+		return common.Tenant{}, nil, false
+	}
+
+	return tenant, groupRepo, true
+}
+
+func decodeGroupRequest(w http.ResponseWriter, r *http.Request) (groupRequest, bool) {
+	var reqGroup groupRequest
+	err := json.NewDecoder(r.Body).Decode(&reqGroup)
+
+	if err != nil {
+		render.Render(w, r, errInvalidRequest(err))
+		return groupRequest{}, false
+	}
+
+	if reqGroup.Name == "" {
+		render.Render(w, r, errInvalidRequest(errors.New("name is required")))
+		return groupRequest{}, false
+	}
+
+	return reqGroup, true
+}
+
+// GroupCtx middleware to load the group named in the url into the request context.
+func GroupCtx(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant, groupRepo, ok := groupRequestContext(w, r)
+
+		if !ok {
+			return
+		}
+
+		group, err := groupRepo.GetGroup(r.Context(), tenant.Id, chi.URLParam(r, "groupId"))
+
+		if err != nil {
+			render.Render(w, r, errFromRepository(err))
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), "group", group)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// NewGroup creates a group from the request parameters.
+func NewGroup(w http.ResponseWriter, r *http.Request) {
+	reqGroup, ok := decodeGroupRequest(w, r)
+
+	if !ok {
+		return
+	}
+
+	tenant, groupRepo, ok := groupRequestContext(w, r)
+
+	if !ok {
+		return
+	}
+
+	group, err := groupRepo.NewGroup(r.Context(), tenant.Id, reqGroup.Name, reqGroup.Description)
+
+	if err != nil {
+		render.Render(w, r, errFromRepository(err))
+		return
+	}
+
+	render.Render(w, r, groupResponse{group, http.StatusCreated})
+}
+
+// ListGroups renders all groups of the request's tenant.
+func ListGroups(w http.ResponseWriter, r *http.Request) {
+	tenant, groupRepo, ok := groupRequestContext(w, r)
+
+	if !ok {
+		return
+	}
+
+	groups, err := groupRepo.ListGroups(r.Context(), tenant.Id)
+
+	if err != nil {
+		render.Render(w, r, errFromRepository(err))
+		return
+	}
+
+	render.Render(w, r, groupListResponse{groups})
+}
+
+// GetGroup renders the group loaded by GroupCtx.
+func GetGroup(w http.ResponseWriter, r *http.Request) {
+	group, ok := r.Context().Value("group").(common.Group)
+
+	if !ok {
+		render.Render(w, r, errNotFound)
+		return
+	}
+
+	render.Render(w, r, groupResponse{Group: group})
+}
+
+// UpdateGroup changes the group loaded by GroupCtx from the request parameters.
+func UpdateGroup(w http.ResponseWriter, r *http.Request) {
+	reqGroup, ok := decodeGroupRequest(w, r)
+
+	if !ok {
+		return
+	}
+
+	tenant, groupRepo, ok := groupRequestContext(w, r)
+
+	if !ok {
+		return
+	}
+
+	group, err := groupRepo.UpdateGroup(r.Context(), tenant.Id, chi.URLParam(r, "groupId"), reqGroup.Name,
+		reqGroup.Description)
+
+	if err != nil {
+		render.Render(w, r, errFromRepository(err))
+		return
+	}
+
+	render.Render(w, r, groupResponse{Group: group})
+}
+
+// DeleteGroup removes the group loaded by GroupCtx.
+func DeleteGroup(w http.ResponseWriter, r *http.Request) {
+	tenant, groupRepo, ok := groupRequestContext(w, r)
+
+	if !ok {
+		return
+	}
+
+	err := groupRepo.DeleteGroup(r.Context(), tenant.Id, chi.URLParam(r, "groupId"))
+
+	if err != nil {
+		render.Render(w, r, errFromRepository(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetGroupMembers renders the direct members of the group loaded by GroupCtx.
+func GetGroupMembers(w http.ResponseWriter, r *http.Request) {
+	tenant, groupRepo, ok := groupRequestContext(w, r)
+
+	if !ok {
+		return
+	}
+
+	members, err := groupRepo.GetGroupMembers(r.Context(), tenant.Id, chi.URLParam(r, "groupId"))
+
+	if err != nil {
+		render.Render(w, r, errFromRepository(err))
+		return
+	}
+
+	render.Render(w, r, groupMembersResponse{members})
+}
+
+// AddGroupUser adds the user named in the url to the group loaded by GroupCtx.
+func AddGroupUser(w http.ResponseWriter, r *http.Request) {
+	changeGroupMembership(w, r, func(groupRepo repository.GroupRepository, tenantId, groupId string) error {
+		return groupRepo.AddGroupUser(r.Context(), tenantId, groupId, chi.URLParam(r, "userId"))
+	})
+}
+
+// RemoveGroupUser removes the user named in the url from the group loaded by GroupCtx.
+func RemoveGroupUser(w http.ResponseWriter, r *http.Request) {
+	changeGroupMembership(w, r, func(groupRepo repository.GroupRepository, tenantId, groupId string) error {
+		return groupRepo.RemoveGroupUser(r.Context(), tenantId, groupId, chi.URLParam(r, "userId"))
+	})
+}
+
+// AddSubgroup adds the group named in the url to the group loaded by GroupCtx.
+func AddSubgroup(w http.ResponseWriter, r *http.Request) {
+	changeGroupMembership(w, r, func(groupRepo repository.GroupRepository, tenantId, groupId string) error {
+		return groupRepo.AddSubgroup(r.Context(), tenantId, groupId, chi.URLParam(r, "memberGroupId"))
+	})
+}
+
+// RemoveSubgroup removes the group named in the url from the group loaded by GroupCtx.
+func RemoveSubgroup(w http.ResponseWriter, r *http.Request) {
+	changeGroupMembership(w, r, func(groupRepo repository.GroupRepository, tenantId, groupId string) error {
+		return groupRepo.RemoveSubgroup(r.Context(), tenantId, groupId, chi.URLParam(r, "memberGroupId"))
+	})
+}
+
+func changeGroupMembership(w http.ResponseWriter, r *http.Request,
+	change func(groupRepo repository.GroupRepository, tenantId, groupId string) error) {
+	tenant, groupRepo, ok := groupRequestContext(w, r)
+
+	if !ok {
+		return
+	}
+
+	err := change(groupRepo, tenant.Id, chi.URLParam(r, "groupId"))
+
+	if err != nil {
+		render.Render(w, r, errFromRepository(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetMyGroups renders every group the authenticated user is a member of, directly or through nested groups.
+func GetMyGroups(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value("claims").(Claims)
+
+	if !ok {
+		render.Render(w, r, errUnauthorized(errors.New("token is required")))
+		return
+	}
+
+	tenant, groupRepo, ok := groupRequestContext(w, r)
+
+	if !ok {
+		return
+	}
+
+	groups, err := groupRepo.GetUserGroups(r.Context(), tenant.Id, claims.Sub)
+
+	if err != nil {
+		render.Render(w, r, errFromRepository(err))
+		return
+	}
+
+	render.Render(w, r, groupListResponse{groups})
+}
+
+// withGroupsClaim adds the names of the user's groups to the claims when the tenant's policy asks for it.
+func withGroupsClaim(ctx context.Context, tenant common.Tenant, claims Claims) (Claims, error) {
+	if !tenant.Policy.GroupsClaim {
+		return claims, nil
+	}
+
+	groupRepo, ok := ctx.Value("repo").(repository.GroupRepository)
+
+	if !ok {
+		return claims, errors.New("GroupRepository not found in context")
+	}
+
+	groups, err := groupRepo.GetUserGroups(ctx, tenant.Id, claims.Sub)
+
+	if err != nil {
+		return claims, err
+	}
+
+	claims.Groups = make([]string, 0, len(groups))
+
+	for _, group := range groups {
+		claims.Groups = append(claims.Groups, group.Name)
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,137 @@
+package service_test
+
+import (
+	"encoding/json"
+	"github.com/go-chi/chi"
+	"github.com/stone1549/auth-service/common"
+	"github.com/stone1549/auth-service/service"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// groupRouter routes group management requests as the service does, leaving out the service token and audit
+// middleware in front of them.
+func groupRouter() http.Handler {
+	r := chi.NewRouter()
+	r.Post("/group", service.NewGroup)
+	r.Get("/group", service.ListGroups)
+	r.Route("/group/{groupId}", func(r chi.Router) {
+		r.Use(service.GroupCtx)
+		r.Get("/", service.GetGroup)
+		r.Put("/", service.UpdateGroup)
+		r.Delete("/", service.DeleteGroup)
+		r.Get("/members", service.GetGroupMembers)
+		r.Put("/users/{userId}", service.AddGroupUser)
+		r.Delete("/users/{userId}", service.RemoveGroupUser)
+		r.Put("/groups/{memberGroupId}", service.AddSubgroup)
+	})
+	r.With(service.AuthenticatedMiddleware).Get("/user/me/groups", service.GetMyGroups)
+
+	return r
+}
+
+// groupRequest makes a group management request.
+func groupRequest(method, path, body string) *http.Request {
+	return httptest.NewRequest(method, "https://auth.example.com"+path, strings.NewReader(body))
+}
+
+// newGroup creates a group through the service, returning its id.
+func newGroup(t *testing.T, ts *testService, name string) string {
+	resp := ts.serve(groupRouter(), groupRequest("POST", "/group", `{"name": "`+name+`"}`))
+	equals(t, http.StatusCreated, resp.Code)
+
+	var group common.Group
+	ok(t, json.NewDecoder(resp.Body).Decode(&group))
+	equals(t, name, group.Name)
+
+	return group.Id
+}
+
+// TestNewGroup ensures groups need a unique name within their tenant.
+func TestNewGroup(t *testing.T) {
+	ts := newTestService(t, common.TenantPolicy{})
+
+	newGroup(t, ts, "engineering")
+
+	equals(t, http.StatusBadRequest, ts.serve(groupRouter(), groupRequest("POST", "/group", `{}`)).Code)
+	equals(t, http.StatusConflict, ts.serve(groupRouter(),
+		groupRequest("POST", "/group", `{"name": "engineering"}`)).Code)
+
+	ts.tenant.Id = "other"
+	newGroup(t, ts, "engineering")
+}
+
+// TestGroup_Members ensures users and nested groups are added to and removed from groups, and that users see the
+// groups they're a member of through nested groups.
+func TestGroup_Members(t *testing.T) {
+	ts := newTestService(t, common.TenantPolicy{})
+	userId := ts.newUser(t, "user@example.com")
+	engineering := newGroup(t, ts, "engineering")
+	platform := newGroup(t, ts, "platform")
+
+	equals(t, http.StatusNoContent, ts.serve(groupRouter(),
+		groupRequest("PUT", "/group/"+platform+"/users/"+userId, "")).Code)
+	equals(t, http.StatusNoContent, ts.serve(groupRouter(),
+		groupRequest("PUT", "/group/"+engineering+"/groups/"+platform, "")).Code)
+	equals(t, http.StatusConflict, ts.serve(groupRouter(),
+		groupRequest("PUT", "/group/"+platform+"/groups/"+engineering, "")).Code)
+	equals(t, http.StatusNotFound, ts.serve(groupRouter(),
+		groupRequest("PUT", "/group/"+platform+"/users/unknown", "")).Code)
+
+	resp := ts.serve(groupRouter(), groupRequest("GET", "/group/"+engineering+"/members", ""))
+	equals(t, http.StatusOK, resp.Code)
+
+	var members common.GroupMembers
+	ok(t, json.NewDecoder(resp.Body).Decode(&members))
+	equals(t, common.GroupMembers{UserIds: []string{}, GroupIds: []string{platform}}, members)
+
+	token := responseToken(t, ts.login(t, loginRequest("user@example.com")))
+	resp = ts.serve(groupRouter(), authenticated("GET", "https://auth.example.com/user/me/groups", token, nil))
+	equals(t, http.StatusOK, resp.Code)
+
+	var groups struct {
+		Groups []common.Group `json:"groups"`
+	}
+	ok(t, json.NewDecoder(resp.Body).Decode(&groups))
+	equals(t, 2, len(groups.Groups))
+
+	equals(t, http.StatusNoContent, ts.serve(groupRouter(),
+		groupRequest("DELETE", "/group/"+platform+"/users/"+userId, "")).Code)
+	equals(t, http.StatusNotFound, ts.serve(groupRouter(),
+		groupRequest("DELETE", "/group/"+platform+"/users/"+userId, "")).Code)
+}
+
+// TestGroup_TenantScoping ensures a group can't be read, changed or deleted from another tenant.
+func TestGroup_TenantScoping(t *testing.T) {
+	ts := newTestService(t, common.TenantPolicy{})
+	groupId := newGroup(t, ts, "engineering")
+
+	tenantId := ts.tenant.Id
+	ts.tenant.Id = "other"
+
+	equals(t, http.StatusNotFound, ts.serve(groupRouter(), groupRequest("GET", "/group/"+groupId, "")).Code)
+	equals(t, http.StatusNotFound, ts.serve(groupRouter(),
+		groupRequest("PUT", "/group/"+groupId, `{"name": "platform"}`)).Code)
+	equals(t, http.StatusNotFound, ts.serve(groupRouter(), groupRequest("DELETE", "/group/"+groupId, "")).Code)
+
+	resp := ts.serve(groupRouter(), groupRequest("GET", "/group", ""))
+	equals(t, http.StatusOK, resp.Code)
+	equals(t, true, strings.Contains(resp.Body.String(), `"groups":[]`))
+
+	ts.tenant.Id = tenantId
+	resp = ts.serve(groupRouter(), groupRequest("GET", "/group/"+groupId, ""))
+	equals(t, http.StatusOK, resp.Code)
+	equals(t, true, strings.Contains(resp.Body.String(), `"name":"engineering"`))
+}
+
+// TestGroup_MissingRepository ensures group requests fail rather than panic when the repository doesn't support
+// groups.
+func TestGroup_MissingRepository(t *testing.T) {
+	ts := newTestService(t, common.TenantPolicy{})
+	ts.values["repo"] = struct{}{}
+
+	equals(t, http.StatusInternalServerError, ts.serve(groupRouter(), groupRequest("GET", "/group", "")).Code)
+	equals(t, http.StatusInternalServerError, ts.serve(groupRouter(), groupRequest("GET", "/group/1", "")).Code)
+}
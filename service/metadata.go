@@ -0,0 +1,28 @@
+package service
+
+import (
+	"github.com/go-chi/render"
+	"github.com/stone1549/auth-service/dpop"
+	"net/http"
+	"strings"
+)
+
+// MetadataPath is where the service's authorization server metadata is published, relative to its routes.
+const MetadataPath = "/.well-known/oauth-authorization-server"
+
+// ServerMetadata constructs a handler describing the service as an OAuth authorization server (RFC 8414), so clients
+// can discover where to request tokens and how they may be bound. The issuer is the configured URL of the service
+// followed by the path the metadata was requested under, such as a tenant's. certificateBound is whether tokens
+// requested over mutual TLS are bound to the client certificate, which requires client certificates to be verified.
+func ServerMetadata(issuer string, certificateBound bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		issuer := issuer + strings.TrimSuffix(r.URL.Path, MetadataPath)
+
+		render.JSON(w, r, map[string]interface{}{
+			"issuer":                            issuer,
+			"token_endpoint":                    issuer + "/session",
+			"dpop_signing_alg_values_supported": dpop.SigningAlgorithms,
+			"tls_client_certificate_bound_access_tokens": certificateBound,
+		})
+	}
+}
@@ -5,17 +5,23 @@ import (
 	"encoding/json"
 	"errors"
 	"github.com/go-chi/render"
+	"github.com/stone1549/auth-service/audit"
+	"github.com/stone1549/auth-service/common"
 	"github.com/stone1549/auth-service/repository"
+	"github.com/stone1549/auth-service/tracing"
 	"net/http"
 )
 
 type newSessionRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
+	// RememberMe selects the tenant's longer remember me session limits.
+	RememberMe bool `json:"rememberMe"`
 }
 
 type newSessionResponse struct {
-	Token string `json:"token"`
+	Token     string `json:"token,omitempty"`
+	CsrfToken string `json:"csrfToken,omitempty"`
 }
 
 func (nsr newSessionResponse) Render(w http.ResponseWriter, r *http.Request) error {
@@ -25,6 +31,9 @@ func (nsr newSessionResponse) Render(w http.ResponseWriter, r *http.Request) err
 // NewSessionMiddleware middleware to authenticate a user from the request parameters
 func NewSessionMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracing.Start(r.Context(), "NewSessionMiddleware")
+		defer span.End()
+		r = r.WithContext(ctx)
 		decoder := json.NewDecoder(r.Body)
 
 		var reqUser newSessionRequest
@@ -44,6 +53,13 @@ func NewSessionMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		tenant, ok := r.Context().Value("tenant").(common.Tenant)
+
+		if !ok {
+			render.Render(w, r, errUnknown(errors.New("tenant not found in context")))
+			return
+		}
+
 		userRepo, ok := r.Context().Value("repo").(repository.UserRepository)
 
 		if !ok {
@@ -51,33 +67,35 @@ func NewSessionMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		id, err := userRepo.Authenticate(r.Context(), reqUser.Email, reqUser.Password)
+		id, err := userRepo.Authenticate(r.Context(), tenant.Id, reqUser.Email, reqUser.Password)
 
 		if err != nil {
+			recordAudit(r, audit.Event{Type: audit.LoginFailed, Email: reqUser.Email, Reason: err.Error()})
 			render.Render(w, r, errRepository(err))
 			return
 		}
 
-		tokenFactory, ok := r.Context().Value("tokenFactory").(TokenFactory)
-
-		if !ok {
-			render.Render(w, r, errUnknown(errors.New("token factory not found in context")))
+		if !checkDevice(w, r, tenant, id, reqUser.Email, reqUser.RememberMe) {
 			return
 		}
 
-		token, err := tokenFactory.NewToken(NewClaims(id, reqUser.Email))
+		token, errRender := newSessionToken(r, tenant, id, reqUser.Email, reqUser.RememberMe)
 
-		if err != nil {
-			render.Render(w, r, errUnknown(errors.New("unable to create token")))
+		if errRender != nil {
+			render.Render(w, r, errRender)
 			return
 		}
 
-		ctx := context.WithValue(r.Context(), "token", token)
+		recordAudit(r, audit.Event{Type: audit.LoginSucceeded, ActorId: id, UserId: id, Email: reqUser.Email,
+			Success: true})
+
+		ctx = context.WithValue(r.Context(), "token", token)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
-// NewSession responds to authentication request with jwt token or appropriate error
+// NewSession responds to authentication request with jwt token or appropriate error. Tenants with cookie sessions
+// keep the token in an HttpOnly cookie and respond with the CSRF token instead.
 func NewSession(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	token, ok := ctx.Value("token").(string)
@@ -87,7 +105,32 @@ func NewSession(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := render.Render(w, r, newSessionResponse{token}); err != nil {
+	tenant, ok := ctx.Value("tenant").(common.Tenant)
+
+	if !ok {
+		render.Render(w, r, errUnknown(errors.New("tenant not found in context")))
+		return
+	}
+
+	response := newSessionResponse{Token: token}
+
+	if tenant.Policy.CookieSessions {
+		var csrfToken string
+		maxAge, err := sessionCookieMaxAge(r, token)
+
+		if err == nil {
+			csrfToken, err = setSessionCookies(w, token, maxAge)
+		}
+
+		if err != nil {
+			render.Render(w, r, errUnknown(err))
+			return
+		}
+
+		response = newSessionResponse{CsrfToken: csrfToken}
+	}
+
+	if err := render.Render(w, r, response); err != nil {
 		render.Render(w, r, errUnknown(err))
 		return
 	}
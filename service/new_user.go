@@ -5,7 +5,11 @@ import (
 	"encoding/json"
 	"errors"
 	"github.com/go-chi/render"
+	"github.com/stone1549/auth-service/audit"
+	"github.com/stone1549/auth-service/common"
 	"github.com/stone1549/auth-service/repository"
+	"github.com/stone1549/auth-service/tracing"
+	"github.com/stone1549/auth-service/webhook"
 	"net/http"
 )
 
@@ -25,6 +29,9 @@ func (nsr newUserResponse) Render(w http.ResponseWriter, r *http.Request) error
 // NewUserMiddleware middleware to add a new user to the repo from the request parameters
 func NewUserMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracing.Start(r.Context(), "NewUserMiddleware")
+		defer span.End()
+		r = r.WithContext(ctx)
 		decoder := json.NewDecoder(r.Body)
 
 		var reqUser newUserRequest
@@ -44,35 +51,51 @@ func NewUserMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		userRepo, ok := r.Context().Value("repo").(repository.UserRepository)
+		tenant, ok := r.Context().Value("tenant").(common.Tenant)
 
 		if !ok {
-			render.Render(w, r, errRepository(errors.New("UserRepository not found in context")))
+			render.Render(w, r, errUnknown(errors.New("tenant not found in context")))
 			return
 		}
 
-		id, err := userRepo.NewUser(r.Context(), reqUser.Email, reqUser.Password)
+		if !tenant.Policy.AllowSignup {
+			recordAudit(r, audit.Event{Type: audit.Signup, Email: reqUser.Email, Reason: "signup is disabled"})
+			render.Render(w, r, errForbidden(errors.New("signup is disabled")))
+			return
+		}
 
-		if err != nil {
-			render.Render(w, r, errRepository(err))
+		if len(reqUser.Password) < tenant.Policy.MinPasswordLength {
+			recordAudit(r, audit.Event{Type: audit.Signup, Email: reqUser.Email, Reason: "password is too short"})
+			render.Render(w, r, errInvalidRequest(errors.New("password is too short")))
 			return
 		}
 
-		tokenFactory, ok := r.Context().Value("tokenFactory").(TokenFactory)
+		userRepo, ok := r.Context().Value("repo").(repository.UserRepository)
 
 		if !ok {
-			render.Render(w, r, errUnknown(errors.New("token factory not found in context")))
+			render.Render(w, r, errRepository(errors.New("UserRepository not found in context")))
 			return
 		}
 
-		token, err := tokenFactory.NewToken(NewClaims(id, reqUser.Email))
+		id, err := userRepo.NewUser(r.Context(), tenant.Id, reqUser.Email, reqUser.Password)
 
 		if err != nil {
-			render.Render(w, r, errUnknown(errors.New("unable to create token")))
+			recordAudit(r, audit.Event{Type: audit.Signup, Email: reqUser.Email, Reason: err.Error()})
+			render.Render(w, r, errRepository(err))
+			return
+		}
+
+		recordAudit(r, audit.Event{Type: audit.Signup, ActorId: id, UserId: id, Email: reqUser.Email, Success: true})
+		publishWebhookEvent(r, webhook.UserCreated, webhook.UserData{UserId: id, Email: reqUser.Email})
+
+		token, errRender := newSessionToken(r, tenant, id, reqUser.Email, false)
+
+		if errRender != nil {
+			render.Render(w, r, errRender)
 			return
 		}
 
-		ctx := context.WithValue(r.Context(), "token", token)
+		ctx = context.WithValue(r.Context(), "token", token)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -0,0 +1,200 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/stone1549/auth-service/audit"
+	"github.com/stone1549/auth-service/common"
+	"github.com/stone1549/auth-service/oidc"
+	"github.com/stone1549/auth-service/repository"
+	"github.com/stone1549/auth-service/webhook"
+	"net/http"
+	"strings"
+)
+
+// oidcStateCookie binds a login with an upstream provider to the browser that began it.
+const oidcStateCookie = "oidc_state"
+
+// isSecure is whether the request reached the service, or the proxy in front of it, over TLS.
+func isSecure(r *http.Request) bool {
+	return r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
+
+func setOidcStateCookie(w http.ResponseWriter, r *http.Request, state string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   isSecure(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// OidcLogin redirects the user to log in with the upstream provider named in the path.
+func OidcLogin(w http.ResponseWriter, r *http.Request) {
+	federation, ok := r.Context().Value("oidc").(*oidc.Federation)
+
+	if !ok {
+		render.Render(w, r, errUnknown(errors.New("oidc federation not found in context")))
+		return
+	}
+
+	tenant, ok := r.Context().Value("tenant").(common.Tenant)
+
+	if !ok {
+		render.Render(w, r, errUnknown(errors.New("tenant not found in context")))
+		return
+	}
+
+	authUrl, state, err := federation.Begin(r.Context(), chi.URLParam(r, "provider"), tenant.Id)
+
+	if err != nil {
+		render.Render(w, r, errInvalidRequest(err))
+		return
+	}
+
+	setOidcStateCookie(w, r, state, int(oidc.LoginTimeout.Seconds()))
+	http.Redirect(w, r, authUrl, http.StatusFound)
+}
+
+// OidcCallbackMiddleware completes a login with an upstream provider and adds a token for the user to the context.
+// Users are linked to the account with their email, which the provider must have verified, and are signed up when
+// they have none and the tenant allows it.
+func OidcCallbackMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		provider := chi.URLParam(r, "provider")
+		query := r.URL.Query()
+
+		if query.Get("error") != "" {
+			recordAudit(r, audit.Event{Type: audit.LoginFailed, Reason: query.Get("error"),
+				Details: map[string]string{"provider": provider}})
+			render.Render(w, r, errUnauthorized(errors.New(fmt.Sprintf("provider refused the login: %s %s",
+				query.Get("error"), query.Get("error_description")))))
+			return
+		}
+
+		cookie, err := r.Cookie(oidcStateCookie)
+
+		if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(query.Get("state"))) != 1 {
+			render.Render(w, r, errInvalidRequest(errors.New("login state doesn't match")))
+			return
+		}
+
+		setOidcStateCookie(w, r, "", -1)
+
+		federation, ok := r.Context().Value("oidc").(*oidc.Federation)
+
+		if !ok {
+			render.Render(w, r, errUnknown(errors.New("oidc federation not found in context")))
+			return
+		}
+
+		tenant, ok := r.Context().Value("tenant").(common.Tenant)
+
+		if !ok {
+			render.Render(w, r, errUnknown(errors.New("tenant not found in context")))
+			return
+		}
+
+		identity, err := federation.Complete(r.Context(), provider, tenant.Id, query.Get("state"), query.Get("code"))
+
+		if err != nil {
+			recordAudit(r, audit.Event{Type: audit.LoginFailed, Reason: err.Error(),
+				Details: map[string]string{"provider": provider}})
+			render.Render(w, r, errUnauthorized(err))
+			return
+		}
+
+		details := map[string]string{"provider": provider, "subject": identity.Subject}
+
+		if identity.Email == "" || !identity.EmailVerified {
+			recordAudit(r, audit.Event{Type: audit.LoginFailed, Email: identity.Email, Reason: "email isn't verified",
+				Details: details})
+			render.Render(w, r, errForbidden(errors.New("provider didn't verify the user's email")))
+			return
+		}
+
+		completeFederatedLogin(w, r, next, tenant, identity.Email, identity.Name, details)
+	})
+}
+
+// completeFederatedLogin links a user an upstream provider authenticated to their account and adds a token for them
+// to the context.
+func completeFederatedLogin(w http.ResponseWriter, r *http.Request, next http.Handler, tenant common.Tenant, email,
+	name string, details map[string]string) {
+	id, err := linkAccount(r, tenant, email, name, details["provider"])
+
+	if err != nil {
+		recordAudit(r, audit.Event{Type: audit.LoginFailed, Email: email, Reason: err.Error(), Details: details})
+		render.Render(w, r, errForbidden(err))
+		return
+	}
+
+	if !checkDevice(w, r, tenant, id, email, false) {
+		return
+	}
+
+	token, errRender := newSessionToken(r, tenant, id, email, false)
+
+	if errRender != nil {
+		render.Render(w, r, errRender)
+		return
+	}
+
+	recordAudit(r, audit.Event{Type: audit.LoginSucceeded, ActorId: id, UserId: id, Email: email, Success: true,
+		Details: details})
+
+	ctx := context.WithValue(r.Context(), "token", token)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// linkAccount finds the active account with an email an upstream provider asserted, creating one with a password
+// nobody knows when there's none and the tenant allows signup.
+func linkAccount(r *http.Request, tenant common.Tenant, email, name, provider string) (string, error) {
+	userRepo, ok := r.Context().Value("repo").(repository.UserAdminRepository)
+
+	if !ok {
+		return "", errors.New("UserAdminRepository not found in context")
+	}
+
+	account, err := userRepo.GetUserByEmail(r.Context(), tenant.Id, email)
+
+	if err == nil && !account.Active {
+		return "", errors.New("user is disabled")
+	} else if err == nil {
+		return account.Id, nil
+	} else if !repository.IsNotFound(err) {
+		return "", err
+	}
+
+	if !tenant.Policy.AllowSignup {
+		recordAudit(r, audit.Event{Type: audit.Signup, Email: email, Reason: "signup is disabled"})
+		return "", errors.New("signup is disabled")
+	}
+
+	password, err := randomPassword()
+
+	if err != nil {
+		return "", err
+	}
+
+	account, err = userRepo.CreateUser(r.Context(), common.UserAccount{TenantId: tenant.Id, Email: email,
+		DisplayName: name, Active: true}, password)
+
+	if err != nil {
+		recordAudit(r, audit.Event{Type: audit.Signup, Email: email, Reason: err.Error()})
+		return "", err
+	}
+
+	recordAudit(r, audit.Event{Type: audit.Signup, ActorId: account.Id, UserId: account.Id, Email: email,
+		Success: true, Details: map[string]string{"provider": provider}})
+	publishWebhookEvent(r, webhook.UserCreated, webhook.UserData{UserId: account.Id, Email: email})
+
+	return account.Id, nil
+}
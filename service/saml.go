@@ -0,0 +1,108 @@
+package service
+
+import (
+	"errors"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/stone1549/auth-service/audit"
+	"github.com/stone1549/auth-service/common"
+	"github.com/stone1549/auth-service/saml"
+	"net/http"
+)
+
+// samlIdentityProvider finds the identity provider named in the path, rendering an error when it isn't trusted by
+// the request's tenant.
+func samlIdentityProvider(w http.ResponseWriter, r *http.Request) (*saml.IdentityProvider, common.Tenant, bool) {
+	sp, ok := r.Context().Value("saml").(*saml.ServiceProvider)
+
+	if !ok {
+		render.Render(w, r, errUnknown(errors.New("saml service provider not found in context")))
+		return nil, common.Tenant{}, false
+	}
+
+	tenant, ok := r.Context().Value("tenant").(common.Tenant)
+
+	if !ok {
+		render.Render(w, r, errUnknown(errors.New("tenant not found in context")))
+		return nil, common.Tenant{}, false
+	}
+
+	idp, ok := sp.IdentityProvider(chi.URLParam(r, "idp"))
+
+	if !ok || (idp.TenantId() != "" && idp.TenantId() != tenant.Id) {
+		render.Render(w, r, errNotFound)
+		return nil, common.Tenant{}, false
+	}
+
+	return idp, tenant, true
+}
+
+// SamlMetadata responds with the service provider's metadata for the identity provider named in the path.
+func SamlMetadata(w http.ResponseWriter, r *http.Request) {
+	idp, _, ok := samlIdentityProvider(w, r)
+
+	if !ok {
+		return
+	}
+
+	metadata, err := idp.Metadata()
+
+	if err != nil {
+		render.Render(w, r, errUnknown(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	w.Write(metadata)
+}
+
+// SamlLogin redirects the user to log in with the identity provider named in the path.
+func SamlLogin(w http.ResponseWriter, r *http.Request) {
+	idp, _, ok := samlIdentityProvider(w, r)
+
+	if !ok {
+		return
+	}
+
+	loginUrl, err := idp.LoginUrl()
+
+	if err != nil {
+		render.Render(w, r, errInvalidRequest(err))
+		return
+	}
+
+	http.Redirect(w, r, loginUrl, http.StatusFound)
+}
+
+// SamlAcsMiddleware consumes a response the identity provider named in the path POSTed and adds a token for the
+// user it asserts to the context. Users are linked to the account with their asserted email, and are signed up when
+// they have none and the tenant allows it.
+func SamlAcsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		idp, tenant, ok := samlIdentityProvider(w, r)
+
+		if !ok {
+			return
+		}
+
+		name := chi.URLParam(r, "idp")
+		assertion, err := idp.ParseResponse(r.PostFormValue("SAMLResponse"))
+
+		if err != nil {
+			recordAudit(r, audit.Event{Type: audit.LoginFailed, Reason: err.Error(),
+				Details: map[string]string{"provider": name}})
+			render.Render(w, r, errUnauthorized(err))
+			return
+		}
+
+		details := map[string]string{"provider": name, "subject": assertion.NameId}
+
+		if assertion.Email == "" {
+			recordAudit(r, audit.Event{Type: audit.LoginFailed, Reason: "no email asserted", Details: details})
+			render.Render(w, r, errForbidden(errors.New("identity provider didn't assert the user's email")))
+			return
+		}
+
+		completeFederatedLogin(w, r, next, tenant, assertion.Email, assertion.Name, details)
+	})
+}
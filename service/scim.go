@@ -0,0 +1,677 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/stone1549/auth-service/audit"
+	"github.com/stone1549/auth-service/common"
+	"github.com/stone1549/auth-service/repository"
+	"github.com/stone1549/auth-service/scim"
+	"github.com/stone1549/auth-service/webhook"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const scimBasePath = "/scim/v2"
+
+// scimBaseUrl is the absolute URL SCIM resources of the request are located under.
+func scimBaseUrl(r *http.Request) string {
+	scheme := "http"
+
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	path := r.URL.Path
+
+	if i := strings.Index(path, scimBasePath); i >= 0 {
+		path = path[:i+len(scimBasePath)]
+	}
+
+	return fmt.Sprintf("%s://%s%s", scheme, r.Host, path)
+}
+
+// scimErrFromRepository maps errors returned by a repository to the appropriate SCIM error.
+func scimErrFromRepository(err error) *scim.Error {
+	if repository.IsNotFound(err) {
+		return scim.NewError(http.StatusNotFound, "", err.Error())
+	} else if repository.IsConflict(err) {
+		return scim.NewError(http.StatusConflict, scim.Uniqueness, err.Error())
+	}
+
+	return scim.NewError(http.StatusInternalServerError, "", err.Error())
+}
+
+func writeScimError(w http.ResponseWriter, err error) {
+	if scimErr, ok := err.(*scim.Error); ok {
+		scim.WriteError(w, scimErr)
+		return
+	}
+
+	scim.WriteError(w, scimErrFromRepository(err))
+}
+
+// scimRequestContext retrieves the tenant and repositories that SCIM requests operate on.
+func scimRequestContext(w http.ResponseWriter, r *http.Request) (common.Tenant, repository.UserAdminRepository,
+	repository.GroupRepository, bool) {
+	tenant, ok := r.Context().Value("tenant").(common.Tenant)
+
+	if !ok {
+		scim.WriteError(w, scim.NewError(http.StatusInternalServerError, "", "tenant not found in context"))
+		return common.Tenant{}, nil, nil, false
+	}
+
+	userRepo, ok := r.Context().Value("repo").(repository.UserAdminRepository)
+
+	if !ok {
+		scim.WriteError(w, scim.NewError(http.StatusInternalServerError, "",
+			"UserAdminRepository not found in context"))
+		return common.Tenant{}, nil, nil, false
+	}
+
+	groupRepo, ok := r.Context().Value("repo").(repository.GroupRepository)
+
+	if !ok {
+		scim.WriteError(w, scim.NewError(http.StatusInternalServerError, "", "GroupRepository not found in context"))
+		return common.Tenant{}, nil, nil, false
+	}
+
+	return tenant, userRepo, groupRepo, true
+}
+
+// decodeScimResource decodes a request body into a resource represented as a JSON object.
+func decodeScimResource(w http.ResponseWriter, r *http.Request) (map[string]interface{}, bool) {
+	resource := make(map[string]interface{})
+	err := json.NewDecoder(r.Body).Decode(&resource)
+
+	if err != nil {
+		scim.WriteError(w, scim.NewError(http.StatusBadRequest, scim.InvalidSyntax, err.Error()))
+		return nil, false
+	}
+
+	return resource, true
+}
+
+func decodeScimPatch(w http.ResponseWriter, r *http.Request) (scim.PatchRequest, bool) {
+	var req scim.PatchRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		scim.WriteError(w, scim.NewError(http.StatusBadRequest, scim.InvalidSyntax, err.Error()))
+		return scim.PatchRequest{}, false
+	}
+
+	return req, true
+}
+
+// scimQuery filters resources with the filter query parameter and responds with the page selected by the
+// startIndex and count query parameters.
+func scimQuery(w http.ResponseWriter, r *http.Request, resources []interface{}) {
+	query := r.URL.Query()
+	startIndex, count := 1, scim.DefaultCount
+	var err error
+
+	if value := query.Get("startIndex"); value != "" {
+		startIndex, err = strconv.Atoi(value)
+
+		if err != nil {
+			scim.WriteError(w, scim.NewError(http.StatusBadRequest, scim.InvalidValue, "invalid startIndex"))
+			return
+		}
+	}
+
+	if value := query.Get("count"); value != "" {
+		count, err = strconv.Atoi(value)
+
+		if err != nil || count < 0 {
+			scim.WriteError(w, scim.NewError(http.StatusBadRequest, scim.InvalidValue, "invalid count"))
+			return
+		}
+
+		if count > scim.MaxCount {
+			count = scim.MaxCount
+		}
+	}
+
+	if value := query.Get("filter"); value != "" {
+		filter, err := scim.ParseFilter(value)
+
+		if err != nil {
+			scim.WriteError(w, scim.NewError(http.StatusBadRequest, scim.InvalidFilter, err.Error()))
+			return
+		}
+
+		matches := make([]interface{}, 0, len(resources))
+
+		for _, resource := range resources {
+			object, err := scim.ToMap(resource)
+
+			if err != nil {
+				writeScimError(w, err)
+				return
+			}
+
+			if filter.Matches(object) {
+				matches = append(matches, resource)
+			}
+		}
+
+		resources = matches
+	}
+
+	scim.Write(w, http.StatusOK, scim.NewListResponse(resources, startIndex, count))
+}
+
+func randomPassword() (string, error) {
+	password := make([]byte, 24)
+
+	if _, err := rand.Read(password); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(password), nil
+}
+
+// ScimServiceProviderConfig responds with the SCIM features supported.
+func ScimServiceProviderConfig(w http.ResponseWriter, r *http.Request) {
+	scim.Write(w, http.StatusOK, scim.NewServiceProviderConfig(scimBaseUrl(r)))
+}
+
+// ScimResourceTypes responds with the SCIM resource types served.
+func ScimResourceTypes(w http.ResponseWriter, r *http.Request) {
+	resourceTypes := scim.NewResourceTypes(scimBaseUrl(r))
+	resources := make([]interface{}, 0, len(resourceTypes))
+
+	for _, resourceType := range resourceTypes {
+		if id := chi.URLParam(r, "resourceTypeId"); id == "" || id == resourceType.Id {
+			resources = append(resources, resourceType)
+		}
+	}
+
+	if chi.URLParam(r, "resourceTypeId") == "" {
+		scim.Write(w, http.StatusOK, scim.NewListResponse(resources, 1, len(resources)))
+	} else if len(resources) == 1 {
+		scim.Write(w, http.StatusOK, resources[0])
+	} else {
+		scim.WriteError(w, scim.NewError(http.StatusNotFound, "", "resource type not found"))
+	}
+}
+
+// ScimSchemas responds with the schemas of the SCIM resources served.
+func ScimSchemas(w http.ResponseWriter, r *http.Request) {
+	schemas := scim.NewSchemas(scimBaseUrl(r))
+	resources := make([]interface{}, 0, len(schemas))
+	id := chi.URLParam(r, "schemaId")
+
+	// Schema ids are URNs such as urn:ietf:params:scim:schemas:core:2.0:User, whose dot is taken as a url format.
+	if format, _ := r.Context().Value(middleware.URLFormatCtxKey).(string); id != "" && format != "" {
+		id += "." + format
+	}
+
+	for _, schema := range schemas {
+		if id == "" || id == schema.Id {
+			resources = append(resources, schema)
+		}
+	}
+
+	if id == "" {
+		scim.Write(w, http.StatusOK, scim.NewListResponse(resources, 1, len(resources)))
+	} else if len(resources) == 1 {
+		scim.Write(w, http.StatusOK, resources[0])
+	} else {
+		scim.WriteError(w, scim.NewError(http.StatusNotFound, "", "schema not found"))
+	}
+}
+
+// ScimCreateUser provisions a user, a random password is set when none is given so the user can't sign in with a
+// password until it's changed.
+func ScimCreateUser(w http.ResponseWriter, r *http.Request) {
+	resource, ok := decodeScimResource(w, r)
+
+	if !ok {
+		return
+	}
+
+	tenant, userRepo, _, ok := scimRequestContext(w, r)
+
+	if !ok {
+		return
+	}
+
+	user, err := scim.DecodeUser(resource)
+
+	if err != nil {
+		writeScimError(w, err)
+		return
+	}
+
+	password := user.Password
+
+	if password != "" && len(password) < tenant.Policy.MinPasswordLength {
+		writeScimError(w, scim.NewError(http.StatusBadRequest, scim.InvalidValue, "password is too short"))
+		return
+	} else if password == "" {
+		password, err = randomPassword()
+
+		if err != nil {
+			writeScimError(w, err)
+			return
+		}
+	}
+
+	account, err := userRepo.CreateUser(r.Context(), user.Account(common.UserAccount{TenantId: tenant.Id}), password)
+
+	if err != nil {
+		writeScimError(w, err)
+		return
+	}
+
+	publishWebhookEvent(r, webhook.UserCreated, webhook.UserData{UserId: account.Id, Email: account.Email})
+
+	created := scim.NewUser(account, scimBaseUrl(r))
+	w.Header().Set("Location", created.Meta.Location)
+	scim.Write(w, http.StatusCreated, created)
+}
+
+// ScimGetUser responds with the user named in the url.
+func ScimGetUser(w http.ResponseWriter, r *http.Request) {
+	tenant, userRepo, _, ok := scimRequestContext(w, r)
+
+	if !ok {
+		return
+	}
+
+	account, err := userRepo.GetUser(r.Context(), tenant.Id, chi.URLParam(r, "userId"))
+
+	if err != nil {
+		writeScimError(w, err)
+		return
+	}
+
+	scim.Write(w, http.StatusOK, scim.NewUser(account, scimBaseUrl(r)))
+}
+
+// ScimListUsers responds with the users of the request's tenant matching the filter query parameter.
+func ScimListUsers(w http.ResponseWriter, r *http.Request) {
+	tenant, userRepo, _, ok := scimRequestContext(w, r)
+
+	if !ok {
+		return
+	}
+
+	accounts, err := userRepo.ListUsers(r.Context(), tenant.Id)
+
+	if err != nil {
+		writeScimError(w, err)
+		return
+	}
+
+	resources := make([]interface{}, 0, len(accounts))
+	baseUrl := scimBaseUrl(r)
+
+	for _, account := range accounts {
+		resources = append(resources, scim.NewUser(account, baseUrl))
+	}
+
+	scimQuery(w, r, resources)
+}
+
+// ScimPatchUser applies PATCH operations to the user named in the url. Setting the password changes the user's
+// password.
+func ScimPatchUser(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeScimPatch(w, r)
+
+	if !ok {
+		return
+	}
+
+	tenant, userRepo, _, ok := scimRequestContext(w, r)
+
+	if !ok {
+		return
+	}
+
+	account, err := userRepo.GetUser(r.Context(), tenant.Id, chi.URLParam(r, "userId"))
+
+	if err != nil {
+		writeScimError(w, err)
+		return
+	}
+
+	resource, err := scim.ToMap(scim.NewUser(account, scimBaseUrl(r)))
+
+	if err == nil {
+		err = scim.ApplyPatch(resource, req.Operations)
+	}
+
+	if err != nil {
+		writeScimError(w, err)
+		return
+	}
+
+	user, err := scim.DecodeUser(resource)
+
+	if err != nil {
+		writeScimError(w, err)
+		return
+	}
+
+	if user.Password != "" && len(user.Password) < tenant.Policy.MinPasswordLength {
+		writeScimError(w, scim.NewError(http.StatusBadRequest, scim.InvalidValue, "password is too short"))
+		return
+	}
+
+	account, err = userRepo.UpdateUser(r.Context(), user.Account(account))
+
+	if err != nil {
+		writeScimError(w, err)
+		return
+	}
+
+	if user.Password != "" {
+		err = userRepo.SetPassword(r.Context(), tenant.Id, account.Id, user.Password)
+
+		if err != nil {
+			writeScimError(w, err)
+			return
+		}
+
+		recordAudit(r, audit.Event{Type: audit.PasswordChanged, ActorId: audit.ServiceActor, UserId: account.Id,
+			Email: account.Email, Success: true})
+	}
+
+	scim.Write(w, http.StatusOK, scim.NewUser(account, scimBaseUrl(r)))
+}
+
+// ScimDeleteUser deprovisions the user named in the url.
+func ScimDeleteUser(w http.ResponseWriter, r *http.Request) {
+	tenant, userRepo, _, ok := scimRequestContext(w, r)
+
+	if !ok {
+		return
+	}
+
+	account, err := userRepo.GetUser(r.Context(), tenant.Id, chi.URLParam(r, "userId"))
+
+	if err == nil {
+		err = userRepo.DeleteUser(r.Context(), tenant.Id, account.Id)
+	}
+
+	if err != nil {
+		writeScimError(w, err)
+		return
+	}
+
+	publishWebhookEvent(r, webhook.UserDeleted, webhook.UserData{UserId: account.Id, Email: account.Email})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// loadScimGroup retrieves a group and its direct members as a SCIM resource.
+func loadScimGroup(r *http.Request, groupRepo repository.GroupRepository, tenantId string,
+	group common.Group) (scim.Group, error) {
+	members, err := groupRepo.GetGroupMembers(r.Context(), tenantId, group.Id)
+
+	if err != nil {
+		return scim.Group{}, err
+	}
+
+	return scim.NewGroup(group, members, scimBaseUrl(r)), nil
+}
+
+// addScimMember adds a user or group to a group, members without a type are looked up as users first.
+func addScimMember(ctx context.Context, groupRepo repository.GroupRepository, tenantId, groupId string,
+	member scim.MultiValue) error {
+	if member.Type == scim.GroupMember {
+		return groupRepo.AddSubgroup(ctx, tenantId, groupId, member.Value)
+	}
+
+	err := groupRepo.AddGroupUser(ctx, tenantId, groupId, member.Value)
+
+	if member.Type == "" && repository.IsNotFound(err) {
+		return groupRepo.AddSubgroup(ctx, tenantId, groupId, member.Value)
+	}
+
+	return err
+}
+
+func removeScimMember(ctx context.Context, groupRepo repository.GroupRepository, tenantId, groupId string,
+	member scim.MultiValue) error {
+	if member.Type == scim.GroupMember {
+		return groupRepo.RemoveSubgroup(ctx, tenantId, groupId, member.Value)
+	}
+
+	return groupRepo.RemoveGroupUser(ctx, tenantId, groupId, member.Value)
+}
+
+// ScimCreateGroup provisions a group with its members, the group isn't created if any member can't be added.
+func ScimCreateGroup(w http.ResponseWriter, r *http.Request) {
+	resource, ok := decodeScimResource(w, r)
+
+	if !ok {
+		return
+	}
+
+	tenant, _, groupRepo, ok := scimRequestContext(w, r)
+
+	if !ok {
+		return
+	}
+
+	req, err := scim.DecodeGroup(resource)
+
+	if err != nil {
+		writeScimError(w, err)
+		return
+	}
+
+	group, err := groupRepo.NewGroup(r.Context(), tenant.Id, req.DisplayName, "")
+
+	if err != nil {
+		writeScimError(w, err)
+		return
+	}
+
+	for _, member := range req.Members {
+		err = addScimMember(r.Context(), groupRepo, tenant.Id, group.Id, member)
+
+		if err != nil {
+			groupRepo.DeleteGroup(r.Context(), tenant.Id, group.Id)
+			writeScimError(w, scim.NewError(http.StatusBadRequest, scim.InvalidValue,
+				fmt.Sprintf("unable to add member %s: %s", member.Value, err.Error())))
+			return
+		}
+	}
+
+	created, err := loadScimGroup(r, groupRepo, tenant.Id, group)
+
+	if err != nil {
+		writeScimError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", created.Meta.Location)
+	scim.Write(w, http.StatusCreated, created)
+}
+
+// ScimGetGroup responds with the group named in the url.
+func ScimGetGroup(w http.ResponseWriter, r *http.Request) {
+	tenant, _, groupRepo, ok := scimRequestContext(w, r)
+
+	if !ok {
+		return
+	}
+
+	group, err := groupRepo.GetGroup(r.Context(), tenant.Id, chi.URLParam(r, "groupId"))
+
+	if err != nil {
+		writeScimError(w, err)
+		return
+	}
+
+	resource, err := loadScimGroup(r, groupRepo, tenant.Id, group)
+
+	if err != nil {
+		writeScimError(w, err)
+		return
+	}
+
+	scim.Write(w, http.StatusOK, resource)
+}
+
+// ScimListGroups responds with the groups of the request's tenant matching the filter query parameter.
+func ScimListGroups(w http.ResponseWriter, r *http.Request) {
+	tenant, _, groupRepo, ok := scimRequestContext(w, r)
+
+	if !ok {
+		return
+	}
+
+	groups, err := groupRepo.ListGroups(r.Context(), tenant.Id)
+
+	if err != nil {
+		writeScimError(w, err)
+		return
+	}
+
+	resources := make([]interface{}, 0, len(groups))
+
+	for _, group := range groups {
+		resource, err := loadScimGroup(r, groupRepo, tenant.Id, group)
+
+		if err != nil {
+			writeScimError(w, err)
+			return
+		}
+
+		resources = append(resources, resource)
+	}
+
+	scimQuery(w, r, resources)
+}
+
+// ScimPatchGroup applies PATCH operations to the group named in the url, adding and removing members that the
+// operations changed.
+func ScimPatchGroup(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeScimPatch(w, r)
+
+	if !ok {
+		return
+	}
+
+	tenant, _, groupRepo, ok := scimRequestContext(w, r)
+
+	if !ok {
+		return
+	}
+
+	group, err := groupRepo.GetGroup(r.Context(), tenant.Id, chi.URLParam(r, "groupId"))
+
+	if err != nil {
+		writeScimError(w, err)
+		return
+	}
+
+	current, err := loadScimGroup(r, groupRepo, tenant.Id, group)
+
+	if err != nil {
+		writeScimError(w, err)
+		return
+	}
+
+	resource, err := scim.ToMap(current)
+
+	if err == nil {
+		err = scim.ApplyPatch(resource, req.Operations)
+	}
+
+	if err != nil {
+		writeScimError(w, err)
+		return
+	}
+
+	patched, err := scim.DecodeGroup(resource)
+
+	if err != nil {
+		writeScimError(w, err)
+		return
+	}
+
+	if patched.DisplayName != group.Name {
+		group, err = groupRepo.UpdateGroup(r.Context(), tenant.Id, group.Id, patched.DisplayName, group.Description)
+
+		if err != nil {
+			writeScimError(w, err)
+			return
+		}
+	}
+
+	existing := make(map[string]scim.MultiValue)
+
+	for _, member := range current.Members {
+		existing[member.Value] = member
+	}
+
+	wanted := make(map[string]bool)
+
+	for _, member := range patched.Members {
+		wanted[member.Value] = true
+
+		if _, ok := existing[member.Value]; ok {
+			continue
+		}
+
+		err = addScimMember(r.Context(), groupRepo, tenant.Id, group.Id, member)
+
+		if err != nil {
+			writeScimError(w, err)
+			return
+		}
+	}
+
+	for _, member := range current.Members {
+		if wanted[member.Value] {
+			continue
+		}
+
+		err = removeScimMember(r.Context(), groupRepo, tenant.Id, group.Id, member)
+
+		if err != nil {
+			writeScimError(w, err)
+			return
+		}
+	}
+
+	updated, err := loadScimGroup(r, groupRepo, tenant.Id, group)
+
+	if err != nil {
+		writeScimError(w, err)
+		return
+	}
+
+	scim.Write(w, http.StatusOK, updated)
+}
+
+// ScimDeleteGroup deprovisions the group named in the url.
+func ScimDeleteGroup(w http.ResponseWriter, r *http.Request) {
+	tenant, _, groupRepo, ok := scimRequestContext(w, r)
+
+	if !ok {
+		return
+	}
+
+	err := groupRepo.DeleteGroup(r.Context(), tenant.Id, chi.URLParam(r, "groupId"))
+
+	if err != nil {
+		writeScimError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
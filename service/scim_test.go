@@ -0,0 +1,90 @@
+package service_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-chi/chi"
+	"github.com/stone1549/auth-service/common"
+	"github.com/stone1549/auth-service/repository"
+	"github.com/stone1549/auth-service/service"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// scimRouter routes SCIM user requests as the service does.
+func scimRouter() http.Handler {
+	r := chi.NewRouter()
+	r.Post("/scim/v2/Users", service.ScimCreateUser)
+	r.Patch("/scim/v2/Users/{userId}", service.ScimPatchUser)
+
+	return r
+}
+
+// TestScimCreateUser_MinPasswordLength ensures users provisioned with a password must meet the tenant's policy.
+func TestScimCreateUser_MinPasswordLength(t *testing.T) {
+	ts := newTestService(t, common.TenantPolicy{MinPasswordLength: 12})
+	create := func(password string) *httptest.ResponseRecorder {
+		return ts.serve(scimRouter(), httptest.NewRequest("POST", "https://auth.example.com/scim/v2/Users",
+			strings.NewReader(`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], `+
+				`"userName": "user@example.com", "password": "`+password+`"}`)))
+	}
+
+	equals(t, http.StatusBadRequest, create("short").Code)
+	equals(t, http.StatusCreated, create("long enough password").Code)
+}
+
+// TestScimPatchUser_MinPasswordLength ensures passwords replaced over SCIM must meet the tenant's policy.
+func TestScimPatchUser_MinPasswordLength(t *testing.T) {
+	ts := newTestService(t, common.TenantPolicy{MinPasswordLength: 12})
+	id := ts.newUser(t, "user@example.com")
+	patch := func(password string) *httptest.ResponseRecorder {
+		return ts.serve(scimRouter(), httptest.NewRequest("PATCH", "https://auth.example.com/scim/v2/Users/"+id,
+			strings.NewReader(`{"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"], `+
+				`"Operations": [{"op": "replace", "path": "password", "value": "`+password+`"}]}`)))
+	}
+
+	equals(t, http.StatusBadRequest, patch("short").Code)
+	equals(t, http.StatusOK, patch("long enough password").Code)
+}
+
+// TestScim_TenantServiceTokens ensures an identity provider's service token can only provision users in its own
+// tenant, whichever tenant the request is routed to.
+func TestScim_TenantServiceTokens(t *testing.T) {
+	ts := newTestService(t, common.TenantPolicy{})
+	tenants := map[string]common.Tenant{
+		"acme":   {Id: "acme", Policy: ts.tenant.Policy, ServiceTokens: []string{"acme-token"}},
+		"globex": {Id: "globex", Policy: ts.tenant.Policy, ServiceTokens: []string{"globex-token"}},
+	}
+	r := chi.NewRouter()
+	r.Route(fmt.Sprintf("/tenant/{%s}/scim/v2", service.TenantParam), func(r chi.Router) {
+		r.Use(service.TenantMiddleware(tenants, common.PathTenantSelector))
+		r.Use(service.ServiceTokenMiddleware)
+		r.Post("/Users", service.ScimCreateUser)
+		r.Get("/Users", service.ScimListUsers)
+		r.Delete("/Users/{userId}", service.ScimDeleteUser)
+	})
+	scim := func(method, tenantId, path, token, body string) int {
+		req := httptest.NewRequest(method, "https://auth.example.com/tenant/"+tenantId+"/scim/v2"+path,
+			strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		return ts.serve(r, req).Code
+	}
+	user := `{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "userName": "user@globex.com"}`
+
+	userRepo := ts.repo.(repository.UserAdminRepository)
+
+	equals(t, http.StatusUnauthorized, scim("POST", "globex", "/Users", "acme-token", user))
+	equals(t, http.StatusUnauthorized, scim("GET", "globex", "/Users", "acme-token", ""))
+
+	_, err := userRepo.GetUserByEmail(context.Background(), "globex", "user@globex.com")
+	equals(t, true, repository.IsNotFound(err))
+
+	equals(t, http.StatusCreated, scim("POST", "globex", "/Users", "globex-token", user))
+	account, err := userRepo.GetUserByEmail(context.Background(), "globex", "user@globex.com")
+	ok(t, err)
+	equals(t, http.StatusUnauthorized, scim("DELETE", "globex", "/Users/"+account.Id, "acme-token", ""))
+	equals(t, http.StatusNoContent, scim("DELETE", "globex", "/Users/"+account.Id, "globex-token", ""))
+}
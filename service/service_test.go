@@ -0,0 +1,141 @@
+package service_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/stone1549/auth-service/common"
+	"github.com/stone1549/auth-service/repository"
+	"github.com/stone1549/auth-service/service"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+const testPassword = "password123"
+
+// testService holds what the service puts in the context of each request, for handlers under test.
+type testService struct {
+	config common.Configuration
+	repo   repository.UserRepository
+	tokens service.TokenFactory
+	tenant common.Tenant
+	// values are added to the context of every request along with the repository, token factory and tenant.
+	values map[string]interface{}
+}
+
+// newTestService constructs a development configuration with an in-memory repository, serving its only tenant with
+// the given policy, keeping its token lifetime unless the policy sets one.
+func newTestService(t *testing.T, policy common.TenantPolicy) *testService {
+	t.Setenv("AUTH_SERVICE_ENVIRONMENT", "DEV")
+	t.Setenv("AUTH_SERVICE_REPO_TYPE", "IN_MEMORY")
+	config, err := common.GetConfiguration()
+	ok(t, err)
+
+	repo, err := repository.NewUserRepository(config)
+	ok(t, err)
+
+	tokens, err := service.NewTokenFactory(config)
+	ok(t, err)
+
+	var tenant common.Tenant
+
+	for _, configured := range config.GetTenants() {
+		tenant = configured
+	}
+
+	if policy.TokenLifetime == 0 {
+		policy.TokenLifetime = tenant.Policy.TokenLifetime
+	}
+
+	tenant.Policy = policy
+
+	return &testService{config: config, repo: repo, tokens: tokens, tenant: tenant,
+		values: make(map[string]interface{})}
+}
+
+// handler wraps a handler with the context the service handles requests with.
+func (ts *testService) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), "repo", ts.repo)
+		ctx = context.WithValue(ctx, "tokenFactory", ts.tokens)
+		ctx = context.WithValue(ctx, "tenant", ts.tenant)
+
+		for key, value := range ts.values {
+			ctx = context.WithValue(ctx, key, value)
+		}
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// serve handles a request with the handler in the service's context.
+func (ts *testService) serve(next http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	ts.handler(next).ServeHTTP(recorder, req)
+
+	return recorder
+}
+
+// newUser signs up a user, returning their id.
+func (ts *testService) newUser(t *testing.T, email string) string {
+	id, err := ts.repo.NewUser(context.Background(), ts.tenant.Id, email, testPassword)
+	ok(t, err)
+
+	return id
+}
+
+// login logs a user in with their password, returning the response.
+func (ts *testService) login(t *testing.T, req *http.Request) *httptest.ResponseRecorder {
+	return ts.serve(service.NewSessionMiddleware(http.HandlerFunc(service.NewSession)), req)
+}
+
+// loginRequest makes a request logging a user in with their password.
+func loginRequest(email string) *http.Request {
+	return httptest.NewRequest("POST", "https://auth.example.com/session",
+		strings.NewReader(fmt.Sprintf(`{"email": "%s", "password": "%s"}`, email, testPassword)))
+}
+
+// responseToken retrieves the token a login responded with.
+func responseToken(t *testing.T, resp *httptest.ResponseRecorder) string {
+	equals(t, http.StatusOK, resp.Code)
+
+	var body struct {
+		Token string `json:"token"`
+	}
+
+	ok(t, json.NewDecoder(resp.Body).Decode(&body))
+
+	return body.Token
+}
+
+// authenticated makes a request bearing a token.
+func authenticated(method, url, token string, body io.Reader) *http.Request {
+	req := httptest.NewRequest(method, url, body)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return req
+}
+
+// ok fails the test if an err is not nil.
+func ok(tb testing.TB, err error) {
+	if err != nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: unexpected error: %s\033[39m\n\n", filepath.Base(file), line, err.Error())
+		tb.FailNow()
+	}
+}
+
+// equals fails the test if exp is not equal to act.
+func equals(tb testing.TB, exp, act interface{}) {
+	if !reflect.DeepEqual(exp, act) {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d:\n\n\texp: %#v\n\n\tgot: %#v\033[39m\n\n", filepath.Base(file), line, exp, act)
+		tb.FailNow()
+	}
+}
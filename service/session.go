@@ -0,0 +1,284 @@
+package service
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/stone1549/auth-service/audit"
+	"github.com/stone1549/auth-service/common"
+	"github.com/stone1549/auth-service/device"
+	"github.com/stone1549/auth-service/dpop"
+	"github.com/stone1549/auth-service/logging"
+	"github.com/stone1549/auth-service/repository"
+	"github.com/stone1549/auth-service/tracing"
+	"net/http"
+	"time"
+)
+
+// sessionTouchInterval limits how often a session's last seen time is written as its tokens are used.
+const sessionTouchInterval = time.Minute
+
+type sessionResponse struct {
+	common.Session
+	// Current is whether the request listing sessions was made with this one.
+	Current bool `json:"current"`
+}
+
+type sessionListResponse struct {
+	Sessions []sessionResponse `json:"sessions"`
+}
+
+func (slr sessionListResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// newSessionToken issues a token for a user who just logged in, recording their session when the repository tracks
+// sessions. Sessions the user asked to be remembered get the tenant's remember me limits. DPoP proofs made to
+// request the token can't carry an access token hash, as no token is presented. Returns the error to respond with on
+// failure.
+func newSessionToken(r *http.Request, tenant common.Tenant, userId, email string, rememberMe bool) (string,
+	render.Renderer) {
+	if proof, ok := r.Context().Value("dpopProof").(dpop.Proof); ok && proof.AccessTokenHash != "" {
+		return "", errInvalidRequest(errors.New("DPoP proof requesting a token can't carry ath"))
+	}
+
+	logging.SetUser(r.Context(), userId)
+	claims := NewClaims(tenant, userId, email)
+	sessionRepo, ok := r.Context().Value("repo").(repository.SessionRepository)
+
+	if !ok {
+		return signSessionToken(r, tenant, claims, common.Session{})
+	}
+
+	idle, lifetime := tenant.Policy.SessionLimits(rememberMe)
+	userAgent := r.UserAgent()
+	session := common.Session{TenantId: tenant.Id, UserId: userId, RemoteAddr: clientIp(r), UserAgent: userAgent,
+		DeviceLabel: device.Label(userAgent), RememberMe: rememberMe, IdleTimeout: idle}
+
+	if lifetime > 0 {
+		session.ExpiresAt = time.Now().Add(lifetime)
+	}
+
+	session, err := sessionRepo.NewSession(r.Context(), session)
+
+	if err != nil {
+		return "", errRepository(err)
+	}
+
+	claims.Sid = session.Id
+
+	return signSessionToken(r, tenant, claims, session)
+}
+
+// signSessionToken adds the user's groups to the claims and signs them, expiring the token no later than its
+// session. Tokens requested over mutual TLS are bound to the client certificate, and those requested with a DPoP
+// proof to its key.
+func signSessionToken(r *http.Request, tenant common.Tenant, claims Claims, session common.Session) (string,
+	render.Renderer) {
+	tokenFactory, ok := r.Context().Value("tokenFactory").(TokenFactory)
+
+	if !ok {
+		return "", errUnknown(errors.New("token factory not found in context"))
+	}
+
+	claims, err := withGroupsClaim(r.Context(), tenant, claims)
+
+	if err != nil {
+		return "", errRepository(err)
+	}
+
+	if !session.ExpiresAt.IsZero() && session.ExpiresAt.Unix() < claims.Exp {
+		claims.Exp = session.ExpiresAt.Unix()
+	}
+
+	if cert, ok := r.Context().Value("clientCert").(*x509.Certificate); ok {
+		claims.CertThumbprint = certThumbprint(cert)
+	}
+
+	if proof, ok := r.Context().Value("dpopProof").(dpop.Proof); ok {
+		claims.KeyThumbprint = proof.Thumbprint
+	}
+
+	_, span := tracing.Start(r.Context(), "TokenFactory.NewToken")
+	token, err := tokenFactory.NewToken(claims)
+	tracing.End(span, err)
+
+	if err != nil {
+		return "", errUnknown(errors.New("unable to create token"))
+	}
+
+	return token, nil
+}
+
+// checkSession ensures the session a token was issued for hasn't been revoked or expired, recording that it was
+// seen so it doesn't go idle.
+func checkSession(r *http.Request, claims Claims) render.Renderer {
+	sessionRepo, ok := r.Context().Value("repo").(repository.SessionRepository)
+
+	if claims.Sid == "" || !ok {
+		return nil
+	}
+
+	session, err := sessionRepo.GetSession(r.Context(), claims.TenantId, claims.Sid)
+
+	if repository.IsNotFound(err) || (err == nil && session.UserId != claims.Sub) {
+		return errUnauthorized(errors.New("session was revoked"))
+	} else if err != nil {
+		return errRepository(err)
+	}
+
+	now := time.Now()
+
+	if session.Expired(now) {
+		return errUnauthorized(errors.New("session expired"))
+	}
+
+	if now.Sub(session.LastSeenAt) >= sessionTouchInterval {
+		err = sessionRepo.TouchSession(r.Context(), claims.TenantId, claims.Sid, now)
+
+		if err != nil && !repository.IsNotFound(err) {
+			return errRepository(err)
+		}
+	}
+
+	return nil
+}
+
+// revokeSession deletes a user's session, recording its revocation.
+func revokeSession(r *http.Request, sessionRepo repository.SessionRepository, claims Claims, sessionId string) error {
+	err := sessionRepo.DeleteSession(r.Context(), claims.TenantId, claims.Sub, sessionId)
+
+	if err != nil {
+		return err
+	}
+
+	recordAudit(r, audit.Event{Type: audit.TokenRevoked, ActorId: claims.Sub, UserId: claims.Sub,
+		Email: claims.Email, Success: true, Details: map[string]string{"sessionId": sessionId}})
+
+	return nil
+}
+
+func sessionRequestContext(w http.ResponseWriter, r *http.Request) (Claims, repository.SessionRepository, bool) {
+	claims, ok := r.Context().Value("claims").(Claims)
+
+	if !ok {
+		render.Render(w, r, errUnauthorized(errors.New("token is required")))
+		return Claims{}, nil, false
+	}
+
+	sessionRepo, ok := r.Context().Value("repo").(repository.SessionRepository)
+
+	if !ok {
+		render.Render(w, r, errRepository(errors.New("SessionRepository not found in context")))
+		return Claims{}, nil, false
+	}
+
+	return claims, sessionRepo, true
+}
+
+// GetMySessions renders the sessions the authenticated user is logged in with, most recently seen first.
+func GetMySessions(w http.ResponseWriter, r *http.Request) {
+	claims, sessionRepo, ok := sessionRequestContext(w, r)
+
+	if !ok {
+		return
+	}
+
+	sessions, err := sessionRepo.ListSessions(r.Context(), claims.TenantId, claims.Sub)
+
+	if err != nil {
+		render.Render(w, r, errFromRepository(err))
+		return
+	}
+
+	response := sessionListResponse{Sessions: make([]sessionResponse, 0, len(sessions))}
+
+	for _, session := range sessions {
+		response.Sessions = append(response.Sessions, sessionResponse{session, session.Id == claims.Sid})
+	}
+
+	render.Render(w, r, response)
+}
+
+// RevokeMySession revokes one of the authenticated user's sessions, tokens issued for it are refused from then on.
+func RevokeMySession(w http.ResponseWriter, r *http.Request) {
+	claims, sessionRepo, ok := sessionRequestContext(w, r)
+
+	if !ok {
+		return
+	}
+
+	err := revokeSession(r, sessionRepo, claims, chi.URLParam(r, "sessionId"))
+
+	if err != nil {
+		render.Render(w, r, errFromRepository(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RefreshSessionMiddleware issues a new token for the session of the authenticated user's token, sliding its expiry
+// forward until the session goes idle or outlives its lifetime, and adds it to the context.
+func RefreshSessionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, sessionRepo, ok := sessionRequestContext(w, r)
+
+		if !ok {
+			return
+		}
+
+		tenant, ok := r.Context().Value("tenant").(common.Tenant)
+
+		if !ok {
+			render.Render(w, r, errUnknown(errors.New("tenant not found in context")))
+			return
+		}
+
+		if claims.Sid == "" {
+			render.Render(w, r, errUnauthorized(errors.New("token wasn't issued for a session")))
+			return
+		}
+
+		session, err := sessionRepo.GetSession(r.Context(), claims.TenantId, claims.Sid)
+
+		if err != nil {
+			render.Render(w, r, errFromRepository(err))
+			return
+		}
+
+		refreshed := NewClaims(tenant, claims.Sub, claims.Email)
+		refreshed.Sid = session.Id
+		token, errRender := signSessionToken(r, tenant, refreshed, session)
+
+		if errRender != nil {
+			render.Render(w, r, errRender)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), "token", token)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// CleanupSessions deletes expired sessions at the given interval until stopped.
+func CleanupSessions(sessionRepo repository.SessionRepository, interval time.Duration, stop <-chan struct{}) {
+	ctx := context.Background()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			_, err := sessionRepo.DeleteExpiredSessions(ctx, time.Now())
+
+			if err != nil {
+				logging.FromContext(ctx).Error("Unable to delete expired sessions", "error", err.Error())
+			}
+		}
+	}
+}
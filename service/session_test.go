@@ -0,0 +1,109 @@
+package service_test
+
+import (
+	"context"
+	"github.com/go-chi/chi"
+	"github.com/stone1549/auth-service/common"
+	"github.com/stone1549/auth-service/repository"
+	"github.com/stone1549/auth-service/service"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type sessionStore interface {
+	repository.UserRepository
+	repository.SessionRepository
+	repository.GroupRepository
+}
+
+// agedRepository reports sessions as though they were last seen idle ago and created age ago.
+type agedRepository struct {
+	sessionStore
+	idle time.Duration
+	age  time.Duration
+}
+
+func (ar agedRepository) GetSession(ctx context.Context, tenantId, sessionId string) (common.Session, error) {
+	session, err := ar.sessionStore.GetSession(ctx, tenantId, sessionId)
+	session.CreatedAt = session.CreatedAt.Add(-ar.age)
+	session.LastSeenAt = session.LastSeenAt.Add(-ar.idle)
+
+	if !session.ExpiresAt.IsZero() {
+		session.ExpiresAt = session.ExpiresAt.Add(-ar.age)
+	}
+
+	return session, err
+}
+
+// sessionRouter routes the session endpoints as the service does, with a protected endpoint answering 200.
+func sessionRouter() http.Handler {
+	r := chi.NewRouter()
+	r.With(service.AuthenticatedMiddleware).Get("/me/sessions", service.GetMySessions)
+	r.With(service.AuthenticatedMiddleware).Delete("/me/sessions/{sessionId}", service.RevokeMySession)
+	r.With(service.AuthenticatedMiddleware, service.RefreshSessionMiddleware).Post("/session/refresh",
+		service.NewSession)
+	r.With(service.AuthenticatedMiddleware).Get("/protected", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	return r
+}
+
+// TestRevokeMySession ensures a revoked session's tokens are refused, while the user's other sessions carry on.
+func TestRevokeMySession(t *testing.T) {
+	ts := newTestService(t, common.TenantPolicy{})
+	ts.newUser(t, "user@example.com")
+	laptop := responseToken(t, ts.login(t, loginRequest("user@example.com")))
+	phone := responseToken(t, ts.login(t, loginRequest("user@example.com")))
+	protected := "https://auth.example.com/protected"
+
+	claims, err := ts.tokens.ParseToken(laptop)
+	ok(t, err)
+
+	resp := ts.serve(sessionRouter(), authenticated("DELETE",
+		"https://auth.example.com/me/sessions/"+claims.Sid, phone, nil))
+	equals(t, http.StatusNoContent, resp.Code)
+
+	equals(t, http.StatusUnauthorized, ts.serve(sessionRouter(), authenticated("GET", protected, laptop, nil)).Code)
+	equals(t, http.StatusUnauthorized, ts.serve(sessionRouter(), authenticated("POST",
+		"https://auth.example.com/session/refresh", laptop, nil)).Code)
+	equals(t, http.StatusOK, ts.serve(sessionRouter(), authenticated("GET", protected, phone, nil)).Code)
+}
+
+// TestSessionTimeouts ensures tokens are refused, and can't be refreshed, once their session has gone idle or
+// outlived its lifetime, with remembered sessions getting the remember me limits.
+func TestSessionTimeouts(t *testing.T) {
+	ts := newTestService(t, common.TenantPolicy{TokenLifetime: 24 * time.Hour, SessionIdleTimeout: 30 * time.Minute,
+		SessionLifetime: 12 * time.Hour, RememberMeIdleTimeout: 7 * 24 * time.Hour,
+		RememberMeLifetime: 30 * 24 * time.Hour})
+	ts.newUser(t, "user@example.com")
+	store := ts.repo.(sessionStore)
+	token := responseToken(t, ts.login(t, loginRequest("user@example.com")))
+	remembered := responseToken(t, ts.login(t, httptest.NewRequest("POST", "https://auth.example.com/session",
+		strings.NewReader(`{"email": "user@example.com", "password": "`+testPassword+`", "rememberMe": true}`))))
+	// accepted reports whether a token is accepted, and can be refreshed, once its session was last seen idle ago
+	// and created age ago.
+	accepted := func(token string, idle, age time.Duration) []bool {
+		ts.repo = agedRepository{sessionStore: store, idle: idle, age: age}
+		defer func() { ts.repo = store }()
+
+		get := ts.serve(sessionRouter(), authenticated("GET", "https://auth.example.com/protected", token, nil))
+		refresh := ts.serve(sessionRouter(), authenticated("POST", "https://auth.example.com/session/refresh",
+			token, nil))
+
+		return []bool{get.Code == http.StatusOK, refresh.Code == http.StatusOK}
+	}
+
+	equals(t, []bool{true, true}, accepted(token, 29*time.Minute, 29*time.Minute))
+	equals(t, []bool{false, false}, accepted(token, 31*time.Minute, 31*time.Minute))
+	equals(t, []bool{true, true}, accepted(token, time.Minute, 11*time.Hour))
+	equals(t, []bool{false, false}, accepted(token, time.Minute, 13*time.Hour))
+
+	equals(t, []bool{true, true}, accepted(remembered, 6*24*time.Hour, 6*24*time.Hour))
+	equals(t, []bool{false, false}, accepted(remembered, 8*24*time.Hour, 8*24*time.Hour))
+	equals(t, []bool{true, true}, accepted(remembered, time.Hour, 29*24*time.Hour))
+	equals(t, []bool{false, false}, accepted(remembered, time.Hour, 31*24*time.Hour))
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/stone1549/auth-service/common"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// TenantHeader is the request header used to select a tenant when using the header tenant selector.
+const TenantHeader = "X-Tenant-ID"
+
+// TenantParam is the url parameter used to select a tenant when using the path tenant selector.
+const TenantParam = "tenantId"
+
+// TenantMiddleware constructs middleware that resolves the tenant a request is for using the given selector and adds
+// it to the request context. Requests that don't identify a tenant fall back to the default tenant if one is
+// configured.
+func TenantMiddleware(tenants map[string]common.Tenant, selector common.TenantSelector) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var tenantId string
+
+			switch selector {
+			case common.HeaderTenantSelector:
+				tenantId = r.Header.Get(TenantHeader)
+			case common.PathTenantSelector:
+				tenantId = chi.URLParam(r, TenantParam)
+			case common.SubdomainTenantSelector:
+				tenantId = tenantIdFromHost(tenants, r.Host)
+			}
+
+			if tenantId == "" {
+				tenantId = common.DefaultTenantId
+			}
+
+			tenant, ok := tenants[tenantId]
+
+			if !ok {
+				render.Render(w, r, errInvalidRequest(errors.New("unknown tenant")))
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), "tenant", tenant)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func tenantIdFromHost(tenants map[string]common.Tenant, host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	host = strings.ToLower(host)
+
+	for id, tenant := range tenants {
+		if tenant.Domain != "" && tenant.Domain == host {
+			return id
+		}
+	}
+
+	labels := strings.SplitN(host, ".", 2)
+
+	if len(labels) == 2 {
+		if _, ok := tenants[labels[0]]; ok {
+			return labels[0]
+		}
+	}
+
+	return ""
+}
@@ -1,26 +1,49 @@
 package service
 
 import (
+	"context"
 	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
 	"errors"
+	"fmt"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/stone1549/auth-service/common"
+	"github.com/stone1549/auth-service/metrics"
 	"time"
 )
 
-// TokenFactory provides methods for creating authentication tokens.
+// TokenFactory provides methods for creating and validating authentication tokens.
 type TokenFactory interface {
 	// NewToken returns a new token string with the given claims
 	NewToken(claims Claims) (string, error)
+	// ParseToken validates the given token string and returns its claims
+	ParseToken(token string) (Claims, error)
 }
 
 type Claims struct {
 	// Subject (globally unique user id) of token
 	Sub string
 
+	// Tenant the subject belongs to
+	TenantId string
+
 	// Subjects email address
 	Email string
 
+	// Session the token was issued for, empty when sessions aren't tracked
+	Sid string
+
+	// Names of the groups the subject is a member of, omitted from the token when nil
+	Groups []string
+
+	// SHA-256 thumbprint of the client certificate the token is bound to, empty when it isn't bound to one
+	CertThumbprint string
+
+	// JWK SHA-256 thumbprint of the DPoP key the token is bound to, empty when it isn't bound to one
+	KeyThumbprint string
+
 	// Not valid before
 	Nbf int64
 
@@ -31,10 +54,94 @@ type Claims struct {
 	Iat int64
 }
 
-func NewClaims(id, email string) Claims {
-	now := time.Now().Unix()
-	exp := time.Now().Add(time.Hour).Unix()
-	return Claims{id, email, now, exp, now}
+func NewClaims(tenant common.Tenant, id, email string) Claims {
+	now := time.Now()
+	return Claims{
+		Sub:      id,
+		TenantId: tenant.Id,
+		Email:    email,
+		Nbf:      now.Unix(),
+		Exp:      now.Add(tenant.Policy.TokenLifetime).Unix(),
+		Iat:      now.Unix(),
+	}
+}
+
+func (c Claims) mapClaims() jwt.MapClaims {
+	mapClaims := jwt.MapClaims{
+		"sub":       c.Sub,
+		"tenant_id": c.TenantId,
+		"email":     c.Email,
+		"nbf":       c.Nbf,
+		"exp":       c.Exp,
+		"iat":       c.Iat,
+	}
+
+	if c.Sid != "" {
+		mapClaims["sid"] = c.Sid
+	}
+
+	if c.Groups != nil {
+		mapClaims["groups"] = c.Groups
+	}
+
+	cnf := map[string]interface{}{}
+
+	if c.CertThumbprint != "" {
+		cnf["x5t#S256"] = c.CertThumbprint
+	}
+
+	if c.KeyThumbprint != "" {
+		cnf["jkt"] = c.KeyThumbprint
+	}
+
+	if len(cnf) > 0 {
+		mapClaims["cnf"] = cnf
+	}
+
+	return mapClaims
+}
+
+func claimsFromMap(mapClaims jwt.MapClaims) Claims {
+	claims := Claims{}
+	claims.Sub, _ = mapClaims["sub"].(string)
+	claims.TenantId, _ = mapClaims["tenant_id"].(string)
+	claims.Email, _ = mapClaims["email"].(string)
+	claims.Sid, _ = mapClaims["sid"].(string)
+
+	if groups, ok := mapClaims["groups"].([]interface{}); ok {
+		claims.Groups = make([]string, 0, len(groups))
+		for _, group := range groups {
+			if name, ok := group.(string); ok {
+				claims.Groups = append(claims.Groups, name)
+			}
+		}
+	}
+
+	if cnf, ok := mapClaims["cnf"].(map[string]interface{}); ok {
+		claims.CertThumbprint, _ = cnf["x5t#S256"].(string)
+		claims.KeyThumbprint, _ = cnf["jkt"].(string)
+	}
+
+	if nbf, ok := mapClaims["nbf"].(float64); ok {
+		claims.Nbf = int64(nbf)
+	}
+
+	if exp, ok := mapClaims["exp"].(float64); ok {
+		claims.Exp = int64(exp)
+	}
+
+	if iat, ok := mapClaims["iat"].(float64); ok {
+		claims.Iat = int64(iat)
+	}
+
+	return claims
+}
+
+// certThumbprint is the base64url encoded SHA-256 hash of a certificate's DER encoding, as tokens bound to it carry in
+// their cnf claim (RFC 8705).
+func certThumbprint(cert *x509.Certificate) string {
+	hash := sha256.Sum256(cert.Raw)
+	return base64.RawURLEncoding.EncodeToString(hash[:])
 }
 
 type jwtFactory struct {
@@ -46,37 +153,179 @@ type jwtFactory struct {
 
 // NewToken returns a new token string with the given claims
 func (jwtf *jwtFactory) NewToken(claims Claims) (string, error) {
-	token := jwt.NewWithClaims(jwtf.SigningMethod, jwt.MapClaims{
-		"sub": claims.Sub,
-		"nbf": claims.Nbf,
-		"exp": claims.Exp,
-		"iat": claims.Iat,
-	})
+	token := jwt.NewWithClaims(jwtf.SigningMethod, claims.mapClaims())
+	var signed string
+	var err error
 
 	if jwtf.SigningMethod == jwt.SigningMethodRS512 {
-		return token.SignedString(jwtf.RsaPrivateKey)
+		signed, err = token.SignedString(jwtf.RsaPrivateKey)
 	} else if jwtf.SigningMethod == jwt.SigningMethodHS512 {
-		return token.SignedString([]byte(jwtf.SecretSharedKey))
+		signed, err = token.SignedString([]byte(jwtf.SecretSharedKey))
 	} else {
 		return "", errors.New("unsupported JWT configuration")
 	}
+
+	if err == nil {
+		metrics.TokenIssued(jwtf.SigningMethod.Alg())
+	}
+
+	return signed, err
 }
 
-// NewTokenFactory constructs a token factory using the given configuration.
-func NewTokenFactory(config common.Configuration) (TokenFactory, error) {
-	if config.GetTokenSecretKey() != "" {
+// ParseToken validates the given token string and returns its claims
+func (jwtf *jwtFactory) ParseToken(token string) (Claims, error) {
+	parsed, err := jwt.Parse(token, jwtf.verificationKey)
+
+	if err != nil {
+		return Claims{}, err
+	}
+
+	mapClaims, ok := parsed.Claims.(jwt.MapClaims)
+
+	if !ok || !parsed.Valid {
+		return Claims{}, errors.New("invalid token")
+	}
+
+	return claimsFromMap(mapClaims), nil
+}
+
+func (jwtf *jwtFactory) verificationKey(token *jwt.Token) (interface{}, error) {
+	if token.Method != jwtf.SigningMethod {
+		return nil, errors.New("unexpected token signing method")
+	}
+
+	if jwtf.SigningMethod == jwt.SigningMethodRS512 {
+		return jwtf.RsaPublicKey, nil
+	}
+
+	return jwtf.SecretSharedKey, nil
+}
+
+type tenantTokenFactory struct {
+	factories map[string]*jwtFactory
+}
+
+// NewToken returns a new token string with the given claims, signed with the keys of the claims tenant.
+func (ttf *tenantTokenFactory) NewToken(claims Claims) (string, error) {
+	factory, ok := ttf.factories[claims.TenantId]
+
+	if !ok {
+		return "", errors.New("no token signing configuration for tenant")
+	}
+
+	return factory.NewToken(claims)
+}
+
+// ParseToken validates the given token string against the keys of the tenant named in it and returns its claims.
+func (ttf *tenantTokenFactory) ParseToken(token string) (Claims, error) {
+	parsed, err := jwt.Parse(token, func(t *jwt.Token) (interface{}, error) {
+		mapClaims, ok := t.Claims.(jwt.MapClaims)
+
+		if !ok {
+			return nil, errors.New("invalid token claims")
+		}
+
+		tenantId, _ := mapClaims["tenant_id"].(string)
+		factory, ok := ttf.factories[tenantId]
+
+		if !ok {
+			return nil, errors.New("no token signing configuration for tenant")
+		}
+
+		return factory.verificationKey(t)
+	})
+
+	if err != nil {
+		return Claims{}, err
+	}
+
+	mapClaims, ok := parsed.Claims.(jwt.MapClaims)
+
+	if !ok || !parsed.Valid {
+		return Claims{}, errors.New("invalid token")
+	}
+
+	return claimsFromMap(mapClaims), nil
+}
+
+func newJwtFactory(secretKey string, privateKey *rsa.PrivateKey, publicKey *rsa.PublicKey) (*jwtFactory, error) {
+	if secretKey != "" {
 		return &jwtFactory{
 			jwt.SigningMethodHS512,
-			[]byte(config.GetTokenSecretKey()),
+			[]byte(secretKey),
 			nil,
 			nil}, nil
-	} else if config.GetTokenPublicKey() != nil && config.GetTokenPrivateKey() != nil {
+	} else if publicKey != nil && privateKey != nil {
 		return &jwtFactory{
 			jwt.SigningMethodRS512,
 			nil,
-			config.GetTokenPrivateKey(),
-			config.GetTokenPublicKey()}, nil
+			privateKey,
+			publicKey}, nil
 	} else {
 		return nil, errors.New("invalid token signing configuration")
 	}
 }
+
+// NewTokenFactory constructs a token factory using the given configuration. Tenants with their own signing keys
+// sign with those, all others use the service wide keys.
+func NewTokenFactory(config common.Configuration) (TokenFactory, error) {
+	defaultFactory, err := newJwtFactory(config.GetTokenSecretKey(), config.GetTokenPrivateKey(),
+		config.GetTokenPublicKey())
+
+	if err != nil {
+		return nil, err
+	}
+
+	factories := make(map[string]*jwtFactory)
+
+	for id, tenant := range config.GetTenants() {
+		if tenant.SecretKey == "" && tenant.PrivateKey == nil {
+			factories[id] = defaultFactory
+			continue
+		}
+
+		factories[id], err = newJwtFactory(tenant.SecretKey, tenant.PrivateKey, tenant.PublicKey)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &tenantTokenFactory{factories}, nil
+}
+
+// CheckSigningKeys verifies every tenant has keys to sign tokens with, for the readiness check.
+func CheckSigningKeys(tokenFactory TokenFactory, tenants map[string]common.Tenant) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		ttf, ok := tokenFactory.(*tenantTokenFactory)
+
+		if !ok {
+			return errors.New("unknown token factory")
+		}
+
+		for id := range tenants {
+			factory, ok := ttf.factories[id]
+
+			if !ok {
+				return errors.New(fmt.Sprintf("no token signing configuration for tenant %s", id))
+			}
+
+			if err := factory.checkKeys(); err != nil {
+				return errors.New(fmt.Sprintf("tenant %s: %s", id, err.Error()))
+			}
+		}
+
+		return nil
+	}
+}
+
+// checkKeys verifies the factory has the keys its signing method needs.
+func (jwtf *jwtFactory) checkKeys() error {
+	if jwtf.SigningMethod == jwt.SigningMethodHS512 && len(jwtf.SecretSharedKey) > 0 {
+		return nil
+	} else if jwtf.SigningMethod == jwt.SigningMethodRS512 && jwtf.RsaPrivateKey != nil && jwtf.RsaPublicKey != nil {
+		return jwtf.RsaPrivateKey.Validate()
+	}
+
+	return errors.New("signing key unavailable")
+}
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"errors"
+	"github.com/go-chi/render"
+	"github.com/stone1549/auth-service/common"
+	"github.com/stone1549/auth-service/repository"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// sessionCookie carries a browser's token when it has no Authorization header.
+const sessionCookie = "session"
+
+const (
+	// UserIdHeader names the authenticated user for the proxied application.
+	UserIdHeader = "X-Auth-User-Id"
+	// EmailHeader is the authenticated user's email.
+	EmailHeader = "X-Auth-Email"
+	// RolesHeader is a comma separated list of the names of the authenticated user's groups.
+	RolesHeader = "X-Auth-Roles"
+)
+
+// requestToken extracts the token from a request's Authorization header, with the Bearer or DPoP scheme, or else its
+// session cookie.
+func requestToken(r *http.Request) string {
+	if token := bearerToken(r); token != "" {
+		return token
+	} else if token := dpopToken(r); token != "" {
+		return token
+	}
+
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		return cookie.Value
+	}
+
+	return ""
+}
+
+// ForwardAuth constructs a handler reverse proxies ask whether to admit a request, forwarding its Authorization
+// header or cookies. Requests with a valid token are admitted with headers describing the user, when groups are
+// named in the query the user must be a member of one of them. Browsers failing authentication are redirected to
+// the login URL when one is given, with the URL they were visiting in its rd parameter when it's on one of
+// redirectHosts.
+func ForwardAuth(loginUrl string, redirectHosts []string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := requestToken(r)
+		var claims Claims
+		var errRender render.Renderer
+
+		if token == "" {
+			errRender = errUnauthorized(errors.New("token is required"))
+		} else {
+			claims, errRender = tokenClaims(r, token)
+		}
+
+		if errRender != nil {
+			if resp, ok := errRender.(*errResponse); ok && resp.HTTPStatusCode == http.StatusUnauthorized {
+				if loginUrl != "" && acceptsHtml(r) {
+					http.Redirect(w, r, withReturnUrl(loginUrl, originalUrl(r, redirectHosts)), http.StatusFound)
+					return
+				}
+
+				w.Header().Set("WWW-Authenticate", "Bearer")
+			}
+
+			render.Render(w, r, errRender)
+			return
+		}
+
+		roles, err := userRoles(r, claims)
+
+		if err != nil {
+			render.Render(w, r, errFromRepository(err))
+			return
+		}
+
+		if required := r.URL.Query()["group"]; len(required) > 0 && !anyOf(roles, required) {
+			render.Render(w, r, errForbidden(errors.New("user isn't a member of a required group")))
+			return
+		}
+
+		w.Header().Set(UserIdHeader, claims.Sub)
+		w.Header().Set(EmailHeader, claims.Email)
+		w.Header().Set(RolesHeader, strings.Join(roles, ","))
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// userRoles returns the names of the user's groups, from their token when it carries them.
+func userRoles(r *http.Request, claims Claims) ([]string, error) {
+	if claims.Groups != nil {
+		return claims.Groups, nil
+	}
+
+	groupRepo, ok := r.Context().Value("repo").(repository.GroupRepository)
+
+	if !ok {
+		return []string{}, nil
+	}
+
+	tenant, ok := r.Context().Value("tenant").(common.Tenant)
+
+	if !ok {
+		return nil, errors.New("tenant not found in context")
+	}
+
+	groups, err := groupRepo.GetUserGroups(r.Context(), tenant.Id, claims.Sub)
+
+	if err != nil {
+		return nil, err
+	}
+
+	roles := make([]string, 0, len(groups))
+
+	for _, group := range groups {
+		roles = append(roles, group.Name)
+	}
+
+	return roles, nil
+}
+
+func anyOf(roles, required []string) bool {
+	for _, role := range roles {
+		for _, name := range required {
+			if role == name {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func acceptsHtml(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+// originalUrl is the URL of the request the proxy is asking about, from the headers nginx or Traefik forward it in,
+// empty unless it's an http or https URL on one of redirectHosts.
+func originalUrl(r *http.Request, redirectHosts []string) string {
+	original := r.Header.Get("X-Original-URL")
+
+	if original == "" && r.Header.Get("X-Forwarded-Host") != "" {
+		scheme := r.Header.Get("X-Forwarded-Proto")
+
+		if scheme == "" {
+			scheme = "http"
+		}
+
+		original = scheme + "://" + r.Header.Get("X-Forwarded-Host") + r.Header.Get("X-Forwarded-Uri")
+	}
+
+	parsed, err := url.Parse(original)
+
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.User != nil {
+		return ""
+	}
+
+	for _, host := range redirectHosts {
+		if strings.EqualFold(parsed.Hostname(), host) {
+			return original
+		}
+	}
+
+	return ""
+}
+
+func withReturnUrl(loginUrl, returnUrl string) string {
+	parsed, err := url.Parse(loginUrl)
+
+	if err != nil || returnUrl == "" {
+		return loginUrl
+	}
+
+	query := parsed.Query()
+	query.Set("rd", returnUrl)
+	parsed.RawQuery = query.Encode()
+	return parsed.String()
+}
@@ -0,0 +1,81 @@
+package service_test
+
+import (
+	"context"
+	"github.com/stone1549/auth-service/common"
+	"github.com/stone1549/auth-service/repository"
+	"github.com/stone1549/auth-service/service"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+const verifyUrl = "https://auth.example.com/auth/verify"
+
+// TestForwardAuth ensures requests with a valid token are admitted with headers describing the user, and refused
+// when the user isn't a member of a required group.
+func TestForwardAuth(t *testing.T) {
+	ts := newTestService(t, common.TenantPolicy{})
+	userId := ts.newUser(t, "user@example.com")
+	groupRepo := ts.repo.(repository.GroupRepository)
+	group, err := groupRepo.NewGroup(context.Background(), ts.tenant.Id, "ops", "")
+	ok(t, err)
+	ok(t, groupRepo.AddGroupUser(context.Background(), ts.tenant.Id, group.Id, userId))
+	token := responseToken(t, ts.login(t, loginRequest("user@example.com")))
+	handler := service.ForwardAuth("", []string{})
+
+	resp := ts.serve(handler, authenticated("GET", verifyUrl, token, nil))
+	equals(t, http.StatusOK, resp.Code)
+	equals(t, userId, resp.Header().Get(service.UserIdHeader))
+	equals(t, "user@example.com", resp.Header().Get(service.EmailHeader))
+	equals(t, "ops", resp.Header().Get(service.RolesHeader))
+
+	resp = ts.serve(handler, authenticated("GET", verifyUrl+"?group=admins&group=ops", token, nil))
+	equals(t, http.StatusOK, resp.Code)
+
+	resp = ts.serve(handler, authenticated("GET", verifyUrl+"?group=admins", token, nil))
+	equals(t, http.StatusForbidden, resp.Code)
+	equals(t, "", resp.Header().Get(service.UserIdHeader))
+}
+
+// TestForwardAuth_Unauthenticated ensures requests without a valid token are refused with a 401, and browsers are
+// redirected to log in, returned only to the original URL when it's on an allowed host.
+func TestForwardAuth_Unauthenticated(t *testing.T) {
+	ts := newTestService(t, common.TenantPolicy{})
+	handler := service.ForwardAuth("https://auth.example.com/login", []string{"app.example.com"})
+	browser := func(headers map[string]string) *http.Request {
+		req := authenticated("GET", verifyUrl, "invalid", nil)
+		req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+
+		return req
+	}
+	returnUrl := func(req *http.Request) string {
+		resp := ts.serve(handler, req)
+		equals(t, http.StatusFound, resp.Code)
+		location, err := url.Parse(resp.Header().Get("Location"))
+		ok(t, err)
+		equals(t, "auth.example.com", location.Host)
+		return location.Query().Get("rd")
+	}
+
+	resp := ts.serve(service.ForwardAuth("", []string{}), authenticated("GET", verifyUrl, "invalid", nil))
+	equals(t, http.StatusUnauthorized, resp.Code)
+	equals(t, "Bearer", resp.Header().Get("WWW-Authenticate"))
+
+	resp = ts.serve(handler, authenticated("GET", verifyUrl, "invalid", nil))
+	equals(t, http.StatusUnauthorized, resp.Code)
+	equals(t, "Bearer", resp.Header().Get("WWW-Authenticate"))
+
+	equals(t, "https://app.example.com/reports?page=2", returnUrl(browser(map[string]string{
+		"X-Forwarded-Proto": "https", "X-Forwarded-Host": "app.example.com", "X-Forwarded-Uri": "/reports?page=2"})))
+	equals(t, "https://app.example.com/reports", returnUrl(browser(map[string]string{
+		"X-Original-URL": "https://app.example.com/reports"})))
+	equals(t, "", returnUrl(browser(map[string]string{
+		"X-Forwarded-Proto": "https", "X-Forwarded-Host": "evil.example.net", "X-Forwarded-Uri": "/"})))
+	equals(t, "", returnUrl(browser(map[string]string{"X-Original-URL": "javascript://app.example.com/%0aalert(1)"})))
+	equals(t, "", returnUrl(browser(map[string]string{"X-Original-URL": "https://app.example.com@evil.example.net/"})))
+}
@@ -0,0 +1,235 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/stone1549/auth-service/common"
+	"github.com/stone1549/auth-service/logging"
+	"github.com/stone1549/auth-service/repository"
+	"github.com/stone1549/auth-service/webhook"
+	"net/http"
+	"net/url"
+)
+
+type webhookRequest struct {
+	Url    string   `json:"url"`
+	Secret string   `json:"secret"`
+	Events []string `json:"events"`
+}
+
+type webhookResponse struct {
+	common.Webhook
+	// Secret is only included when the webhook is created.
+	Secret string `json:"secret,omitempty"`
+	status int
+}
+
+func (wr webhookResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	if wr.status != 0 {
+		render.Status(r, wr.status)
+	}
+
+	return nil
+}
+
+type webhookListResponse struct {
+	Webhooks []common.Webhook `json:"webhooks"`
+}
+
+func (wlr webhookListResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+type deliveryResponse struct {
+	common.WebhookDelivery
+}
+
+func (dr deliveryResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+type deliveryListResponse struct {
+	Deliveries []common.WebhookDelivery `json:"deliveries"`
+}
+
+func (dlr deliveryListResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// webhookRequestContext retrieves the tenant and webhook repository that requests for webhooks operate on.
+func webhookRequestContext(w http.ResponseWriter, r *http.Request) (common.Tenant, repository.WebhookRepository,
+	bool) {
+	tenant, ok := r.Context().Value("tenant").(common.Tenant)
+
+	if !ok {
+		render.Render(w, r, errUnknown(errors.New("tenant not found in context")))
+		return common.Tenant{}, nil, false
+	}
+
+	webhookRepo, ok := r.Context().Value("repo").(repository.WebhookRepository)
+
+	if !ok {
+		render.Render(w, r, errRepository(errors.New("WebhookRepository not found in context")))
+		return common.Tenant{}, nil, false
+	}
+
+	return tenant, webhookRepo, true
+}
+
+// publishWebhookEvent queues an event for the request tenant's subscribed webhooks. Failing to queue is logged
+// rather than failing the request.
+func publishWebhookEvent(r *http.Request, eventType string, data interface{}) {
+	tenant, ok := r.Context().Value("tenant").(common.Tenant)
+
+	if !ok {
+		return
+	}
+
+	webhookRepo, ok := r.Context().Value("repo").(repository.WebhookRepository)
+
+	if !ok {
+		return
+	}
+
+	err := webhook.Publish(r.Context(), webhookRepo, tenant.Id, eventType, data)
+
+	if err != nil {
+		logging.FromContext(r.Context()).Error("Unable to queue webhook event", "eventType", eventType,
+			"error", err.Error())
+	}
+}
+
+// NewWebhook subscribes a URL to account lifecycle events, generating a signing secret when none is given. The
+// secret is only ever included in this response.
+func NewWebhook(w http.ResponseWriter, r *http.Request) {
+	var req webhookRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+
+	if err != nil {
+		render.Render(w, r, errInvalidRequest(err))
+		return
+	}
+
+	target, err := url.Parse(req.Url)
+
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		render.Render(w, r, errInvalidRequest(errors.New("url must be an absolute http or https URL")))
+		return
+	}
+
+	if len(req.Events) == 0 {
+		render.Render(w, r, errInvalidRequest(errors.New("at least one event is required")))
+		return
+	}
+
+	if req.Secret == "" {
+		secret := make([]byte, 32)
+
+		if _, err = rand.Read(secret); err != nil {
+			render.Render(w, r, errUnknown(err))
+			return
+		}
+
+		req.Secret = hex.EncodeToString(secret)
+	}
+
+	tenant, webhookRepo, ok := webhookRequestContext(w, r)
+
+	if !ok {
+		return
+	}
+
+	created, err := webhookRepo.NewWebhook(r.Context(), tenant.Id, req.Url, req.Secret, req.Events)
+
+	if err != nil {
+		render.Render(w, r, errFromRepository(err))
+		return
+	}
+
+	render.Render(w, r, webhookResponse{created, created.Secret, http.StatusCreated})
+}
+
+// ListWebhooks renders all webhooks of the request's tenant.
+func ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	tenant, webhookRepo, ok := webhookRequestContext(w, r)
+
+	if !ok {
+		return
+	}
+
+	webhooks, err := webhookRepo.ListWebhooks(r.Context(), tenant.Id)
+
+	if err != nil {
+		render.Render(w, r, errFromRepository(err))
+		return
+	}
+
+	render.Render(w, r, webhookListResponse{webhooks})
+}
+
+// DeleteWebhook removes a webhook and its queued deliveries.
+func DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	tenant, webhookRepo, ok := webhookRequestContext(w, r)
+
+	if !ok {
+		return
+	}
+
+	err := webhookRepo.DeleteWebhook(r.Context(), tenant.Id, chi.URLParam(r, "webhookId"))
+
+	if err != nil {
+		render.Render(w, r, errFromRepository(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListDeliveries renders the webhook deliveries of the request's tenant, filtered by the status query parameter.
+func ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	status := common.DeliveryStatus(r.URL.Query().Get("status"))
+
+	switch status {
+	case "", common.PendingDelivery, common.DeliveredDelivery, common.DeadDelivery:
+	default:
+		render.Render(w, r, errInvalidRequest(errors.New("status must be pending, delivered or dead")))
+		return
+	}
+
+	tenant, webhookRepo, ok := webhookRequestContext(w, r)
+
+	if !ok {
+		return
+	}
+
+	deliveries, err := webhookRepo.ListDeliveries(r.Context(), tenant.Id, status)
+
+	if err != nil {
+		render.Render(w, r, errFromRepository(err))
+		return
+	}
+
+	render.Render(w, r, deliveryListResponse{deliveries})
+}
+
+// ReplayDelivery queues a delivered or dead lettered delivery to be attempted again.
+func ReplayDelivery(w http.ResponseWriter, r *http.Request) {
+	tenant, webhookRepo, ok := webhookRequestContext(w, r)
+
+	if !ok {
+		return
+	}
+
+	delivery, err := webhookRepo.ReplayDelivery(r.Context(), tenant.Id, chi.URLParam(r, "deliveryId"))
+
+	if err != nil {
+		render.Render(w, r, errFromRepository(err))
+		return
+	}
+
+	render.Render(w, r, deliveryResponse{delivery})
+}
@@ -0,0 +1,121 @@
+package service_test
+
+import (
+	"encoding/json"
+	"github.com/go-chi/chi"
+	"github.com/stone1549/auth-service/common"
+	"github.com/stone1549/auth-service/service"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// webhookRouter routes webhook management requests as the service does, leaving out the service token and audit
+// middleware in front of them, along with SCIM user creation to publish events.
+func webhookRouter() http.Handler {
+	r := chi.NewRouter()
+	r.Post("/webhook", service.NewWebhook)
+	r.Get("/webhook", service.ListWebhooks)
+	r.Get("/webhook/deliveries", service.ListDeliveries)
+	r.Post("/webhook/deliveries/{deliveryId}/replay", service.ReplayDelivery)
+	r.Delete("/webhook/{webhookId}", service.DeleteWebhook)
+	r.Post("/scim/v2/Users", service.ScimCreateUser)
+
+	return r
+}
+
+// webhookRequest makes a webhook management request.
+func webhookRequest(method, path, body string) *http.Request {
+	return httptest.NewRequest(method, "https://auth.example.com"+path, strings.NewReader(body))
+}
+
+// TestNewWebhook ensures webhooks need an absolute http URL and events, and that their generated secret is only
+// given when they're created.
+func TestNewWebhook(t *testing.T) {
+	ts := newTestService(t, common.TenantPolicy{})
+	create := func(body string) *httptest.ResponseRecorder {
+		return ts.serve(webhookRouter(), webhookRequest("POST", "/webhook", body))
+	}
+
+	equals(t, http.StatusBadRequest, create(`{"url": "/hooks", "events": ["user.created"]}`).Code)
+	equals(t, http.StatusBadRequest, create(`{"url": "ftp://hooks.example.com", "events": ["user.created"]}`).Code)
+	equals(t, http.StatusBadRequest, create(`{"url": "https://hooks.example.com"}`).Code)
+
+	resp := create(`{"url": "https://hooks.example.com", "events": ["user.created"]}`)
+	equals(t, http.StatusCreated, resp.Code)
+
+	var created struct {
+		common.Webhook
+		Secret string `json:"secret"`
+	}
+	ok(t, json.NewDecoder(resp.Body).Decode(&created))
+	equals(t, 64, len(created.Secret))
+
+	resp = ts.serve(webhookRouter(), webhookRequest("GET", "/webhook", ""))
+	equals(t, http.StatusOK, resp.Code)
+	equals(t, true, strings.Contains(resp.Body.String(), created.Id))
+	equals(t, false, strings.Contains(resp.Body.String(), created.Secret))
+}
+
+// TestWebhook_TenantScoping ensures webhooks and their deliveries can't be seen, replayed or deleted from another
+// tenant.
+func TestWebhook_TenantScoping(t *testing.T) {
+	ts := newTestService(t, common.TenantPolicy{})
+
+	resp := ts.serve(webhookRouter(), webhookRequest("POST", "/webhook",
+		`{"url": "https://hooks.example.com", "secret": "s3cret", "events": ["user.created"]}`))
+	equals(t, http.StatusCreated, resp.Code)
+
+	var created common.Webhook
+	ok(t, json.NewDecoder(resp.Body).Decode(&created))
+
+	resp = ts.serve(webhookRouter(), webhookRequest("POST", "/scim/v2/Users",
+		`{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "userName": "user@example.com"}`))
+	equals(t, http.StatusCreated, resp.Code)
+
+	deliveries := func(query string) []common.WebhookDelivery {
+		resp := ts.serve(webhookRouter(), webhookRequest("GET", "/webhook/deliveries"+query, ""))
+		equals(t, http.StatusOK, resp.Code)
+
+		var body struct {
+			Deliveries []common.WebhookDelivery `json:"deliveries"`
+		}
+		ok(t, json.NewDecoder(resp.Body).Decode(&body))
+
+		return body.Deliveries
+	}
+
+	pending := deliveries("?status=pending")
+	equals(t, 1, len(pending))
+	equals(t, created.Id, pending[0].WebhookId)
+	equals(t, "user.created", pending[0].EventType)
+	equals(t, 0, len(deliveries("?status=dead")))
+	equals(t, http.StatusBadRequest, ts.serve(webhookRouter(),
+		webhookRequest("GET", "/webhook/deliveries?status=lost", "")).Code)
+	equals(t, http.StatusConflict, ts.serve(webhookRouter(),
+		webhookRequest("POST", "/webhook/deliveries/"+pending[0].Id+"/replay", "")).Code)
+
+	tenantId := ts.tenant.Id
+	ts.tenant.Id = "other"
+
+	equals(t, 0, len(deliveries("")))
+	equals(t, http.StatusNotFound, ts.serve(webhookRouter(),
+		webhookRequest("POST", "/webhook/deliveries/"+pending[0].Id+"/replay", "")).Code)
+	equals(t, http.StatusNotFound, ts.serve(webhookRouter(), webhookRequest("DELETE", "/webhook/"+created.Id, "")).Code)
+
+	ts.tenant.Id = tenantId
+	equals(t, http.StatusNoContent, ts.serve(webhookRouter(),
+		webhookRequest("DELETE", "/webhook/"+created.Id, "")).Code)
+	equals(t, http.StatusNotFound, ts.serve(webhookRouter(),
+		webhookRequest("DELETE", "/webhook/"+created.Id, "")).Code)
+}
+
+// TestWebhook_MissingRepository ensures webhook requests fail rather than panic when the repository doesn't support
+// webhooks.
+func TestWebhook_MissingRepository(t *testing.T) {
+	ts := newTestService(t, common.TenantPolicy{})
+	ts.values["repo"] = struct{}{}
+
+	equals(t, http.StatusInternalServerError, ts.serve(webhookRouter(), webhookRequest("GET", "/webhook", "")).Code)
+}
@@ -0,0 +1,147 @@
+package tlsserver
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"github.com/pkg/errors"
+	"github.com/stone1549/auth-service/common"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Certificate serves the certificate and key read from files, reloading them when the files change so renewed
+// certificates are served without a restart.
+type Certificate struct {
+	certFile string
+	keyFile  string
+	mutex    sync.RWMutex
+	cert     *tls.Certificate
+	modTimes [2]time.Time
+}
+
+// NewConfig constructs the TLS configuration the service is served with, along with the certificate it serves for
+// the caller to watch for changes. Clients are asked for certificates verified against the client CA bundle when
+// one is configured.
+func NewConfig(config common.TlsConfig) (*tls.Config, *Certificate, error) {
+	certificate := &Certificate{certFile: config.CertFile, keyFile: config.KeyFile}
+
+	if _, err := certificate.Reload(); err != nil {
+		return nil, nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:     config.MinVersion,
+		CipherSuites:   config.CipherSuites,
+		GetCertificate: certificate.GetCertificate,
+	}
+
+	if config.ClientCaFile != "" {
+		bundle, err := ioutil.ReadFile(config.ClientCaFile)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		tlsConfig.ClientCAs = x509.NewCertPool()
+
+		if !tlsConfig.ClientCAs.AppendCertsFromPEM(bundle) {
+			return nil, nil, errors.New("no certificates found in client CA bundle")
+		}
+
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+
+		if config.RequireClientCert {
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+
+	return tlsConfig, certificate, nil
+}
+
+// GetCertificate returns the current certificate for every handshake.
+func (c *Certificate) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.cert, nil
+}
+
+// Reload reads the certificate and key when either file changed since they were last read, returning whether they
+// were. The current certificate is kept when the files can't be read or don't match.
+func (c *Certificate) Reload() (bool, error) {
+	var modTimes [2]time.Time
+
+	for i, path := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(path)
+
+		if err != nil {
+			return false, err
+		}
+
+		modTimes[i] = info.ModTime()
+	}
+
+	c.mutex.RLock()
+	unchanged := c.cert != nil && modTimes == c.modTimes
+	c.mutex.RUnlock()
+
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// Remember failed attempts too so a broken pair is only reported once per change.
+	c.modTimes = modTimes
+
+	if err != nil {
+		return false, err
+	}
+
+	c.cert = &cert
+
+	return true, nil
+}
+
+// Watch reloads the certificate every interval until stop is closed.
+func (c *Certificate) Watch(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			reloaded, err := c.Reload()
+
+			if err != nil {
+				slog.Warn("Keeping current TLS certificate, unable to reload it", "path", c.certFile,
+					"error", err.Error())
+			} else if reloaded {
+				slog.Info("Reloaded TLS certificate", "path", c.certFile)
+			}
+		}
+	}
+}
+
+// ClientCertMiddleware adds the verified certificate a client authenticated the connection with to the context, as
+// "clientCert", when there is one.
+func ClientCertMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+			ctx := context.WithValue(r.Context(), "clientCert", r.TLS.VerifiedChains[0][0])
+			r = r.WithContext(ctx)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
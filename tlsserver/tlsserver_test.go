@@ -0,0 +1,206 @@
+package tlsserver_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"github.com/stone1549/auth-service/common"
+	"github.com/stone1549/auth-service/tlsserver"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// issue creates a certificate for the given common name, signed by parent or self signed when parent is nil.
+func issue(t *testing.T, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey,
+	isCa bool) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCa,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:              []string{name},
+	}
+
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert, key
+}
+
+// writePair writes a certificate and its key as PEM files, returning their paths.
+func writePair(t *testing.T, dir string, cert *x509.Certificate, key *ecdsa.PrivateKey) (string, string) {
+	keyDer, err := x509.MarshalECPrivateKey(key)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	err = ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0600)
+
+	if err == nil {
+		err = ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return certFile, keyFile
+}
+
+// served returns the common name of the certificate served for a handshake.
+func served(t *testing.T, config *tls.Config) string {
+	cert, err := config.GetCertificate(&tls.ClientHelloInfo{})
+	ok(t, err)
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	ok(t, err)
+
+	return leaf.Subject.CommonName
+}
+
+// TestCertificate_Reload ensures a changed certificate is served once reloaded, and that the current one is kept
+// when the files can't be loaded.
+func TestCertificate_Reload(t *testing.T) {
+	dir := t.TempDir()
+	cert, key := issue(t, "first.example.com", nil, nil, false)
+	certFile, keyFile := writePair(t, dir, cert, key)
+
+	config, certificate, err := tlsserver.NewConfig(common.TlsConfig{CertFile: certFile, KeyFile: keyFile,
+		MinVersion: tls.VersionTLS12})
+	ok(t, err)
+	equals(t, uint16(tls.VersionTLS12), config.MinVersion)
+	equals(t, tls.NoClientCert, config.ClientAuth)
+	equals(t, "first.example.com", served(t, config))
+
+	reloaded, err := certificate.Reload()
+	ok(t, err)
+	equals(t, false, reloaded)
+
+	cert, key = issue(t, "second.example.com", nil, nil, false)
+	writePair(t, dir, cert, key)
+	later := time.Now().Add(time.Minute)
+	ok(t, os.Chtimes(certFile, later, later))
+
+	reloaded, err = certificate.Reload()
+	ok(t, err)
+	equals(t, true, reloaded)
+	equals(t, "second.example.com", served(t, config))
+
+	ok(t, ioutil.WriteFile(keyFile, []byte("not a key"), 0600))
+	later = later.Add(time.Minute)
+	ok(t, os.Chtimes(keyFile, later, later))
+
+	_, err = certificate.Reload()
+	notOk(t, err)
+	equals(t, "second.example.com", served(t, config))
+}
+
+// TestNewConfig_ClientCa ensures client certificates are requested when a client CA bundle is configured, and
+// required when asked to.
+func TestNewConfig_ClientCa(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey := issue(t, "Test CA", nil, nil, true)
+	cert, key := issue(t, "auth.example.com", ca, caKey, false)
+	certFile, keyFile := writePair(t, dir, cert, key)
+	caFile := filepath.Join(dir, "ca.pem")
+	ok(t, ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw}), 0600))
+
+	config, _, err := tlsserver.NewConfig(common.TlsConfig{CertFile: certFile, KeyFile: keyFile,
+		ClientCaFile: caFile})
+	ok(t, err)
+	equals(t, tls.VerifyClientCertIfGiven, config.ClientAuth)
+
+	config, _, err = tlsserver.NewConfig(common.TlsConfig{CertFile: certFile, KeyFile: keyFile,
+		ClientCaFile: caFile, RequireClientCert: true})
+	ok(t, err)
+	equals(t, tls.RequireAndVerifyClientCert, config.ClientAuth)
+
+	_, _, err = tlsserver.NewConfig(common.TlsConfig{CertFile: certFile, KeyFile: keyFile, ClientCaFile: keyFile})
+	notOk(t, err)
+}
+
+// TestClientCertMiddleware ensures the verified client certificate of a connection is added to the context, and
+// that nothing is added for connections without one.
+func TestClientCertMiddleware(t *testing.T) {
+	ca, caKey := issue(t, "Test CA", nil, nil, true)
+	client, _ := issue(t, "user@example.com", ca, caKey, false)
+
+	var found *x509.Certificate
+	handler := tlsserver.ClientCertMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		found, _ = r.Context().Value("clientCert").(*x509.Certificate)
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	equals(t, (*x509.Certificate)(nil), found)
+
+	req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{client, ca}}}
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	equals(t, client, found)
+}
+
+// ok fails the test if an err is not nil.
+func ok(tb testing.TB, err error) {
+	if err != nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: unexpected error: %s\033[39m\n\n", filepath.Base(file), line, err.Error())
+		tb.FailNow()
+	}
+}
+
+// notOk fails the test if an err is nil.
+func notOk(tb testing.TB, err error) {
+	if err == nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: expected error\033[39m\n\n", filepath.Base(file), line)
+		tb.FailNow()
+	}
+}
+
+// equals fails the test if exp is not equal to act.
+func equals(tb testing.TB, exp, act interface{}) {
+	if !reflect.DeepEqual(exp, act) {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d:\n\n\texp: %#v\n\n\tgot: %#v\033[39m\n\n", filepath.Base(file), line, exp, act)
+		tb.FailNow()
+	}
+}
@@ -0,0 +1,128 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/pkg/errors"
+	"github.com/stone1549/auth-service/common"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// tracerName identifies the spans started by the service.
+const tracerName = "github.com/stone1549/auth-service"
+
+// Setup installs the configured exporter as the global tracer provider, and W3C trace context and baggage as the
+// propagator. Returns a function flushing buffered spans and stopping the exporter, which should be called before
+// exiting.
+func Setup(ctx context.Context, exporterType common.TraceExporterType, endpoint string) (func(context.Context) error,
+	error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{},
+		propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+
+	switch exporterType {
+	case common.NoTraceExporter:
+		return func(context.Context) error { return nil }, nil
+	case common.StdoutTraceExporter:
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case common.OtlpTraceExporter:
+		var options []otlptracehttp.Option
+
+		if endpoint != "" {
+			collector, err := url.Parse(endpoint)
+
+			if err != nil {
+				return nil, err
+			}
+
+			// A collector's URL without a path is given the standard traces path, as with OTEL_EXPORTER_OTLP_ENDPOINT.
+			if strings.Trim(collector.Path, "/") == "" {
+				collector.Path = "/v1/traces"
+			}
+
+			options = append(options, otlptracehttp.WithEndpointURL(collector.String()))
+		}
+
+		exporter, err = otlptracehttp.New(ctx, options...)
+	default:
+		return nil, errors.New(fmt.Sprintf("trace exporter %s unimplemented", exporterType))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	serviceResource, err := resource.Merge(resource.Default(),
+		resource.NewSchemaless(attribute.String("service.name", "auth-service")))
+
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(serviceResource))
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// Start begins a span as a child of any span in ctx, returning a context carrying it.
+func Start(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// End records the error a span's operation failed with, if any, and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+// Middleware continues the trace of each request from its W3C trace context headers, or begins one, with a server
+// span named for the route the request matched.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := otel.Tracer(tracerName).Start(ctx, r.Method, trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(attribute.String("http.request.method", r.Method),
+				attribute.String("url.path", r.URL.Path)))
+		defer span.End()
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		if rctx := chi.RouteContext(ctx); rctx != nil && rctx.RoutePattern() != "" {
+			span.SetName(r.Method + " " + rctx.RoutePattern())
+			span.SetAttributes(attribute.String("http.route", rctx.RoutePattern()))
+		}
+
+		status := ww.Status()
+
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	})
+}
@@ -0,0 +1,77 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi"
+	"github.com/stone1549/auth-service/common"
+	"github.com/stone1549/auth-service/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+// record installs a tracer provider recording every span ended.
+func record(t *testing.T) *tracetest.SpanRecorder {
+	_, err := tracing.Setup(context.Background(), common.NoTraceExporter, "")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	return recorder
+}
+
+// TestMiddleware ensures requests continue the trace of their traceparent header, with a server span named for the
+// route they matched that's the parent of spans started while handling them.
+func TestMiddleware(t *testing.T) {
+	recorder := record(t)
+	r := chi.NewRouter()
+	r.Use(tracing.Middleware)
+	r.Get("/group/{groupId}", func(w http.ResponseWriter, r *http.Request) {
+		_, span := tracing.Start(r.Context(), "GroupRepository.GetGroup")
+		tracing.End(span, errors.New("group not found"))
+		w.WriteHeader(http.StatusNotFound)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/group/1", nil)
+	req.Header.Set("traceparent", traceparent)
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+
+	child, server := spans[0], spans[1]
+
+	if server.Name() != "GET /group/{groupId}" {
+		t.Fatalf("expected server span to be named for its route, got %s", server.Name())
+	}
+
+	if server.SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("expected server span to continue the incoming trace, got %s", server.SpanContext().TraceID())
+	}
+
+	if server.Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Fatalf("expected server span to be a child of the caller's span, got %s", server.Parent().SpanID())
+	}
+
+	if child.Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Fatal("expected span started by the handler to be a child of the server span")
+	}
+
+	if child.Status().Code != codes.Error || len(child.Events()) != 1 {
+		t.Fatal("expected span's error to be recorded")
+	}
+}
@@ -0,0 +1,136 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/stone1549/auth-service/common"
+	"github.com/stone1549/auth-service/repository"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// claimLease is how long a claimed delivery is hidden from other dispatchers while it's attempted.
+	claimLease = time.Minute
+	// batchSize is the most deliveries claimed at once.
+	batchSize = 50
+)
+
+// Dispatcher delivers queued webhook events, retrying failures with exponential backoff until they're delivered or
+// dead lettered.
+type Dispatcher interface {
+	// DeliverDue attempts every delivery that's due, returning how many were attempted.
+	DeliverDue(ctx context.Context) (int, error)
+	// Run delivers due deliveries every interval until stop is closed.
+	Run(interval time.Duration, stop <-chan struct{})
+}
+
+type dispatcher struct {
+	repo        repository.WebhookRepository
+	client      *http.Client
+	maxAttempts int
+}
+
+// NewDispatcher constructs a Dispatcher delivering from repo with client, dead lettering deliveries after
+// maxAttempts failed attempts.
+func NewDispatcher(repo repository.WebhookRepository, client *http.Client, maxAttempts int) Dispatcher {
+	return &dispatcher{repo, client, maxAttempts}
+}
+
+// DeliverDue attempts every delivery that's due, returning how many were attempted.
+func (d *dispatcher) DeliverDue(ctx context.Context) (int, error) {
+	attempted := 0
+
+	for {
+		deliveries, err := d.repo.ClaimDueDeliveries(ctx, time.Now().UTC(), claimLease, batchSize)
+
+		if err != nil {
+			return attempted, err
+		}
+
+		for _, delivery := range deliveries {
+			webhook, err := d.repo.GetWebhook(ctx, delivery.TenantId, delivery.WebhookId)
+
+			if repository.IsNotFound(err) {
+				continue
+			} else if err != nil {
+				return attempted, err
+			}
+
+			attempted++
+			err = d.deliver(ctx, webhook.Url, webhook.Secret, delivery.Id, delivery.EventType, delivery.Payload)
+
+			if err == nil {
+				err = d.repo.CompleteDelivery(ctx, delivery.Id)
+			} else {
+				attempts := delivery.Attempts + 1
+				err = d.repo.FailDelivery(ctx, delivery.Id, err.Error(), time.Now().UTC().Add(common.Backoff(attempts)),
+					attempts >= d.maxAttempts)
+			}
+
+			if err != nil {
+				return attempted, err
+			}
+		}
+
+		if len(deliveries) < batchSize {
+			return attempted, nil
+		}
+	}
+}
+
+func (d *dispatcher) deliver(ctx context.Context, url, secret, deliveryId, eventType string, payload []byte) error {
+	timestamp := time.Now().Unix()
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+
+	if err != nil {
+		return err
+	}
+
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(IdHeader, deliveryId)
+	req.Header.Set(EventHeader, eventType)
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, Sign(secret, timestamp, payload))
+
+	resp, err := d.client.Do(req)
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.New(fmt.Sprintf("webhook responded with %d", resp.StatusCode))
+	}
+
+	return nil
+}
+
+// Run delivers due deliveries every interval until stop is closed.
+func (d *dispatcher) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			_, err := d.DeliverDue(context.Background())
+
+			if err != nil {
+				slog.Error("Unable to deliver webhooks", "error", err.Error())
+			}
+		}
+	}
+}
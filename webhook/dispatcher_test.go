@@ -0,0 +1,139 @@
+package webhook_test
+
+import (
+	"context"
+	"github.com/stone1549/auth-service/common"
+	"github.com/stone1549/auth-service/repository"
+	"github.com/stone1549/auth-service/webhook"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// webhookRepository is a minimal WebhookRepository holding a single webhook and its deliveries.
+type webhookRepository struct {
+	repository.WebhookRepository
+	webhook    common.Webhook
+	deliveries map[string]*common.WebhookDelivery
+}
+
+func (wr *webhookRepository) GetWebhook(ctx context.Context, tenantId, webhookId string) (common.Webhook, error) {
+	return wr.webhook, nil
+}
+
+func (wr *webhookRepository) EnqueueWebhookEvent(ctx context.Context, tenantId, eventType string,
+	payload []byte) ([]common.WebhookDelivery, error) {
+	delivery := &common.WebhookDelivery{Id: strconv.Itoa(len(wr.deliveries) + 1), TenantId: tenantId,
+		WebhookId: wr.webhook.Id, EventType: eventType, Payload: payload, Status: common.PendingDelivery}
+	wr.deliveries[delivery.Id] = delivery
+
+	return []common.WebhookDelivery{*delivery}, nil
+}
+
+func (wr *webhookRepository) ClaimDueDeliveries(ctx context.Context, now time.Time, lease time.Duration,
+	limit int) ([]common.WebhookDelivery, error) {
+	claimed := make([]common.WebhookDelivery, 0)
+
+	for _, delivery := range wr.deliveries {
+		if delivery.Status == common.PendingDelivery && !delivery.NextAttemptAt.After(now) {
+			delivery.NextAttemptAt = now.Add(lease)
+			claimed = append(claimed, *delivery)
+		}
+	}
+
+	return claimed, nil
+}
+
+func (wr *webhookRepository) CompleteDelivery(ctx context.Context, deliveryId string) error {
+	wr.deliveries[deliveryId].Attempts++
+	wr.deliveries[deliveryId].Status = common.DeliveredDelivery
+	return nil
+}
+
+func (wr *webhookRepository) FailDelivery(ctx context.Context, deliveryId, lastError string,
+	nextAttemptAt time.Time, dead bool) error {
+	delivery := wr.deliveries[deliveryId]
+	delivery.Attempts++
+	delivery.LastError = lastError
+	delivery.NextAttemptAt = nextAttemptAt
+
+	if dead {
+		delivery.Status = common.DeadDelivery
+	}
+
+	return nil
+}
+
+func makeRepo(url string) *webhookRepository {
+	return &webhookRepository{
+		webhook:    common.Webhook{Id: "hook", TenantId: "default", Url: url, Secret: "s3cret", Events: []string{"*"}},
+		deliveries: make(map[string]*common.WebhookDelivery),
+	}
+}
+
+// TestDispatcher_Deliver ensures events are delivered signed, with the delivery id and event type as headers.
+func TestDispatcher_Deliver(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	var body []byte
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = ioutil.ReadAll(r.Body)
+		received <- r
+	}))
+	defer server.Close()
+
+	repo := makeRepo(server.URL)
+	ok(t, webhook.Publish(context.Background(), repo, "default", webhook.UserCreated,
+		webhook.UserData{UserId: "1", Email: "jane@example.com"}))
+
+	attempted, err := webhook.NewDispatcher(repo, server.Client(), 3).DeliverDue(context.Background())
+	ok(t, err)
+	equals(t, 1, attempted)
+	equals(t, common.DeliveredDelivery, repo.deliveries["1"].Status)
+
+	r := <-received
+	equals(t, "1", r.Header.Get(webhook.IdHeader))
+	equals(t, webhook.UserCreated, r.Header.Get(webhook.EventHeader))
+
+	timestamp, err := strconv.ParseInt(r.Header.Get(webhook.TimestampHeader), 10, 64)
+	ok(t, err)
+	equals(t, true, webhook.Verify("s3cret", timestamp, body, r.Header.Get(webhook.SignatureHeader)))
+	equals(t, string(repo.deliveries["1"].Payload), string(body))
+}
+
+// TestDispatcher_Retry ensures failed deliveries are retried with backoff and dead lettered after the maximum number
+// of attempts.
+func TestDispatcher_Retry(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	repo := makeRepo(server.URL)
+	ok(t, webhook.Publish(context.Background(), repo, "default", webhook.UserDeleted, webhook.UserData{UserId: "1"}))
+
+	dispatcher := webhook.NewDispatcher(repo, server.Client(), 2)
+	before := time.Now()
+
+	_, err := dispatcher.DeliverDue(context.Background())
+	ok(t, err)
+
+	delivery := repo.deliveries["1"]
+	equals(t, common.PendingDelivery, delivery.Status)
+	equals(t, 1, delivery.Attempts)
+	equals(t, "webhook responded with 503", delivery.LastError)
+	equals(t, true, !delivery.NextAttemptAt.Before(before.Add(common.Backoff(1))))
+
+	attempted, err := dispatcher.DeliverDue(context.Background())
+	ok(t, err)
+	equals(t, 0, attempted)
+
+	delivery.NextAttemptAt = time.Time{}
+	_, err = dispatcher.DeliverDue(context.Background())
+	ok(t, err)
+	equals(t, common.DeadDelivery, delivery.Status)
+	equals(t, 2, delivery.Attempts)
+}
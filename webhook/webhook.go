@@ -0,0 +1,83 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/stone1549/auth-service/common"
+	"github.com/stone1549/auth-service/repository"
+	"github.com/twinj/uuid"
+	"strconv"
+	"time"
+)
+
+const (
+	// UserCreated is delivered when a user signs up.
+	UserCreated = common.UserCreatedEvent
+	// UserDeleted is delivered when a user is deleted.
+	UserDeleted = common.UserDeletedEvent
+)
+
+const (
+	// IdHeader carries the delivery id, which stays the same across retries so receivers can ignore duplicates.
+	IdHeader = "X-Webhook-Id"
+	// EventHeader carries the event type.
+	EventHeader = "X-Webhook-Event"
+	// TimestampHeader carries the unix time the delivery was attempted, it's part of the signature.
+	TimestampHeader = "X-Webhook-Timestamp"
+	// SignatureHeader carries sha256= followed by the hex HMAC-SHA256 of the timestamp, a dot and the body, keyed
+	// with the webhook's secret.
+	SignatureHeader = "X-Webhook-Signature"
+)
+
+// Event is the JSON body delivered to webhooks.
+type Event struct {
+	Id        string      `json:"id"`
+	Type      string      `json:"type"`
+	TenantId  string      `json:"tenantId"`
+	CreatedAt time.Time   `json:"createdAt"`
+	Data      interface{} `json:"data"`
+}
+
+// UserData is the data of user events.
+type UserData struct {
+	UserId string `json:"userId"`
+	Email  string `json:"email,omitempty"`
+}
+
+// Publish queues an event for delivery to every webhook of the tenant subscribed to its type.
+func Publish(ctx context.Context, repo repository.WebhookRepository, tenantId, eventType string,
+	data interface{}) error {
+	payload, err := json.Marshal(Event{
+		Id:        uuid.NewV4().String(),
+		Type:      eventType,
+		TenantId:  tenantId,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	_, err = repo.EnqueueWebhookEvent(ctx, tenantId, eventType, payload)
+
+	return err
+}
+
+// Sign computes the signature header value of a body delivered at the given unix time.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is the valid signature of a body delivered at the given unix time.
+func Verify(secret string, timestamp int64, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
@@ -0,0 +1,40 @@
+package webhook_test
+
+import (
+	"fmt"
+	"github.com/stone1549/auth-service/webhook"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+// TestSign ensures signatures are verified with the same secret, timestamp and body only.
+func TestSign(t *testing.T) {
+	body := []byte(`{"type":"user.created"}`)
+	signature := webhook.Sign("s3cret", 1525176000, body)
+
+	equals(t, "sha256=", signature[:7])
+	equals(t, true, webhook.Verify("s3cret", 1525176000, body, signature))
+	equals(t, false, webhook.Verify("other", 1525176000, body, signature))
+	equals(t, false, webhook.Verify("s3cret", 1525176001, body, signature))
+	equals(t, false, webhook.Verify("s3cret", 1525176000, []byte(`{"type":"user.deleted"}`), signature))
+}
+
+// ok fails the test if an err is not nil.
+func ok(tb testing.TB, err error) {
+	if err != nil {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d: unexpected error: %s\033[39m\n\n", filepath.Base(file), line, err.Error())
+		tb.FailNow()
+	}
+}
+
+// equals fails the test if exp is not equal to act.
+func equals(tb testing.TB, exp, act interface{}) {
+	if !reflect.DeepEqual(exp, act) {
+		_, file, line, _ := runtime.Caller(1)
+		fmt.Printf("\033[31m%s:%d:\n\n\texp: %#v\n\n\tgot: %#v\033[39m\n\n", filepath.Base(file), line, exp, act)
+		tb.FailNow()
+	}
+}